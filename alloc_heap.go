@@ -0,0 +1,66 @@
+//go:build !cyw43439.noheap
+
+package cyw43439
+
+import "errors"
+
+// This file contains the default implementations of error helpers which
+// allocate in order to provide detailed error messages. Build with the
+// cyw43439.noheap tag to use the non-allocating versions in alloc_noheap.go.
+
+// heapAlloc is set when the driver may allocate, i.e: the receive buffer if
+// Config.RxBuffer is not set.
+const heapAlloc = true
+
+// errjoion returns an error that wraps the given errors.
+// Any nil error values are discarded.
+// errjoion returns nil if every value in errs is nil.
+// The error formats as the concatenation of the strings obtained
+// by calling the Error method of each element of errs, with a newline
+// between each string.
+//
+// A non-nil error returned by errjoion implements the Unwrap() []error method.
+func errjoin(errs ...error) error {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	e := &joinError{
+		errs: make([]error, 0, n),
+	}
+	for _, err := range errs {
+		if err != nil {
+			e.errs = append(e.errs, err)
+		}
+	}
+	return e
+}
+
+// errHex returns an error with the hexadecimal representation of got appended to msg.
+func errHex(msg string, got uint32) error {
+	return errors.New(msg + hex32(got))
+}
+
+type joinError struct {
+	errs []error
+}
+
+func (e *joinError) Error() string {
+	var b []byte
+	for i, err := range e.errs {
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		b = append(b, err.Error()...)
+	}
+	return string(b)
+}
+
+func (e *joinError) Unwrap() []error {
+	return e.errs
+}
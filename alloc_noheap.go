@@ -0,0 +1,30 @@
+//go:build cyw43439.noheap
+
+package cyw43439
+
+import "errors"
+
+// This file contains non-allocating versions of the error helpers in alloc_heap.go
+// for hard real-time applications that must bound memory use. Errors lose detail:
+// joined errors are reduced to the first non-nil error and numeric context is dropped.
+
+var errHexDetail = errors.New("unexpected register value (build without cyw43439.noheap for details)")
+
+// heapAlloc is set when the driver may allocate. Config.RxBuffer is required
+// instead of allocating the receive buffer.
+const heapAlloc = false
+
+// errjoin returns the first non-nil error in errs or nil if every value in errs is nil.
+func errjoin(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errHex returns a static error. msg and got are discarded to avoid allocating.
+func errHex(msg string, got uint32) error {
+	return errHexDetail
+}
@@ -0,0 +1,60 @@
+package cyw43439
+
+import "time"
+
+// regBatchMax is the maximum amount of bytes coalesced into a single transaction.
+// It is the F1 burst limit so batches may target backplane registers.
+const regBatchMax = 64
+
+// regBatch accumulates byte register writes and coalesces writes to consecutive
+// addresses of the same function into a single auto-incrementing gSPI transaction,
+// saving the command word and CS cycle of each individual write. The gSPI protocol
+// decodes a single command per CS assertion so separate commands can't be streamed
+// back-to-back; writing contiguous registers in one burst is the closest equivalent.
+// The first error encountered is retained and returned by flush.
+type regBatch struct {
+	d    *Device
+	fn   Function
+	addr uint32
+	n    uint32
+	buf  [regBatchMax / 4]uint32
+	err  error
+}
+
+func (d *Device) newRegBatch(fn Function) regBatch {
+	return regBatch{d: d, fn: fn}
+}
+
+// write8 queues a write of val to addr. Pending writes are flushed first if
+// addr does not directly follow them.
+func (b *regBatch) write8(addr uint32, val uint8) {
+	if b.n > 0 && (addr != b.addr+b.n || b.n == regBatchMax) {
+		b.flush()
+	}
+	if b.n == 0 {
+		b.addr = addr
+		b.buf = [regBatchMax / 4]uint32{}
+	}
+	u32AsU8(b.buf[:])[b.n] = val
+	b.n++
+}
+
+// flush writes all pending writes to the bus and returns the first error encountered by the batch.
+func (b *regBatch) flush() error {
+	if b.n == 0 || b.err != nil {
+		b.n = 0
+		return b.err
+	}
+	var err error
+	if b.n <= 4 {
+		err = b.d.writen(b.fn, b.addr, b.buf[0], b.n)
+	} else {
+		cmd := Cmd{Write: true, AutoInc: true, Fn: b.fn, Addr: b.addr, Size: b.n}.Encode()
+		_, err = b.d.spi.cmd_write(cmd, b.buf[:alignup(b.n, 4)/4])
+		b.d.lastStatusGet = time.Now()
+		b.d.recordErr("regBatch", err)
+	}
+	b.err = err
+	b.n = 0
+	return err
+}
@@ -0,0 +1,146 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// This file implements a minimal BLE broadcaster which talks HCI directly to
+// the CYW43439's bluetooth controller. It is meant for users who only need to
+// send out advertisements (i.e: beacons) and do not want to pay the RAM cost
+// of a full bluetooth host stack.
+
+var (
+	errBLEAdvTooLong      = errors.New("BLE advertising data exceeds 31 bytes")
+	errHCICommandTimeout  = errors.New("HCI command complete timeout")
+	errHCICommandStatus   = errors.New("HCI command returned non-zero status")
+	errBLEIntervalInvalid = errors.New("BLE advertising interval out of range [20ms, 10.24s]")
+)
+
+// HCI packet types and opcodes used by the BLE broadcaster.
+const (
+	hciPacketCommand = 0x01
+	hciPacketEvent   = 0x04
+
+	hciEvtCommandComplete = 0x0e
+
+	hciOpReset                 = 0x0c03 // OGF=0x03(Controller&Baseband) OCF=0x003
+	hciOpLESetAdvParameters    = 0x2006 // OGF=0x08(LE) OCF=0x006
+	hciOpLESetAdvData          = 0x2008 // OGF=0x08(LE) OCF=0x008
+	hciOpLESetAdvEnable        = 0x200a // OGF=0x08(LE) OCF=0x00a
+	bleAdvNonConnectableUndir  = 0x03   // ADV_NONCONN_IND
+	bleAdvAllChannels          = 0x07
+	bleAdvIntervalUnit         = 625 * time.Microsecond
+	bleAdvMaxData              = 31
+	hciCommandCompleteTimeout  = 500 * time.Millisecond
+	hciCommandCompleteMinBytes = 7 // type+code+plen+ncmd+opcode(2)+status.
+)
+
+// StartBLEAdvertising begins broadcasting non-connectable BLE advertisements
+// containing adv every interval. adv must be formatted as a sequence of
+// AD structures (length, type, data) and be at most 31 bytes long.
+// The device must have been initialized with bluetooth enabled and the HCI
+// interface must not be in use by a separate bluetooth host stack.
+func (d *Device) StartBLEAdvertising(adv []byte, interval time.Duration) error {
+	if len(adv) > bleAdvMaxData {
+		return errBLEAdvTooLong
+	}
+	units := interval / bleAdvIntervalUnit
+	if units < 0x20 || units > 0x4000 {
+		return errBLEIntervalInvalid
+	}
+	err := d.acquire(modeBluetooth)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("StartBLEAdvertising", slog.Int("len", len(adv)), slog.Duration("interval", interval))
+
+	err = d.hci_command(hciOpReset, nil)
+	if err != nil {
+		return err
+	}
+
+	var params [bleAdvMaxData + 1]byte
+	// Advertising_Interval_Min and Advertising_Interval_Max.
+	params[0] = byte(units)
+	params[1] = byte(units >> 8)
+	params[2] = byte(units)
+	params[3] = byte(units >> 8)
+	params[4] = bleAdvNonConnectableUndir
+	// Own address type, peer address type and peer address left as zero (public).
+	params[13] = bleAdvAllChannels
+	params[14] = 0 // Filter policy: process all.
+	err = d.hci_command(hciOpLESetAdvParameters, params[:15])
+	if err != nil {
+		return err
+	}
+
+	params = [bleAdvMaxData + 1]byte{}
+	params[0] = byte(len(adv))
+	copy(params[1:], adv)
+	err = d.hci_command(hciOpLESetAdvData, params[:])
+	if err != nil {
+		return err
+	}
+	return d.hci_command(hciOpLESetAdvEnable, []byte{1})
+}
+
+// StopBLEAdvertising stops BLE advertisements started by StartBLEAdvertising.
+func (d *Device) StopBLEAdvertising() error {
+	err := d.acquire(modeBluetooth)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.hci_command(hciOpLESetAdvEnable, []byte{0})
+}
+
+// hci_command sends a HCI command packet and waits for the matching Command Complete event.
+// Unrelated events received while waiting are discarded.
+func (d *Device) hci_command(opcode uint16, params []byte) error {
+	d.trace("hci_command", slog.Uint64("opcode", uint64(opcode)), slog.Int("plen", len(params)))
+	var cmd [4 + bleAdvMaxData + 1]byte
+	cmd[0] = hciPacketCommand
+	cmd[1] = byte(opcode)
+	cmd[2] = byte(opcode >> 8)
+	cmd[3] = byte(len(params))
+	n := 4 + copy(cmd[4:], params)
+	err := d.hci_write(cmd[:n])
+	if err != nil {
+		return err
+	}
+	buf := u32AsU8(d._rxBuf[:])
+	deadline := time.Now().Add(hciCommandCompleteTimeout)
+	for time.Until(deadline) > 0 {
+		buffered, err := d.hci_buffered()
+		if err != nil {
+			return err
+		} else if buffered == 0 {
+			time.Sleep(time.Millisecond)
+			continue
+		} else if alignup(buffered, 4) > uint32(len(buf)) {
+			return errLargeHCIPacket
+		}
+		_, err = d.hci_read(buf[:alignup(buffered, 4)])
+		if err != nil {
+			return err
+		}
+		// Skip 3 byte SDIO header.
+		evt := buf[3:]
+		if evt[0] != hciPacketEvent || evt[1] != hciEvtCommandComplete || evt[2]+3 < hciCommandCompleteMinBytes {
+			continue
+		}
+		gotOp := uint16(evt[4]) | uint16(evt[5])<<8
+		if gotOp != opcode {
+			continue
+		}
+		if evt[6] != 0 {
+			d.logerr("hci_command:status", slog.Uint64("opcode", uint64(opcode)), slog.Uint64("status", uint64(evt[6])))
+			return errHCICommandStatus
+		}
+		return nil
+	}
+	return errHCICommandTimeout
+}
@@ -20,6 +20,8 @@ var (
 	errBTInvalidVersionLength = errors.New("invalid bt version length")
 	errBTWatermark            = errors.New("bt watermark set failed")
 	errLargeHCIPacket         = errors.New("cyw: HCI packet too large for buffer")
+	errBTBootStatus           = errors.New("bt boot status bits not set")
+	errUnalignedBTFirmware    = errors.New("unaligned BT firmware bug")
 )
 
 type deviceHCI struct {
@@ -38,6 +40,94 @@ func (d *deviceHCI) Write(b []byte) (int, error) {
 	return d.dev.WriteHCI(b)
 }
 
+// HCITransport is a byte oriented HCI transport in the style of the
+// TinyGo bluetooth package's HCI transport interface. Reads are served from
+// whole HCI packets read out of the CYW43439 ring buffer so callers may
+// consume packets one byte at a time.
+type HCITransport interface {
+	io.ReadWriter
+	io.ByteReader
+	// Buffered returns the amount of bytes ready to be read.
+	Buffered() int
+}
+
+// hciTransport buffers a single HCI packet read from the device so that it
+// can be consumed in arbitrarily sized reads.
+type hciTransport struct {
+	dev *Device
+	off int
+	n   int
+	// buf must be large enough to hold largest HCI packet plus SDIO header, rounded to 4 bytes.
+	buf [1028]byte
+}
+
+// HCITransport returns a HCITransport which wraps the BufferedHCI, WriteHCI and ReadHCI methods.
+// Unlike HCIReadWriter, the returned transport may be read from with buffers of any length.
+func (d *Device) HCITransport() (HCITransport, error) {
+	if !d.bt_mode_enabled() {
+		return nil, errors.New("need to enable bluetooth in Init to use HCI interface")
+	}
+	return &hciTransport{
+		dev: d,
+	}, nil
+}
+
+func (t *hciTransport) Buffered() int {
+	if t.off < t.n {
+		return t.n - t.off
+	}
+	return t.dev.BufferedHCI()
+}
+
+func (t *hciTransport) Write(b []byte) (int, error) {
+	return t.dev.WriteHCI(b)
+}
+
+func (t *hciTransport) ReadByte() (byte, error) {
+	err := t.fill()
+	if err != nil {
+		return 0, err
+	}
+	c := t.buf[t.off]
+	t.off++
+	return c, nil
+}
+
+func (t *hciTransport) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	err := t.fill()
+	if err != nil {
+		return 0, err
+	}
+	n := copy(b, t.buf[t.off:t.n])
+	t.off += n
+	return n, nil
+}
+
+// fill reads the next HCI packet from the device if the internal buffer has been consumed.
+func (t *hciTransport) fill() error {
+	if t.off < t.n {
+		return nil
+	}
+	t.off, t.n = 0, 0
+	buffered := uint32(t.dev.BufferedHCI())
+	if buffered == 0 {
+		return io.EOF
+	}
+	readLen := alignup(buffered, 4)
+	if readLen > uint32(len(t.buf)) {
+		return errLargeHCIPacket
+	}
+	n, err := t.dev.ReadHCI(t.buf[:readLen])
+	if err != nil {
+		return err
+	}
+	t.n = n
+	return nil
+}
+
 // HCIReaderWriter returns a io.ReadWriter interface which wraps the BufferedHCI, WriteHCI and ReadHCI methods.
 func (d *Device) HCIReadWriter() (interface {
 	io.ReadWriter
@@ -129,10 +219,26 @@ func (d *Device) bt_init(firmware string) error {
 	if err != nil {
 		return err
 	}
-	d.bt_toggle_intr()
+	err = d.bt_toggle_intr()
 	if err != nil {
 		return err
 	}
+	return d.bt_verify_boot()
+}
+
+// bt_verify_boot checks the BT core reports both firmware ready and awake
+// status bits after the patchram download and host handshake.
+func (d *Device) bt_verify_boot() error {
+	const bootBits = whd.BTSDIO_REG_FW_RDY_BITMASK | whd.BTSDIO_REG_BT_AWAKE_BITMASK
+	val, err := d.bp_read32(whd.BT_CTRL_REG_ADDR)
+	if err != nil {
+		return err
+	}
+	if val&bootBits != bootBits {
+		d.logerr("bt:boot-status", slog.Uint64("got", uint64(val)), slog.Uint64("want", uint64(bootBits)))
+		return errBTBootStatus
+	}
+	d.debug("bt:ready")
 	return nil
 }
 
@@ -203,7 +309,7 @@ func (d *Device) bt_upload_firmware(firmware string) error {
 
 		bufferToWrite := alignedDataBuffer[0:alignedDataBufferIdx]
 		if dstStartAddr%4 != 0 || dstEndAddr%4 != 0 || alignedDataBufferIdx%4 != 0 {
-			return errors.New("unaligned BT firmware bug")
+			return errUnalignedBTFirmware
 		}
 
 		const chunksize = 64 // Is writing in 64 byte chunks needed?
@@ -0,0 +1,151 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+var errBSSInfo = errors.New("invalid BSS info")
+
+// bssInfoBufLen is the size of the WLC_GET_BSS_INFO buffer which holds the
+// BSS info fixed fields followed by the information elements of the AP's
+// beacon or probe response.
+const bssInfoBufLen = 1024
+
+// Offsets of the wl_bss_info_t fields. Reference: whd_wlioctl.h.
+const (
+	bssiLength    = 4
+	bssiBSSID     = 8
+	bssiBeacon    = 14
+	bssiCap       = 16
+	bssiSSIDLen   = 18
+	bssiSSID      = 19
+	bssiRateCount = 52
+	bssiRates     = 56
+	bssiChanspec  = 72
+	bssiDTIM      = 76
+	bssiRSSI      = 78
+	bssiNoise     = 80
+	bssiNCap      = 81
+	bssiCtlCh     = 88
+	bssiBasicMCS  = 100
+	bssiIEOffset  = 116
+	bssiIELength  = 120
+	bssiSNR       = 124
+	bssiFixedLen  = 128
+)
+
+// Information element IDs.
+const (
+	ieHTCapabilities = 45
+	ieHTOperation    = 61
+)
+
+// BSSInfo describes a BSS as reported by the firmware from the AP's beacons
+// and probe responses.
+type BSSInfo struct {
+	BSSID [6]byte
+	SSID  string
+	// BeaconPeriod is the beacon interval in time units of 1024µs.
+	BeaconPeriod uint16
+	// Capability is the 802.11 capability information field, i.e: bit 4 is privacy.
+	Capability uint16
+	// Channel is the control channel and Chanspec the firmware's chanspec
+	// encoding channel, bandwidth and band.
+	Channel  uint8
+	Chanspec uint16
+	// DTIMPeriod is the amount of beacons between DTIM beacons.
+	DTIMPeriod uint8
+	// RSSI and Noise in dBm and SNR in dB of the last received frame.
+	RSSI  int16
+	Noise int8
+	SNR   int16
+	// Rates are the supported rates in units of 500kbps. Bit 7 marks basic rates.
+	Rates []uint8
+	// HT reports whether the BSS supports 802.11n. HTCapabilities is the
+	// capabilities info field of the HT capabilities element and HTOperation
+	// the HT operation element (primary channel, operation info and basic MCS set),
+	// both zero if not advertised.
+	HT             bool
+	HTCapabilities uint16
+	HTOperation    [22]byte
+	// BasicMCS is the basic HT MCS set bitmask.
+	BasicMCS [16]byte
+	// IEs holds all information elements of the beacon or probe response.
+	IEs []byte
+}
+
+// AssociatedAPInfo returns the BSS info of the access point the device is
+// associated with, including the information elements of its beacon or
+// probe response, to debug interoperability problems with specific access points.
+func (d *Device) AssociatedAPInfo() (BSSInfo, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return BSSInfo{}, err
+	}
+	if !d.IsLinkUp() {
+		return BSSInfo{}, errLinkDown
+	}
+	d.info("AssociatedAPInfo")
+	buf := u32AsU8(d._iovarBuf[:])[:bssInfoBufLen]
+	for i := range buf {
+		buf[i] = 0
+	}
+	// The first word is the buffer length, overwritten by the BSS info version.
+	binary.LittleEndian.PutUint32(buf, bssInfoBufLen)
+	n, err := d.doIoctlGet(whd.WLC_GET_BSS_INFO, whd.IF_STA, buf)
+	if err != nil {
+		return BSSInfo{}, err
+	}
+	// Skip the buffer length.
+	return parseBSSInfo(buf[4:n])
+}
+
+// parseBSSInfo parses a wl_bss_info_t. The returned Rates and IEs are copied.
+func parseBSSInfo(b []byte) (info BSSInfo, err error) {
+	if len(b) < bssiFixedLen {
+		return info, errBSSInfo
+	}
+	length := int(binary.LittleEndian.Uint32(b[bssiLength:]))
+	ssidLen := int(b[bssiSSIDLen])
+	rateCount := int(binary.LittleEndian.Uint32(b[bssiRateCount:]))
+	ieOff := int(binary.LittleEndian.Uint16(b[bssiIEOffset:]))
+	ieLen := int(binary.LittleEndian.Uint32(b[bssiIELength:]))
+	if length < bssiFixedLen || length > len(b) || ssidLen > 32 || rateCount > 16 ||
+		ieOff+ieLen > length {
+		return info, errBSSInfo
+	}
+	copy(info.BSSID[:], b[bssiBSSID:])
+	info.SSID = string(b[bssiSSID : bssiSSID+ssidLen])
+	info.BeaconPeriod = binary.LittleEndian.Uint16(b[bssiBeacon:])
+	info.Capability = binary.LittleEndian.Uint16(b[bssiCap:])
+	info.Rates = append([]byte(nil), b[bssiRates:bssiRates+rateCount]...)
+	info.Chanspec = binary.LittleEndian.Uint16(b[bssiChanspec:])
+	info.DTIMPeriod = b[bssiDTIM]
+	info.RSSI = int16(binary.LittleEndian.Uint16(b[bssiRSSI:]))
+	info.Noise = int8(b[bssiNoise])
+	info.HT = b[bssiNCap] != 0
+	info.Channel = b[bssiCtlCh]
+	if info.Channel == 0 {
+		info.Channel = uint8(info.Chanspec) // Not HT, chanspec holds the channel.
+	}
+	copy(info.BasicMCS[:], b[bssiBasicMCS:])
+	info.SNR = int16(binary.LittleEndian.Uint16(b[bssiSNR:]))
+	if ieLen == 0 {
+		return info, nil
+	}
+	info.IEs = append([]byte(nil), b[ieOff:ieOff+ieLen]...)
+	for ies := info.IEs; len(ies) >= 2 && len(ies) >= 2+int(ies[1]); ies = ies[2+ies[1]:] {
+		id, data := ies[0], ies[2:2+ies[1]]
+		switch {
+		case id == ieHTCapabilities && len(data) >= 2:
+			info.HTCapabilities = binary.LittleEndian.Uint16(data)
+		case id == ieHTOperation:
+			copy(info.HTOperation[:], data)
+		}
+	}
+	return info, nil
+}
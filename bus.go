@@ -7,6 +7,9 @@ import (
 	"encoding/binary"
 	"errors"
 	"log/slog"
+	"math/bits"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -14,9 +17,67 @@ import (
 	"golang.org/x/exp/constraints"
 )
 
+var (
+	errBusWordLength = errors.New("chip reverted to a different word length or byte order")
+	errRespDelay     = errors.New("unsupported response delay")
+)
+
+// busVerifyIdle is the idle time after which the bus configuration is verified on the next transaction.
+const busVerifyIdle = 5 * time.Second
+
+// defaultBusInitRetries is the amount of test register reads in initBus when
+// Config.BusInitRetries is zero.
+const defaultBusInitRetries = 128
+
 type spibus struct {
-	spi cmdBus
-	cs  outputPin
+	spi  cmdBus
+	cs   outputPin
+	crit CriticalSection
+	// mu is locked around every transaction when set. See Config.BusMutex.
+	mu sync.Locker
+	// inTx is set while CS is asserted, when the shared data/IRQ line
+	// toggles with data. Read by MarkIRQ from interrupt context.
+	inTx atomic.Bool
+}
+
+// CriticalSection holds functions which mark the start and end of a code section
+// that must not be preempted, i.e: by disabling and restoring interrupts or taking
+// a spinlock shared with the other core. A nil Enter or Exit is ignored.
+type CriticalSection struct {
+	Enter func()
+	Exit  func()
+}
+
+// critMaxWords is the length of the longest transaction, in 32 bit words, run inside
+// the critical section: register accesses and backplane bursts. Longer F2 packet
+// transfers are not run inside the critical section to not block interrupts for long.
+const critMaxWords = whd.BUS_SPI_MAX_BACKPLANE_TRANSFER_SIZE/4 + maxRespDelay/4
+
+func (d *spibus) critEnter(n int) {
+	if n <= critMaxWords && d.crit.Enter != nil {
+		d.crit.Enter()
+	}
+}
+
+func (d *spibus) critExit(n int) {
+	if n <= critMaxWords && d.crit.Exit != nil {
+		d.crit.Exit()
+	}
+}
+
+// timeoutBus is implemented by cmdBus implementations which can abort a
+// transaction that exceeds a time limit, i.e: on a stuck clock or an
+// unresponsive chip, instead of blocking forever. Abort should leave the
+// bus ready for the next transaction and return an error from CmdRead/CmdWrite.
+type timeoutBus interface {
+	SetTimeout(timeout time.Duration)
+}
+
+// setTimeout passes the transaction time limit on to the underlying bus, if supported.
+func (d *spibus) setTimeout(timeout time.Duration) {
+	if tb, ok := any(d.spi).(timeoutBus); ok {
+		tb.SetTimeout(timeout)
+	}
 }
 
 func New(pwr, cs outputPin, spi cmdBus) *Device {
@@ -32,89 +93,169 @@ func New(pwr, cs outputPin, spi cmdBus) *Device {
 }
 
 func (d *spibus) cmd_read(cmd uint32, buf []uint32) (status uint32, err error) {
+	d.lock()
+	d.critEnter(len(buf))
 	d.csEnable(true)
 	err = d.spi.CmdRead(cmd, buf)
 	d.csEnable(false)
-	return d.spi.LastStatus(), err
+	status = d.spi.LastStatus()
+	d.critExit(len(buf))
+	d.unlock()
+	return status, err
 }
 
 func (d *spibus) cmd_write(cmd uint32, buf []uint32) (status uint32, err error) {
 	// TODO(soypat): add cmd as argument and remove copies elsewhere?
+	d.lock()
+	d.critEnter(len(buf))
 	d.csEnable(true)
 	err = d.spi.CmdWrite(cmd, buf)
 	d.csEnable(false)
-	return d.spi.LastStatus(), err
+	status = d.spi.LastStatus()
+	d.critExit(len(buf))
+	d.unlock()
+	return status, err
+}
+
+// lock locks the user provided bus mutex, if any. It is taken before
+// entering the critical section since it may block.
+func (d *spibus) lock() {
+	if d.mu != nil {
+		d.mu.Lock()
+	}
+}
+
+// unlock unlocks the user provided bus mutex, if any.
+func (d *spibus) unlock() {
+	if d.mu != nil {
+		d.mu.Unlock()
+	}
 }
 
 func (d *spibus) csEnable(b bool) {
+	if b {
+		d.inTx.Store(true)
+	}
 	d.cs(!b)
+	if !b {
+		d.inTx.Store(false)
+	}
 }
 
 func (d *spibus) Status() Status {
 	return Status(d.spi.LastStatus())
 }
 
-func (d *Device) initBus(mode opMode) (err error) {
-	// https://github.com/embassy-rs/embassy/blob/26870082427b64d3ca42691c55a2cded5eadc548/cyw43/src/bus.rs#L51
-	d.reset()
-	d.mode = mode
-	retries := 128
+// busSetupValue is written to the gSPI bus configuration registers in initBus.
+// 132275 is Pico-sdk's default value.
+// NOTE: embassy uses little endian words and StatusEnable.
+const busSetupValue = whd.BusConfigReg(whd.WORD_LENGTH_32|whd.HIGH_SPEED_MODE|whd.INTERRUPT_POLARITY_HIGH|whd.WAKE_UP) |
+	4<<8 | // Response delay.
+	(whd.STATUS_ENABLE|whd.INTR_WITH_STATUS)<<16
+
+// busOrder is a word length and byte order the gSPI bus may be in when the
+// driver starts. Command and data words are converted with conv for
+// transactions in that order.
+type busOrder uint8
+
+const (
+	// bus16 is the power on default: 16 bit little endian words.
+	bus16 busOrder = iota
+	// bus32 is 32 bit little endian words, configured by busSetupValue. The
+	// chip is found in this order after a warm reset which did not power cycle it.
+	bus32
+	// bus16BE and bus32BE are the big endian orders.
+	bus16BE
+	bus32BE
+	numBusOrders
+)
+
+func (o busOrder) conv(v uint32) uint32 {
+	switch o {
+	case bus16:
+		return swap16(v)
+	case bus16BE:
+		return bits.ReverseBytes32(swap16(v))
+	case bus32BE:
+		return bits.ReverseBytes32(v)
+	}
+	return v
+}
+
+// detect_bus_order reads the test register in each of orders until the
+// test pattern is read, retrying up to retries times. Reads in a wrong order
+// may be interpreted as writes by the chip, i.e: a bus16 read is an F2 write
+// to a chip in bus32, so orders should start with the one the chip is
+// expected in. The last value read is returned on failure.
+func (d *Device) detect_bus_order(retries int, orders ...busOrder) (order busOrder, got uint32, err error) {
 	for {
-		got := d.read32_swapped(FuncBus, whd.SPI_READ_TEST_REGISTER)
-		if got == whd.TEST_PATTERN {
-			break
-		} else if retries <= 0 {
-			return errors.New("spi test failed:" + hex32(got))
+		for _, order = range orders {
+			got = d.read32_order(FuncBus, whd.SPI_READ_TEST_REGISTER, order)
+			if got == whd.TEST_PATTERN {
+				return order, got, nil
+			}
+		}
+		if retries <= 0 {
+			return 0, got, errHex("spi test failed:", got)
 		}
 		retries--
 	}
+}
+
+func (d *Device) initBus(mode opMode, retries int) (err error) {
+	// https://github.com/embassy-rs/embassy/blob/26870082427b64d3ca42691c55a2cded5eadc548/cyw43/src/bus.rs#L51
+	d.reset()
+	d.mode = mode
+	if retries <= 0 {
+		retries = defaultBusInitRetries
+	}
+	// The chip was just power cycled so it is in the power on default order.
+	order, _, err := d.detect_bus_order(retries, bus16, bus32, bus16BE, bus32BE)
+	if err != nil {
+		return err
+	}
+	if order != bus16 {
+		d.info("initBus:bus-order", slog.Uint64("order", uint64(order)))
+	}
+	return d.setupBus(order)
+}
+
+// spiRegTestRW is the gSPI read/write test register, a scratch register for
+// testing bus access.
+const spiRegTestRW = 0x18
+
+// setupBus tests register access with the bus in order and configures it for
+// operation in 32 bit little endian words.
+func (d *Device) setupBus(order busOrder) (err error) {
 	const RWTestPattern = 0x12345678
-	const spiRegTestRW = 0x18
-	d.write32_swapped(FuncBus, spiRegTestRW, RWTestPattern)
-	got := d.read32_swapped(FuncBus, spiRegTestRW)
+	d.write32_order(FuncBus, spiRegTestRW, RWTestPattern, order)
+	got := d.read32_order(FuncBus, spiRegTestRW, order)
 	if got != RWTestPattern {
-		return errors.New("spi test failed:" + hex32(got) + " wanted " + hex32(RWTestPattern))
+		return errHex("spi RW test failed, wanted 12345678 got:", got)
 	}
 
-	// Address 0x0000 registers.
-	const (
-		// 0=16bit word, 1=32bit word transactions.
-		WordLengthPos = 0
-		// Set to 1 for big endian words.
-		EndianessBigPos = 1 // 30
-		HiSpeedModePos  = 4
-		InterruptPolPos = 5
-		WakeUpPos       = 7
-
-		ResponseDelayPos       = 0x1*8 + 0
-		StatusEnablePos        = 0x2*8 + 0
-		InterruptWithStatusPos = 0x2*8 + 1
-		// 132275 is Pico-sdk's default value.
-		// NOTE: embassy uses little endian words and StatusEnablePos.
-		setupValue = (1 << WordLengthPos) | (1 << HiSpeedModePos) | (0 << EndianessBigPos) |
-			(1 << InterruptPolPos) | (1 << WakeUpPos) |
-			(1 << InterruptWithStatusPos) | (1 << StatusEnablePos) | (0x4 << (ResponseDelayPos))
-	)
-	val := d.read32_swapped(FuncBus, 0)
-
-	d.write32_swapped(FuncBus, whd.SPI_BUS_CONTROL, setupValue)
-	got8, _ := d.read8(FuncBus, whd.SPI_BUS_CONTROL)
-	d.debug("read back bus ctl", slog.Uint64("got", uint64(got8)))
+	if d.logenabled(slog.LevelDebug) {
+		val := d.read32_order(FuncBus, 0, order)
+		d.debug("current bus ctl", slog.Uint64("val", uint64(val)))
+	}
+	d.set_bus_config(busSetupValue, order)
+	if d.logenabled(slog.LevelDebug) {
+		got8, _ := d.read8(FuncBus, whd.SPI_BUS_CONTROL)
+		d.debug("read back bus ctl", slog.Uint64("got", uint64(got8)))
+	}
 
 	got, err = d.read32(FuncBus, whd.SPI_READ_TEST_REGISTER)
-
-	d.debug("current bus ctl", slog.Uint64("val", uint64(val)), slog.Uint64("got", uint64(got)))
 	if err != nil || got != whd.TEST_PATTERN {
-		return errjoin(errors.New("spi RO test failed:"+hex32(got)), err)
+		return errjoin(errHex("spi RO test failed:", got), err)
 	}
 
 	got, err = d.read32(FuncBus, spiRegTestRW)
 	if err != nil || got != RWTestPattern {
-		return errjoin(errors.New("spi RW test failed:"+hex32(got)), err)
+		return errjoin(errHex("spi RW test failed:", got), err)
 	}
 	// Bus Read/write operations validated. Proceed to configure what remains of bus.
 
-	err = d.write8(FuncBus, whd.SPI_RESP_DELAY_F1, whd.BUS_SPI_BACKPLANE_READ_PADD_SIZE)
+	err = d.set_resp_delay(FuncBackplane, whd.BUS_SPI_BACKPLANE_READ_PADD_SIZE)
 	if err != nil {
 		return err
 	}
@@ -124,18 +265,18 @@ func (d *Device) initBus(mode opMode) (err error) {
 	d.write8(FuncBus, whd.SPI_INTERRUPT_REGISTER, uint8(irqclr))
 
 	// Enable selection of interrupts.
-	const defaultIrqSet = irqF2_F3_FIFO_RD_UNDERFLOW | irqF2_F3_FIFO_WR_OVERFLOW |
-		irqCOMMAND_ERROR | irqDATA_ERROR | irqF2_PACKET_AVAILABLE | irqF1_OVERFLOW
-	irqSet := uint16(defaultIrqSet)
+	irqSet := DefaultInterrupts
 	if d.bt_mode_enabled() {
-		irqSet |= uint16(irqF1_INTR)
+		irqSet |= whd.F1_INTR
 	}
-	d.write16(FuncBus, whd.SPI_INTERRUPT_REGISTER, irqSet)
-	return nil
+	if d.disableIRQ {
+		irqSet = 0 // Interrupts are still latched in the interrupt register.
+	}
+	return d.set_interrupt_enable(irqSet)
 }
 
 func (d *Device) core_disable(coreID uint8) error {
-	base := coreaddress(coreID)
+	base := d.core_address(coreID)
 
 	// Check if not already in reset.
 	d.bp_read8(base + whd.AI_RESETCTRL_OFFSET) // Dummy read.
@@ -165,7 +306,7 @@ func (d *Device) core_reset(coreID uint8, coreHalt bool) error {
 	if coreHalt {
 		cpuhaltFlag = whd.SICF_CPUHALT
 	}
-	base := coreaddress(coreID)
+	base := d.core_address(coreID)
 	const addr = 0x18103000 + whd.AI_IOCTRL_OFFSET
 	d.bp_write8(base+whd.AI_IOCTRL_OFFSET, whd.SICF_FGC|whd.SICF_CLOCK_EN|cpuhaltFlag)
 	d.bp_read8(base + whd.AI_IOCTRL_OFFSET) // Dummy read.
@@ -185,7 +326,7 @@ func (d *Device) core_reset(coreID uint8, coreHalt bool) error {
 //
 //	reference: device_core_is_up
 func (d *Device) core_is_up(coreID uint8) bool {
-	base := coreaddress(coreID)
+	base := d.core_address(coreID)
 	reg, _ := d.bp_read8(base + whd.AI_IOCTRL_OFFSET)
 	if reg&(whd.SICF_FGC|whd.SICF_CLOCK_EN) != whd.SICF_CLOCK_EN {
 		return false
@@ -194,15 +335,16 @@ func (d *Device) core_is_up(coreID uint8) bool {
 	return reg&whd.AIRC_RESET == 0
 }
 
-// coreaddress returns either WLAN=0x18103000  or  SOCRAM=0x18104000
+// core_address returns the wrapper address of the core of the chip profile,
+// i.e: WLAN=0x18103000 or SOCRAM=0x18104000 on the CYW43439.
 //
 //	reference: get_core_address
-func coreaddress(coreID uint8) (v uint32) {
+func (d *Device) core_address(coreID uint8) (v uint32) {
 	switch coreID {
 	case whd.CORE_WLAN_ARM:
-		v = whd.WRAPPER_REGISTER_OFFSET + whd.WLAN_ARMCM3_BASE_ADDRESS
+		v = d.chip_profile().WLANCore
 	case whd.CORE_SOCSRAM:
-		v = whd.WRAPPER_REGISTER_OFFSET + whd.SOCSRAM_BASE_ADDRESS
+		v = d.chip_profile().SOCSRAMCore
 	default:
 		panic("bad core id")
 	}
@@ -257,18 +399,28 @@ func decodeSharedMemLog(order binary.ByteOrder, buf []byte) (s sharedMemLog) {
 
 func (d *Device) wlan_read(buf []uint32, lenInBytes int) (err error) {
 	// d.trace("wlan_read:start")
-	cmd := cmd_word(false, true, FuncWLAN, 0, uint32(lenInBytes))
+	cmd := Cmd{Write: false, AutoInc: true, Fn: FuncWLAN, Addr: 0, Size: uint32(lenInBytes)}.Encode()
 	lenU32 := (lenInBytes + 3) / 4
-	_, err = d.spi.cmd_read(cmd, buf[:lenU32])
+	status, err := d.spi.cmd_read(cmd, buf[:lenU32])
 	d.lastStatusGet = time.Now()
+	d.recordErr("wlan_read", err)
+	d.recordStatus("wlan_read", status)
+	if err == nil {
+		err = d.fifo_recover(Status(status))
+	}
 	return err
 }
 
 func (d *Device) wlan_write(data []uint32, plen uint32) (err error) {
 	// d.trace("wlan_write:start")
-	cmd := cmd_word(true, true, FuncWLAN, 0, plen)
-	_, err = d.spi.cmd_write(cmd, data)
+	cmd := Cmd{Write: true, AutoInc: true, Fn: FuncWLAN, Addr: 0, Size: plen}.Encode()
+	status, err := d.spi.cmd_write(cmd, data)
 	d.lastStatusGet = time.Now()
+	d.recordErr("wlan_write", err)
+	d.recordStatus("wlan_write", status)
+	if err == nil {
+		err = d.fifo_recover(Status(status))
+	}
 	return err
 }
 
@@ -277,8 +429,9 @@ func (d *Device) bp_read(addr uint32, data []byte) (err error) {
 	const maxTxSize = whd.BUS_SPI_MAX_BACKPLANE_TRANSFER_SIZE
 	alignedLen := alignup(uint32(len(data)), 4)
 	data = data[:alignedLen]
-	var buf [maxTxSize/4 + 1]uint32 // TODO: heapalloc replace.
+	var buf [maxTxSize/4 + maxRespDelay/4]uint32 // TODO: heapalloc replace.
 	buf8 := unsafeAsSlice[uint32, byte](buf[:])
+	padding := d.read_padding(FuncBackplane)
 	for len(data) > 0 {
 		// Calculate address and length of next write.
 		windowOffset := addr & whd.BACKPLANE_ADDR_MASK
@@ -289,15 +442,16 @@ func (d *Device) bp_read(addr uint32, data []byte) (err error) {
 		if err != nil {
 			return err
 		}
-		cmd := cmd_word(false, true, FuncBackplane, windowOffset, lenBytes)
+		cmd := Cmd{Write: false, AutoInc: true, Fn: FuncBackplane, Addr: windowOffset, Size: lenBytes}.Encode()
 
-		// round `buf` to word boundary, add one extra word for the response delay byte.
-		_, err = d.spi.cmd_read(cmd, buf[:(lenBytes+3)/4+1])
+		// round `buf` to word boundary, add the words read during the response delay.
+		_, err = d.spi.cmd_read(cmd, buf[:(lenBytes+3)/4+padding])
 		if err != nil {
+			d.recordErr("bp_read", err)
 			return err
 		}
-		// when writing out the data, we skip the response-delay *word* (4 bytes).
-		copy(data[:lenBytes], buf8[4:4+lenBytes])
+		// when writing out the data, we skip the response-delay padding.
+		copy(data[:lenBytes], buf8[4*padding:4*padding+lenBytes])
 		addr += lenBytes
 		data = data[lenBytes:]
 	}
@@ -312,34 +466,65 @@ func (d *Device) bp_writestring(addr uint32, data string) error {
 }
 
 func (d *Device) bp_write(addr uint32, data []byte) (err error) {
+	d.debug("bp_write", slog.Uint64("addr", uint64(addr)), slog.Int("len", len(data)))
+	return d.bp_write_scatter(addr, data)
+}
+
+// WriteBackplaneScatter writes the concatenation of chunks to the backplane
+// starting at addr. Chunks are coalesced into 64 byte F1 bursts so segmented
+// sources, such as a firmware image stored across flash pages, need not be
+// copied into a contiguous buffer first. addr must be 4 byte aligned and the
+// final burst is zero padded to a multiple of 4 bytes.
+func (d *Device) WriteBackplaneScatter(addr uint32, chunks ...[]byte) error {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.bp_write_scatter(addr, chunks...)
+}
+
+func (d *Device) bp_write_scatter(addr uint32, chunks ...[]byte) (err error) {
 	if addr%4 != 0 {
 		return errUnalignedBuffer
 	}
-	d.debug("bp_write", slog.Uint64("addr", uint64(addr)), slog.Int("len", len(data)))
-
 	const maxTxSize = whd.BUS_SPI_MAX_BACKPLANE_TRANSFER_SIZE
-	// var buf [maxTxSize]byte
-	alignedLen := alignup(uint32(len(data)), 4)
-	data = data[:alignedLen]
 	buf := d._iovarBuf[:maxTxSize/4+1]
-	// var buf [maxTxSize/4 + 1]uint32 // TODO(soypat): heapalloc replace.
 	buf8 := unsafeAsSlice[uint32, byte](buf[:])
-	for err == nil && len(data) > 0 {
+	chunkIdx, chunkOff := 0, 0
+	for {
 		// Calculate address and length of next write to ensure transfer doesn't cross a window boundary.
 		windowOffset := addr & whd.BACKPLANE_ADDR_MASK
 		windowRemaining := 0x8000 - windowOffset // windowsize - windowoffset
-		length := min(min(uint32(len(data)), maxTxSize), windowRemaining)
-		copy(buf8[:length], data[:length])
-
+		limit := min(uint32(maxTxSize), windowRemaining)
+		var length uint32
+		for length < limit && chunkIdx < len(chunks) {
+			n := copy(buf8[length:limit], chunks[chunkIdx][chunkOff:])
+			length += uint32(n)
+			chunkOff += n
+			if chunkOff == len(chunks[chunkIdx]) {
+				chunkIdx++
+				chunkOff = 0
+			}
+		}
+		if length == 0 {
+			break
+		}
+		for length%4 != 0 {
+			buf8[length] = 0 // Only last burst may be unaligned.
+			length++
+		}
 		err = d.backplane_setwindow(addr)
 		if err != nil {
 			return err
 		}
-		cmd := cmd_word(true, true, FuncBackplane, windowOffset, length)
-
+		cmd := Cmd{Write: true, AutoInc: true, Fn: FuncBackplane, Addr: windowOffset, Size: length}.Encode()
 		_, err = d.spi.cmd_write(cmd, buf[:(length+3)/4+1])
+		d.recordErr("bp_write", err)
+		if err != nil {
+			return err
+		}
 		addr += length
-		data = data[length:]
 	}
 	d.lastStatusGet = time.Now()
 	if d.isTraceEnabled() {
@@ -408,16 +593,18 @@ func (d *Device) backplane_setwindow(addr uint32) (err error) {
 		return nil
 	}
 
-	if (addr & 0xff000000) != currentWindow&0xff000000 {
-		err = d.write8(FuncBackplane, SDIO_BACKPLANE_ADDRESS_HIGH, uint8(addr>>24))
+	// Address registers are contiguous so changed bytes are written in as few transactions as possible.
+	batch := d.newRegBatch(FuncBackplane)
+	if (addr & 0x0000ff00) != currentWindow&0x0000ff00 {
+		batch.write8(SDIO_BACKPLANE_ADDRESS_LOW, uint8(addr>>8))
 	}
-	if err == nil && (addr&0x00ff0000) != currentWindow&0x00ff0000 {
-		err = d.write8(FuncBackplane, SDIO_BACKPLANE_ADDRESS_MID, uint8(addr>>16))
+	if (addr & 0x00ff0000) != currentWindow&0x00ff0000 {
+		batch.write8(SDIO_BACKPLANE_ADDRESS_MID, uint8(addr>>16))
 	}
-	if err == nil && (addr&0x0000ff00) != currentWindow&0x0000ff00 {
-		err = d.write8(FuncBackplane, SDIO_BACKPLANE_ADDRESS_LOW, uint8(addr>>8))
+	if (addr & 0xff000000) != currentWindow&0xff000000 {
+		batch.write8(SDIO_BACKPLANE_ADDRESS_HIGH, uint8(addr>>24))
 	}
-
+	err = batch.flush()
 	if err != nil {
 		d.backplaneWindow = 0xaaaa_aaaa
 		return err
@@ -449,37 +636,78 @@ func (d *Device) write8(fn Function, addr uint32, val uint8) error {
 
 // writen is primitive SPI write function for <= 4 byte writes.
 func (d *Device) writen(fn Function, addr, val, size uint32) (err error) {
-	cmd := cmd_word(true, true, fn, addr, size)
+	cmd := Cmd{Write: true, AutoInc: true, Fn: fn, Addr: addr, Size: size}.Encode()
 	d.rwBuf = [2]uint32{val, 0}
 	_, err = d.spi.cmd_write(cmd, d.rwBuf[:1])
 	d.lastStatusGet = time.Now()
+	d.recordErr("writen", err)
 	return err
 }
 
 // readn is primitive SPI read function for <= 4 byte reads.
 func (d *Device) readn(fn Function, addr, size uint32) (result uint32, err error) {
-	cmd := cmd_word(false, true, fn, addr, size)
+	cmd := Cmd{Write: false, AutoInc: true, Fn: fn, Addr: addr, Size: size}.Encode()
 	buf := d.rwBuf[:]
-	var padding uint32
-	if fn == FuncBackplane {
-		padding = 1
-	}
+	padding := d.read_padding(fn)
 	_, err = d.spi.cmd_read(cmd, buf[:1+padding])
 	d.lastStatusGet = time.Now()
+	d.recordErr("readn", err)
 	return buf[padding], err
 }
 
-func (d *Device) read32_swapped(fn Function, addr uint32) uint32 {
-	cmd := cmd_word(false, true, fn, addr, 4)
-	cmd = swap16(cmd)
+// maxRespDelay is the largest response delay in bytes supported by readn and bp_read.
+const maxRespDelay = 4
+
+// set_resp_delay sets the amount of bytes the chip waits before returning read
+// data of fn and tracks it so reads skip exactly that amount of padding.
+// delay must be a multiple of 4 since reads are performed in 32 bit words.
+func (d *Device) set_resp_delay(fn Function, delay uint8) error {
+	if delay%4 != 0 || delay > maxRespDelay {
+		return errRespDelay
+	}
+	err := d.write8(FuncBus, whd.SPI_RESP_DELAY_F0+uint32(fn), delay)
+	if err != nil {
+		return err
+	}
+	d.respDelay[fn] = delay
+	return nil
+}
+
+// read_padding returns the amount of 32 bit words preceding read data of fn
+// due to the response delay configured for it.
+func (d *Device) read_padding(fn Function) uint32 {
+	return uint32(d.respDelay[fn&3]) / 4
+}
+
+// read32_order reads a 32 bit register with the bus in order.
+func (d *Device) read32_order(fn Function, addr uint32, order busOrder) uint32 {
+	v, _ := d.readn_order(fn, addr, 4, order)
+	return v
+}
+
+// write32_order writes a 32 bit register with the bus in order.
+func (d *Device) write32_order(fn Function, addr uint32, value uint32, order busOrder) {
+	d.writen_order(fn, addr, value, 4, order)
+}
+
+// readn_order reads a register of size <= 4 bytes with the bus in order,
+// without response delay. Command and data words are converted by order.conv,
+// the only place the driver swaps bus words.
+func (d *Device) readn_order(fn Function, addr, size uint32, order busOrder) (uint32, error) {
+	cmd := Cmd{Write: false, AutoInc: true, Fn: fn, Addr: addr, Size: size}.Encode()
 	buf := d.rwBuf[:1]
-	d.spi.cmd_read(cmd, buf)
-	return swap16(buf[0])
+	_, err := d.spi.cmd_read(order.conv(cmd), buf)
+	d.recordErr("readn_order", err)
+	return order.conv(buf[0]), err
 }
-func (d *Device) write32_swapped(fn Function, addr uint32, value uint32) {
-	cmd := cmd_word(true, true, fn, addr, 4)
-	d.rwBuf = [2]uint32{swap16(value), 0}
-	d.spi.cmd_write(swap16(cmd), d.rwBuf[:1])
+
+// writen_order writes a register of size <= 4 bytes with the bus in order.
+func (d *Device) writen_order(fn Function, addr, value, size uint32, order busOrder) error {
+	cmd := Cmd{Write: true, AutoInc: true, Fn: fn, Addr: addr, Size: size}.Encode()
+	d.rwBuf = [2]uint32{order.conv(value), 0}
+	_, err := d.spi.cmd_write(order.conv(cmd), d.rwBuf[:1])
+	d.recordErr("writen_order", err)
+	return err
 }
 
 func u32AsU8(buf []uint32) []byte {
@@ -514,7 +742,117 @@ func unsafeAsSlice[F, T constraints.Unsigned](buf []F) []T {
 	return unsafe.Slice((*T)(ptr), alignup(uint32(len(buf)/div), uint32(div)))
 }
 
-//go:inline
-func cmd_word(write, autoInc bool, fn Function, addr uint32, sz uint32) uint32 {
-	return b2u32(write)<<31 | b2u32(autoInc)<<30 | uint32(fn)<<28 | (addr&0x1ffff)<<11 | sz
+// Cmd is a gSPI command word which precedes every bus transaction.
+type Cmd struct {
+	// Write is set for write transactions, unset for reads.
+	Write bool
+	// AutoInc enables incremental addressing.
+	AutoInc bool
+	Fn      Function
+	// Addr is the 17 bit register address.
+	Addr uint32
+	// Size is the 11 bit transaction length in bytes. A size of 0 means 2048 bytes for F1/F2.
+	Size uint32
+}
+
+// Encode returns the 32 bit gSPI command word.
+func (c Cmd) Encode() uint32 {
+	return b2u32(c.Write)<<31 | b2u32(c.AutoInc)<<30 | uint32(c.Fn&0b11)<<28 | (c.Addr&0x1ffff)<<11 | c.Size&0x7ff
+}
+
+// ParseCmd decodes a 32 bit gSPI command word.
+func ParseCmd(cmd uint32) Cmd {
+	return Cmd{
+		Write:   cmd&(1<<31) != 0,
+		AutoInc: cmd&(1<<30) != 0,
+		Fn:      Function(cmd>>28) & 0b11,
+		Addr:    (cmd >> 11) & 0x1ffff,
+		Size:    cmd & 0x7ff,
+	}
+}
+
+// EnableInterrupts enables the interrupts in mask which assert the host-wake (IRQ)
+// line. Interrupts enabled previously are left enabled.
+func (d *Device) EnableInterrupts(mask Interrupts) error {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.set_interrupt_enable(d.irqEnable | mask)
+}
+
+// DisableInterrupts disables the interrupts in mask.
+func (d *Device) DisableInterrupts(mask Interrupts) error {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.set_interrupt_enable(d.irqEnable &^ mask)
+}
+
+// EnabledInterrupts returns the currently enabled interrupts.
+func (d *Device) EnabledInterrupts() Interrupts {
+	return d.irqEnable
+}
+
+// set_interrupt_enable writes SPI_INTERRUPT_ENABLE_REGISTER and updates its
+// shadow. The write is skipped if the register already holds mask.
+func (d *Device) set_interrupt_enable(mask Interrupts) error {
+	if d.irqEnableValid && mask == d.irqEnable {
+		return nil
+	}
+	err := d.write16(FuncBus, whd.SPI_INTERRUPT_ENABLE_REGISTER, uint16(mask))
+	if err != nil {
+		d.irqEnableValid = false // The write may have taken effect.
+		return err
+	}
+	d.irqEnable = mask
+	d.irqEnableValid = true
+	return nil
+}
+
+// set_bus_config writes the gSPI bus configuration registers (bus control,
+// response delay, status enable) in order and updates their shadows. The
+// registers only change when written so they are never read back.
+func (d *Device) set_bus_config(cfg whd.BusConfigReg, order busOrder) {
+	d.write32_order(FuncBus, whd.SPI_BUS_CONTROL, uint32(cfg), order)
+	d.busConfig = cfg
+	d.respDelay[FuncBackplane] = cfg.ResponseDelay()
+}
+
+// bus_verify_due returns true if the bus configuration should be verified
+// before the next transaction, which is the case after errors or long idle periods.
+func (d *Device) bus_verify_due() bool {
+	return d.errs.n != d.errsVerified || time.Since(d.lastStatusGet) > busVerifyIdle
+}
+
+// bus_verify checks the chip is still in 32 bit word mode by reading the test
+// register. The firmware is running so the register is only read in the
+// configured order: a read in another order may be taken as a write by the
+// chip. If the chip reverted to another word length or byte order, i.e: after
+// a brown-out which also stopped the firmware, an error is returned and the
+// Device must be initialized again.
+func (d *Device) bus_verify() error {
+	err := d.bus_check_wordlength()
+	d.errsVerified = d.errs.n
+	return err
+}
+
+// busVerifyRetries is the amount of test register reads by bus_verify before
+// reporting errBusWordLength.
+const busVerifyRetries = 3
+
+func (d *Device) bus_check_wordlength() (err error) {
+	var got uint32
+	for i := 0; i < busVerifyRetries; i++ {
+		got, err = d.read32(FuncBus, whd.SPI_READ_TEST_REGISTER)
+		if err == nil && got == whd.TEST_PATTERN {
+			return nil
+		}
+	}
+	d.warn("bus_verify:mismatch", slog.Uint64("got", uint64(got)))
+	d.recordErr("bus_verify", errBusWordLength)
+	return errjoin(errBusWordLength, errHex("bus verify failed:", got), err)
 }
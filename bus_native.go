@@ -8,8 +8,10 @@ import (
 
 var _busOrder = binary.LittleEndian
 
-type cmdBus interface {
-	CmdRead(cmd uint32, buf []uint32) error
-	CmdWrite(cmd uint32, buf []uint32) error
-	LastStatus() uint32
+type cmdBus = SPI
+
+// NewWithHAL returns a Device which powers the CYW43439 with pwr and runs
+// transactions over spi, selecting the chip with cs.
+func NewWithHAL(pwr, cs Pin, spi SPI) *Device {
+	return New(pwr.Set, cs.Set, spi)
 }
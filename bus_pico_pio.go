@@ -5,6 +5,7 @@ package cyw43439
 import (
 	"encoding/binary"
 	"machine"
+	"time"
 
 	pio "github.com/tinygo-org/pio/rp2-pio"
 	"github.com/tinygo-org/pio/rp2-pio/piolib"
@@ -12,8 +13,76 @@ import (
 
 var _busOrder = binary.LittleEndian
 
+var _ Pin = machine.Pin(0)
+
 type cmdBus struct {
 	piolib.SPI3w
+	clk *pioClock
+}
+
+// pioClock holds the state machine running the gSPI program to change its
+// clock divider, see clockBus, and the transaction timeout, see SetTimeout.
+type pioClock struct {
+	sm   pio.StateMachine
+	baud uint32
+	// timeout is set with SetTimeout and applied to the SPI3w by the next
+	// transaction when dirty, since SetTimeout has a value receiver.
+	timeout time.Duration
+	dirty   bool
+}
+
+// SetTimeout sets the maximum duration of a transaction. The SPI3w gives up
+// waiting on the state machine FIFOs and DMA once it elapses and CmdRead and
+// CmdWrite stop the state machine and return an error, after which the driver
+// raises CS. Zero means no limit.
+func (c cmdBus) SetTimeout(timeout time.Duration) {
+	c.clk.timeout = timeout
+	c.clk.dirty = true
+}
+
+// CmdRead runs a read transaction, see SPI.
+func (c *cmdBus) CmdRead(cmd uint32, buf []uint32) error {
+	c.applyTimeout()
+	return c.abortOnErr(c.SPI3w.CmdRead(cmd, buf))
+}
+
+// CmdWrite runs a write transaction, see SPI.
+func (c *cmdBus) CmdWrite(cmd uint32, buf []uint32) error {
+	c.applyTimeout()
+	return c.abortOnErr(c.SPI3w.CmdWrite(cmd, buf))
+}
+
+func (c *cmdBus) applyTimeout() {
+	if c.clk.dirty {
+		c.clk.dirty = false
+		c.SPI3w.SetTimeout(c.clk.timeout)
+	}
+}
+
+// abortOnErr stops the state machine clocking the bus if the transaction
+// failed, i.e: timed out. The next transaction restarts it.
+func (c *cmdBus) abortOnErr(err error) error {
+	if err != nil {
+		c.clk.sm.SetEnabled(false)
+		c.clk.sm.ClearFIFOs()
+	}
+	return err
+}
+
+// Baud returns the gSPI clock frequency in Hz.
+func (c cmdBus) Baud() uint32 { return c.clk.baud }
+
+// SetBaud sets the gSPI clock frequency in Hz by changing the state machine's
+// clock divider.
+func (c cmdBus) SetBaud(baud uint32) error {
+	// The SPI3w program takes 2 cycles per bit, as in piolib.NewSPI3w.
+	whole, frac, err := pio.ClkDivFromFrequency(2*baud, machine.CPUFrequency())
+	if err != nil {
+		return err
+	}
+	c.clk.sm.SetClkDiv(whole, frac)
+	c.clk.baud = baud
+	return nil
 }
 
 func NewPicoWCmdBus(baud uint32) (cmdBus, error) {
@@ -35,7 +104,7 @@ func NewPicoWCmdBus(baud uint32) (cmdBus, error) {
 	if err != nil {
 		panic(err.Error())
 	}
-	return cmdBus{*spi}, nil
+	return cmdBus{SPI3w: *spi, clk: &pioClock{sm: sm, baud: baud}}, nil
 }
 
 func NewPicoWDevice() *Device {
@@ -0,0 +1,49 @@
+package cyw43439
+
+// This file exposes the gSPI register accesses made while the bus is in its
+// power on configuration, used by bring-up and diagnostic tools. After power
+// on, or a Reset, the CYW43439 gSPI bus transfers 16 bit little endian words:
+// the halves of each 32 bit command and data word are swapped on the wire. Init
+// reconfigures the bus to 32 bit words (see busSetupValue) and detects the
+// configuration left by a warm reset, so applications never need these.
+//
+// The S (swapped) variants perform accesses in the power on configuration
+// with the same primitives Init uses to detect and configure the bus:
+//
+//   - Before Init, or after Reset, to probe whether the chip responds, i.e:
+//     Read32S(FuncBus, whd.SPI_READ_TEST_REGISTER) returns whd.TEST_PATTERN.
+//   - To configure the bus by hand, i.e: Write32S(FuncBus, whd.SPI_BUS_CONTROL, cfg).
+//     Once 32 bit words are configured the S variants read garbage and may
+//     be interpreted as writes by the chip; reset the chip to use them again.
+//
+// Only gSPI bus (FuncBus) registers should be accessed since no response
+// delay is applied.
+
+// Read32S reads the 32 bit register at addr of fn with the bus in its power on configuration.
+func (d *Device) Read32S(fn Function, addr uint32) (uint32, error) {
+	d.acquire(0)
+	defer d.release()
+	return d.readn_order(fn, addr, 4, bus16)
+}
+
+// Read16S reads the 16 bit register at addr of fn with the bus in its power on configuration.
+func (d *Device) Read16S(fn Function, addr uint32) (uint16, error) {
+	d.acquire(0)
+	defer d.release()
+	v, err := d.readn_order(fn, addr, 2, bus16)
+	return uint16(v), err
+}
+
+// Write32S writes the 32 bit register at addr of fn with the bus in its power on configuration.
+func (d *Device) Write32S(fn Function, addr, val uint32) error {
+	d.acquire(0)
+	defer d.release()
+	return d.writen_order(fn, addr, val, 4, bus16)
+}
+
+// Write16S writes the 16 bit register at addr of fn with the bus in its power on configuration.
+func (d *Device) Write16S(fn Function, addr uint32, val uint16) error {
+	d.acquire(0)
+	defer d.release()
+	return d.writen_order(fn, addr, uint32(val), 2, bus16)
+}
@@ -0,0 +1,100 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements bus speed autotuning: Init raises the gSPI clock step
+// by step while checking register access and settles on the fastest reliable
+// speed for the specific board and wiring. See Config.BusAutotuneMaxBaud.
+
+var errBusTune = errors.New("bus unreliable after reverting autotuned clock")
+
+const (
+	// gspiMaxBaud is the highest gSPI clock frequency of the CYW43439 datasheet.
+	gspiMaxBaud = 50_000_000
+	// busTuneChecks is the amount of test register reads and scratch
+	// register write/read cycles required to pass at each speed.
+	busTuneChecks = 64
+	// busTuneMinStep is the smallest clock frequency increase between steps.
+	busTuneMinStep = 500_000
+)
+
+// clockBus is implemented by cmdBus implementations whose clock frequency can
+// be changed at runtime, enabling bus speed autotuning.
+type clockBus interface {
+	// Baud returns the current clock frequency in Hz.
+	Baud() uint32
+	// SetBaud sets the clock frequency in Hz.
+	SetBaud(baud uint32) error
+}
+
+// busTunePatterns are written to the scratch register. They toggle every data
+// bit in both directions and include the alternating patterns most sensitive
+// to crosstalk and slow edges.
+var busTunePatterns = [...]uint32{0xffff_ffff, 0x0000_0000, 0xaaaa_aaaa, 0x5555_5555, 0x1234_5678, 0xedcb_a987}
+
+// tuneBus raises the bus clock in steps of about 10% up to maxBaud while
+// busTuneCheck passes and keeps the fastest passing speed.
+func (d *Device) tuneBus(maxBaud uint32) error {
+	clk, ok := any(d.spi.spi).(clockBus)
+	if !ok {
+		d.warn("tuneBus:unsupported")
+		return nil
+	}
+	maxBaud = min(maxBaud, gspiMaxBaud)
+	start := time.Now()
+	good := clk.Baud()
+	for good < maxBaud {
+		next := min(good+max(good/10, busTuneMinStep), maxBaud)
+		err := clk.SetBaud(next)
+		if err == nil {
+			err = d.busTuneCheck()
+		}
+		if err != nil {
+			d.debug("tuneBus:fail", slog.Uint64("baud", uint64(next)), slog.String("err", err.Error()))
+			break
+		}
+		good = next
+	}
+	// Reapply and recheck the fastest passing speed, the failed step may have
+	// disturbed the bus.
+	err := clk.SetBaud(good)
+	if err == nil {
+		err = d.busTuneCheck()
+	}
+	if err != nil {
+		return errjoin(errBusTune, err)
+	}
+	d.info("tuneBus:done", slog.Uint64("baud", uint64(good)), slog.Duration("took", time.Since(start)))
+	return nil
+}
+
+// busTuneCheck reads the gSPI test register and writes and reads back patterns
+// to the scratch register busTuneChecks times, failing on the first mismatch.
+func (d *Device) busTuneCheck() error {
+	for i := 0; i < busTuneChecks; i++ {
+		got, err := d.read32(FuncBus, whd.SPI_READ_TEST_REGISTER)
+		if err != nil {
+			return err
+		} else if got != whd.TEST_PATTERN {
+			return errHex("test register mismatch:", got)
+		}
+		pattern := busTunePatterns[i%len(busTunePatterns)]
+		err = d.write32(FuncBus, spiRegTestRW, pattern)
+		if err != nil {
+			return err
+		}
+		got, err = d.read32(FuncBus, spiRegTestRW)
+		if err != nil {
+			return err
+		} else if got != pattern {
+			return errHex("scratch register mismatch:", got)
+		}
+	}
+	return nil
+}
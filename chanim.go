@@ -0,0 +1,183 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements a channel survey from the firmware's channel
+// interference measurements (chanim) so that access points can be started on
+// the least congested channel.
+
+var (
+	errChanimVersion = errors.New("unsupported chanim_stats version")
+	errSurveyLinkUp  = errors.New("channel survey requires link down")
+)
+
+const (
+	chanimVersion  = 2
+	chanimCountOne = 1
+	// chanimHdrLen is the length of the buflen, version and count fields
+	// preceding the stats of wl_chanim_stats_t.
+	chanimHdrLen   = 12
+	chanimStatsLen = 36
+	// ccastats indices. Reference: CCASTATS_* in wlioctl.h.
+	ccaTxDur  = 0
+	ccaInBSS  = 1
+	ccaOBSS   = 2
+	ccaNoCat  = 3
+	ccaNoPkt  = 4
+	ccaDoze   = 5
+	ccaTxOP   = 6
+	ccaStats  = 9
+	ccaOffset = 8
+
+	defaultSurveyDwell = 200 * time.Millisecond
+)
+
+// ChannelStats are the airtime and interference measurements of a channel.
+// Airtime fields are percentages of the measurement period.
+type ChannelStats struct {
+	Channel  uint8
+	Chanspec uint16
+	// Glitches and BadPLCP count receive glitches and frames with a bad PLCP
+	// header, which indicate non Wi-Fi interference.
+	Glitches uint32
+	BadPLCP  uint32
+	// TxDur is airtime spent transmitting, InBSS receiving frames of the own
+	// BSS and OBSS receiving frames of other BSSs.
+	TxDur uint8
+	InBSS uint8
+	OBSS  uint8
+	// NoCategory is airtime the medium was busy with frames which could not be
+	// classified and NoPacket busy without a decodable frame (interference).
+	NoCategory uint8
+	NoPacket   uint8
+	// Doze is airtime the radio was asleep and TxOP the transmit opportunity left.
+	Doze uint8
+	TxOP uint8
+	// Noise is the background noise in dBm.
+	Noise int8
+	// Idle is the percentage of time the channel was idle.
+	Idle uint8
+}
+
+// Busy returns the percentage of airtime the channel was occupied by others.
+func (s ChannelStats) Busy() int {
+	return int(s.InBSS) + int(s.OBSS) + int(s.NoCategory) + int(s.NoPacket)
+}
+
+// ChannelStats returns the interference measurements of the current channel.
+func (d *Device) ChannelStats() (ChannelStats, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return ChannelStats{}, err
+	}
+	return d.chanimStats()
+}
+
+// SurveyChannels measures each of channels for dwell and stores the results
+// in dst, returning the amount stored. Zero dwell selects 200ms. The link must
+// be down since the radio is retuned; surveys are meant to be run before
+// StartAP. The device is left on the last surveyed channel.
+func (d *Device) SurveyChannels(channels []uint8, dwell time.Duration, dst []ChannelStats) (int, error) {
+	if dwell <= 0 {
+		dwell = defaultSurveyDwell
+	}
+	n := 0
+	for _, ch := range channels {
+		if n == len(dst) {
+			break
+		}
+		err := d.acquire(modeWifi)
+		if err == nil && d.IsLinkUp() {
+			err = errSurveyLinkUp
+		}
+		if err == nil {
+			d.info("SurveyChannels", slog.Int("ch", int(ch)))
+			err = d.set_ioctl(whd.WLC_SET_CHANNEL, whd.IF_STA, uint32(ch))
+		}
+		if err == nil {
+			// Read to start a new measurement period on this channel.
+			_, err = d.chanimStats()
+		}
+		d.release()
+		if err != nil {
+			return n, err
+		}
+		time.Sleep(dwell)
+		err = d.acquire(modeWifi)
+		if err == nil {
+			dst[n], err = d.chanimStats()
+		}
+		d.release()
+		if err != nil {
+			return n, err
+		}
+		dst[n].Channel = ch // The reported chanspec may lag the retune.
+		n++
+	}
+	return n, nil
+}
+
+// AutoChannel surveys the non overlapping 2.4GHz channels 1, 6 and 11 and
+// returns the least busy one, to be passed to StartAP.
+func (d *Device) AutoChannel() (uint8, error) {
+	channels := [...]uint8{1, 6, 11}
+	var stats [len(channels)]ChannelStats
+	n, err := d.SurveyChannels(channels[:], 0, stats[:])
+	if err != nil {
+		return 0, err
+	}
+	best := stats[0]
+	for _, s := range stats[1:n] {
+		if s.Busy() < best.Busy() || (s.Busy() == best.Busy() && s.Noise < best.Noise) {
+			best = s
+		}
+	}
+	return best.Channel, nil
+}
+
+// chanimStats reads the chanim_stats of the current channel.
+func (d *Device) chanimStats() (ChannelStats, error) {
+	var params [chanimHdrLen]byte
+	binary.LittleEndian.PutUint32(params[0:], chanimHdrLen+chanimStatsLen)
+	binary.LittleEndian.PutUint32(params[4:], chanimVersion)
+	binary.LittleEndian.PutUint32(params[8:], chanimCountOne)
+	var res [chanimHdrLen + chanimStatsLen]byte
+	_, err := d.get_iovar_params("chanim_stats", whd.IF_STA, params[:], res[:])
+	if err != nil {
+		return ChannelStats{}, err
+	}
+	return parseChanimStats(res[:])
+}
+
+// parseChanimStats parses a wl_chanim_stats_t holding one version 2 chanim_stats_t.
+func parseChanimStats(b []byte) (s ChannelStats, err error) {
+	if len(b) < chanimHdrLen+chanimStatsLen || binary.LittleEndian.Uint32(b[4:]) != chanimVersion {
+		return s, errChanimVersion
+	}
+	b = b[chanimHdrLen:]
+	cca := b[ccaOffset : ccaOffset+ccaStats]
+	s = ChannelStats{
+		Glitches:   binary.LittleEndian.Uint32(b[0:]),
+		BadPLCP:    binary.LittleEndian.Uint32(b[4:]),
+		TxDur:      cca[ccaTxDur],
+		InBSS:      cca[ccaInBSS],
+		OBSS:       cca[ccaOBSS],
+		NoCategory: cca[ccaNoCat],
+		NoPacket:   cca[ccaNoPkt],
+		Doze:       cca[ccaDoze],
+		TxOP:       cca[ccaTxOP],
+		Noise:      int8(b[17]),
+		Chanspec:   binary.LittleEndian.Uint16(b[18:]),
+		Idle:       b[32],
+	}
+	s.Channel = uint8(s.Chanspec) // Low byte of chanspec is the channel.
+	return s, nil
+}
@@ -0,0 +1,74 @@
+package cyw43439
+
+import (
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file negotiates the firmware's TCP/IP offload engine (TOE) which
+// computes the TCP and UDP checksums of sent frames and verifies those of
+// received frames, sparing the host from summing every payload byte in
+// software. Support depends on the firmware build.
+
+// ChecksumOffload is a set of checksum offloads. Reference: TOE_TX_CSUM_OL
+// and TOE_RX_CSUM_OL in wlioctl.h.
+type ChecksumOffload uint32
+
+const (
+	// ChecksumTx has the firmware compute the TCP and UDP checksums of sent
+	// IP frames. The stack should leave the checksum field zero.
+	ChecksumTx ChecksumOffload = 1 << 0
+	// ChecksumRx has the firmware verify the TCP and UDP checksums of
+	// received IP frames. See RxChecksumGood.
+	ChecksumRx ChecksumOffload = 1 << 1
+)
+
+// EnableChecksumOffload probes the firmware for the offload engine and
+// enables the offloads of want it supports, returning those enabled. A
+// firmware without the offload engine enables none and returns no error. A
+// zero want disables checksum offloading.
+func (d *Device) EnableChecksumOffload(want ChecksumOffload) (ChecksumOffload, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	d.info("EnableChecksumOffload", slog.Uint64("want", uint64(want)))
+	d.csum = 0
+	_, err = d.get_iovar("toe_ol", whd.IF_STA)
+	if err != nil {
+		d.debug("EnableChecksumOffload:unsupported", slog.String("err", err.Error()))
+		return 0, nil
+	}
+	err = d.set_iovar("toe_ol", whd.IF_STA, uint32(want&(ChecksumTx|ChecksumRx)))
+	if err != nil {
+		return 0, err
+	}
+	err = d.set_iovar("toe", whd.IF_STA, b2u32(want != 0))
+	if err != nil || want == 0 {
+		return 0, err
+	}
+	got, err := d.get_iovar("toe_ol", whd.IF_STA)
+	if err != nil {
+		return 0, err
+	}
+	d.csum = ChecksumOffload(got) & want
+	return d.csum, nil
+}
+
+// ChecksumOffload returns the checksum offloads enabled with EnableChecksumOffload.
+// An IP stack skips computing checksums of sent frames if ChecksumTx is set.
+func (d *Device) ChecksumOffload() ChecksumOffload {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.csum
+}
+
+// RxChecksumGood returns true if the firmware verified the TCP or UDP
+// checksum of the frame being passed to the RecvEthHandle handler so the IP
+// stack may skip verifying it. It must only be called from within the
+// handler and is always false for frames delivered by HandleRx.
+func (d *Device) RxChecksumGood() bool {
+	return d.rxSumGood
+}
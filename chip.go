@@ -0,0 +1,146 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file describes the CYW43 family chips the driver supports. They share
+// the gSPI bus, backplane and firmware protocol but differ in memory layout,
+// reference NVRAM and firmware. The profile is selected on Init from the chip
+// ID, so boards with a CYW43438 or CYW4343W wired over gSPI, i.e: modules of
+// the original Raspberry Pi Zero W, are driven like the Pico W's CYW43439.
+
+var (
+	errUnknownChip  = errors.New("unsupported chip ID")
+	errChipNVRAM    = errors.New("chip has no reference NVRAM, set Config.NVRAM")
+	errChipFirmware = errors.New("firmware built for another chip")
+)
+
+// ChipProfile describes a CYW43 family chip.
+type ChipProfile struct {
+	// Name is the marketing name of the chip, i.e: "CYW43439".
+	Name string
+	// ChipID is the ID read from the chipcommon chip ID register.
+	ChipID uint16
+	// RAMBase and RAMSize locate the chip's RAM on the backplane. Firmware is
+	// downloaded to RAMBase and the NVRAM to the end of the RAM. SRMemSize is
+	// the size of the save/restore memory at the end of the RAM, below which
+	// the firmware publishes the address of its shared memory structure.
+	RAMBase   uint32
+	RAMSize   uint32
+	SRMemSize uint32
+	// WLANCore and SOCSRAMCore are the backplane addresses of the WLAN ARM
+	// and SOCSRAM cores' wrapper registers, used to reset them.
+	WLANCore    uint32
+	SOCSRAMCore uint32
+	// FirmwareTarget is the start of FirmwareInfo.Target of firmware built
+	// for the chip, i.e: "43439a0". Init refuses other firmware.
+	FirmwareTarget string
+	// NVRAM is the NVRAM of the chip's reference board, used if Config.NVRAM
+	// is not set. Empty if the chip has none so Config.NVRAM is required.
+	NVRAM string
+	// SRAM3Remap is set on 4343x chips whose SOCSRAM bank 3 remap must be
+	// disabled before the firmware download.
+	SRAM3Remap bool
+}
+
+// chipProfiles are the supported chips. The first is the default used
+// before the chip is detected.
+var chipProfiles = [...]ChipProfile{
+	{
+		Name:           "CYW43439",
+		ChipID:         43439,
+		RAMSize:        512 * 1024,
+		SRMemSize:      64 * 1024,
+		WLANCore:       whd.WRAPPER_REGISTER_OFFSET + whd.WLAN_ARMCM3_BASE_ADDRESS,
+		SOCSRAMCore:    whd.WRAPPER_REGISTER_OFFSET + whd.SOCSRAM_BASE_ADDRESS,
+		FirmwareTarget: "43439",
+		NVRAM:          nvram43439,
+		SRAM3Remap:     true,
+	},
+	{
+		// The CYW4343W is a CYW43438 variant which reports the same ID.
+		Name:           "CYW43438",
+		ChipID:         43430,
+		RAMSize:        512 * 1024,
+		SRMemSize:      64 * 1024,
+		WLANCore:       whd.WRAPPER_REGISTER_OFFSET + whd.WLAN_ARMCM3_BASE_ADDRESS,
+		SOCSRAMCore:    whd.WRAPPER_REGISTER_OFFSET + whd.SOCSRAM_BASE_ADDRESS,
+		FirmwareTarget: "43430",
+		SRAM3Remap:     true,
+	},
+}
+
+// LookupChip returns the profile of the chip with ID chipID.
+func LookupChip(chipID uint16) (ChipProfile, bool) {
+	for i := range chipProfiles {
+		if chipProfiles[i].ChipID == chipID {
+			return chipProfiles[i], true
+		}
+	}
+	return ChipProfile{}, false
+}
+
+// Chip returns the profile of the chip detected on Init, or of the CYW43439
+// if the Device was not initialized.
+func (d *Device) Chip() ChipProfile {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return *d.chip_profile()
+}
+
+func (d *Device) chip_profile() *ChipProfile {
+	if d.chip == nil {
+		return &chipProfiles[0]
+	}
+	return d.chip
+}
+
+// detect_chip reads the chip ID and selects its profile.
+func (d *Device) detect_chip() error {
+	id, err := d.bp_read16(whd.CHIPCOMMON_BASE_ADDRESS)
+	if err != nil {
+		return err
+	}
+	for i := range chipProfiles {
+		if chipProfiles[i].ChipID == id {
+			d.chip = &chipProfiles[i]
+			d.debug("chip", slog.String("name", d.chip.Name))
+			return nil
+		}
+	}
+	d.logerr("chip:unknown", slog.Uint64("id", uint64(id)))
+	return errUnknownChip
+}
+
+// check_images verifies the firmware and NVRAM of cfg suit the detected chip
+// and returns the NVRAM to download.
+func (p *ChipProfile) check_images(cfg *Config) (nvram string, err error) {
+	info, err := parseFirmwareInfo(cfg.Firmware)
+	if err == nil && !strings.HasPrefix(info.Target, p.FirmwareTarget) {
+		return "", errChipFirmware
+	}
+	nvram = cfg.NVRAM
+	if nvram == "" {
+		nvram = p.NVRAM
+	}
+	if nvram == "" {
+		return "", errChipNVRAM
+	}
+	return nvram, nil
+}
+
+// sharedPtrAddr returns the address holding the address of the firmware's
+// shared memory structure once it has booted.
+func (p *ChipProfile) sharedPtrAddr() uint32 {
+	return p.RAMBase + p.RAMSize - 4 - p.SRMemSize
+}
+
+// inRAM returns true if the size bytes at addr are within the chip's RAM.
+func (p *ChipProfile) inRAM(addr, size uint32) bool {
+	return addr >= p.RAMBase && addr-p.RAMBase <= p.RAMSize-size
+}
@@ -14,6 +14,7 @@ import (
 
 	"log/slog"
 
+	"github.com/soypat/cyw43439"
 	"github.com/soypat/saleae"
 	"github.com/soypat/saleae/analyzers"
 	"golang.org/x/exp/constraints"
@@ -224,11 +225,8 @@ func (bus *BusCtl) CommandFromBytes(b []byte) (cmd CYW43439Cmd, data []byte) {
 	_ = b[3]
 	command := bus.Order.Uint32(b)
 
-	cmd.Write = command&(1<<31) != 0
-	cmd.AutoInc = command&(1<<30) != 0
-	cmd.Fn = Function(command>>28) & 0b11
-	cmd.Addr = (command >> 11) & 0x1ffff
-	cmd.Size = command & ((1 << 11) - 1)
+	c := cyw43439.ParseCmd(command)
+	cmd = CYW43439Cmd{Write: c.Write, AutoInc: c.AutoInc, Fn: Function(c.Fn), Addr: c.Addr, Size: c.Size}
 	data = b[4:]
 	if cmd.Fn == FuncBackplane && !cmd.Write && len(data) > 4 {
 		data = b[8:] // padding.
@@ -0,0 +1,70 @@
+// Command cywnvram converts a vendor NVRAM file, in plain key=value text or as
+// a C header such as the Pico SDK's wifi_nvram_43439.h, to a Go source file
+// declaring the binary NVRAM as a string constant for Config.NVRAM. It is
+// meant to be run via go generate:
+//
+//	//go:generate go run github.com/soypat/cyw43439/cmd/cywnvram -pkg main -name nvram -o nvram.go board_nvram.txt
+//
+// NVRAM may also be converted at runtime with cyw43439.ParseNVRAM.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/soypat/cyw43439"
+)
+
+func main() {
+	output := flag.String("o", "", "output file name, standard output if empty")
+	pkg := flag.String("pkg", "main", "package name of the output file")
+	name := flag.String("name", "nvram", "name of the declared constant")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("cywnvram: one input file required")
+	}
+	text, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	nvram, err := cyw43439.ParseNVRAM(string(text))
+	if err != nil {
+		log.Fatal(flag.Arg(0), ": ", err)
+	}
+	src, err := generate(*pkg, *name, filepath.Base(flag.Arg(0)), nvram)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*output, src, 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate returns the Go source declaring nvram, one entry per line.
+func generate(pkg, name, input, nvram string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by \"cywnvram %s\"; DO NOT EDIT.\n\npackage %s\n\n", input, pkg)
+	fmt.Fprintf(&buf, "const %s = ", name)
+	entries := strings.SplitAfter(strings.TrimSuffix(nvram, "\x00"), "\x00")
+	for _, entry := range entries {
+		if entry == "" {
+			continue
+		}
+		buf.WriteString(strconv.Quote(entry))
+		buf.WriteString(" +\n")
+	}
+	buf.WriteString("\"\\x00\"\n")
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,30 @@
+package cyw43439
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	connectAttempts = 3
+	connectBackoff  = 2 * time.Second
+)
+
+// initJoin initializes d with cfg and joins the network ssid, retrying failed
+// joins. It implements ConnectWiFi.
+func (d *Device) initJoin(cfg Config, ssid, pass string) (err error) {
+	err = d.Init(cfg)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = d.JoinWPA2(ssid, pass)
+		if err == nil || attempt == connectAttempts {
+			return err
+		}
+		d.mu.Lock()
+		d.logerr("ConnectWiFi:join", slog.Int("attempt", attempt), slog.String("err", err.Error()))
+		d.mu.Unlock()
+		time.Sleep(connectBackoff)
+	}
+}
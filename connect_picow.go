@@ -0,0 +1,29 @@
+//go:build !cy43nopio && rp2040
+
+package cyw43439
+
+// ConnectWiFi creates the Pico W's device, initializes it with
+// DefaultWifiConfig and joins the network ssid with passphrase pass, or an
+// open network if pass is empty. Failed joins are retried up to 3 times.
+//
+// The returned Device is a link layer (Ethernet) interface: its SendEth,
+// RecvEthHandle, HardwareAddr6 and MTU methods are all a TCP/IP stack needs.
+// It does not implement the socket based netdev interface of
+// tinygo.org/x/drivers, which is not a dependency of this module, nor does it
+// acquire an address: pass it to a stack such as udpdriver or seqs, i.e:
+//
+//	dev, err := cyw43439.ConnectWiFi(ssid, pass)
+//	if err != nil {
+//		panic(err)
+//	}
+//	mac, _ := dev.HardwareAddr6()
+//	stack := stacks.NewPortStack(stacks.PortStackConfig{MAC: mac, MTU: dev.MTU()})
+//	dev.RecvEthHandle(stack.RecvEth)
+func ConnectWiFi(ssid, pass string) (*Device, error) {
+	dev := NewPicoWDevice()
+	err := dev.initJoin(DefaultWifiConfig(), ssid, pass)
+	if err != nil {
+		return nil, err
+	}
+	return dev, nil
+}
@@ -0,0 +1,116 @@
+package cyw43439
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+)
+
+// This file reads the firmware console and the chip RAM for post mortem
+// diagnostics of firmware crashes (traps and asserts), which leave the
+// firmware's state in RAM. Unlike the console lines logged while polling
+// they do not require a logger nor the firmware to be running.
+
+var errNoSharedMem = errors.New("firmware shared memory not found")
+
+const (
+	// consoleRingLen is the size of the firmware console ring buffer.
+	consoleRingLen = 0x400
+	// coreDumpChunk is the amount of RAM read per bus acquisition by CoreDump.
+	coreDumpChunk = 512
+)
+
+// ReadConsole copies the firmware console ring buffer to dst, oldest byte
+// first, and returns the amount of bytes copied. The buffer holds the last
+// 1024 bytes printed by the firmware, i.e: the trap or assert which crashed it.
+func (d *Device) ReadConsole(dst []byte) (int, error) {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	d.info("ReadConsole")
+	smem, err := d.shared_mem()
+	if err != nil {
+		return 0, err
+	}
+	buf8 := u32AsU8(d._iovarBuf[:])
+	err = d.bp_read(smem.console_addr+8, buf8[:16])
+	if err != nil {
+		return 0, err
+	}
+	clog := decodeSharedMemLog(_busOrder, buf8[:16])
+	if clog.buf == 0 || !d.chip_profile().inRAM(clog.buf, consoleRingLen) {
+		return 0, errNoSharedMem
+	}
+	ring := buf8[:consoleRingLen]
+	err = d.bp_read(clog.buf, ring)
+	if err != nil {
+		return 0, err
+	}
+	// The oldest byte is at the write index; unwritten bytes are zero.
+	idx := int(clog.idx % consoleRingLen)
+	n := 0
+	for i := 0; i < consoleRingLen && n < len(dst); i++ {
+		b := ring[(idx+i)%consoleRingLen]
+		if b != 0 {
+			dst[n] = b
+			n++
+		}
+	}
+	return n, nil
+}
+
+// CoreDump writes the contents of the chip's RAM, 512kB on the CYW43439, to w
+// and returns the amount of bytes written. The device is released between reads so other
+// goroutines are not blocked for the duration of slow writes to w.
+func (d *Device) CoreDump(w io.Writer) (n int64, err error) {
+	d.mu.Lock()
+	d.info("CoreDump")
+	d.mu.Unlock()
+	var chunk [coreDumpChunk]byte
+	chip := d.Chip()
+	for addr := chip.RAMBase; addr < chip.RAMBase+chip.RAMSize; addr += coreDumpChunk {
+		err = d.readRAM(addr, chunk[:])
+		if err != nil {
+			return n, err
+		}
+		nw, err := w.Write(chunk[:])
+		n += int64(nw)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (d *Device) readRAM(addr uint32, dst []byte) error {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.bp_read(addr, dst)
+}
+
+// shared_mem reads the firmware's shared memory structure.
+func (d *Device) shared_mem() (sharedMem, error) {
+	chip := d.chip_profile()
+	sharedAddr, err := d.bp_read32(chip.sharedPtrAddr())
+	if err != nil {
+		return sharedMem{}, err
+	} else if !chip.inRAM(sharedAddr, 32) || sharedAddr%4 != 0 {
+		d.debug("shared_mem:invalid", slog.Uint64("addr", uint64(sharedAddr)))
+		return sharedMem{}, errNoSharedMem
+	}
+	var shared [32]byte
+	err = d.bp_read(sharedAddr, shared[:])
+	if err != nil {
+		return sharedMem{}, err
+	}
+	smem := decodeSharedMem(_busOrder, shared[:])
+	if smem.console_addr == 0 || !chip.inRAM(smem.console_addr, 24) {
+		return sharedMem{}, errNoSharedMem
+	}
+	return smem, nil
+}
@@ -0,0 +1,100 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file detects transmit credit starvation. The firmware grants the host
+// SDPCM sequence numbers it may send up to in the header of every frame it
+// sends. When it stops doing so, i.e: since it hung or dropped the host after
+// missed keepalives, every send blocks until waitForCredit times out. The
+// condition is reported once it lasts longer than a timeout and the firmware
+// is periodically interrupted through the SDIO mailbox, which has it send a
+// frame carrying the current credit.
+
+var errCreditStarved = errors.New("firmware granted no transmit credit")
+
+// CreditStarvation reports the firmware not granting transmit credits.
+type CreditStarvation struct {
+	// Duration is the time since the last credit was available. When
+	// Recovered is set it is the total time without credit.
+	Duration time.Duration
+	// TxSeq is the SDPCM sequence number of the next frame sent and TxSeqMax
+	// the sequence number the firmware allows sending up to.
+	TxSeq    uint8
+	TxSeqMax uint8
+	// Recovered is set once the firmware grants credit again after a
+	// starvation was reported.
+	Recovered bool
+}
+
+type creditWatch struct {
+	timeout time.Duration
+	cb      func(CreditStarvation)
+	// since is the time credit was first found unavailable, zero while
+	// credit is available.
+	since time.Time
+	// lastPoke is the time of the last recovery mailbox write.
+	lastPoke time.Time
+	reported bool
+}
+
+// OnCreditStarvation sets the timeout after which the firmware granting no
+// transmit credits is reported. cb, which may be nil, is called once the
+// timeout elapses and again once credit is granted. Each starvation is also
+// logged, recorded in LastErrors and counted in Counters.TxStarved, and
+// while it lasts the firmware is asked to resend its credit every timeout.
+// A timeout of zero disables detection. cb is called from within the polling
+// functions with the Device locked so it must not call Device methods.
+func (d *Device) OnCreditStarvation(timeout time.Duration, cb func(CreditStarvation)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.starve.timeout = timeout
+	d.starve.cb = cb
+}
+
+// credit_check tracks the time the firmware has granted no transmit credit
+// for, reporting and attempting to recover from starvation.
+func (d *Device) credit_check() {
+	w := &d.starve
+	if d.has_credit() {
+		if w.reported {
+			d.info("credit:recovered", slog.Duration("after", time.Since(w.since)))
+			if w.cb != nil {
+				w.cb(CreditStarvation{Duration: time.Since(w.since), TxSeq: d.sdpcmSeq, TxSeqMax: d.sdpcmSeqMax, Recovered: true})
+			}
+		}
+		w.since = time.Time{}
+		w.reported = false
+		return
+	} else if w.timeout <= 0 {
+		return
+	}
+	now := time.Now()
+	if w.since.IsZero() {
+		w.since = now
+		return
+	}
+	starved := now.Sub(w.since)
+	if starved < w.timeout || now.Sub(w.lastPoke) < w.timeout {
+		return
+	}
+	if !w.reported {
+		w.reported = true
+		d.counters.TxStarved++
+		d.recordErr("credit", errCreditStarved)
+		d.warn("credit:starved", slog.Duration("for", starved), slog.Uint64("seq", uint64(d.sdpcmSeq)), slog.Uint64("seqmax", uint64(d.sdpcmSeqMax)))
+		if w.cb != nil {
+			w.cb(CreditStarvation{Duration: starved, TxSeq: d.sdpcmSeq, TxSeqMax: d.sdpcmSeqMax})
+		}
+	}
+	w.lastPoke = now
+	err := d.bp_write32(whd.SDIO_TO_SB_MAILBOX, whd.SMB_DEV_INT)
+	if err != nil {
+		d.recordErr("credit_poke", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/hex"
 	"runtime"
+	"unsafe"
 
 	"log/slog"
 )
@@ -17,8 +18,16 @@ const (
 
 	// heapAllocDebugging enables heap allocation debugging. So Prints do not use the heap.
 	heapAllocDebugging = false
+	// maxLogAttrs is the amount of attributes logged per message, more are dropped.
+	maxLogAttrs = 8
 )
 
+// Logging does not allocate: attributes are copied to a Device owned array
+// before being passed to the logger, keeping the variadic slices on the stack
+// even with conservative escape analysis, and firmware log lines are not
+// copied into strings. Whether the logger's handler allocates is up to it.
+// Build with the cyw43439.nolog tag to remove logging entirely, see log_disabled.go.
+
 func (d *Device) logerr(msg string, attrs ...slog.Attr) {
 	d.logattrs(slog.LevelError, msg, attrs...)
 }
@@ -36,13 +45,15 @@ func (d *Device) debug(msg string, attrs ...slog.Attr) {
 }
 
 func (d *Device) trace(msg string, attrs ...slog.Attr) {
-	if d._traceenabled { // Special case for trace since so common. Might save a few nanoseconds.
+	if logBuild && d._traceenabled { // Special case for trace since so common. Might save a few nanoseconds.
 		d.logattrs(levelTrace, msg, attrs...)
 	}
 }
 
 func (d *Device) logenabled(level slog.Level) bool {
-	if heapAllocDebugging {
+	if !logBuild {
+		return false
+	} else if heapAllocDebugging {
 		return true
 	}
 	return d.logger != nil && d.logger.Handler().Enabled(context.Background(), level)
@@ -57,8 +68,12 @@ var (
 	lastAllocs uint64
 )
 
+// logattrs logs msg with attrs at level. It must be called with d.mu held
+// since it uses d.logAttrs.
 func (d *Device) logattrs(level slog.Level, msg string, attrs ...slog.Attr) {
-	if heapAllocDebugging {
+	if !logBuild {
+		return
+	} else if heapAllocDebugging {
 		runtime.ReadMemStats(&memstats)
 		if memstats.TotalAlloc != lastAllocs {
 			print("[ALLOC] inc=", int64(memstats.TotalAlloc)-int64(lastAllocs))
@@ -86,9 +101,12 @@ func (d *Device) logattrs(level slog.Level, msg string, attrs ...slog.Attr) {
 		}
 		return
 	}
-	if d.logger != nil {
-		d.logger.LogAttrs(context.Background(), level, msg, attrs...)
+	if d.logger == nil || !d.logger.Handler().Enabled(context.Background(), level) {
+		return
 	}
+	n := copy(d.logAttrs[:], attrs)
+	d.logger.LogAttrs(context.Background(), level, msg, d.logAttrs[:n]...)
+	d.logAttrs = [maxLogAttrs]slog.Attr{} // Do not keep attribute values reachable.
 }
 
 // SetLogger sets the logger for the device. If nil logging is disabled.
@@ -96,24 +114,20 @@ func (d *Device) SetLogger(l *slog.Logger) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.logger = l
+	d._traceenabled = l != nil && l.Handler().Enabled(context.Background(), levelTrace)
 }
 
 func (d *Device) log_init() error {
-	if d.logger == nil || !d.logger.Handler().Enabled(context.Background(), deviceLevel) {
+	if !logBuild || d.logger == nil || !d.logger.Handler().Enabled(context.Background(), deviceLevel) {
 		return nil
 	}
 	d.trace("log_init")
-	const (
-		ramBase           = 0
-		ramSize           = 512 * 1024
-		socram_srmem_size = 64 * 1024
-	)
-	const addr = ramBase + ramSize - 4 - socram_srmem_size
-	sharedAddr, err := d.bp_read32(addr)
+	sharedAddr, err := d.bp_read32(d.chip_profile().sharedPtrAddr())
 	if err != nil {
 		return err
 	}
-	shared := make([]byte, 32)
+	var sharedBuf [32]byte
+	shared := sharedBuf[:]
 	d.bp_read(sharedAddr, shared)
 	caddr := _busOrder.Uint32(shared[20:])
 	smem := decodeSharedMem(_busOrder, shared)
@@ -133,7 +147,7 @@ func (d *Device) log_init() error {
 // log_read reads the CY43439's internal logs and prints them to the structured logger
 // under the CY43 level.
 func (d *Device) log_read() error {
-	if d.logger == nil || !d.logger.Handler().Enabled(context.Background(), deviceLevel) {
+	if !logBuild || d.logger == nil || !d.logger.Handler().Enabled(context.Background(), deviceLevel) {
 		return nil
 	}
 	d.trace("log_read")
@@ -158,7 +172,9 @@ func (d *Device) log_read() error {
 		b := buf8[d.log.last_idx]
 		if b == '\r' || b == '\n' {
 			if d.log.bufcount != 0 {
-				d.logattrs(deviceLevel, string(d.log.buf[:d.log.bufcount]))
+				// The line aliases d.log.buf and so is only valid during
+				// the logger call, handlers must not retain the message.
+				d.logattrs(deviceLevel, unsafe.String(&d.log.buf[0], d.log.bufcount))
 				d.log.bufcount = 0
 			}
 		} else if d.log.bufcount < uint32(len(d.log.buf)) {
@@ -2,7 +2,11 @@ package cyw43439
 
 import (
 	"errors"
+	"hash/crc32"
+	"io"
+	"strconv"
 	"strings"
+	"unsafe"
 
 	"github.com/soypat/cyw43439/whd"
 	"golang.org/x/exp/constraints"
@@ -48,29 +52,73 @@ func (f Function) String() (s string) {
 // without any timing overhead.
 type Status uint32
 
+// String returns the names of the fields set in s. See Fields.
 func (s Status) String() (str string) {
 	if s == 0 {
 		return "no status"
 	}
-	if s.HostCommandDataError() {
-		str += "hostcmderr "
+	var buf [statusFieldCount]StatusField
+	for _, f := range s.appendFields(buf[:0]) {
+		str += f.String() + " "
 	}
-	if s.DataUnavailable() {
-		str += "dataunavailable "
+	return str
+}
+
+// StatusField is a decoded field of a Status or Interrupts word.
+type StatusField struct {
+	Name string
+	// Value is 1 for set flags and the field value for multi-bit fields.
+	Value uint16
+	// Bits is the width of the field, 1 for flags.
+	Bits uint8
+}
+
+// String returns the field name, followed by its value for multi-bit fields, i.e: "f2len=1500".
+func (f StatusField) String() string {
+	if f.Bits == 1 {
+		return f.Name
 	}
-	if s.IsOverflow() {
-		str += "overflow "
+	return f.Name + "=" + strconv.Itoa(int(f.Value))
+}
+
+const statusFieldCount = 12
+
+// Fields returns the flags set in s followed by the packet lengths of the
+// functions with a packet available. Status reports F1 (backplane) transfer
+// problems through DataUnavailable, Overflow and HostCommandDataError since
+// F1 has no FIFO of its own; the F1 interrupt conditions are in Interrupts.
+func (s Status) Fields() []StatusField {
+	return s.appendFields(make([]StatusField, 0, statusFieldCount))
+}
+
+func (s Status) appendFields(dst []StatusField) []StatusField {
+	flags := [...]struct {
+		set  bool
+		name string
+	}{
+		{s.DataUnavailable(), "dataunavailable"},
+		{s.IsUnderflow(), "underflow"},
+		{s.IsOverflow(), "overflow"},
+		{s.F2Interrupt(), "f2intr"},
+		{s.F3Interrupt(), "f3intr"},
+		{s.F2RxReady(), "f2rxready"},
+		{s.F3RxReady(), "f3rxready"},
+		{s.HostCommandDataError(), "hostcmderr"},
+		{s.F2PacketAvailable(), "f2packetavail"},
+		{s.F3PacketAvailable(), "f3packetavail"},
 	}
-	if s.IsUnderflow() {
-		str += "underflow "
+	for _, f := range flags {
+		if f.set {
+			dst = append(dst, StatusField{Name: f.name, Value: 1, Bits: 1})
+		}
 	}
-	if s.F2PacketAvailable() || s.F3PacketAvailable() {
-		str += "packetavail "
+	if s.F2PacketAvailable() {
+		dst = append(dst, StatusField{Name: "f2len", Value: s.F2PacketLength(), Bits: 11})
 	}
-	if s.F2RxReady() || s.F3RxReady() {
-		str += "rxready "
+	if s.F3PacketAvailable() {
+		dst = append(dst, StatusField{Name: "f3len", Value: s.F3PacketLength(), Bits: 11})
 	}
-	return str
+	return dst
 }
 
 // DataUnavailable returns true if requested read data is unavailable.
@@ -85,13 +133,17 @@ func (s Status) IsOverflow() bool { return s&(1<<2) != 0 }
 // F2Interrupt returns true if F2 channel interrupt set.
 func (s Status) F2Interrupt() bool { return s&(1<<3) != 0 }
 
+// F3Interrupt returns true if F3 channel interrupt set.
+func (s Status) F3Interrupt() bool { return s&(1<<4) != 0 }
+
 // F2RxReady returns true if F2 FIFO is ready to receive data (FIFO empty).
 func (s Status) F2RxReady() bool { return s&(1<<5) != 0 }
 
 // F3RxReady returns true if F3 FIFO is ready to receive data (FIFO empty).
 func (s Status) F3RxReady() bool { return s&0x40 != 0 }
 
-// HostCommandDataError TODO document.
+// HostCommandDataError returns true if the data of the last command was in
+// error, i.e: a read or write of a length the addressed function does not support.
 func (s Status) HostCommandDataError() bool { return s&0x80 != 0 }
 
 // GSPIPacketAvailable notifies there is a packet available over gSPI.
@@ -117,6 +169,11 @@ func (s Status) F3PacketLength() uint16 {
 
 type Interrupts uint16
 
+// DefaultInterrupts are the interrupts enabled after Init, appropriate for
+// data-path operation: F2 packet available and bus error conditions.
+const DefaultInterrupts Interrupts = whd.F2_F3_FIFO_RD_UNDERFLOW | whd.F2_F3_FIFO_WR_OVERFLOW |
+	whd.COMMAND_ERROR | whd.DATA_ERROR | whd.F2_PACKET_AVAILABLE | whd.F1_OVERFLOW
+
 func (Int Interrupts) IsBusOverflowedOrUnderflowed() bool {
 	return Int&(whd.F2_F3_FIFO_RD_UNDERFLOW|whd.F2_F3_FIFO_WR_OVERFLOW|whd.F1_OVERFLOW) != 0
 }
@@ -129,6 +186,17 @@ func (Int Interrupts) IsDataUnavailable() bool {
 	return Int&(whd.DATA_UNAVAILABLE) != 0
 }
 
+// Fields returns the interrupts set in Int, each with value 1.
+func (Int Interrupts) Fields() (fields []StatusField) {
+	for i := 0; Int != 0; i++ {
+		if Int&1 != 0 {
+			fields = append(fields, StatusField{Name: irqmask(1 << i).String(), Value: 1, Bits: 1})
+		}
+		Int >>= 1
+	}
+	return fields
+}
+
 func (Int Interrupts) String() (s string) {
 	if Int == 0 {
 		return "no interrupts"
@@ -142,16 +210,73 @@ func (Int Interrupts) String() (s string) {
 	return s
 }
 
-func GetCLM(firmware []byte) []byte {
-	clmAddr := alignup(uint32(len(firmware)), 512)
-	if uint32(cap(firmware)) < clmAddr+clmLen {
-		panic("firmware slice too small for CLM")
+var errCLMNotAppended = errors.New("no CLM blob in firmware slice capacity")
+
+// GetCLM returns the CLM blob appended to firmware at the first 512 byte
+// boundary after it, within the capacity of the firmware slice.
+// Its length is read from the blob's header. See ParseFirmwareInfo.
+// CLM blobs stored separately from the firmware need not use GetCLM,
+// see Config.CLM and Config.CLMReader.
+func GetCLM(firmware []byte) ([]byte, error) {
+	clmAddr := int(alignup(uint32(len(firmware)), 512))
+	if cap(firmware) <= clmAddr {
+		return nil, errCLMNotAppended
+	}
+	full := firmware[:cap(firmware)]
+	clmLen, err := clmBlobLen(unsafe.String(unsafe.SliceData(full[clmAddr:]), len(full)-clmAddr))
+	if err != nil {
+		return nil, err
 	}
-	return firmware[clmAddr : clmAddr+clmLen]
+	return full[clmAddr : clmAddr+clmLen], nil
 }
 
 var errFirmwareValidationFailed = errors.New("firmware validation failed")
 
+var (
+	errFirmwareCRC   = errors.New("firmware image CRC-32 mismatch")
+	errCLMCRC        = errors.New("CLM image CRC-32 mismatch")
+	errBTFirmwareCRC = errors.New("bluetooth firmware image CRC-32 mismatch")
+)
+
+// verifyImages checks the images in cfg against their expected checksums, if set.
+func verifyImages(cfg *Config) error {
+	if cfg.FirmwareCRC32 != 0 && crc32String(cfg.Firmware) != cfg.FirmwareCRC32 {
+		return errFirmwareCRC
+	} else if cfg.CLMCRC32 != 0 && cfg.CLMReader == nil && crc32String(cfg.CLM) != cfg.CLMCRC32 {
+		return errCLMCRC
+	} else if cfg.BTFirmwareCRC32 != 0 && crc32String(cfg.BTFirmware) != cfg.BTFirmwareCRC32 {
+		return errBTFirmwareCRC
+	}
+	if cfg.CLMCRC32 != 0 && cfg.CLMReader != nil {
+		crc, err := crc32Reader(cfg.CLMReader)
+		if err != nil {
+			return err
+		} else if crc != cfg.CLMCRC32 {
+			return errCLMCRC
+		}
+	}
+	return nil
+}
+
+// crc32Reader returns the IEEE CRC-32 checksum of the contents of r.
+func crc32Reader(r *io.SectionReader) (crc uint32, err error) {
+	var buf [256]byte
+	for off := int64(0); off < r.Size(); {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), r.Size()-off)], off)
+		if err != nil && !(err == io.EOF && off+int64(n) == r.Size()) {
+			return 0, err
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:n])
+		off += int64(n)
+	}
+	return crc, nil
+}
+
+// crc32String returns the IEEE CRC-32 checksum of s without copying it.
+func crc32String(s string) uint32 {
+	return crc32.ChecksumIEEE(unsafe.Slice(unsafe.StringData(s), len(s)))
+}
+
 func getFWVersion(src string) (string, error) {
 	begin := strings.LastIndex(src, "Version: ")
 	if begin == -1 {
@@ -168,35 +293,6 @@ func getFWVersion(src string) (string, error) {
 	return fwVersion, nil
 }
 
-// errjoion returns an error that wraps the given errors.
-// Any nil error values are discarded.
-// errjoion returns nil if every value in errs is nil.
-// The error formats as the concatenation of the strings obtained
-// by calling the Error method of each element of errs, with a newline
-// between each string.
-//
-// A non-nil error returned by errjoion implements the Unwrap() []error method.
-func errjoin(errs ...error) error {
-	n := 0
-	for _, err := range errs {
-		if err != nil {
-			n++
-		}
-	}
-	if n == 0 {
-		return nil
-	}
-	e := &joinError{
-		errs: make([]error, 0, n),
-	}
-	for _, err := range errs {
-		if err != nil {
-			e.errs = append(e.errs, err)
-		}
-	}
-	return e
-}
-
 //go:generate stringer -type=irqmask -output=interrupts_string.go -trimprefix=irq
 type irqmask uint16
 
@@ -340,25 +436,6 @@ func (pm powerManagementMode) mode() uint8 {
 	}
 }
 
-type joinError struct {
-	errs []error
-}
-
-func (e *joinError) Error() string {
-	var b []byte
-	for i, err := range e.errs {
-		if i > 0 {
-			b = append(b, '\n')
-		}
-		b = append(b, err.Error()...)
-	}
-	return string(b)
-}
-
-func (e *joinError) Unwrap() []error {
-	return e.errs
-}
-
 type _uinteger = interface {
 	~uint8 | ~uint16 | ~uint32 | ~uint64 | uintptr
 }
@@ -395,12 +472,3 @@ func b2u32(b bool) uint32 {
 func swap16(b uint32) uint32 {
 	return (b >> 16) | (b << 16)
 }
-
-func swap16be(b uint32) uint32 {
-	b = swap16(b)
-	b0 := b & 0xff
-	b1 := (b >> 8) & 0xff
-	b2 := (b >> 16) & 0xff
-	b3 := (b >> 24) & 0xff
-	return b0<<24 | b1<<16 | b2<<8 | b3
-}
@@ -3,8 +3,11 @@ package cyw43439
 import (
 	"context"
 	"errors"
+	"io"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"log/slog"
@@ -25,41 +28,120 @@ const (
 	modeBluetooth
 )
 
-// CYW43439 internal link state enum.
-type linkState uint8
+//go:generate stringer -type=LinkState -output=linkstate_string.go -trimprefix=LinkState
+
+// LinkState is the state of the CYW43439's wifi station connection. It is
+// maintained from firmware events received while polling the device.
+type LinkState uint8
+
+const (
+	// LinkStateDown indicates no connection and no join in progress.
+	LinkStateDown LinkState = iota
+	// LinkStateAuthenticating indicates a join was requested and
+	// 802.11 authentication with the access point is in progress.
+	LinkStateAuthenticating
+	// LinkStateAssociated indicates authentication succeeded and
+	// association with the access point is in progress.
+	LinkStateAssociated
+	// LinkStateKeysInstalled indicates the WPA handshake completed and
+	// encryption keys have been installed.
+	LinkStateKeysInstalled
+	// LinkStateUp indicates the connection is established and data may be sent.
+	LinkStateUp
+	// LinkStateFailed indicates the join operation failed.
+	LinkStateFailed
+	// LinkStateAuthFailed indicates authentication with the access point failed, i.e: wrong passphrase.
+	LinkStateAuthFailed
+	// LinkStateReconnecting indicates the link was lost and the firmware is attempting to reconnect.
+	LinkStateReconnecting
+)
+
+// Adaptivity selects whether energy-detect carrier sense (EDCRS) is enabled.
+// It is the adaptivity mechanism, deferring transmission while the channel
+// is occupied, required by ETSI EN 300 328.
+type Adaptivity uint8
 
 const (
-	linkStateDown = iota
-	linkStateUpWaitForSSID
-	linkStateUp
-	linkStateFailed
-	linkStateAuthFailed
-	linkStateWaitForReconnect
+	// AdaptivityDefault leaves the CLM default for the country.
+	AdaptivityDefault Adaptivity = iota
+	// AdaptivityEnabled enables energy-detect adaptivity.
+	AdaptivityEnabled
+	// AdaptivityDisabled disables energy-detect adaptivity.
+	AdaptivityDisabled
 )
 
 type outputPin func(bool)
 
+// Limits on the length of Config.RxBuffer in 32-bit words.
+// The maximum corresponds to the 2048 byte F2 packet limit.
+const (
+	MinRxBufferLen = 1024 / 4
+	MaxRxBufferLen = 2048 / 4
+)
+
+// Errors returned during Init and device acquisition are declared at package
+// level so that returning them does not allocate.
+var (
+	errNoOpMode           = errors.New("no operation mode selected")
+	errNoBTFirmware       = errors.New("bluetooth enabled but no BT firmware set")
+	errCountryCode        = errors.New("invalid country code")
+	errEDThreshold        = errors.New("energy detect threshold must be negative dBm")
+	errAdaptivity         = errors.New("invalid adaptivity setting")
+	errInitBus            = errors.New("failed to init bus")
+	errCoreNotUp          = errors.New("core not up after reset")
+	errChipClockTimeout   = errors.New("timeout waiting for chip clock")
+	errWifiStartupTimeout = errors.New("wifi startup timeout")
+	errHTClockTimeout     = errors.New("ht clock timeout")
+	errALPTimeout         = errors.New("alp clock timeout")
+	errDevUninitialized   = errors.New("device uninitialized")
+	errModeUninitialized  = errors.New("device mode uninitialized")
+	errGPIORange          = errors.New("gpio out of range")
+	errRxBufferLen        = errors.New("rx buffer length out of range")
+	errNoRxBuffer         = errors.New("rx buffer required with cyw43439.noheap")
+)
+
+// DefaultConfig returns the default configuration for Wifi operation
+// with bluetooth optionally enabled. When enableBT is set the combined
+// wifi+bluetooth firmware is selected.
+func DefaultConfig(enableBT bool) Config {
+	if enableBT {
+		return DefaultWifiBluetoothConfig()
+	}
+	return DefaultWifiConfig()
+}
+
 func DefaultBluetoothConfig() Config {
 	return Config{
-		Firmware: embassyFWbt,
-		CLM:      embassyFWclm,
-		mode:     modeInit | modeBluetooth,
+		Firmware:        embassyFWbt,
+		CLM:             embassyFWclm,
+		BTFirmware:      btFW,
+		FirmwareCRC32:   embassyFWbtCRC,
+		CLMCRC32:        embassyFWclmCRC,
+		BTFirmwareCRC32: btFWCRC,
+		mode:            modeInit | modeBluetooth,
 	}
 }
 
 func DefaultWifiBluetoothConfig() Config {
+	fw, clm := wifibtImages()
 	return Config{
-		Firmware: wifibtFW,
-		CLM:      clmFW,
-		mode:     modeInit | modeWifi | modeBluetooth,
+		Firmware:        fw,
+		CLM:             clm,
+		BTFirmware:      btFW,
+		FirmwareCRC32:   embassyFWbtCRC,
+		CLMCRC32:        embassyFWclmCRC,
+		BTFirmwareCRC32: btFWCRC,
+		mode:            modeInit | modeWifi | modeBluetooth,
 	}
 }
 
 func DefaultWifiConfig() Config {
 	return Config{
-		Firmware: wifiFW2,
-		CLM:      clmFW,
-		mode:     modeInit | modeWifi,
+		Firmware:      wifiFW2,
+		CLM:           clmFW,
+		FirmwareCRC32: wifiFW2CRC,
+		CLMCRC32:      clmFWCRC,
+		mode:          modeInit | modeWifi,
 	}
 }
 
@@ -84,7 +166,7 @@ type Device struct {
 	rwBuf         [2]uint32        // rwBuf used for read* and write* functions.
 	_sendIoctlBuf [2048 / 4]uint32 // _sendIoctlBuf used only in sendIoctl and tx.
 	_iovarBuf     [2048 / 4]uint32 // _iovarBuf used in get_iovar*, set_iovar* and write_backplane calls.
-	_rxBuf        [2048 / 4]uint32 // Used in check_status->rx calls and handle_irq.
+	_rxBuf        []uint32         // Used in check_status->rx calls and handle_irq. See Config.RxBuffer.
 	// We define headers in the Device struct to alleviate stack growth. Also used along with _sendIoctlBuf
 	lastSDPCMHeader whd.SDPCMHeader
 	auxCDCHeader    whd.CDCHeader
@@ -92,38 +174,274 @@ type Device struct {
 	rcvEth          func([]byte) error
 	rcvHCI          func([]byte) error
 	logger          *slog.Logger
+	logAttrs        [maxLogAttrs]slog.Attr // Copy of logged attributes, see logattrs.
 	_traceenabled   bool
-	state           linkState
+	state           LinkState
+	onLinkChange    func(old, new LinkState)
+	onTxCredit      func(credits uint8)
+	announceCount   int
+	// starve tracks the time without transmit credits. See credit.go.
+	starve creditWatch
+	// busAsleep is set when the bus has been put to sleep by the host. See sleep.go.
+	busAsleep  bool
+	afterSleep func()
+	beforeWake func()
+	// chip is the profile of the chip detected on Init, nil before. See chip.go.
+	chip *ChipProfile
+	// srEnabled is set when the firmware's save/restore engine is used. See saverestore.go.
+	srEnabled bool
+	// irqEnable shadows SPI_INTERRUPT_ENABLE_REGISTER if irqEnableValid and
+	// busConfig the bus configuration registers, so that they need not be
+	// read. See set_interrupt_enable and set_bus_config.
+	irqEnable      Interrupts
+	irqEnableValid bool
+	busConfig      whd.BusConfigReg
+	// respDelay is the response delay in bytes configured for reads of each function.
+	respDelay [4]uint8
+	// irqMark is the UnixNano timestamp of the pending MarkIRQ call. See irqlatency.go.
+	irqMark  atomic.Int64
+	irqStats IRQLatencyStats
+	// irqPending is set by MarkIRQ and irqRecheck on interrupts and irqMasked
+	// when MarkIRQ ignored edges during transactions. See irq.go.
+	irqPending atomic.Bool
+	irqMasked  atomic.Bool
+	// glom holds the subframe lengths of the next superframe. See glom.go.
+	glom glomDesc
+	// errs holds the most recent bus and protocol errors. See errlog.go.
+	errs errRing
+	// errsVerified is errs.n at the last bus configuration check. See bus_verify.
+	errsVerified uint32
+	// ampduBAWSize is the AMPDU block ack window size set on join. Zero selects the default.
+	ampduBAWSize uint8
+	// counters counts frames exchanged with the device. See diag.go.
+	counters Counters
+	// onPNOFound is called for networks found by scheduled scans. See pno.go.
+	onPNOFound func(PNONetwork)
+	// onNeighborReport and onBTMRequest are the 802.11k/v callbacks and
+	// neighbors holds the neighbors passed to them. See wnm.go.
+	onNeighborReport func([]Neighbor)
+	onBTMRequest     func(*BSSTransitionRequest)
+	neighbors        [maxNeighbors]Neighbor
+	// onSignal is called on signalQuality changes given by the RSSI
+	// thresholds signalLow and signalHigh. See signal.go.
+	onSignal      func(SignalQuality, int8)
+	signalLow     int8
+	signalHigh    int8
+	signalQuality SignalQuality
+	// statusLED enables the status indicator and ledOn is the LED level, if
+	// ledKnown. See statusled.go.
+	statusLED bool
+	ledOn     bool
+	ledKnown  bool
+	// onIfEvent is called on firmware interface events. See p2p.go.
+	onIfEvent func(InterfaceEvent)
+	// shapers are the transmit rate limits indexed by priority. See shaper.go.
+	shapers [8]txShaper
+	// f2MaxPacket is the F2 maximum packet size read on Init, zero if unknown. See MTU.
+	f2MaxPacket uint16
+	// evHandlers are the raw event handlers. See evhandler.go.
+	evHandlers [maxEventHandlers]eventHandler
+	// macRandom selects the MAC address randomization. See macrand.go.
+	macRandom MACRandomization
+	// events holds the received events for NextEvent if eventQueue is set. See evqueue.go.
+	eventQueue bool
+	events     eventQueue
+	// disableIRQ keeps the interrupts disabled and Poll reads the status
+	// register at most every pollInterval. See pollmode.go.
+	disableIRQ   bool
+	pollInterval time.Duration
+	lastPoll     time.Time
+	// hostEAPOL disables the firmware supplicant on joins and onEAPOL and
+	// onSupEvent receive EAPOL frames and key exchange events. See supplicant.go.
+	hostEAPOL  bool
+	onEAPOL    func([]byte)
+	onSupEvent func(SupplicantEvent)
+	// rxq holds received frames for HandleRx if Config.RxQueue is set. See rxqueue.go.
+	rxq rxQueue
+	// csum holds the enabled checksum offloads and rxSumGood is set while the
+	// receive handler is called with a frame whose checksums the firmware
+	// verified. See checksum.go.
+	csum      ChecksumOffload
+	rxSumGood bool
 }
 
 type Config struct {
 	Firmware string
 	CLM      string
-	Logger   *slog.Logger
+	// CLMReader, if set, is read for the CLM blob instead of CLM, allowing it to be
+	// stored independently of the firmware, i.e: in a separate flash partition or file.
+	// Wrap an io.ReaderAt with io.NewSectionReader to set its size.
+	CLMReader *io.SectionReader
+	// NVRAM is the board configuration downloaded with the firmware in the
+	// binary format returned by ParseNVRAM. Empty selects the Pico W's.
+	NVRAM string
+	// BTFirmware is the bluetooth patchram image downloaded to the BT core
+	// when bluetooth is enabled. It must be compatible with Firmware.
+	BTFirmware string
+	// FirmwareCRC32, CLMCRC32 and BTFirmwareCRC32 are the expected IEEE CRC-32
+	// checksums of Firmware, CLM and BTFirmware. Init refuses to download an image
+	// which does not match its checksum since a corrupted image, i.e: due to
+	// flash bit-rot, otherwise manifests as inexplicable join failures.
+	// A zero checksum skips verification of the image.
+	FirmwareCRC32   uint32
+	CLMCRC32        uint32
+	BTFirmwareCRC32 uint32
+	Logger          *slog.Logger
+	// Country is the ISO 3166 two letter country code which selects the
+	// regulatory domain from the CLM, i.e: "DE". Countries in the ETSI domain
+	// have energy-detect adaptivity (EDCCA) enabled as required by EN 300 328.
+	// Empty selects the worldwide "XX" domain.
+	Country string
+	// EDThreshold overrides the energy-detect CCA threshold in dBm used by
+	// adaptivity, i.e: -62. Zero leaves the CLM default for the country.
+	EDThreshold int8
+	// Adaptivity overrides whether energy-detect adaptivity is enabled.
+	// The zero value leaves the CLM default for the country.
+	Adaptivity Adaptivity
+	// BusMutex, if set, is held for the duration of every CYW43439 bus transaction,
+	// from asserting CS until it is raised again, and released in between so that
+	// the SPI lines may be shared with other devices such as displays or SD cards.
+	// Other users of the bus must hold the lock while using it and leave the
+	// pins configured as they found them before unlocking.
+	BusMutex sync.Locker
+	// RxBuffer, if set, is used as the buffer for received packets instead of
+	// a 2048 byte buffer allocated on the first call to Init. Its length must be in
+	// the range [MinRxBufferLen, MaxRxBufferLen]. Received frames which do not fit
+	// are dropped by the chip, so memory constrained applications which shrink it
+	// should also limit the size of frames they expect to receive. It is
+	// required when built with the cyw43439.noheap tag.
+	RxBuffer []uint32
+	// BusTimeout is the maximum duration of a single gSPI transaction. A
+	// transaction which exceeds it is aborted: the bus returns an error, CS is
+	// raised and the error is recorded in LastErrors. The Pico W PIO bus resets
+	// its state machine on abort. It is passed to buses with a
+	// SetTimeout(time.Duration) method, others ignore it. Zero means no limit.
+	BusTimeout time.Duration
+	// BusInitRetries is the amount of times Init reads the gSPI test register
+	// while waiting for the chip to respond after power up. Each read is tried
+	// in every word length and byte order so the bus is brought up even if
+	// the chip was left configured by a previous run, i.e: after a warm reset
+	// which did not power cycle it. Zero selects 128.
+	BusInitRetries int
+	// BusAutotuneMaxBaud, if non-zero, makes Init raise the gSPI clock in
+	// steps from its initial frequency up to BusAutotuneMaxBaud Hz, capped
+	// at the 50MHz maximum of the CYW43439, while test register reads and
+	// scratch register write/read cycles pass. The fastest passing frequency
+	// is kept and logged. It requires a bus whose clock can be changed, such
+	// as the PIO bus of NewPicoWDevice; otherwise it is ignored.
+	BusAutotuneMaxBaud uint32
+	// Glom enables frame aggregation by the firmware which delivers multiple
+	// frames in a single F2 transfer (superframe), reducing per-frame command
+	// overhead on the bus under heavy receive load. Superframes are up to
+	// 2048 bytes long so RxBuffer, if set, must be MaxRxBufferLen words long.
+	Glom bool
+	// CriticalSection, if set, is entered around short gSPI transactions such as
+	// register accesses, which must not be preempted midway when the bus shares
+	// pins or is bit-banged, i.e: to run correctly under TinyGo's interrupt based
+	// scheduler or with the other core accessing the same peripherals.
+	// Enter and Exit must be cheap and must not call Device methods.
+	CriticalSection CriticalSection
+	// StatusLED enables the status indicator: the LED on CYW43439 GPIO 0, the
+	// Pico W's onboard LED, is driven in a pattern for each driver state:
+	//
+	//	solid on              initializing
+	//	fast blink            scanning or joining
+	//	on, short off blinks  associated
+	//	slow blink            not associated
+	//	double blink          join failed
+	//
+	// The LED is updated from PollOne, which must be called regularly, and
+	// GPIOSet must not be used on GPIO 0.
+	StatusLED bool
+	// AnnounceCount is the number of gratuitous ARPs, each followed by the
+	// multicast group reports, sent by each call to AnnounceL2.
+	// Zero selects 3.
+	AnnounceCount int
+	// MAC overrides the hardware address programmed in the chip's OTP memory,
+	// which is used if MAC is the zero value so that every device has a
+	// unique address out of the box. It must be a unicast address.
+	MAC [6]byte
+	// MACRandomization makes Init replace the hardware address, given by MAC
+	// or the OTP, with a random one, and optionally each scan too, for privacy.
+	// See SetHardwareAddr to change the address after Init.
+	MACRandomization MACRandomization
+	// EventQueue queues the firmware events received for NextEvent. At most
+	// 16 events are queued; events received while the queue is full are
+	// dropped and counted in Counters.EventsDropped.
+	EventQueue bool
+	// DisableIRQ is set on boards whose host-wake (IRQ) line is not usable. The
+	// CYW43439 then never asserts the line, MarkIRQ and Sleep's host-wake are
+	// not available and received packets are found by calling Poll regularly.
+	DisableIRQ bool
+	// PollInterval is the minimum time between the status register reads made
+	// by Poll. Zero selects 10ms.
+	PollInterval time.Duration
+	// RxQueue, if non-zero, is the amount of received frames queued, each in
+	// a buffer of MTU bytes allocated by Init, for HandleRx to pass them to the
+	// RecvEthHandle handler outside of polling. Zero calls the handler inline
+	// while polling. See rxqueue.go for the stack usage of each context.
+	RxQueue int
 	// mode selects the enabled operation modes of the CYW43439.
 	mode opMode
 }
 
 func (d *Device) Init(cfg Config) (err error) {
-	if cfg.mode&(modeBluetooth|modeWifi) == 0 {
-		return errors.New("no operation mode selected")
+	err = checkConfig(&cfg)
+	if err != nil {
+		return err
 	}
 	err = d.acquire(0)
 	defer d.release()
 	if err != nil {
 		return err
 	}
+	return d.init(cfg)
+}
+
+// checkConfig validates cfg before any access to the device.
+func checkConfig(cfg *Config) error {
+	if cfg.mode&(modeBluetooth|modeWifi) == 0 {
+		return errNoOpMode
+	} else if cfg.mode&modeBluetooth != 0 && cfg.BTFirmware == "" {
+		return errNoBTFirmware
+	} else if cfg.Country != "" && whd.CountryInfo(cfg.Country, 0)[0] == 0 {
+		return errCountryCode
+	} else if cfg.EDThreshold > 0 {
+		return errEDThreshold
+	} else if cfg.Adaptivity > AdaptivityDisabled {
+		return errAdaptivity
+	} else if cfg.RxBuffer != nil && (len(cfg.RxBuffer) < MinRxBufferLen || len(cfg.RxBuffer) > MaxRxBufferLen) {
+		return errRxBufferLen
+	} else if !heapAlloc && cfg.RxBuffer == nil {
+		return errNoRxBuffer
+	} else if cfg.Glom && cfg.RxBuffer != nil && len(cfg.RxBuffer) < MaxRxBufferLen {
+		return errGlomRxBuffer
+	} else if cfg.MAC[0]&1 != 0 {
+		return errInvalidHardwareAddr
+	} else if cfg.NVRAM != "" && !strings.HasSuffix(cfg.NVRAM, "\x00\x00") {
+		return errNVRAMFormat
+	}
+	return verifyImages(cfg)
+}
+
+// init power cycles the device and initializes it with cfg. d.mu must be held.
+func (d *Device) init(cfg Config) (err error) {
+	d.applyConfig(&cfg)
 	d.info("Init:start")
 	start := time.Now()
 	// Reference: https://github.com/embassy-rs/embassy/blob/6babd5752e439b234151104d8d20bae32e41d714/cyw43/src/runner.rs#L76
-	d.logger = cfg.Logger
-	d._traceenabled = d.logger != nil && d.logger.Handler().Enabled(context.Background(), levelTrace)
 
 	d.backplaneWindow = 0xaaaa_aaaa
 
-	err = d.initBus(cfg.mode)
+	err = d.initBus(cfg.mode, cfg.BusInitRetries)
 	if err != nil {
-		return errjoin(errors.New("failed to init bus"), err)
+		return errjoin(errInitBus, err)
+	}
+	if cfg.BusAutotuneMaxBaud != 0 {
+		err = d.tuneBus(cfg.BusAutotuneMaxBaud)
+		if err != nil {
+			return errjoin(errInitBus, err)
+		}
 	}
 
 	d.debug("Init:alp")
@@ -139,10 +457,13 @@ func (d *Device) Init(cfg Config) (err error) {
 		}
 	}
 
+	deadline := time.Now().Add(time.Second)
 	for {
 		got, _ := d.read8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR)
 		if got&whd.SBSDIO_ALP_AVAIL != 0 {
 			break // ALP available-> clock OK.
+		} else if time.Since(deadline) > 0 {
+			return errALPTimeout
 		}
 		time.Sleep(time.Millisecond)
 	}
@@ -150,7 +471,15 @@ func (d *Device) Init(cfg Config) (err error) {
 	// Clear request for ALP.
 	d.write8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR, 0)
 
-	chip_id, _ := d.bp_read16(0x1800_0000)
+	err = d.detect_chip()
+	if err != nil {
+		return err
+	}
+	chip := d.chip
+	nvram, err := chip.check_images(&cfg)
+	if err != nil {
+		return err
+	}
 
 	// Upload firmware.
 	err = d.core_disable(whd.CORE_WLAN_ARM)
@@ -166,28 +495,30 @@ func (d *Device) Init(cfg Config) (err error) {
 		return err
 	}
 
-	// this is 4343x specific stuff: Disable remap for SRAM_3
-	d.bp_write32(whd.SOCSRAM_BASE_ADDRESS+0x10, 3)
-	d.bp_write32(whd.SOCSRAM_BASE_ADDRESS+0x44, 0)
+	if chip.SRAM3Remap {
+		// this is 4343x specific stuff: Disable remap for SRAM_3
+		d.bp_write32(whd.SOCSRAM_BASE_ADDRESS+0x10, 3)
+		d.bp_write32(whd.SOCSRAM_BASE_ADDRESS+0x44, 0)
+	}
 
-	d.debug("flashing firmware", slog.Uint64("chip_id", uint64(chip_id)), slog.Int("fwlen", len(cfg.Firmware)))
-	var ramAddr uint32 // Start at ATCM_RAM_BASE_ADDRESS = 0.
+	d.debug("flashing firmware", slog.String("chip", chip.Name), slog.Int("fwlen", len(cfg.Firmware)))
+	ramAddr := chip.RAMBase
+	ramEnd := chip.RAMBase + chip.RAMSize
 	err = d.bp_writestring(ramAddr, cfg.Firmware)
 	if err != nil {
 		return err
 	}
 
 	// Load NVRAM
-	const chipRAMSize = 512 * 1024
-	nvramLen := alignup(uint32(len(nvram43439)), 4)
-	d.debug("flashing nvram")
-	err = d.bp_writestring(ramAddr+chipRAMSize-4-nvramLen, nvram43439)
+	nvramLen := alignup(uint32(len(nvram)), 4)
+	d.debug("flashing nvram", slog.Int("len", len(nvram)))
+	err = d.bp_writestring(ramEnd-4-nvramLen, nvram)
 	if err != nil {
 		return err
 	}
 	nvramLenWords := nvramLen / 4
 	nvramLenMagic := ((^nvramLenWords) << 16) | nvramLenWords
-	d.bp_write32(ramAddr+chipRAMSize-4, nvramLenMagic)
+	d.bp_write32(ramEnd-4, nvramLenMagic)
 
 	// Start core.
 	d.debug("Init:start-core")
@@ -196,19 +527,19 @@ func (d *Device) Init(cfg Config) (err error) {
 		return err
 	}
 	if !d.core_is_up(whd.CORE_WLAN_ARM) {
-		return errors.New("core not up after reset")
+		return errCoreNotUp
 	}
 	d.debug("core up")
 
 	// Wait until HT clock is available, takes about 29ms.
-	deadline := time.Now().Add(100 * time.Millisecond)
+	deadline = time.Now().Add(100 * time.Millisecond)
 	for {
 		got, _ := d.read8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR)
 		if got&0x80 != 0 {
 			break
 		}
 		if time.Since(deadline) >= 0 {
-			return errors.New("timeout waiting for chip clock")
+			return errChipClockTimeout
 		}
 		time.Sleep(time.Millisecond)
 	}
@@ -220,7 +551,7 @@ func (d *Device) Init(cfg Config) (err error) {
 		d.bp_write32(whd.SDIO_BASE_ADDRESS+whd.SDIO_INT_HOST_MASK, whd.I_HMB_FC_CHANGE)
 	}
 
-	d.write16(FuncBus, whd.SPI_INTERRUPT_ENABLE_REGISTER, whd.F2_PACKET_AVAILABLE)
+	d.set_interrupt_enable(d.irqEnable)
 
 	// ""Lower F2 Watermark to avoid DMA Hang in F2 when SD Clock is stopped.""
 	// "Sounds scary..."
@@ -232,10 +563,15 @@ func (d *Device) Init(cfg Config) (err error) {
 	deadline = time.Now().Add(100 * time.Millisecond)
 	for !d.status().F2RxReady() {
 		if time.Since(deadline) >= 0 {
-			return errors.New("wifi startup timeout")
+			return errWifiStartupTimeout
 		}
 		time.Sleep(time.Millisecond)
 	}
+	// The F2 maximum packet size limits the frames we may send. See MTU.
+	f2info, err := d.function_info(FuncWLAN)
+	if err == nil {
+		d.f2MaxPacket = f2info.MaxPacketSize()
+	}
 
 	// Clear pulls.
 	d.write8(FuncBackplane, whd.SDIO_PULL_UP, 0)
@@ -252,39 +588,74 @@ func (d *Device) Init(cfg Config) (err error) {
 		if got&0x80 != 0 {
 			break
 		} else if time.Since(deadline) > 0 {
-			return errors.New("ht clock timeout")
+			return errHTClockTimeout
 		}
 		time.Sleep(time.Millisecond)
 	}
 
+	err = d.sr_enable()
+	if err != nil {
+		return err
+	}
+
 	err = d.log_init()
 	if err != nil {
 		return err
 	}
 	d.log_read()
+	if d.statusLED {
+		d.ledSet(true)
+	}
 	d.debug("base init done")
-	if cfg.CLM == "" {
+	if cfg.CLM == "" && cfg.CLMReader == nil {
 		return nil
 	}
 
 	// Starting polling to simulate hw interrupts
 	// go d.irqPoll()
 
-	err = d.initControl(cfg.CLM)
+	err = d.initControl(cfg)
 	if err != nil {
 		return err
 	}
 
 	err = d.set_power_management(pmPowerSave)
-	d.state = linkStateDown
+	d.setLinkState(LinkStateDown)
+	d.ledUpdate()
 	d.info("Init:done", slog.Duration("took", time.Since(start)))
 	return err
 }
 
+// applyConfig sets the driver settings of cfg which do not involve the chip.
+func (d *Device) applyConfig(cfg *Config) {
+	d.spi.mu = cfg.BusMutex
+	d.spi.setTimeout(cfg.BusTimeout)
+	d.spi.crit = cfg.CriticalSection
+	d.announceCount = cfg.AnnounceCount
+	if d.announceCount <= 0 {
+		d.announceCount = defaultAnnounceCount
+	}
+	if cfg.RxBuffer != nil {
+		d._rxBuf = cfg.RxBuffer
+	} else if d._rxBuf == nil {
+		d._rxBuf = make([]uint32, MaxRxBufferLen)
+	}
+	d.statusLED = cfg.StatusLED
+	d.macRandom = cfg.MACRandomization
+	d.eventQueue = cfg.EventQueue
+	d.rxq.setSlots(cfg.RxQueue)
+	d.disableIRQ = cfg.DisableIRQ
+	d.pollInterval = cfg.PollInterval
+	if d.pollInterval <= 0 {
+		d.pollInterval = defaultPollInterval
+	}
+	d.logger = cfg.Logger
+	d._traceenabled = d.logger != nil && d.logger.Handler().Enabled(context.Background(), levelTrace)
+}
+
 func (d *Device) GPIOSet(wlGPIO uint8, value bool) (err error) {
-	d.info("GPIOSet", slog.Uint64("wlGPIO", uint64(wlGPIO)), slog.Bool("value", value))
 	if wlGPIO >= 3 {
-		return errors.New("gpio out of range")
+		return errGPIORange
 	}
 	val0 := uint32(1) << wlGPIO
 	val1 := b2u32(value) << wlGPIO
@@ -293,6 +664,7 @@ func (d *Device) GPIOSet(wlGPIO uint8, value bool) (err error) {
 	if err != nil {
 		return err
 	}
+	d.info("GPIOSet", slog.Uint64("wlGPIO", uint64(wlGPIO)), slog.Bool("value", value))
 	return d.set_iovar2("gpioout", whd.IF_STA, val0, val1)
 }
 
@@ -319,17 +691,59 @@ func (d *Device) Reset() {
 	d.release()
 }
 
+// ResetAsync power-cycles and re-initializes the CYW43439 with cfg without
+// blocking the caller, i.e: so watchdog-sensitive main loops are not stalled
+// by the power-cycle delays and firmware download. Initialization, which itself
+// begins with a power-cycle, runs on its own goroutine and done is called with
+// its result once finished. The Device is locked before ResetAsync returns
+// so other Device methods block until initialization completes. An invalid
+// cfg is passed to done without resetting the device.
+func (d *Device) ResetAsync(cfg Config, done func(error)) {
+	err := checkConfig(&cfg)
+	if err == nil {
+		d.acquire(0) // Released by the goroutine once initialized.
+	}
+	go func() {
+		if err == nil {
+			err = d.init(cfg)
+			d.release()
+		}
+		if done != nil {
+			done(err)
+		}
+	}()
+}
+
 func (d *Device) reset() {
 	d.pwr(false)
 	time.Sleep(20 * time.Millisecond)
 	d.pwr(true)
 	time.Sleep(250 * time.Millisecond) // Wait for bus to initialize.
+	d.resetState()
+}
+
+// resetState resets the driver's view of the chip to that of a power cycled chip.
+func (d *Device) resetState() {
 	d.mode = 0
 	d.backplaneWindow = 0
 	d.state = 0
 	d.ioctlID = 0
 	d.sdpcmSeq = 0
 	d.sdpcmSeqMax = 1
+	d.busAsleep = false
+	d.srEnabled = false
+	d.chip = nil
+	d.irqEnable = 0
+	d.irqEnableValid = false
+	d.busConfig = 0
+	d.respDelay = [4]uint8{}
+	d.glom = glomDesc{}
+	d.ledKnown = false
+	d.events = eventQueue{}
+	d.rxq.head, d.rxq.n = 0, 0
+	d.csum = 0
+	d.starve.since, d.starve.reported = time.Time{}, false
+	d.f2MaxPacket = 0
 }
 
 func (d *Device) getInterrupts() Interrupts {
@@ -343,14 +757,25 @@ func (d *Device) getInterrupts() Interrupts {
 func (d *Device) acquire(mode opMode) error {
 	d.mu.Lock()
 	if mode != 0 && d.mode == 0 {
-		return errors.New("device uninitialized")
+		return errDevUninitialized
 	} else if mode&d.mode != mode {
-		return errors.New("device mode uninitialized")
+		return errModeUninitialized
+	}
+	if mode != 0 && d.busAsleep {
+		// Assert device wake before any transaction.
+		err := d.bus_wake()
+		if err != nil {
+			return err
+		}
+		return d.bus_verify()
+	} else if mode != 0 && d.bus_verify_due() {
+		return d.bus_verify()
 	}
 	return nil
 }
 
 func (d *Device) release() {
+	d.irqRecheck()
 	d.mu.Unlock()
 }
 
@@ -0,0 +1,278 @@
+package cyw43439
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements a diagnostics report of the driver state which
+// applications can ship to a backend to diagnose devices in the field. The
+// report is encoded by hand to avoid reflection based encoders on
+// microcontrollers.
+
+var errDiagFormat = errors.New("unknown diagnostics format")
+
+// Counters are the amount of frames exchanged with the CYW43439 since the Device was created.
+type Counters struct {
+	// TxPackets and TxBytes count Ethernet frames sent. TxErrors counts frames
+	// which could not be written to the bus.
+	TxPackets uint32
+	TxBytes   uint32
+	TxErrors  uint32
+	// TxShaped counts frames rejected by the rate limits set with SetTxShaping.
+	TxShaped uint32
+	// RxPackets and RxBytes count data frames received, including those
+	// dropped since no RecvEthHandle handler was set.
+	RxPackets uint32
+	RxBytes   uint32
+	// RxEvents counts asynchronous firmware events received.
+	RxEvents uint32
+	// EventsDropped counts events not queued for NextEvent since the queue was full.
+	EventsDropped uint32
+	// RxDropped counts data frames not queued for HandleRx since the queue was full.
+	RxDropped uint32
+	// TxStarved counts the times the firmware granted no transmit credits for
+	// longer than the timeout set with OnCreditStarvation.
+	TxStarved uint32
+}
+
+// Counters returns the frame counters.
+func (d *Device) Counters() Counters {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.counters
+}
+
+// DiagFormat selects the encoding of a diagnostics report.
+type DiagFormat uint8
+
+const (
+	DiagJSON DiagFormat = iota
+	DiagCBOR            // RFC 8949 Concise Binary Object Representation.
+)
+
+// DiagnosticsReport writes a snapshot of the driver state to w encoded as a
+// single JSON object or CBOR map with the following keys:
+//
+//	time         time of the snapshot (RFC 3339)
+//	firmware     firmware version string, empty if it could not be read
+//	mac          hardware address
+//	link         link state, i.e: "Up"
+//	counters     frame counters (see Counters) and total errors
+//	irq_latency  count, mean and max latency in microseconds (see IRQLatencyStats)
+//	last_errors  array of the most recent errors (see LastErrors) with time, op, err and status
+//
+// The report is produced even if the device is not initialized or does not
+// respond so that failures can be reported. Only write errors are returned.
+func (d *Device) DiagnosticsReport(w io.Writer, format DiagFormat) error {
+	if format != DiagJSON && format != DiagCBOR {
+		return errDiagFormat
+	}
+	var errs [errRingSize]BusError
+	nerrs := d.LastErrors(errs[:])
+	var ver [128]byte
+	verLen := 0
+	err := d.acquire(modeWifi)
+	if err == nil {
+		verLen, _ = d.get_iovar_n("ver", whd.IF_STA, ver[:])
+	}
+	state := d.state
+	counters := d.counters
+	errCount := d.errs.n
+	irq := d.irqStats
+	mac := d.mac
+	d.release()
+
+	e := diagEncoder{cbor: format == DiagCBOR, buf: make([]byte, 0, 512)}
+	e.beginMap(7)
+	e.key("time")
+	e.str(time.Now().Format(time.RFC3339))
+	e.key("firmware")
+	e.str(strings.TrimSpace(strings.TrimRight(string(ver[:verLen]), "\x00")))
+	e.key("mac")
+	e.str(net.HardwareAddr(mac[:]).String())
+	e.key("link")
+	e.str(state.String())
+
+	e.key("counters")
+	e.beginMap(11)
+	e.key("tx_packets")
+	e.uint(uint64(counters.TxPackets))
+	e.key("tx_bytes")
+	e.uint(uint64(counters.TxBytes))
+	e.key("tx_errors")
+	e.uint(uint64(counters.TxErrors))
+	e.key("tx_shaped")
+	e.uint(uint64(counters.TxShaped))
+	e.key("rx_packets")
+	e.uint(uint64(counters.RxPackets))
+	e.key("rx_bytes")
+	e.uint(uint64(counters.RxBytes))
+	e.key("rx_events")
+	e.uint(uint64(counters.RxEvents))
+	e.key("events_dropped")
+	e.uint(uint64(counters.EventsDropped))
+	e.key("rx_dropped")
+	e.uint(uint64(counters.RxDropped))
+	e.key("tx_starved")
+	e.uint(uint64(counters.TxStarved))
+	e.key("errors")
+	e.uint(uint64(errCount))
+	e.endMap()
+
+	e.key("irq_latency")
+	e.beginMap(3)
+	e.key("count")
+	e.uint(uint64(irq.Count))
+	e.key("mean_us")
+	e.uint(uint64(irq.Mean() / time.Microsecond))
+	e.key("max_us")
+	e.uint(uint64(irq.Max / time.Microsecond))
+	e.endMap()
+
+	e.key("last_errors")
+	e.beginArray(nerrs)
+	for _, be := range errs[:nerrs] {
+		e.beginMap(4)
+		e.key("time")
+		e.str(be.Time.Format(time.RFC3339))
+		e.key("op")
+		e.str(be.Op)
+		e.key("err")
+		if be.Err != nil {
+			e.str(be.Err.Error())
+		} else {
+			e.str("")
+		}
+		e.key("status")
+		e.uint(uint64(be.Status))
+		e.endMap()
+	}
+	e.endArray()
+	e.endMap()
+	_, err = w.Write(e.buf)
+	return err
+}
+
+// diagEncoder encodes the diagnostics report as JSON or CBOR. Map and array
+// lengths are only used by CBOR.
+type diagEncoder struct {
+	buf  []byte
+	cbor bool
+	// first is set when the next JSON value needs no separating comma.
+	first bool
+}
+
+func (e *diagEncoder) beginMap(n int) {
+	if e.cbor {
+		e.cborHead(5, uint64(n))
+		return
+	}
+	e.sep()
+	e.buf = append(e.buf, '{')
+	e.first = true
+}
+
+func (e *diagEncoder) endMap() {
+	if !e.cbor {
+		e.buf = append(e.buf, '}')
+		e.first = false
+	}
+}
+
+func (e *diagEncoder) beginArray(n int) {
+	if e.cbor {
+		e.cborHead(4, uint64(n))
+		return
+	}
+	e.sep()
+	e.buf = append(e.buf, '[')
+	e.first = true
+}
+
+func (e *diagEncoder) endArray() {
+	if !e.cbor {
+		e.buf = append(e.buf, ']')
+		e.first = false
+	}
+}
+
+func (e *diagEncoder) key(k string) {
+	e.str(k)
+	if !e.cbor {
+		e.buf = append(e.buf, ':')
+		e.first = true
+	}
+}
+
+func (e *diagEncoder) str(s string) {
+	if e.cbor {
+		e.cborHead(3, uint64(len(s)))
+		e.buf = append(e.buf, s...)
+		return
+	}
+	e.sep()
+	const hex = "0123456789abcdef"
+	e.buf = append(e.buf, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			e.buf = append(e.buf, '\\', c)
+		case c < 0x20:
+			e.buf = append(e.buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			e.buf = append(e.buf, c)
+		}
+	}
+	e.buf = append(e.buf, '"')
+}
+
+func (e *diagEncoder) uint(v uint64) {
+	if e.cbor {
+		e.cborHead(0, v)
+		return
+	}
+	e.sep()
+	var tmp [20]byte
+	i := len(tmp)
+	for {
+		i--
+		tmp[i] = byte('0' + v%10)
+		v /= 10
+		if v == 0 {
+			break
+		}
+	}
+	e.buf = append(e.buf, tmp[i:]...)
+}
+
+func (e *diagEncoder) sep() {
+	if !e.first && len(e.buf) > 0 {
+		e.buf = append(e.buf, ',')
+	}
+	e.first = false
+}
+
+// cborHead appends a CBOR data item head of major type major and argument v.
+func (e *diagEncoder) cborHead(major byte, v uint64) {
+	major <<= 5
+	switch {
+	case v < 24:
+		e.buf = append(e.buf, major|byte(v))
+	case v <= 0xff:
+		e.buf = append(e.buf, major|24, byte(v))
+	case v <= 0xffff:
+		e.buf = append(e.buf, major|25, byte(v>>8), byte(v))
+	case v <= 0xffffffff:
+		e.buf = append(e.buf, major|26, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		e.buf = append(e.buf, major|27, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
@@ -0,0 +1,18 @@
+// Package cyw43439 is a driver for the Infineon CYW43439 Wi-Fi and Bluetooth
+// chip found on the Raspberry Pi Pico W.
+//
+// # API stability
+//
+// The module follows semantic versioning. Within a major version the
+// exported identifiers of this package and of package whd are not removed
+// and keep their signatures and documented behavior, so applications and
+// network stacks built on Device keep compiling across releases.
+// Identifiers that are superseded are marked Deprecated and keep working
+// until the next major version.
+//
+// Package experimental holds features whose API is still being worked out,
+// i.e: monitor mode, and is excluded from these guarantees. So are the
+// examples, commands and internal packages. Behavior which depends on the
+// firmware, such as the set of supported iovars, is defined by the firmware
+// image in use rather than by this package.
+package cyw43439
@@ -0,0 +1,75 @@
+package cyw43439
+
+import (
+	"errors"
+	"time"
+)
+
+// This file implements a small ring of recent bus and protocol errors which
+// can be retrieved by the application to diagnose field failures after the
+// fact without having verbose logging enabled at all times.
+
+const errRingSize = 8
+
+var errBusStatus = errors.New("gSPI status reports FIFO underflow/overflow or command/data error")
+
+// BusError is a record of an error encountered while communicating with the CYW43439.
+type BusError struct {
+	// Time at which the error was recorded.
+	Time time.Time
+	// Op is the name of the operation that failed, i.e: "wlan_read".
+	Op string
+	// Err is the error returned by the operation.
+	Err error
+	// Status is the last gSPI status word read from the bus when the error occurred.
+	Status Status
+}
+
+type errRing struct {
+	buf [errRingSize]BusError
+	// n is the total amount of errors recorded.
+	n uint32
+}
+
+// LastErrors copies the most recent bus and protocol errors into dst, most recent first,
+// and returns the amount of errors copied. At most 8 errors are retained.
+func (d *Device) LastErrors(dst []BusError) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for n < len(dst) && uint32(n) < d.errs.n && n < errRingSize {
+		dst[n] = d.errs.buf[(d.errs.n-1-uint32(n))%errRingSize]
+		n++
+	}
+	return n
+}
+
+// ErrorCount returns the total amount of bus and protocol errors recorded since the Device was created,
+// including those no longer retained by LastErrors.
+func (d *Device) ErrorCount() uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.errs.n
+}
+
+// recordErr stores err in the error ring if non-nil. op should be a static string to avoid allocations.
+func (d *Device) recordErr(op string, err error) {
+	if err == nil {
+		return
+	}
+	d.errs.buf[d.errs.n%errRingSize] = BusError{
+		Time:   time.Now(),
+		Op:     op,
+		Err:    err,
+		Status: d.spi.Status(),
+	}
+	d.errs.n++
+}
+
+// recordStatus records an error if the gSPI status word flags a bus error.
+func (d *Device) recordStatus(op string, status uint32) {
+	st := Status(status)
+	if st.IsUnderflow() || st.IsOverflow() || st.HostCommandDataError() {
+		d.recordErr(op, errBusStatus)
+	}
+}
@@ -0,0 +1,143 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements event flood control: selecting which events the
+// firmware sends and pacing its scans. On slow buses, i.e: a bit-banged gSPI,
+// the host may not drain F2 fast enough during dense scans with hundreds of
+// access points in range and the firmware drops frames. Disabling unneeded
+// events and spending more time on the home channel between scanned channels
+// spreads the results out.
+
+var errEventType = errors.New("event type out of range")
+
+// ScanTiming holds the firmware's scan dwell times. Zero fields of a
+// ScanTiming passed to SetScanTiming are left unchanged.
+type ScanTiming struct {
+	// ChannelTime is the active scan dwell time per channel while associated.
+	ChannelTime time.Duration
+	// UnassocTime is the active scan dwell time per channel while not associated.
+	UnassocTime time.Duration
+	// PassiveTime is the passive scan dwell time per channel.
+	PassiveTime time.Duration
+	// HomeTime is the time spent on the home channel between scanned
+	// channels while associated. Longer home times space out scan results
+	// and leave time for data traffic.
+	HomeTime time.Duration
+	// Probes is the amount of probe requests sent per channel in active scans.
+	Probes uint8
+}
+
+// scanTimingCmds are the get ioctls of the ScanTiming fields in order, the
+// set ioctl of each is the following command.
+var scanTimingCmds = [...]whd.SDPCMCommand{
+	whd.WLC_GET_SCAN_CHANNEL_TIME, whd.WLC_GET_SCAN_UNASSOC_TIME,
+	whd.WLC_GET_SCAN_PASSIVE_TIME, whd.WLC_GET_SCAN_HOME_TIME, whd.WLC_GET_SCAN_NPROBES,
+}
+
+// ScanTiming returns the firmware's scan dwell times.
+func (d *Device) ScanTiming() (t ScanTiming, err error) {
+	err = d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return t, err
+	}
+	var v [len(scanTimingCmds)]uint32
+	for i, cmd := range scanTimingCmds {
+		v[i], err = d.get_ioctl(cmd, whd.IF_STA)
+		if err != nil {
+			return t, err
+		}
+	}
+	// Times are in milliseconds.
+	t.ChannelTime = time.Duration(v[0]) * time.Millisecond
+	t.UnassocTime = time.Duration(v[1]) * time.Millisecond
+	t.PassiveTime = time.Duration(v[2]) * time.Millisecond
+	t.HomeTime = time.Duration(v[3]) * time.Millisecond
+	t.Probes = uint8(v[4])
+	return t, nil
+}
+
+// SetScanTiming sets the firmware's scan dwell times, rounded to milliseconds.
+// Zero fields are left unchanged. It affects scans started after the call,
+// including roaming and scheduled (PNO) scans.
+func (d *Device) SetScanTiming(t ScanTiming) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetScanTiming", slog.Duration("chan", t.ChannelTime), slog.Duration("home", t.HomeTime))
+	v := [len(scanTimingCmds)]uint32{
+		uint32(t.ChannelTime.Milliseconds()), uint32(t.UnassocTime.Milliseconds()),
+		uint32(t.PassiveTime.Milliseconds()), uint32(t.HomeTime.Milliseconds()), uint32(t.Probes),
+	}
+	for i, cmd := range scanTimingCmds {
+		if v[i] == 0 {
+			continue
+		}
+		err = d.set_ioctl(cmd+1, whd.IF_STA, v[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FirmwareEventEnabled reports whether the firmware sends events of type ev to the host.
+func (d *Device) FirmwareEventEnabled(ev whd.AsyncEventType) (bool, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return false, err
+	}
+	var mask eventMask
+	if int(ev/8) >= len(mask.events) {
+		return false, errEventType
+	}
+	_, err = d.get_iovar_n("event_msgs", whd.IF_STA, mask.events[:])
+	return mask.IsEnabled(ev), err
+}
+
+// SetFirmwareEvent enables or disables sending events of type ev to the host
+// in the firmware. Disabled events are not transferred over the bus at all,
+// i.e: disabling whd.EvESCAN_RESULT during a dense scan saves bus bandwidth
+// if the results are not needed. Disabling events the driver relies on, such
+// as link events, breaks link state tracking.
+func (d *Device) SetFirmwareEvent(ev whd.AsyncEventType, enable bool) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetFirmwareEvent", slog.String("event", ev.String()), slog.Bool("enable", enable))
+	return d.set_fw_event(ev, enable)
+}
+
+// set_fw_event enables or disables ev in the firmware's event mask and the
+// local event mask. Init configures the firmware to not send some events, i.e:
+// IF events.
+func (d *Device) set_fw_event(ev whd.AsyncEventType, enable bool) error {
+	var mask eventMask
+	if int(ev/8) >= len(mask.events) {
+		return errEventType
+	}
+	_, err := d.get_iovar_n("event_msgs", whd.IF_STA, mask.events[:])
+	if err != nil {
+		return err
+	}
+	if enable {
+		mask.Enable(ev)
+		d.eventmask.Enable(ev)
+	} else {
+		mask.Disable(ev)
+		d.eventmask.Disable(ev)
+	}
+	return d.set_iovar_n("event_msgs", whd.IF_STA, mask.events[:])
+}
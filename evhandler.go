@@ -0,0 +1,74 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements handlers of raw firmware events so that events this
+// package does not model, i.e: vendor specific events of custom or newer
+// firmware builds, can be consumed by applications.
+
+var errEventHandlers = errors.New("too many event handlers")
+
+const maxEventHandlers = 4
+
+// EventHandler handles a raw firmware event. msg is the event message,
+// decoded to host byte order, and payload the event data following it. Both
+// are only valid during the call. It is called from within the polling
+// functions with the Device locked so it must not call Device methods.
+type EventHandler func(msg *whd.EventMessage, payload []byte)
+
+type eventHandler struct {
+	ev whd.AsyncEventType
+	h  EventHandler
+}
+
+// HandleEvent registers h to be called on events of type ev, replacing the
+// handler previously registered for ev, if any. A nil h removes the handler.
+// Up to 4 event types may be handled. Handlers are called before the driver
+// processes the event, for every event received regardless of whether the
+// driver handles it. Events within the firmware's event mask are enabled in
+// the firmware; see SetFirmwareEvent.
+func (d *Device) HandleEvent(ev whd.AsyncEventType, h EventHandler) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("HandleEvent", slog.Uint64("event", uint64(ev)), slog.Bool("set", h != nil))
+	free := -1
+	for i := range d.evHandlers {
+		if d.evHandlers[i].h != nil && d.evHandlers[i].ev == ev {
+			free = i
+			break
+		} else if d.evHandlers[i].h == nil && free < 0 {
+			free = i
+		}
+	}
+	if h == nil {
+		if free >= 0 && d.evHandlers[free].ev == ev {
+			d.evHandlers[free] = eventHandler{}
+		}
+		return nil
+	} else if free < 0 {
+		return errEventHandlers
+	}
+	d.evHandlers[free] = eventHandler{ev: ev, h: h}
+	if int(ev/8) < len(d.eventmask.events) {
+		return d.set_fw_event(ev, true)
+	}
+	return nil // Events outside the mask can not be filtered by the firmware.
+}
+
+// dispatchEvent calls the handler registered for the event, if any.
+func (d *Device) dispatchEvent(msg *whd.EventMessage, payload []byte) {
+	for i := range d.evHandlers {
+		if d.evHandlers[i].h != nil && d.evHandlers[i].ev == msg.EventType {
+			d.evHandlers[i].h(msg, payload)
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package cyw43439
+
+import (
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements a bounded queue of the asynchronous firmware events
+// received while polling. Events are copied into the queue so the polling
+// path never waits on the application; when the application falls behind
+// during event storms the newest events are dropped and counted.
+
+const eventQueueLen = 16
+
+// Event is an asynchronous firmware event. Event payloads are not queued;
+// events carrying data, i.e: PNO results, are also passed to their callbacks.
+type Event struct {
+	// Time is the time the event was received by the host.
+	Time   time.Time
+	Type   whd.AsyncEventType
+	Status uint32
+	Reason uint32
+	Flags  uint16
+	// Addr is the peer address of the event, i.e: the BSSID on joins.
+	Addr  [6]byte
+	IfIdx uint8
+}
+
+// eventQueue is a ring buffer of events.
+type eventQueue struct {
+	buf  [eventQueueLen]Event
+	head uint8 // Index of the oldest event.
+	n    uint8
+}
+
+// NextEvent removes and returns the oldest queued event. ok is false if no
+// event is queued or Config.EventQueue is not set. Events are queued while
+// polling so PollOne must be called regularly.
+func (d *Device) NextEvent() (ev Event, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := &d.events
+	if q.n == 0 {
+		return Event{}, false
+	}
+	ev = q.buf[q.head]
+	q.head = (q.head + 1) % eventQueueLen
+	q.n--
+	return ev, true
+}
+
+// queueEvent appends msg to the event queue or counts it as dropped if full.
+func (d *Device) queueEvent(msg *whd.EventMessage) {
+	if !d.eventQueue {
+		return
+	}
+	q := &d.events
+	if q.n == eventQueueLen {
+		d.counters.EventsDropped++
+		return
+	}
+	q.buf[(q.head+q.n)%eventQueueLen] = Event{
+		Time:   time.Now(),
+		Type:   msg.EventType,
+		Status: msg.Status,
+		Reason: msg.Reason,
+		Flags:  msg.Flags,
+		Addr:   msg.Addr,
+		IfIdx:  msg.IFIdx,
+	}
+	q.n++
+}
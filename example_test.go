@@ -0,0 +1,172 @@
+//go:build cy43nopio || !rp2040
+
+package cyw43439_test
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/soypat/cyw43439"
+)
+
+// The examples are compiled by go test but not run since they require the
+// CYW43439. On the Pico W the Device is created with NewPicoWDevice instead
+// of newDevice.
+
+// nopBus and nopPin stand in for the gSPI command bus and pins of the board.
+type nopBus struct{}
+
+type nopPin struct{}
+
+func (nopPin) Set(bool) {}
+
+func (nopBus) CmdRead(cmd uint32, buf []uint32) error  { return nil }
+func (nopBus) CmdWrite(cmd uint32, buf []uint32) error { return nil }
+func (nopBus) LastStatus() uint32                      { return 0 }
+
+func newDevice() *cyw43439.Device {
+	return cyw43439.NewWithHAL(nopPin{}, nopPin{}, nopBus{})
+}
+
+func ExampleDevice_Init() {
+	dev := newDevice()
+	dev.SetLogger(slog.Default())
+	err := dev.Init(cyw43439.DefaultWifiConfig())
+	if err != nil {
+		panic(err)
+	}
+	mac, _ := dev.HardwareAddr6()
+	println("initialized", net.HardwareAddr(mac[:]).String())
+}
+
+func ExampleDevice_StartPNO() {
+	dev := newDevice()
+	err := dev.Init(cyw43439.DefaultWifiConfig())
+	if err != nil {
+		panic(err)
+	}
+	found := make(chan cyw43439.PNONetwork, 1)
+	dev.OnPNONetworkFound(func(n cyw43439.PNONetwork) {
+		select {
+		case found <- n:
+		default:
+		}
+	})
+	err = dev.StartPNO(cyw43439.PNOConfig{SSIDs: []string{"home", "office"}})
+	if err != nil {
+		panic(err)
+	}
+	for {
+		// The firmware raises the event handled by the callback on a poll.
+		dev.PollOne()
+		select {
+		case n := <-found:
+			dev.StopPNO()
+			println("found", n.SSID, n.RSSI)
+			return
+		default:
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+func ExampleDevice_JoinWPA2() {
+	dev := newDevice()
+	err := dev.Init(cyw43439.DefaultWifiConfig())
+	if err != nil {
+		panic(err)
+	}
+	dev.OnLinkStateChange(func(old, new cyw43439.LinkState) {
+		println("link", old.String(), "->", new.String())
+	})
+	for retries := 0; retries < 3; retries++ {
+		err = dev.JoinWPA2("ssid", "passphrase")
+		if err == nil {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ExampleDevice_SendEth() {
+	dev := newDevice()
+	err := dev.Init(cyw43439.DefaultWifiConfig())
+	if err != nil {
+		panic(err)
+	}
+	err = dev.JoinWPA2("ssid", "passphrase")
+	if err != nil {
+		panic(err)
+	}
+	dev.RecvEthHandle(func(pkt []byte) error {
+		// pkt is only valid during the call; copy it to keep it.
+		println("received", len(pkt), "bytes")
+		return nil
+	})
+	mac, _ := dev.HardwareAddr6()
+	// Broadcast an Ethernet frame with a local experimental EtherType.
+	var frame [60]byte
+	copy(frame[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[6:12], mac[:])
+	frame[12], frame[13] = 0x88, 0xb5
+	copy(frame[14:], "hello")
+	err = dev.SendEth(frame[:])
+	if err != nil {
+		panic(err)
+	}
+	for {
+		// Received frames are passed to the handler from within PollOne.
+		gotPacket, err := dev.PollOne()
+		if err != nil {
+			panic(err)
+		}
+		if !gotPacket {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func ExampleDevice_StartAP() {
+	dev := newDevice()
+	err := dev.Init(cyw43439.DefaultWifiConfig())
+	if err != nil {
+		panic(err)
+	}
+	channel, err := dev.AutoChannel()
+	if err != nil {
+		channel = 6
+	}
+	err = dev.StartAP("pico-ap", "passphrase", channel)
+	if err != nil {
+		panic(err)
+	}
+	defer dev.StopAP()
+	// Serve clients with RecvEthHandle and SendEth as in station mode.
+	for i := 0; i < 100; i++ {
+		dev.PollOne()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func ExampleParseNVRAM() {
+	// NVRAM as found in a vendor C header.
+	const header = `static const uint8_t wifi_nvram_4343[] =
+	"manfid=0x2d0" "\x00"
+	"boardnum=22" "\x00"
+	"\x00\x00";`
+	nvram, err := cyw43439.ParseNVRAM(header)
+	if err != nil {
+		panic(err)
+	}
+	dev := newDevice()
+	cfg := cyw43439.DefaultWifiConfig()
+	cfg.NVRAM = nvram
+	err = dev.Init(cfg)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -26,9 +26,26 @@ type SetupConfig struct {
 	UDPPorts uint16
 	// Number of TCP ports to open for the stack.
 	TCPPorts uint16
+	// IP is the static addressing of the stack. If IP.Addr is set DHCP is skipped.
+	IP cyw43439.IPConfig
 }
 
-func SetupWithDHCP(cfg SetupConfig) (*stacks.DHCPClient, *stacks.PortStack, *cyw43439.Device, error) {
+// Addressing is the result of SetupWithDHCP.
+type Addressing struct {
+	// IP is the addressing in use, either the static SetupConfig.IP or the
+	// one obtained with DHCP.
+	IP cyw43439.IPConfig
+	// DHCP is the client which obtained IP. It is nil with static addressing.
+	DHCP *stacks.DHCPClient
+}
+
+// WifiCredentials returns the SSID and passphrase set in secrets.go for
+// examples which join the network without SetupWithDHCP.
+func WifiCredentials() (string, string) {
+	return ssid, pass
+}
+
+func SetupWithDHCP(cfg SetupConfig) (Addressing, *stacks.PortStack, *cyw43439.Device, error) {
 	cfg.UDPPorts++ // Add extra UDP port for DHCP client.
 	logger := cfg.Logger
 	if logger == nil {
@@ -41,7 +58,7 @@ func SetupWithDHCP(cfg SetupConfig) (*stacks.DHCPClient, *stacks.PortStack, *cyw
 	if cfg.RequestedIP != "" {
 		reqAddr, err = netip.ParseAddr(cfg.RequestedIP)
 		if err != nil {
-			return nil, nil, nil, err
+			return Addressing{}, nil, nil, err
 		}
 	}
 
@@ -54,7 +71,7 @@ func SetupWithDHCP(cfg SetupConfig) (*stacks.DHCPClient, *stacks.PortStack, *cyw
 
 	err = dev.Init(wificfg)
 	if err != nil {
-		return nil, nil, nil, errors.New("wifi init failed:" + err.Error())
+		return Addressing{}, nil, nil, errors.New("wifi init failed:" + err.Error())
 	}
 	logger.Info("cyw43439:Init", slog.Duration("duration", time.Since(devInitTime)))
 	if len(pass) == 0 {
@@ -87,15 +104,30 @@ func SetupWithDHCP(cfg SetupConfig) (*stacks.DHCPClient, *stacks.PortStack, *cyw
 	// Begin asynchronous packet handling.
 	go nicLoop(dev, stack)
 
-	// Perform DHCP request.
+	if !cfg.IP.IsDHCP() {
+		prefix, err := cfg.IP.Prefix()
+		if err != nil {
+			return Addressing{}, stack, dev, err
+		}
+		logger.Info("assigning static IP", slog.String("ip", prefix.String()), slog.String("gateway", cfg.IP.Gateway.String()))
+		stack.SetAddr(prefix.Addr())
+		err = dev.AnnounceL2(mac, prefix.Addr())
+		if err != nil {
+			logger.Error("announce", slog.String("err", err.Error()))
+		}
+		return Addressing{IP: cfg.IP}, stack, dev, nil
+	}
 	dhcpClient := stacks.NewDHCPClient(stack, dhcp.DefaultClientPort)
+	addressing := Addressing{DHCP: dhcpClient}
+
+	// Perform DHCP request.
 	err = dhcpClient.BeginRequest(stacks.DHCPRequestConfig{
 		RequestedAddr: reqAddr,
 		Xid:           uint32(time.Now().Nanosecond()),
 		Hostname:      cfg.Hostname,
 	})
 	if err != nil {
-		return nil, stack, dev, errors.New("dhcp begin request:" + err.Error())
+		return addressing, stack, dev, errors.New("dhcp begin request:" + err.Error())
 	}
 	i := 0
 	for dhcpClient.State() != dhcp.StateBound {
@@ -104,23 +136,25 @@ func SetupWithDHCP(cfg SetupConfig) (*stacks.DHCPClient, *stacks.PortStack, *cyw
 		time.Sleep(time.Second / 2)
 		if i > 15 {
 			if !reqAddr.IsValid() {
-				return dhcpClient, stack, dev, errors.New("DHCP did not complete and no static IP was requested")
+				return addressing, stack, dev, errors.New("DHCP did not complete and no static IP was requested")
 			}
 			logger.Info("DHCP did not complete, assigning static IP", slog.String("ip", cfg.RequestedIP))
 			stack.SetAddr(reqAddr)
-			return dhcpClient, stack, dev, nil
+			addressing.IP.Addr = reqAddr
+			return addressing, stack, dev, nil
 		}
 	}
-	var primaryDNS netip.Addr
-	dnsServers := dhcpClient.DNSServers()
-	if len(dnsServers) > 0 {
-		primaryDNS = dnsServers[0]
-	}
 	ip := dhcpClient.Offer()
+	addressing.IP = cyw43439.IPConfig{
+		Addr:    ip,
+		Mask:    cyw43439.IPMask(int(dhcpClient.CIDRBits())),
+		Gateway: dhcpClient.Router(),
+	}
+	copy(addressing.IP.DNS[:], dhcpClient.DNSServers())
 	logger.Info("DHCP complete",
 		slog.Uint64("cidrbits", uint64(dhcpClient.CIDRBits())),
 		slog.String("ourIP", ip.String()),
-		slog.String("dns", primaryDNS.String()),
+		slog.String("dns", addressing.IP.DNS[0].String()),
 		slog.String("broadcast", dhcpClient.BroadcastAddr().String()),
 		slog.String("gateway", dhcpClient.Gateway().String()),
 		slog.String("router", dhcpClient.Router().String()),
@@ -132,7 +166,12 @@ func SetupWithDHCP(cfg SetupConfig) (*stacks.DHCPClient, *stacks.PortStack, *cyw
 	)
 
 	stack.SetAddr(ip) // It's important to set the IP address after DHCP completes.
-	return dhcpClient, stack, dev, nil
+	// Announce ourselves so the first packets sent to us are not lost.
+	err = dev.AnnounceL2(mac, ip)
+	if err != nil {
+		logger.Error("announce", slog.String("err", err.Error()))
+	}
+	return addressing, stack, dev, nil
 }
 
 // ResolveHardwareAddr obtains the hardware address of the given IP address.
@@ -165,22 +204,20 @@ func ResolveHardwareAddr(stack *stacks.PortStack, ip netip.Addr) ([6]byte, error
 type Resolver struct {
 	stack     *stacks.PortStack
 	dns       *stacks.DNSClient
-	dhcp      *stacks.DHCPClient
 	dnsaddr   netip.Addr
 	dnshwaddr [6]byte
 }
 
-func NewResolver(stack *stacks.PortStack, dhcp *stacks.DHCPClient) (*Resolver, error) {
-	dnsc := stacks.NewDNSClient(stack, dns.ClientPort)
-	dnsaddrs := dhcp.DNSServers()
-	if len(dnsaddrs) > 0 && !dnsaddrs[0].IsValid() {
-		return nil, errors.New("dns addr obtained via DHCP not valid")
+// NewResolver returns a DNS resolver using the primary DNS server of ip.
+func NewResolver(stack *stacks.PortStack, ip cyw43439.IPConfig) (*Resolver, error) {
+	if !ip.DNS[0].IsValid() {
+		return nil, errors.New("no valid dns addr configured")
 	}
+	dnsc := stacks.NewDNSClient(stack, dns.ClientPort)
 	return &Resolver{
 		stack:   stack,
-		dhcp:    dhcp,
 		dns:     dnsc,
-		dnsaddr: dnsaddrs[0],
+		dnsaddr: ip.DNS[0],
 	}, nil
 }
 
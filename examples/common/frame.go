@@ -0,0 +1,92 @@
+package common
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+// Header lengths and ether types used to build frames for the raw data path
+// with SendEth, i.e. when running without a network stack.
+const (
+	EthHeaderLen  = 14
+	ARPLen        = 28
+	IPv4HeaderLen = 20
+
+	EtherTypeIPv4 = 0x0800
+	EtherTypeARP  = 0x0806
+)
+
+// BroadcastMAC is the Ethernet broadcast address.
+var BroadcastMAC = [6]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// PutEthernet writes an Ethernet header into buf.
+func PutEthernet(buf []byte, src, dst [6]byte, etherType uint16) {
+	copy(buf[0:6], dst[:])
+	copy(buf[6:12], src[:])
+	binary.BigEndian.PutUint16(buf[12:], etherType)
+}
+
+// PutARPRequest writes a broadcast ARP request for target into buf and returns the frame length.
+func PutARPRequest(buf []byte, src [6]byte, srcIP, target netip.Addr) int {
+	PutEthernet(buf, src, BroadcastMAC, EtherTypeARP)
+	arp := buf[EthHeaderLen : EthHeaderLen+ARPLen]
+	binary.BigEndian.PutUint16(arp[0:], 1)             // Hardware type: Ethernet.
+	binary.BigEndian.PutUint16(arp[2:], EtherTypeIPv4) // Protocol type.
+	arp[4] = 6                                         // Hardware address length.
+	arp[5] = 4                                         // Protocol address length.
+	binary.BigEndian.PutUint16(arp[6:], 1)             // Operation: request.
+	copy(arp[8:14], src[:])
+	ip := srcIP.As4()
+	copy(arp[14:18], ip[:])
+	copy(arp[18:24], []byte{0, 0, 0, 0, 0, 0}) // Target hardware address unknown.
+	ip = target.As4()
+	copy(arp[24:28], ip[:])
+	return EthHeaderLen + ARPLen
+}
+
+// ParseARPReply returns the sender addresses of the ARP reply in the Ethernet frame pkt.
+// ok is false if pkt is not an ARP reply.
+func ParseARPReply(pkt []byte) (mac [6]byte, ip netip.Addr, ok bool) {
+	if len(pkt) < EthHeaderLen+ARPLen || binary.BigEndian.Uint16(pkt[12:]) != EtherTypeARP {
+		return mac, ip, false
+	}
+	arp := pkt[EthHeaderLen:]
+	const opReply = 2
+	if binary.BigEndian.Uint16(arp[6:]) != opReply {
+		return mac, ip, false
+	}
+	copy(mac[:], arp[8:14])
+	return mac, netip.AddrFrom4([4]byte(arp[14:18])), true
+}
+
+// PutIPv4 writes an IPv4 header without options into buf for a payload of
+// length plen and protocol proto.
+func PutIPv4(buf []byte, srcIP, dstIP netip.Addr, proto uint8, plen int) {
+	ip := buf[:IPv4HeaderLen]
+	ip[0] = 0x45 // Version 4, 5 word header.
+	ip[1] = 0    // DSCP/ECN.
+	binary.BigEndian.PutUint16(ip[2:], uint16(IPv4HeaderLen+plen))
+	binary.BigEndian.PutUint32(ip[4:], 0) // ID, flags and fragment offset.
+	ip[8] = 64                            // TTL.
+	ip[9] = proto
+	binary.BigEndian.PutUint16(ip[10:], 0)
+	srcIP4, dstIP4 := srcIP.As4(), dstIP.As4()
+	copy(ip[12:16], srcIP4[:])
+	copy(ip[16:20], dstIP4[:])
+	binary.BigEndian.PutUint16(ip[10:], Checksum(ip))
+}
+
+// Checksum calculates the internet checksum (RFC 1071) of b.
+func Checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 != 0 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
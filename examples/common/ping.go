@@ -0,0 +1,159 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/seqs/stacks"
+)
+
+// PingStats are the results of a call to Ping.
+type PingStats struct {
+	Sent     int
+	Received int
+	MinRTT   time.Duration
+	MaxRTT   time.Duration
+	// AvgRTT is the average round trip time of received replies.
+	AvgRTT time.Duration
+}
+
+var errARPTimeout = errors.New("ping: ARP resolution timeout")
+
+const (
+	icmpHeaderLen = 8
+	pingDataLen   = 32
+
+	protoICMP = 1
+	pingID    = 0xc743
+)
+
+// Ping sends count ICMP echo requests to target over the driver's raw data path,
+// waiting up to timeout for each reply, and returns round trip statistics.
+// target must be on the local network since no routing is performed.
+//
+// stack is the network stack set up by SetupWithDHCP. While Ping runs every
+// received frame is still passed on to the stack and its receive handler is
+// restored on return. Ping does not poll the device itself and relies on the
+// loop started by SetupWithDHCP to deliver replies:
+//
+//	stats, err := common.Ping(dev, stack, gatewayIP, 4, time.Second)
+func Ping(dev *cyw43439.Device, stack *stacks.PortStack, target netip.Addr, count int, timeout time.Duration) (stats PingStats, err error) {
+	mac, err := dev.HardwareAddr6()
+	if err != nil {
+		return stats, err
+	}
+	var (
+		// mu guards targetMAC and gotSeq which are written by the handler
+		// from the goroutine polling the device.
+		mu        sync.Mutex
+		targetMAC [6]byte
+		gotSeq    int = -1
+		buf       [EthHeaderLen + IPv4HeaderLen + icmpHeaderLen + pingDataLen]byte
+	)
+	defer dev.RecvEthHandle(stack.RecvEth)
+	dev.RecvEthHandle(func(pkt []byte) error {
+		if sender, ip, ok := ParseARPReply(pkt); ok && ip == target {
+			mu.Lock()
+			targetMAC = sender
+			mu.Unlock()
+		} else if seq, ok := parseEchoReply(pkt, target); ok {
+			mu.Lock()
+			gotSeq = seq
+			mu.Unlock()
+		}
+		return stack.RecvEth(pkt)
+	})
+	waitUntil := func(done func() bool) bool {
+		deadline := time.Now().Add(timeout)
+		for {
+			mu.Lock()
+			ok := done()
+			mu.Unlock()
+			if ok {
+				return true
+			} else if time.Until(deadline) <= 0 {
+				return false
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Resolve target's MAC address.
+	localIP := stack.Addr()
+	n := PutARPRequest(buf[:], mac, localIP, target)
+	err = dev.SendEth(buf[:n])
+	if err != nil {
+		return stats, err
+	}
+	if !waitUntil(func() bool { return targetMAC != [6]byte{} }) {
+		return stats, errARPTimeout
+	}
+
+	var total time.Duration
+	for seq := 0; seq < count; seq++ {
+		n := putEchoRequest(buf[:], mac, targetMAC, localIP, target, uint16(seq))
+		start := time.Now()
+		err = dev.SendEth(buf[:n])
+		if err != nil {
+			return stats, err
+		}
+		stats.Sent++
+		if !waitUntil(func() bool { return gotSeq == seq }) {
+			continue
+		}
+		rtt := time.Since(start)
+		stats.Received++
+		total += rtt
+		if stats.MinRTT == 0 || rtt < stats.MinRTT {
+			stats.MinRTT = rtt
+		}
+		if rtt > stats.MaxRTT {
+			stats.MaxRTT = rtt
+		}
+	}
+	if stats.Received > 0 {
+		stats.AvgRTT = total / time.Duration(stats.Received)
+	}
+	return stats, nil
+}
+
+// parseEchoReply returns the sequence number of the ICMP echo reply from
+// target sent in response to Ping's echo requests.
+func parseEchoReply(pkt []byte, target netip.Addr) (seq int, ok bool) {
+	if len(pkt) < EthHeaderLen || binary.BigEndian.Uint16(pkt[12:]) != EtherTypeIPv4 {
+		return 0, false
+	}
+	ip := pkt[EthHeaderLen:]
+	if len(ip) < IPv4HeaderLen+icmpHeaderLen || ip[9] != protoICMP || netip.AddrFrom4([4]byte(ip[12:16])) != target {
+		return 0, false
+	}
+	icmp := ip[int(ip[0]&0xf)*4:]
+	const echoReply = 0
+	if len(icmp) < icmpHeaderLen || icmp[0] != echoReply || binary.BigEndian.Uint16(icmp[4:]) != pingID {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(icmp[6:])), true
+}
+
+// putEchoRequest writes an ICMP echo request frame into buf and returns its length.
+func putEchoRequest(buf []byte, src, dst [6]byte, srcIP, dstIP netip.Addr, seq uint16) int {
+	PutEthernet(buf, src, dst, EtherTypeIPv4)
+	PutIPv4(buf[EthHeaderLen:], srcIP, dstIP, protoICMP, icmpHeaderLen+pingDataLen)
+
+	icmp := buf[EthHeaderLen+IPv4HeaderLen : EthHeaderLen+IPv4HeaderLen+icmpHeaderLen+pingDataLen]
+	const echoRequest = 8
+	icmp[0] = echoRequest
+	icmp[1] = 0
+	binary.BigEndian.PutUint16(icmp[2:], 0)
+	binary.BigEndian.PutUint16(icmp[4:], pingID)
+	binary.BigEndian.PutUint16(icmp[6:], seq)
+	for i := range icmp[icmpHeaderLen:] {
+		icmp[icmpHeaderLen+i] = byte(i)
+	}
+	binary.BigEndian.PutUint16(icmp[2:], Checksum(icmp))
+	return EthHeaderLen + IPv4HeaderLen + icmpHeaderLen + pingDataLen
+}
@@ -30,13 +30,16 @@ const (
 	MOCK_DAT = machine.GPIO4
 	MOCK_CLK = machine.GPIO5
 	MOCK_CS  = machine.GPIO6
+
+	// SPI clock frequency of the bit-bang bus. Lower it if your logic analyzer's
+	// sample rate is too low to capture the signals.
+	SPI_FREQ = 2_000_000
 )
 
 var bus = &SPIbb{
-	SCK:   CLK,
-	SDI:   DATA_IN,
-	SDO:   DATA_OUT,
-	Delay: 1,
+	SCK: CLK,
+	SDI: DATA_IN,
+	SDO: DATA_OUT,
 	MockTo: &SPIbb{
 		SCK: MOCK_CLK,
 		SDI: MOCK_DAT,
@@ -45,9 +48,14 @@ var bus = &SPIbb{
 }
 
 func main() {
-	bus.Configure()
 	WL_REG_ON.Configure(machine.PinConfig{Mode: machine.PinOutput})
 	CS.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	CS.High()
+	MOCK_CS.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	MOCK_CS.High()
+	bus.Configure()
+	freq := bus.SetFrequency(SPI_FREQ)
+	println("bit-bang SPI frequency:", freq, "Hz delay:", bus.Delay)
 	cs := func(b bool) {
 		CS.Set(b)
 		MOCK_CS.Set(b)
@@ -1,4 +1,5 @@
 //go:build tinygo
+
 package main
 
 import (
@@ -6,6 +7,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"machine"
+	"time"
 	"unsafe"
 )
 
@@ -18,14 +20,20 @@ var order = binary.LittleEndian
 // SPIbb is a dumb bit-bang implementation of SPI protocol that is hardcoded
 // to mode 0.
 type SPIbb struct {
-	SCK   machine.Pin
-	SDI   machine.Pin
-	SDO   machine.Pin
+	SCK machine.Pin
+	SDI machine.Pin
+	SDO machine.Pin
+	// Delay is the amount of busy loop iterations per quarter clock cycle.
+	// Use SetFrequency to set it from a target SCK frequency.
 	Delay uint32
 	// If MockTo is not nil then clock, SDI and SDO writes/reads are duplicated to it.
 	MockTo *SPIbb
 	buf    [4]byte
 	status uint32
+	// Calibration results, see Calibrate.
+	loopPs       uint32 // Duration of a single Delay iteration in picoseconds.
+	overheadPs   uint32 // Duration of a bit transfer excluding Delay iterations in picoseconds.
+	calibratedAt uint32 // CPU frequency at time of calibration.
 }
 
 // Configure sets up the SCK and SDO pins as outputs and sets them low
@@ -197,6 +205,75 @@ func (s *SPIbb) delay(mocking bool) {
 	}
 }
 
+// Calibrate measures the bit period achieved by the current CPU clock with two
+// Delay values to derive the duration of a single Delay iteration and the fixed
+// overhead of a bit transfer. It is called by SetFrequency when the CPU frequency
+// changed since the last calibration. SCK and SDO toggle during calibration
+// so chip select must be deasserted.
+func (s *SPIbb) Calibrate() {
+	const (
+		n      = 256 // Bytes transferred per measurement.
+		bits   = 8 * n
+		d0, d1 = 1, 33
+	)
+	delay := s.Delay
+	s.Delay = d0
+	t0 := s.measure(n)
+	s.Delay = d1
+	t1 := s.measure(n)
+	s.Delay = delay
+	// A bit transfer consists of 4 delay calls, see bitTransfer.
+	loopPs := (t1 - t0).Nanoseconds() * 1000 / (4 * (d1 - d0) * bits)
+	if loopPs <= 0 {
+		loopPs = 1
+	}
+	overheadPs := t0.Nanoseconds()*1000/bits - 4*d0*loopPs
+	if overheadPs < 0 {
+		overheadPs = 0
+	}
+	s.loopPs = uint32(loopPs)
+	s.overheadPs = uint32(overheadPs)
+	s.calibratedAt = machine.CPUFrequency()
+}
+
+func (s *SPIbb) measure(n int) time.Duration {
+	mock := s.MockTo != nil
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		s.transfer(0xa5, mock)
+	}
+	return time.Since(start)
+}
+
+// SetFrequency sets Delay so the SCK frequency is as close as possible to hz
+// without exceeding it, unless hz is above the maximum achievable frequency.
+// It returns the achieved frequency. The delay count is derived for the current
+// CPU frequency so changing the clock configuration does not silently change
+// the SPI clock. SetFrequency must be called after Configure.
+func (s *SPIbb) SetFrequency(hz uint32) (achieved uint32) {
+	if s.calibratedAt != machine.CPUFrequency() {
+		s.Calibrate()
+	}
+	periodPs := 1_000_000_000_000 / uint64(hz)
+	overhead, quarterLoop := uint64(s.overheadPs), 4*uint64(s.loopPs)
+	delay := uint64(1)
+	if periodPs > overhead+quarterLoop {
+		delay = (periodPs - overhead + quarterLoop - 1) / quarterLoop // Round up to not exceed hz.
+	}
+	s.Delay = uint32(delay)
+	return s.Frequency()
+}
+
+// Frequency returns the SCK frequency achieved with the current Delay
+// as measured by the last calibration. It returns 0 if not calibrated.
+func (s *SPIbb) Frequency() uint32 {
+	if s.loopPs == 0 {
+		return 0
+	}
+	periodPs := uint64(s.overheadPs) + 4*uint64(s.Delay)*uint64(s.loopPs)
+	return uint32(1_000_000_000_000 / periodPs)
+}
+
 func (s *SPIbb) SDOSet(b, mocking bool) {
 	s.SDO.Set(b)
 	if mocking {
@@ -18,13 +18,13 @@ func main() {
 	logger := slog.New(slog.NewTextHandler(machine.Serial, &slog.HandlerOptions{
 		Level: slog.LevelDebug,
 	}))
-	client, _, _, err := common.SetupWithDHCP(common.SetupConfig{
+	addressing, _, _, err := common.SetupWithDHCP(common.SetupConfig{
 		Hostname:    "DHCP-pico",
 		Logger:      logger,
 		RequestedIP: "10.94.2.0",
 		UDPPorts:    1,
 	})
-	if client.State() != dhcp.StateBound {
+	if addressing.DHCP == nil || addressing.DHCP.State() != dhcp.StateBound {
 		println("DHCP did not complete succesfully")
 	}
 	if err != nil {
@@ -0,0 +1,116 @@
+package main
+
+// This example bridges the CYW43439's HCI interface to USB-CDC using
+// H4 (UART) framing so that the Pico W may be used as a standard
+// bluetooth controller from a host PC, i.e: via btattach on Linux:
+//
+//	sudo btattach -B /dev/ttyACM0 -P h4
+
+import (
+	"machine"
+	"time"
+
+	"github.com/soypat/cyw43439"
+)
+
+// H4 packet types.
+const (
+	h4Command = 0x01
+	h4ACL     = 0x02
+	h4SCO     = 0x03
+	h4Event   = 0x04
+)
+
+func main() {
+	time.Sleep(time.Second)
+	dev := cyw43439.NewPicoWDevice()
+	cfg := cyw43439.DefaultBluetoothConfig()
+	err := dev.Init(cfg)
+	if err != nil {
+		panic("dev Init:" + err.Error())
+	}
+	hci, err := dev.HCITransport()
+	if err != nil {
+		panic("HCITransport:" + err.Error())
+	}
+	usb := machine.USBCDC
+	var (
+		rxbuf   [512]byte
+		pkt     [1024]byte
+		pktlen  int
+		pktneed int
+	)
+	for {
+		idle := true
+		// Controller -> host.
+		for hci.Buffered() > 0 {
+			idle = false
+			n, err := hci.Read(rxbuf[:])
+			if err != nil {
+				println("hci read:", err.Error())
+				break
+			}
+			usb.Write(rxbuf[:n])
+		}
+
+		// Host -> controller. Accumulate a whole H4 packet before sending it.
+		for usb.Buffered() > 0 {
+			idle = false
+			c, _ := usb.ReadByte()
+			if pktlen == len(pkt) {
+				println("dropping oversized packet")
+				pktlen, pktneed = 0, 0
+			}
+			pkt[pktlen] = c
+			pktlen++
+			if pktneed == 0 {
+				pktneed = h4HeaderLen(pkt[0])
+				if pktneed == 0 {
+					println("bad H4 packet type", pkt[0])
+					pktlen = 0
+				}
+				continue
+			}
+			if pktlen == h4HeaderLen(pkt[0]) {
+				// Header complete, add payload length once.
+				pktneed += h4PayloadLen(pkt[:pktlen])
+			}
+			if pktlen == pktneed {
+				_, err := hci.Write(pkt[:pktlen])
+				if err != nil {
+					println("hci write:", err.Error())
+				}
+				pktlen, pktneed = 0, 0
+			}
+		}
+		if idle {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// h4HeaderLen returns the length of the H4 packet header including the packet type byte.
+func h4HeaderLen(packetType byte) int {
+	switch packetType {
+	case h4Command, h4SCO:
+		return 4
+	case h4ACL:
+		return 5
+	case h4Event:
+		return 3
+	}
+	return 0
+}
+
+// h4PayloadLen returns the length of the payload following a complete H4 header.
+func h4PayloadLen(hdr []byte) int {
+	switch hdr[0] {
+	case h4Command, h4SCO:
+		return int(hdr[3])
+	case h4ACL:
+		return int(hdr[3]) | int(hdr[4])<<8
+	case h4Event:
+		return int(hdr[2])
+	}
+	return 0
+}
@@ -0,0 +1,339 @@
+package main
+
+// This example is the device side of the hwtest harness: a line based console
+// over USB serial which runs driver operations on request so that driver
+// changes can be regression tested on real hardware from the host. Each
+// command line is answered with a single line starting with "OK", optionally
+// followed by a result, or "ERR" followed by the error. Arguments are space
+// separated so SSIDs and passphrases may not contain spaces.
+//
+//	init                    initialize the CYW43439 for Wi-Fi
+//	mac                     print the MAC address
+//	scan <ssid> [timeout]   wait for ssid to be found by a scheduled scan, prints RSSI
+//	join <ssid> [pass]      join a network
+//	disconnect              leave the joined network
+//	link                    print the link state
+//	send <n>                broadcast n Ethernet frames
+//	poll <ms>               poll for ms milliseconds, prints the amount of frames received
+//	ap <ssid> <pass> <ch>   start an access point
+//	stopap                  stop the access point
+//	phy                     print the per antenna RSSI, noise and carrier sense threshold in dBm
+//	diag                    print the diagnostics report as JSON
+//	log                     print the driver log kept in RAM, followed by OK
+//	console                 stream the firmware console ring buffer
+//	coredump                stream the chip RAM, i.e: after a firmware crash
+//	power <ms> [state...]   hold each of the idle, pm2-sleep and down power states for ms milliseconds
+//
+// The power command prints a "STATE <state>" line as each state is entered so
+// a current probe capture can be aligned with it. The chip must be
+// initialized again with init after the down state.
+//
+// Streaming commands send their data in lines of the form "DATA <base64>",
+// each holding up to 192 bytes, and wait for the host to answer every line
+// with a line, i.e: "ACK", before sending the next one so the host is never
+// overrun. The final "OK" line is followed by the amount of bytes sent.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"machine"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/logsink"
+)
+
+var (
+	errUsage    = errors.New("bad arguments")
+	errNotFound = errors.New("network not found")
+)
+
+// logs keeps the most recent driver log lines so they can be read after a
+// failed command without a logger blocking on the console.
+var logs = logsink.NewRing(4096)
+
+func main() {
+	dev := cyw43439.NewPicoWDevice()
+	received := 0
+	var line []byte
+	for {
+		line = readLine(line[:0])
+		result, err := run(dev, strings.Fields(string(line)), &received)
+		if err != nil {
+			machine.Serial.Write([]byte("ERR " + err.Error() + "\n"))
+		} else if result != "" {
+			machine.Serial.Write([]byte("OK " + result + "\n"))
+		} else {
+			machine.Serial.Write([]byte("OK\n"))
+		}
+	}
+}
+
+func run(dev *cyw43439.Device, args []string, received *int) (string, error) {
+	if len(args) == 0 {
+		return "", errUsage
+	}
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "init":
+		cfg := cyw43439.DefaultWifiConfig()
+		cfg.Logger = slog.New(logsink.NewHandler(logs, slog.LevelInfo))
+		err := dev.Init(cfg)
+		if err != nil {
+			return "", err
+		}
+		dev.RecvEthHandle(func(pkt []byte) error {
+			*received++
+			return nil
+		})
+		return "", nil
+
+	case "mac":
+		mac, err := dev.HardwareAddr6()
+		return net.HardwareAddr(mac[:]).String(), err
+
+	case "scan":
+		if len(args) < 1 {
+			return "", errUsage
+		}
+		timeout := 30 * time.Second
+		if len(args) > 1 {
+			secs, err := strconv.Atoi(args[1])
+			if err != nil {
+				return "", errUsage
+			}
+			timeout = time.Duration(secs) * time.Second
+		}
+		var found *cyw43439.PNONetwork
+		dev.OnPNONetworkFound(func(n cyw43439.PNONetwork) {
+			if found == nil {
+				found = &n
+			}
+		})
+		defer dev.OnPNONetworkFound(nil)
+		err := dev.StartPNO(cyw43439.PNOConfig{SSIDs: args[:1], Interval: 10 * time.Second})
+		if err != nil {
+			return "", err
+		}
+		defer dev.StopPNO()
+		for start := time.Now(); found == nil && time.Since(start) < timeout; {
+			dev.PollOne()
+			time.Sleep(10 * time.Millisecond)
+		}
+		if found == nil {
+			return "", errNotFound
+		}
+		return strconv.Itoa(int(found.RSSI)), nil
+
+	case "join":
+		if len(args) < 1 {
+			return "", errUsage
+		}
+		pass := ""
+		if len(args) > 1 {
+			pass = args[1]
+		}
+		return "", dev.JoinWPA2(args[0], pass)
+
+	case "disconnect":
+		return "", dev.Disconnect()
+
+	case "link":
+		return dev.LinkState().String(), nil
+
+	case "send":
+		if len(args) < 1 {
+			return "", errUsage
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", errUsage
+		}
+		mac, err := dev.HardwareAddr6()
+		if err != nil {
+			return "", err
+		}
+		var frame [60]byte
+		copy(frame[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+		copy(frame[6:12], mac[:])
+		frame[12], frame[13] = 0x88, 0xb5 // Local experimental EtherType.
+		copy(frame[14:], "hwtest")
+		for i := 0; i < n; i++ {
+			err = dev.SendEth(frame[:])
+			if err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+
+	case "poll":
+		if len(args) < 1 {
+			return "", errUsage
+		}
+		ms, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", errUsage
+		}
+		*received = 0
+		for start := time.Now(); time.Since(start) < time.Duration(ms)*time.Millisecond; {
+			gotPacket, err := dev.PollOne()
+			if err != nil {
+				return "", err
+			}
+			if !gotPacket {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		return strconv.Itoa(*received), nil
+
+	case "ap":
+		if len(args) < 3 {
+			return "", errUsage
+		}
+		ch, err := strconv.Atoi(args[2])
+		if err != nil {
+			return "", errUsage
+		}
+		return "", dev.StartAP(args[0], args[1], uint8(ch))
+
+	case "stopap":
+		return "", dev.StopAP()
+
+	case "phy":
+		stats, err := dev.PHYStats()
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		b.WriteString("rssi=")
+		for i, rssi := range stats.RSSI[:stats.Antennas] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Itoa(int(rssi)))
+		}
+		b.WriteString(" noise=" + strconv.Itoa(int(stats.Noise)))
+		b.WriteString(" crsmin=" + strconv.Itoa(int(stats.CRSMin)))
+		return b.String(), nil
+
+	case "diag":
+		var buf bytes.Buffer
+		err := dev.DiagnosticsReport(&buf, cyw43439.DiagJSON)
+		return buf.String(), err
+
+	case "log":
+		_, err := logs.WriteTo(machine.Serial)
+		return "", err
+
+	case "console":
+		var buf [1024]byte
+		n, err := dev.ReadConsole(buf[:])
+		if err != nil {
+			return "", err
+		}
+		var s stream
+		s.Write(buf[:n])
+		s.flush()
+		return strconv.Itoa(n), nil
+
+	case "power":
+		if len(args) < 1 {
+			return "", errUsage
+		}
+		ms, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", errUsage
+		}
+		cfg := cyw43439.PowerTestConfig{
+			Hold: time.Duration(ms) * time.Millisecond,
+			OnState: func(s cyw43439.PowerState) {
+				machine.Serial.Write([]byte("STATE " + s.String() + "\n"))
+			},
+		}
+		for _, name := range args[1:] {
+			state, ok := powerStates[name]
+			if !ok {
+				return "", errUsage
+			}
+			cfg.States = append(cfg.States, state)
+		}
+		return "", dev.PowerTest(cfg)
+
+	case "coredump":
+		var s stream
+		n, err := dev.CoreDump(&s)
+		s.flush()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	}
+	return "", errUsage
+}
+
+var powerStates = map[string]cyw43439.PowerState{
+	cyw43439.PowerIdle.String():  cyw43439.PowerIdle,
+	cyw43439.PowerSleep.String(): cyw43439.PowerSleep,
+	cyw43439.PowerDown.String():  cyw43439.PowerDown,
+}
+
+// readLine appends the next line read from the serial port to line, without
+// the line terminator, and returns it.
+func readLine(line []byte) []byte {
+	for {
+		b, err := machine.Serial.ReadByte()
+		if err != nil {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if b == '\r' {
+			continue
+		} else if b == '\n' {
+			return line
+		}
+		line = append(line, b)
+	}
+}
+
+// streamChunk is the amount of bytes sent per DATA line.
+const streamChunk = 192
+
+// stream is an io.Writer which sends the data written to it in DATA lines,
+// waiting for the host to acknowledge each line.
+type stream struct {
+	buf  [streamChunk]byte
+	n    int
+	line [len("DATA \n") + streamChunk/3*4]byte
+	ack  []byte
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	written := len(b)
+	for len(b) > 0 {
+		c := copy(s.buf[s.n:], b)
+		s.n += c
+		b = b[c:]
+		if s.n == streamChunk {
+			s.flush()
+		}
+	}
+	return written, nil
+}
+
+// flush sends the buffered data, if any, and waits for the acknowledgement.
+func (s *stream) flush() {
+	if s.n == 0 {
+		return
+	}
+	n := copy(s.line[:], "DATA ")
+	base64.StdEncoding.Encode(s.line[n:], s.buf[:s.n])
+	n += base64.StdEncoding.EncodedLen(s.n)
+	s.line[n] = '\n'
+	machine.Serial.Write(s.line[:n+1])
+	s.n = 0
+	s.ack = readLine(s.ack[:0])
+}
@@ -0,0 +1,49 @@
+package main
+
+// This example joins the network stored in flash or, if there is none or
+// joining fails, waits for credentials provisioned over USB serial with the
+// Improv Wi-Fi protocol, i.e: from ESP Web Tools in a browser. Nothing else is
+// written to the serial port so as not to confuse the provisioning tool.
+
+import (
+	"machine"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/improv"
+	"github.com/soypat/cyw43439/storage"
+)
+
+func main() {
+	dev := cyw43439.NewPicoWDevice()
+	err := dev.Init(cyw43439.DefaultWifiConfig())
+	if err != nil {
+		panic("wifi init:" + err.Error())
+	}
+	store, err := storage.NewPicoFlash()
+	if err != nil {
+		panic("storage:" + err.Error())
+	}
+	ssid, pass, err := storage.LoadCredentials(store)
+	if err == nil {
+		err = dev.JoinWPA2(ssid, pass)
+	}
+	if err != nil {
+		srv := improv.New(dev, machine.Serial, improv.Config{
+			FirmwareName: "improv-example",
+			DeviceName:   "Pico W",
+			Storage:      store,
+		})
+		_, _, err = srv.Serve()
+		if err != nil {
+			panic("improv:" + err.Error())
+		}
+	}
+	// Blink the LED once joined.
+	for {
+		dev.GPIOSet(0, true)
+		time.Sleep(500 * time.Millisecond)
+		dev.GPIOSet(0, false)
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -23,7 +23,7 @@ func main() {
 		Level: slog.LevelDebug,
 	}))
 	time.Sleep(100 * time.Millisecond)
-	dhcpc, stack, _, err := common.SetupWithDHCP(common.SetupConfig{
+	addressing, stack, _, err := common.SetupWithDHCP(common.SetupConfig{
 		Hostname:    hostname,
 		RequestedIP: "192.168.1.145",
 		Logger:      logger,
@@ -33,12 +33,12 @@ func main() {
 		panic("setup failed:" + err.Error())
 	}
 
-	routerhw, err := common.ResolveHardwareAddr(stack, dhcpc.Router())
+	routerhw, err := common.ResolveHardwareAddr(stack, addressing.IP.Gateway)
 	if err != nil {
 		panic("router hwaddr resolving:" + err.Error())
 	}
 
-	resolver, err := common.NewResolver(stack, dhcpc)
+	resolver, err := common.NewResolver(stack, addressing.IP)
 	if err != nil {
 		panic("resolver create:" + err.Error())
 	}
@@ -0,0 +1,40 @@
+package main
+
+// This example joins a network with DHCP and pings the gateway using
+// the raw data path helper common.Ping alongside the network stack to
+// verify the link is working.
+
+import (
+	"machine"
+	"time"
+
+	"log/slog"
+
+	"github.com/soypat/cyw43439/examples/common"
+)
+
+func main() {
+	time.Sleep(2 * time.Second)
+	logger := slog.New(slog.NewTextHandler(machine.Serial, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	addressing, stack, dev, err := common.SetupWithDHCP(common.SetupConfig{
+		Hostname: "ping-pico",
+		Logger:   logger,
+	})
+	if err != nil {
+		panic("setup DHCP:" + err.Error())
+	}
+	gateway := addressing.IP.Gateway
+	for {
+		stats, err := common.Ping(dev, stack, gateway, 4, time.Second)
+		if err != nil {
+			logger.Error("ping", slog.String("err", err.Error()))
+		} else {
+			logger.Info("ping", slog.String("addr", gateway.String()),
+				slog.Int("sent", stats.Sent), slog.Int("recv", stats.Received),
+				slog.Duration("min", stats.MinRTT), slog.Duration("avg", stats.AvgRTT), slog.Duration("max", stats.MaxRTT))
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+// This example joins a network and obtains an address and DNS servers with
+// the minimal udpdriver, dhcpclient and dnsclient packages instead of a full
+// network stack and then resolves an NTP server periodically, setting the
+// clock with the sntp package.
+
+import (
+	"machine"
+	"time"
+
+	"log/slog"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/examples/common"
+	"github.com/soypat/cyw43439/udpdriver"
+	"github.com/soypat/cyw43439/udpdriver/dhcpclient"
+	"github.com/soypat/cyw43439/udpdriver/dnsclient"
+	"github.com/soypat/cyw43439/udpdriver/sntp"
+)
+
+const hostname = "pool.ntp.org"
+
+func main() {
+	time.Sleep(2 * time.Second)
+	logger := slog.New(slog.NewTextHandler(machine.Serial, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	dev, err := cyw43439.ConnectWiFi(common.WifiCredentials())
+	if err != nil {
+		panic("connect:" + err.Error())
+	}
+	stack, err := udpdriver.New(dev, udpdriver.Config{})
+	if err != nil {
+		panic("udpdriver:" + err.Error())
+	}
+	dhcp, err := dhcpclient.New(stack, dhcpclient.Config{
+		Hostname: "resolve-pico",
+		OnLease: func(l dhcpclient.Lease) {
+			logger.Info("lease", slog.String("addr", l.Addr.String()), slog.String("gateway", l.Gateway.String()))
+		},
+	})
+	if err != nil {
+		panic("dhcp:" + err.Error())
+	}
+	lease, err := dhcp.Acquire()
+	for err != nil {
+		logger.Error("dhcp", slog.String("err", err.Error()))
+		time.Sleep(5 * time.Second)
+		lease, err = dhcp.Acquire()
+	}
+	go dhcp.Run() // Keep the lease renewed.
+	resolver, err := dnsclient.New(stack, lease.DNS[:]...)
+	if err != nil {
+		panic("dns:" + err.Error())
+	}
+	for {
+		addr, err := resolver.Resolve(hostname)
+		if err != nil {
+			logger.Error("resolve", slog.String("err", err.Error()))
+		} else {
+			logger.Info("resolve", slog.String("name", hostname), slog.String("addr", addr.String()))
+			now, err := sntp.Sync(stack, addr, 2*time.Second)
+			if err != nil {
+				logger.Error("sntp", slog.String("err", err.Error()))
+			} else {
+				logger.Info("sntp", slog.String("now", now.Format(time.RFC3339)))
+			}
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
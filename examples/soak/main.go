@@ -0,0 +1,157 @@
+package main
+
+// This example is a long running soak test: it joins a Wi-Fi network and
+// continuously sends UDP datagrams to an echo server, counting the echoes
+// received back. Counters and a health snapshot are printed periodically
+// and the device is re-initialized and rejoined whenever the link goes down
+// or the driver keeps failing, so it doubles as a template for unattended
+// devices which must recover on their own. Run an echo server with i.e:
+//
+//	socat -v UDP-LISTEN:9999,fork PIPE
+//
+// A healthy run shows the amount of echoes close to the amount sent and no
+// recoveries. Lost echoes alone do not trigger recovery since the network
+// may drop datagrams.
+
+import (
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/examples/common"
+	"github.com/soypat/cyw43439/udpdriver"
+)
+
+// Static addressing since there is no DHCP client.
+var (
+	localIP = netip.MustParsePrefix("192.168.1.78/24")
+	gateway = netip.MustParseAddr("192.168.1.1")
+	echoIP  = netip.MustParseAddrPort("192.168.1.2:9999")
+)
+
+const (
+	sendInterval  = 100 * time.Millisecond
+	echoTimeout   = 500 * time.Millisecond
+	statsInterval = 30 * time.Second
+	// maxFailures is the amount of consecutive driver errors after which the
+	// device is recovered.
+	maxFailures = 5
+	retryDelay  = 5 * time.Second
+)
+
+// stats are the soak test's own counters, complementing the driver's.
+type stats struct {
+	start      time.Time
+	sent       uint32
+	echoed     uint32
+	sendErrs   uint32
+	recoveries uint32
+}
+
+func main() {
+	time.Sleep(time.Second)
+	dev := cyw43439.NewPicoWDevice()
+	st := stats{start: time.Now()}
+	var conn *udpdriver.Conn
+	for {
+		var err error
+		conn, err = connect(dev)
+		if err == nil {
+			break
+		}
+		println("connect failed:", err.Error())
+		time.Sleep(retryDelay)
+	}
+
+	var out, in [64]byte
+	failures := 0
+	lastStats := time.Now()
+	for {
+		if dev.LinkState() != cyw43439.LinkStateUp || failures >= maxFailures {
+			println("recovering: link", dev.LinkState().String(), "failures", failures)
+			conn.Close()
+			for {
+				var err error
+				conn, err = connect(dev)
+				if err == nil {
+					break
+				}
+				println("recover failed:", err.Error())
+				time.Sleep(retryDelay)
+			}
+			st.recoveries++
+			failures = 0
+		}
+
+		st.sent++
+		payload := strconv.AppendUint(append(out[:0], "soak seq="...), uint64(st.sent), 10)
+		_, err := conn.Write(payload)
+		if err != nil {
+			st.sendErrs++
+			failures++
+		} else {
+			failures = 0
+			conn.SetReadDeadline(time.Now().Add(echoTimeout))
+			n, err := conn.Read(in[:])
+			if err == nil && string(in[:n]) == string(payload) {
+				st.echoed++
+			}
+		}
+
+		if time.Since(lastStats) >= statsInterval {
+			lastStats = time.Now()
+			if !printStats(dev, &st) {
+				failures++
+			}
+		}
+		time.Sleep(sendInterval)
+	}
+}
+
+// connect initializes dev, joins the network and opens the echo Conn.
+func connect(dev *cyw43439.Device) (*udpdriver.Conn, error) {
+	err := dev.Init(cyw43439.DefaultWifiConfig())
+	if err != nil {
+		return nil, err
+	}
+	ssid, pass := common.WifiCredentials()
+	err = dev.JoinWPA2(ssid, pass)
+	if err != nil {
+		return nil, err
+	}
+	stack, err := udpdriver.New(dev, udpdriver.Config{IP: cyw43439.IPConfig{
+		Addr:    localIP.Addr(),
+		Mask:    cyw43439.IPMask(localIP.Bits()),
+		Gateway: gateway,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	mac, _ := dev.HardwareAddr6()
+	err = dev.AnnounceL2(mac, localIP.Addr())
+	if err != nil {
+		println("announce:", err.Error())
+	}
+	return stack.DialUDP(echoIP)
+}
+
+// printStats prints the soak and driver counters and a health snapshot. It
+// returns false if the health snapshot could not be read.
+func printStats(dev *cyw43439.Device, st *stats) bool {
+	c := dev.Counters()
+	println("soak: uptime", time.Since(st.start).String(),
+		"sent", st.sent, "echoed", st.echoed, "lost", st.sent-st.echoed,
+		"send_errs", st.sendErrs, "recoveries", st.recoveries)
+	println("driver: tx", c.TxPackets, "tx_errs", c.TxErrors, "rx", c.RxPackets,
+		"events", c.RxEvents, "events_dropped", c.EventsDropped, "rx_dropped", c.RxDropped)
+	h, err := dev.Health()
+	println("health: link", h.LinkState.String(), "errors", h.Errors,
+		"seq", h.TxSeq, "seq_max", h.TxSeqMax, "credits", h.TxCredits,
+		"clock_csr", h.ClockCSR, "chip_status", h.ChipStatus)
+	if err != nil {
+		println("health read failed:", err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package main
+
+// This example joins a Wi-Fi network and periodically sends the RP2040's
+// temperature as a UDP datagram without a TCP/IP stack, crafting Ethernet,
+// ARP, IPv4 and UDP headers by hand and sending them with SendEth.
+// The collector's MAC address is resolved with ARP. If it does not respond
+// telemetry is broadcast instead. Listen on the collector with i.e:
+//
+//	nc -ul 9999
+
+import (
+	"encoding/binary"
+	"machine"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/examples/common"
+)
+
+// Static addressing since there is no DHCP client.
+var (
+	localIP     = netip.MustParseAddr("192.168.1.77")
+	collectorIP = netip.MustParseAddr("192.168.1.2")
+)
+
+const (
+	localPort     = 9998
+	collectorPort = 9999
+	period        = 5 * time.Second
+
+	udpHeaderLen = 8
+	protoUDP     = 17
+	headersLen   = common.EthHeaderLen + common.IPv4HeaderLen + udpHeaderLen
+)
+
+func main() {
+	time.Sleep(time.Second)
+	dev, err := cyw43439.ConnectWiFi(common.WifiCredentials())
+	if err != nil {
+		panic("connect:" + err.Error())
+	}
+	mac, _ := dev.HardwareAddr6()
+
+	var collectorMAC [6]byte
+	dev.RecvEthHandle(func(pkt []byte) error {
+		// Look for the ARP reply from the collector.
+		if mac, ip, ok := common.ParseARPReply(pkt); ok && ip == collectorIP {
+			collectorMAC = mac
+		}
+		return nil
+	})
+
+	var buf [headersLen + 64]byte
+	n := common.PutARPRequest(buf[:], mac, localIP, collectorIP)
+	err = dev.SendEth(buf[:n])
+	if err != nil {
+		println("arp send:", err.Error())
+	}
+	deadline := time.Now().Add(time.Second)
+	for collectorMAC == [6]byte{} && time.Until(deadline) > 0 {
+		dev.PollOne()
+		time.Sleep(10 * time.Millisecond)
+	}
+	dst, dstIP := collectorMAC, collectorIP
+	if dst == [6]byte{} {
+		println("collector did not respond to ARP, broadcasting telemetry")
+		dst, dstIP = common.BroadcastMAC, netip.AddrFrom4([4]byte{255, 255, 255, 255})
+	}
+
+	var seq uint32
+	for {
+		seq++
+		payload := buf[headersLen:headersLen]
+		payload = append(payload, "seq="...)
+		payload = strconv.AppendUint(payload, uint64(seq), 10)
+		payload = append(payload, " temp_mC="...)
+		payload = strconv.AppendInt(payload, int64(machine.ReadTemperature()), 10)
+		payload = append(payload, '\n')
+		n = putUDP(buf[:], mac, dst, localIP, dstIP, len(payload))
+		err = dev.SendEth(buf[:n])
+		if err != nil {
+			println("udp send:", err.Error())
+		}
+		deadline = time.Now().Add(period)
+		for time.Until(deadline) > 0 {
+			dev.PollOne() // Keep servicing the device.
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+// putUDP writes Ethernet, IPv4 and UDP headers for a payload of length plen
+// already present in buf after the headers and returns the frame length.
+func putUDP(buf []byte, src, dst [6]byte, srcIP, dstIP netip.Addr, plen int) int {
+	common.PutEthernet(buf, src, dst, common.EtherTypeIPv4)
+	common.PutIPv4(buf[common.EthHeaderLen:], srcIP, dstIP, protoUDP, udpHeaderLen+plen)
+	udp := buf[common.EthHeaderLen+common.IPv4HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:], localPort)
+	binary.BigEndian.PutUint16(udp[2:], collectorPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderLen+plen))
+	binary.BigEndian.PutUint16(udp[6:], 0) // Checksum is optional over IPv4.
+	return common.EthHeaderLen + common.IPv4HeaderLen + udpHeaderLen + plen
+}
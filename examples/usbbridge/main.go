@@ -0,0 +1,110 @@
+package main
+
+// This example bridges Ethernet frames between USB and the CYW43439 turning the
+// Pico W into a USB Wi-Fi adapter. TinyGo does not yet provide a CDC-ECM/NCM
+// USB network class so frames are exchanged over USB-CDC (serial) with each
+// frame prefixed by its length as a 2 byte big endian integer. A host-side
+// program is expected to shuttle frames between the serial port and a TAP
+// interface whose MAC address is printed on startup.
+//
+// An 802.11 station may only send frames with its own source address, so the
+// CYW43439's MAC address is passed through to the host by using the host's
+// MAC address for the CYW43439. Set it in hostMAC below.
+
+import (
+	"encoding/binary"
+	"machine"
+	"net"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/examples/common"
+)
+
+// hostMAC is the MAC address of the host's TAP interface. Set to zero to use
+// the CYW43439's factory MAC address and configure the TAP interface with it.
+var hostMAC = [6]byte{}
+
+func main() {
+	time.Sleep(time.Second)
+	dev := cyw43439.NewPicoWDevice()
+	err := dev.Init(cyw43439.DefaultWifiConfig())
+	if err != nil {
+		panic("dev Init:" + err.Error())
+	}
+	if hostMAC != [6]byte{} {
+		err = dev.SetHardwareAddr(hostMAC)
+		if err != nil {
+			panic("SetHardwareAddr:" + err.Error())
+		}
+	}
+	ssid, pass := common.WifiCredentials()
+	for {
+		err = dev.JoinWPA2(ssid, pass)
+		if err == nil {
+			break
+		}
+		println("join failed:", err.Error())
+		time.Sleep(5 * time.Second)
+	}
+	mac, _ := dev.HardwareAddr6()
+	println("joined, bridge MAC:", net.HardwareAddr(mac[:]).String())
+	// Forward all received frames to the host, not only those addressed to the bridge.
+	err = dev.SetPromiscuous(true)
+	if err != nil {
+		println("promiscuous mode unavailable:", err.Error())
+	}
+
+	usb := machine.USBCDC
+	var hdr [2]byte
+	// WiFi -> USB.
+	dev.RecvEthHandle(func(pkt []byte) error {
+		binary.BigEndian.PutUint16(hdr[:], uint16(len(pkt)))
+		usb.Write(hdr[:])
+		_, err := usb.Write(pkt)
+		return err
+	})
+
+	var (
+		frame  [cyw43439.MTU]byte
+		hdrlen int
+		plen   int
+		n      int
+	)
+	for {
+		gotPacket, err := dev.PollOne()
+		if err != nil {
+			println("poll:", err.Error())
+		}
+		idle := !gotPacket
+		// USB -> WiFi. Accumulate a whole frame before sending it.
+		for usb.Buffered() > 0 {
+			idle = false
+			c, _ := usb.ReadByte()
+			if hdrlen < 2 {
+				hdr[hdrlen] = c
+				hdrlen++
+				if hdrlen == 2 {
+					plen = int(binary.BigEndian.Uint16(hdr[:]))
+					if plen == 0 || plen > len(frame) {
+						println("dropping bad length frame", plen)
+						hdrlen = 0
+					}
+				}
+				continue
+			}
+			frame[n] = c
+			n++
+			if n == plen {
+				err = dev.SendEth(frame[:n])
+				if err != nil {
+					println("send:", err.Error())
+				}
+				n, hdrlen = 0, 0
+			}
+		}
+		if idle {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package experimental holds CYW43439 features whose API is still being
+// worked out, i.e: monitor mode. It is built on the raw ioctl, iovar and
+// event handler layer of package cyw43439 so it can change without touching
+// the driver.
+//
+// Unlike package cyw43439 this package is not covered by the module's
+// semantic versioning: any identifier may change or be removed in a minor
+// release. Features graduate into package cyw43439 once their API has
+// settled, after which they follow its compatibility guarantees.
+//
+// Functions take the *cyw43439.Device to operate on and, like Device
+// methods, must not be called from within its callbacks.
+package experimental
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errShortResponse = errors.New("experimental: short firmware response")
+
+// u32 returns v encoded as the firmware expects ioctl and iovar integers.
+func u32(v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return buf[:]
+}
+
+func b2u32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package experimental
+
+import (
+	"encoding/binary"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/whd"
+)
+
+// SetMonitor enables or disables monitor mode, in which the firmware passes
+// every 802.11 frame received on the current channel to the handler set with
+// Device.RecvEthHandle instead of Ethernet frames. The captured frame format
+// depends on the firmware build. The device should not be joined to a
+// network while monitoring.
+func SetMonitor(dev *cyw43439.Device, enable bool) error {
+	return dev.IoctlSet(whd.WLC_SET_MONITOR, whd.IF_STA, u32(b2u32(enable)))
+}
+
+// Monitor returns true if monitor mode is enabled.
+func Monitor(dev *cyw43439.Device) (bool, error) {
+	var buf [4]byte
+	n, err := dev.IoctlGet(whd.WLC_GET_MONITOR, whd.IF_STA, buf[:])
+	if err != nil {
+		return false, err
+	} else if n < len(buf) {
+		return false, errShortResponse
+	}
+	return binary.LittleEndian.Uint32(buf[:]) != 0, nil
+}
@@ -0,0 +1,51 @@
+package cyw43439
+
+import (
+	"errors"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements the recovery of the gSPI F2 FIFO after the status word
+// of a transfer reports an underflow (the host read more than the chip had
+// queued) or an overflow (the host wrote more than the FIFO could take). The
+// chip is left mid-frame in both cases so the frame is terminated through the
+// frame control register, discarding it, and the latched interrupts are
+// cleared. A discarded write frame never reached the firmware so its SDPCM
+// sequence number is reused, keeping the host in sync with the firmware's
+// credit accounting.
+
+var (
+	errFIFOUnderflow = errors.New("F2 FIFO underflow, read frame discarded")
+	errFIFOOverflow  = errors.New("F2 FIFO overflow, write frame discarded")
+)
+
+// fifo_recover terminates the frame in flight when status reports a FIFO
+// underflow or overflow and returns the corresponding error, or nil if
+// status reports neither.
+func (d *Device) fifo_recover(status Status) error {
+	var sfc uint8
+	var ferr error
+	if status.IsUnderflow() {
+		sfc |= whd.SFC_RF_TERM
+		ferr = errFIFOUnderflow
+	}
+	if status.IsOverflow() {
+		sfc |= whd.SFC_WF_TERM
+		ferr = errFIFOOverflow
+	}
+	if ferr == nil {
+		return nil
+	}
+	d.recordErr("fifo_recover", ferr)
+	err := d.write8(FuncBackplane, whd.SPI_FRAME_CONTROL, sfc)
+	if err != nil {
+		return err
+	}
+	// Interrupt bits are cleared by writing a 1.
+	err = d.write16(FuncBus, whd.SPI_INTERRUPT_REGISTER, uint16(whd.BUS_OVERFLOW_UNDERFLOW))
+	if err != nil {
+		return err
+	}
+	return ferr
+}
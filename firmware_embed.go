@@ -25,13 +25,30 @@ var (
 	btFW string
 )
 
+// IEEE CRC-32 checksums of the embedded images. See Config.FirmwareCRC32.
 const (
-	wifiFWLen   = 224190
-	wifibtFWLen = 231077
-	clmLen      = 984
-	_nvramlen   = len(nvram43439)
+	wifiFW2CRC      = 0x4e004ebe
+	clmFWCRC        = 0xe6ea8a32
+	embassyFWbtCRC  = 0xb36c77c0 // Also of the firmware in wifibtFW.
+	embassyFWclmCRC = 0x29aa78fd // Also of wifibtCLM().
+	btFWCRC         = 0xb443f51f
 )
 
+const (
+	wifiFWLen = 224190
+	_nvramlen = len(nvram43439)
+)
+
+// wifibtImages returns the firmware and CLM blob of the combined wifi+bt image.
+// The CLM starts at the first 512 byte boundary after the firmware.
+func wifibtImages() (fw, clm string) {
+	info, err := parseFirmwareInfo(wifibtFW)
+	if err != nil || info.CLMSize == 0 {
+		panic("cyw43439: corrupt embedded wifi+bt firmware")
+	}
+	return wifibtFW[:info.Size], wifibtFW[info.CLMOffset : info.CLMOffset+info.CLMSize]
+}
+
 const nvram43439 = "NVRAMRev=$Rev$" + "\x00" +
 	"manfid=0x2d0" + "\x00" +
 	"prodid=0x0727" + "\x00" +
@@ -0,0 +1,80 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file reads the gSPI function information registers which report
+// whether the backplane (F1), WLAN (F2) and F3 functions are enabled and
+// ready, and their maximum packet size. The WLAN function becomes ready once
+// the downloaded firmware has started and set up the data path.
+
+var (
+	errFuncInfo         = errors.New("function has no info register")
+	errFuncReadyTimeout = errors.New("timeout waiting for function ready")
+)
+
+// FunctionInfo is the value of a gSPI SPI_FUNCTIONx_INFO register.
+type FunctionInfo uint16
+
+// Enabled returns true if the function is enabled.
+func (i FunctionInfo) Enabled() bool { return i&whd.SPI_FUNCTIONX_ENABLED != 0 }
+
+// Ready returns true if the function is ready for data transfers.
+func (i FunctionInfo) Ready() bool { return i&whd.SPI_FUNCTIONX_READY != 0 }
+
+// MaxPacketSize returns the largest packet in bytes the function transfers.
+func (i FunctionInfo) MaxPacketSize() uint16 { return uint16(i>>2) & 0xfff }
+
+// FunctionInfo reads the information register of fn, which must be
+// FuncBackplane, FuncWLAN or FuncDMA2.
+func (d *Device) FunctionInfo(fn Function) (FunctionInfo, error) {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	return d.function_info(fn)
+}
+
+// WaitFunctionReady polls the information register of fn until its ready bit
+// is set, i.e: to wait for the WLAN function (F2) after the firmware download
+// before starting the data path. It returns an error if timeout elapses first.
+func (d *Device) WaitFunctionReady(fn Function, timeout time.Duration) error {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("WaitFunctionReady", slog.String("fn", fn.String()), slog.Duration("timeout", timeout))
+	_, err = d.wait_function_ready(fn, timeout)
+	return err
+}
+
+func (d *Device) function_info(fn Function) (FunctionInfo, error) {
+	if fn == FuncBus || fn > FuncDMA2 {
+		return 0, errFuncInfo
+	}
+	// F1, F2 and F3 info registers are consecutive 16 bit registers.
+	info, err := d.read16(FuncBus, whd.SPI_FUNCTION1_INFO+2*(uint32(fn)-1))
+	return FunctionInfo(info), err
+}
+
+// wait_function_ready polls the information register of fn every millisecond
+// until its ready bit is set and returns the last value read.
+func (d *Device) wait_function_ready(fn Function, timeout time.Duration) (FunctionInfo, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := d.function_info(fn)
+		if err != nil || info.Ready() {
+			return info, err
+		} else if time.Since(deadline) >= 0 {
+			return info, errFuncReadyTimeout
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,96 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// The fuzz targets check that parsing bytes received from the radio never panics.
+
+// FuzzRx fuzzes the processing of a received F2 frame: SDPCM, CDC and BDC
+// headers, event decoding and the parsers of event payloads.
+func FuzzRx(f *testing.F) {
+	f.Add(fuzzEventFrame(whd.EvLINK, nil))
+	f.Add(fuzzEventFrame(whd.EvPFN_NET_FOUND, make([]byte, 12+44)))
+	f.Add(fuzzEventFrame(whd.EvRRM, []byte{0, 0, 0, 0, 5, 0, 5, 0, 52, 13, 1, 2, 3, 4, 5, 6, 0, 0, 0, 0, 81, 6, 7}))
+	f.Add(fuzzEventFrame(whd.EvACTION_FRAME_RX, make([]byte, 16+24+7)))
+	f.Add(fuzzEventFrame(whd.EvRSSI, []byte{0xff, 0xff, 0xff, 0xb0}))
+	f.Fuzz(func(t *testing.T, packet []byte) {
+		d := &Device{}
+		for i := range d.eventmask.events {
+			d.eventmask.events[i] = 0xff
+		}
+		d.onLinkChange = func(old, new LinkState) {}
+		d.onPNOFound = func(PNONetwork) {}
+		d.onNeighborReport = func([]Neighbor) {}
+		d.onBTMRequest = func(*BSSTransitionRequest) {}
+		d.onSignal = func(SignalQuality, int8) {}
+		d.rcvEth = func([]byte) error { return nil }
+		d.rx(packet)
+		d.glom.n = 0
+	})
+}
+
+func FuzzParseBSSInfo(f *testing.F) {
+	seed := make([]byte, bssiFixedLen+4)
+	binary.LittleEndian.PutUint32(seed[bssiLength:], uint32(len(seed)))
+	binary.LittleEndian.PutUint16(seed[bssiIEOffset:], bssiFixedLen)
+	binary.LittleEndian.PutUint32(seed[bssiIELength:], 4)
+	copy(seed[bssiFixedLen:], []byte{ieHTCapabilities, 2, 0x6f, 0x01})
+	f.Add(seed)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		parseBSSInfo(b)
+	})
+}
+
+func FuzzParseChanimStats(f *testing.F) {
+	seed := make([]byte, chanimHdrLen+chanimStatsLen)
+	binary.LittleEndian.PutUint32(seed[4:], chanimVersion)
+	f.Add(seed)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		parseChanimStats(b)
+	})
+}
+
+func FuzzCLMBlobLen(f *testing.F) {
+	seed := make([]byte, 20+20)
+	copy(seed, "BLOB")
+	binary.LittleEndian.PutUint32(seed[4:], 20)
+	binary.LittleEndian.PutUint32(seed[16:], 1)
+	binary.LittleEndian.PutUint32(seed[24:], 20)
+	binary.LittleEndian.PutUint32(seed[28:], 20)
+	f.Add(seed)
+	huge := append([]byte(nil), seed...)
+	binary.LittleEndian.PutUint32(huge[16:], 0x7fffffff) // Entry count overflowing int32 when multiplied.
+	f.Add(huge)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		size, err := clmBlobLen(string(b))
+		if err == nil && (size < 0 || size > len(b)) {
+			t.Fatalf("size %d out of blob of length %d", size, len(b))
+		}
+	})
+}
+
+// fuzzEventFrame returns an SDPCM frame holding an event of type ev with payload.
+func fuzzEventFrame(ev whd.AsyncEventType, payload []byte) []byte {
+	const hdrLen = whd.SDPCM_HEADER_LEN + whd.BDC_HEADER_LEN + 72
+	frame := make([]byte, hdrLen+len(payload))
+	sdpcm := whd.SDPCMHeader{
+		Size:         uint16(len(frame)),
+		SizeCom:      ^uint16(len(frame)),
+		ChanAndFlags: uint8(whd.ASYNCEVENT_HEADER),
+		HeaderLength: whd.SDPCM_HEADER_LEN,
+	}
+	sdpcm.Put(binary.LittleEndian, frame)
+	event := frame[whd.SDPCM_HEADER_LEN+whd.BDC_HEADER_LEN:]
+	binary.BigEndian.PutUint16(event[12:], 0x886c)
+	binary.BigEndian.PutUint16(event[14:], 32769)
+	copy(event[19:22], []byte{0x00, 0x10, 0x18})
+	binary.BigEndian.PutUint16(event[22:], 1)
+	binary.BigEndian.PutUint32(event[24+4:], uint32(ev))
+	binary.BigEndian.PutUint32(event[24+20:], uint32(len(payload)))
+	copy(event[72:], payload)
+	return frame
+}
@@ -0,0 +1,111 @@
+package cyw43439
+
+import (
+	"errors"
+	"strings"
+	"unsafe"
+)
+
+var (
+	errFirmwareTrailer = errors.New("firmware trailer not found")
+	errCLMBlob         = errors.New("invalid CLM blob")
+)
+
+// FirmwareInfo is the metadata found in the trailer of a CYW43439 firmware image.
+type FirmwareInfo struct {
+	// Target is the chip and build the firmware was built for,
+	// i.e: "43439a0-roml/sdio-g-pool-p2p-...-tko-nvd".
+	Target string
+	// Version is the firmware version, i.e: "7.95.62".
+	Version string
+	// Description is the full version string of the trailer which also contains
+	// the firmware's CRC, build date and microcode version.
+	Description string
+	// DVID is the identifier which ends the trailer, i.e: "DVID 01-95566d6a".
+	DVID string
+	// Size is the length in bytes of the firmware image up to the end of its trailer.
+	Size int
+	// CLMOffset and CLMSize locate a CLM blob appended to the firmware image
+	// at the first 512 byte boundary following it. Both are zero if the image
+	// has no CLM blob appended.
+	CLMOffset int
+	CLMSize   int
+}
+
+// ParseFirmwareInfo parses the trailer of the firmware image fw which may be
+// followed by a CLM blob, as is the case of combined wifi and bluetooth images.
+// The returned strings reference fw's memory.
+func ParseFirmwareInfo(fw []byte) (FirmwareInfo, error) {
+	return parseFirmwareInfo(unsafe.String(unsafe.SliceData(fw), len(fw)))
+}
+
+func parseFirmwareInfo(fw string) (info FirmwareInfo, err error) {
+	// The trailer is the NUL terminated version string followed by its
+	// length as a 16 bit little endian integer and the DVID string.
+	const dvidLen = len("DVID 01-95566d6a")
+	dvidStart := strings.LastIndex(fw, "DVID ")
+	if dvidStart < 2 || dvidStart+dvidLen > len(fw) {
+		return info, errFirmwareTrailer
+	}
+	verLen := int(fw[dvidStart-2]) | int(fw[dvidStart-1])<<8
+	verStart := dvidStart - 2 - verLen
+	if verLen == 0 || verStart < 0 {
+		return info, errFirmwareTrailer
+	}
+	info.Description = strings.TrimRight(fw[verStart:dvidStart-2], "\x00")
+	info.DVID = fw[dvidStart : dvidStart+dvidLen]
+	info.Size = dvidStart + dvidLen
+	target, rest, ok := strings.Cut(info.Description, " Version: ")
+	if !ok {
+		return info, errFirmwareTrailer
+	}
+	info.Target = target
+	info.Version, _, _ = strings.Cut(rest, " ")
+
+	clmOffset := int(alignup(uint32(info.Size), 512))
+	if clmOffset < len(fw) {
+		clmSize, err := clmBlobLen(fw[clmOffset:])
+		if err != nil {
+			return info, err
+		}
+		info.CLMOffset = clmOffset
+		info.CLMSize = clmSize
+	}
+	return info, nil
+}
+
+// clmBlobLen returns the length of the CLM blob at the start of blob. The blob
+// header is the "BLOB" magic, header length, CRC, flags and amount of entries,
+// followed by entries of 5 words: type, offset, length, CRC and a reserved word.
+func clmBlobLen(blob string) (int, error) {
+	const (
+		hdrLen   = 20
+		entryLen = 20
+	)
+	if len(blob) < hdrLen || blob[:4] != "BLOB" {
+		return 0, errCLMBlob
+	}
+	u32 := func(off int) uint32 {
+		return uint32(blob[off]) | uint32(blob[off+1])<<8 | uint32(blob[off+2])<<16 | uint32(blob[off+3])<<24
+	}
+	// Fields are checked in uint32 so malformed headers can not overflow int
+	// on 32 bit targets.
+	n := u32(16)
+	if n > uint32((len(blob)-hdrLen)/entryLen) {
+		return 0, errCLMBlob
+	}
+	bloblen := uint32(len(blob))
+	size := u32(4) // Header length.
+	for i := 0; i < int(n); i++ {
+		entry := hdrLen + i*entryLen
+		offset, length := u32(entry+4), u32(entry+8)
+		if offset > bloblen || length > bloblen-offset {
+			return 0, errCLMBlob
+		}
+		size = max(size, offset+length)
+	}
+	if size > bloblen {
+		return 0, errCLMBlob
+	}
+	return int(size), nil
+}
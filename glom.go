@@ -0,0 +1,71 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements reception of superframes: when frame aggregation (glom)
+// is enabled with Config.Glom the firmware first sends a glom descriptor frame
+// listing the lengths of the subframes it packed in the next F2 transfer.
+// Each subframe is a complete SDPCM frame with its own header. Superframes
+// are bounded by the F2 maximum packet size of 2048 bytes so the receive
+// buffer must not be shrunk when glom is enabled.
+
+const maxGlomFrames = 16
+
+var (
+	errGlomDesc       = errors.New("invalid glom descriptor")
+	errGlomSuperframe = errors.New("superframe shorter than glom descriptor")
+	errGlomRxBuffer   = errors.New("Glom requires an RxBuffer of MaxRxBufferLen")
+)
+
+type glomDesc struct {
+	lens [maxGlomFrames]uint16
+	n    uint8
+}
+
+// rxGlomDesc stores the subframe lengths of the next superframe.
+func (d *Device) rxGlomDesc(payload []byte) error {
+	n := len(payload) / 2
+	if n == 0 || n > maxGlomFrames {
+		return errGlomDesc
+	}
+	for i := 0; i < n; i++ {
+		d.glom.lens[i] = _busOrder.Uint16(payload[2*i:])
+	}
+	d.glom.n = uint8(n)
+	return nil
+}
+
+// rxSuperframe splits a superframe into its subframes and processes each one.
+// The offset and length of a control subframe's payload, if present, are
+// returned relative to the start of super. The first error encountered is returned.
+func (d *Device) rxSuperframe(super []byte) (offset, plen uint16, hdrType whd.SDPCMHeaderType, err error) {
+	lens := d.glom.lens[:d.glom.n]
+	d.glom.n = 0 // Consumed even if the superframe fails to parse.
+	d.debug("rxSuperframe", slog.Int("len", len(super)), slog.Int("n", len(lens)))
+	hdrType = whd.UNKNOWN_HEADER
+	start := 0
+	for _, sublen := range lens {
+		end := start + int(sublen)
+		if end > len(super) || sublen < whd.SDPCM_HEADER_LEN {
+			return offset, plen, hdrType, errjoin(err, errGlomSuperframe)
+		}
+		sub := super[start:end]
+		// Subframes may be padded past the size in their header.
+		if size := _busOrder.Uint16(sub); int(size) >= whd.SDPCM_HEADER_LEN && int(size) < len(sub) {
+			sub = sub[:size]
+		}
+		o, p, t, rerr := d.rx(sub)
+		if rerr != nil && err == nil {
+			err = rerr
+		} else if rerr == nil && hdrType != whd.CONTROL_HEADER {
+			offset, plen, hdrType = uint16(start)+o, p, t
+		}
+		start = end
+	}
+	return offset, plen, hdrType, err
+}
@@ -0,0 +1,25 @@
+package cyw43439
+
+// This file declares the hardware abstraction the driver is built on so that
+// everything above the bus (framing, state machines and parsers) compiles and
+// can be tested on desktop Go. On the Pico W the HAL is implemented by the
+// machine package and the PIO gSPI bus, see NewPicoWDevice. Desktop builds,
+// and TinyGo builds with the cy43nopio tag, accept any implementation via
+// NewWithHAL, i.e: mocks in tests.
+
+// Pin is a digital output pin. machine.Pin implements Pin.
+type Pin interface {
+	Set(high bool)
+}
+
+// SPI is the half duplex gSPI command bus to the CYW43439. CmdRead and
+// CmdWrite run a transaction of the 32 bit command word cmd followed by
+// reading or writing buf. LastStatus returns the status word which the
+// CYW43439 appends to each transaction.
+// Implementations which can abort a stuck transfer may also have a
+// SetTimeout(time.Duration) method, see Config.BusTimeout.
+type SPI interface {
+	CmdRead(cmd uint32, buf []uint32) error
+	CmdWrite(cmd uint32, buf []uint32) error
+	LastStatus() uint32
+}
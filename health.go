@@ -0,0 +1,72 @@
+package cyw43439
+
+import "github.com/soypat/cyw43439/whd"
+
+// Health is a snapshot of the low level bus and protocol state of the
+// CYW43439, meant to be printed when reporting a problem with the driver.
+type Health struct {
+	// ClockCSR is the chip clock control and status register. Bit 7 is set
+	// while the HT (backplane) clock is available. See whd.SBSDIO_HT_AVAIL.
+	ClockCSR uint8
+	// SleepCSR is the sleep control and status register.
+	SleepCSR uint8
+	// ChipStatus is the chipcommon chip status register.
+	ChipStatus uint32
+	// BusStatus is the gSPI status word, read from the status register.
+	BusStatus Status
+	// Interrupts are the pending gSPI interrupts.
+	Interrupts Interrupts
+	// TxSeq is the SDPCM sequence number of the next frame sent and
+	// TxSeqMax the sequence number the firmware allows sending up to.
+	TxSeq    uint8
+	TxSeqMax uint8
+	// TxCredits is the amount of frames the firmware can currently accept.
+	TxCredits uint8
+	// IoctlID is the ID of the last ioctl sent.
+	IoctlID   uint16
+	BusAsleep bool
+	LinkState LinkState
+	// Errors is the total amount of bus and protocol errors. See LastErrors.
+	Errors uint32
+}
+
+// Health returns a snapshot of the low level driver state. The registers are
+// read without waking the bus or verifying its configuration so that a
+// snapshot can be taken while the device misbehaves; the returned error is the
+// first register read error, in which case the snapshot is partial.
+func (d *Device) Health() (h Health, err error) {
+	d.acquire(0)
+	defer d.release()
+	h = Health{
+		TxSeq:     d.sdpcmSeq,
+		TxSeqMax:  d.sdpcmSeqMax,
+		TxCredits: d.tx_credits(),
+		IoctlID:   d.ioctlID,
+		BusAsleep: d.busAsleep,
+		LinkState: d.state,
+		Errors:    d.errs.n,
+	}
+	if d.mode == 0 {
+		return h, errDevUninitialized
+	}
+	status, err := d.read32(FuncBus, whd.SPI_STATUS_REGISTER)
+	h.BusStatus = Status(status)
+	keep := func(err2 error) {
+		if err == nil {
+			err = err2
+		}
+	}
+	irq, err2 := d.read16(FuncBus, whd.SPI_INTERRUPT_REGISTER)
+	h.Interrupts = Interrupts(irq)
+	keep(err2)
+	h.ClockCSR, err2 = d.read8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR)
+	keep(err2)
+	h.SleepCSR, err2 = d.read8(FuncBackplane, whd.SDIO_SLEEP_CSR)
+	keep(err2)
+	if !d.busAsleep {
+		// Backplane reads require the bus to be awake.
+		h.ChipStatus, err2 = d.bp_read32(whd.CHIPCOMMON_CHIPSTATUS)
+		keep(err2)
+	}
+	return h, err
+}
@@ -0,0 +1,159 @@
+// Package hwtest drives a Pico W running the examples/hwconsole firmware over
+// USB serial so that driver changes can be regression tested on real
+// hardware. The tests of this package are built with the hwtest build tag and
+// configured with environment variables:
+//
+//	HWTEST_PORT  serial port of the Pico W, i.e: /dev/ttyACM0
+//	HWTEST_SSID  network to scan for and join
+//	HWTEST_PASS  passphrase of HWTEST_SSID, empty for open networks
+//
+// The serial port must be in raw mode without echo, i.e:
+//
+//	stty -F /dev/ttyACM0 raw -echo
+//	HWTEST_PORT=/dev/ttyACM0 HWTEST_SSID=ssid HWTEST_PASS=pass go test -tags hwtest ./hwtest
+package hwtest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var errTimeout = errors.New("hwtest: timeout waiting for response")
+
+// CommandError is an error reported by the console for a command.
+type CommandError struct {
+	Cmd string
+	Msg string
+}
+
+func (e *CommandError) Error() string { return "hwtest: " + e.Cmd + ": " + e.Msg }
+
+// Console is a connection to the hwconsole firmware.
+type Console struct {
+	rw io.ReadWriter
+	// lines receives the lines read from rw by the reading goroutine.
+	lines chan string
+	rerr  chan error
+}
+
+// Open opens the console on the serial port at path.
+func Open(path string) (*Console, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return New(f), nil
+}
+
+// New returns a Console communicating over rw.
+func New(rw io.ReadWriter) *Console {
+	c := &Console{rw: rw, lines: make(chan string, 16), rerr: make(chan error, 1)}
+	go c.readLines()
+	return c
+}
+
+// Close closes the underlying connection if it is an io.Closer.
+func (c *Console) Close() error {
+	if closer, ok := c.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Do runs the command line made of cmd and args and returns its result,
+// waiting at most timeout for the response. Lines which are not a response,
+// i.e: driver logs, are skipped.
+func (c *Console) Do(timeout time.Duration, cmd string, args ...string) (string, error) {
+	// Discard stale lines, i.e: the response of a timed out command.
+	for len(c.lines) > 0 {
+		<-c.lines
+	}
+	line := strings.Join(append([]string{cmd}, args...), " ") + "\n"
+	_, err := io.WriteString(c.rw, line)
+	if err != nil {
+		return "", err
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case resp := <-c.lines:
+			switch {
+			case resp == "OK":
+				return "", nil
+			case strings.HasPrefix(resp, "OK "):
+				return resp[3:], nil
+			case strings.HasPrefix(resp, "ERR "):
+				return "", &CommandError{Cmd: cmd, Msg: resp[4:]}
+			}
+		case err := <-c.rerr:
+			return "", err
+		case <-deadline.C:
+			return "", errTimeout
+		}
+	}
+}
+
+// Stream runs a streaming command, i.e: coredump, writing the data it sends
+// to w and acknowledging every DATA line. timeout limits the wait for each
+// line rather than the whole command. It returns the command's result.
+func (c *Console) Stream(w io.Writer, timeout time.Duration, cmd string, args ...string) (string, error) {
+	for len(c.lines) > 0 {
+		<-c.lines
+	}
+	line := strings.Join(append([]string{cmd}, args...), " ") + "\n"
+	_, err := io.WriteString(c.rw, line)
+	if err != nil {
+		return "", err
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case resp := <-c.lines:
+			switch {
+			case strings.HasPrefix(resp, "DATA "):
+				data, err := base64.StdEncoding.DecodeString(resp[5:])
+				if err != nil {
+					return "", err
+				}
+				_, err = w.Write(data)
+				if err != nil {
+					return "", err
+				}
+				_, err = io.WriteString(c.rw, "ACK\n")
+				if err != nil {
+					return "", err
+				}
+				deadline.Reset(timeout)
+			case resp == "OK":
+				return "", nil
+			case strings.HasPrefix(resp, "OK "):
+				return resp[3:], nil
+			case strings.HasPrefix(resp, "ERR "):
+				return "", &CommandError{Cmd: cmd, Msg: resp[4:]}
+			}
+		case err := <-c.rerr:
+			return "", err
+		case <-deadline.C:
+			return "", errTimeout
+		}
+	}
+}
+
+func (c *Console) readLines() {
+	sc := bufio.NewScanner(c.rw)
+	for sc.Scan() {
+		c.lines <- strings.TrimRight(sc.Text(), "\r")
+	}
+	err := sc.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	c.rerr <- err
+}
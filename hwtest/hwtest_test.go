@@ -0,0 +1,201 @@
+//go:build hwtest
+
+package hwtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var console *Console
+
+func TestMain(m *testing.M) {
+	port := os.Getenv("HWTEST_PORT")
+	if port == "" {
+		println("hwtest: HWTEST_PORT not set")
+		os.Exit(1)
+	}
+	var err error
+	console, err = Open(port)
+	if err != nil {
+		println("hwtest:", err.Error())
+		os.Exit(1)
+	}
+	code := m.Run()
+	console.Close()
+	os.Exit(code)
+}
+
+func ssid(t *testing.T) string {
+	ssid := os.Getenv("HWTEST_SSID")
+	if ssid == "" {
+		t.Skip("HWTEST_SSID not set")
+	}
+	return ssid
+}
+
+func do(t *testing.T, timeout time.Duration, cmd string, args ...string) string {
+	t.Helper()
+	res, err := console.Do(timeout, cmd, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// join joins HWTEST_SSID unless the link is already up.
+func join(t *testing.T) {
+	t.Helper()
+	if do(t, time.Second, "link") == "Up" {
+		return
+	}
+	args := []string{ssid(t)}
+	if pass := os.Getenv("HWTEST_PASS"); pass != "" {
+		args = append(args, pass)
+	}
+	do(t, 30*time.Second, "join", args...)
+}
+
+type report struct {
+	Firmware string
+	MAC      string
+	Link     string
+	Counters struct {
+		TxPackets uint32 `json:"tx_packets"`
+		TxErrors  uint32 `json:"tx_errors"`
+		RxPackets uint32 `json:"rx_packets"`
+		Errors    uint32
+	}
+}
+
+func diag(t *testing.T) report {
+	t.Helper()
+	var r report
+	err := json.Unmarshal([]byte(do(t, time.Second, "diag")), &r)
+	if err != nil {
+		t.Fatal("invalid diagnostics report:", err)
+	}
+	return r
+}
+
+func TestInit(t *testing.T) {
+	do(t, 10*time.Second, "init")
+	mac, err := net.ParseMAC(do(t, time.Second, "mac"))
+	if err != nil {
+		t.Fatal(err)
+	} else if mac.String() == "00:00:00:00:00:00" {
+		t.Fatal("zero MAC address")
+	}
+	r := diag(t)
+	if r.Firmware == "" {
+		t.Error("firmware version not reported")
+	}
+	if r.MAC != mac.String() {
+		t.Errorf("diagnostics MAC %s, want %s", r.MAC, mac)
+	}
+}
+
+func TestScan(t *testing.T) {
+	ssid := ssid(t)
+	if do(t, time.Second, "link") == "Up" {
+		t.Skip("scheduled scans require link down")
+	}
+	res := do(t, 35*time.Second, "scan", ssid, "30")
+	rssi, err := strconv.Atoi(res)
+	if err != nil {
+		t.Fatal(err)
+	} else if rssi >= 0 || rssi < -100 {
+		t.Errorf("implausible RSSI %d", rssi)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	join(t)
+	if link := do(t, time.Second, "link"); link != "Up" {
+		t.Fatalf("link %s after join", link)
+	}
+}
+
+func TestTraffic(t *testing.T) {
+	join(t)
+	const frames = 20
+	before := diag(t)
+	do(t, 5*time.Second, "send", strconv.Itoa(frames))
+	// Broadcast and multicast traffic of the network is expected within 5s.
+	received, err := strconv.Atoi(do(t, 10*time.Second, "poll", "5000"))
+	if err != nil {
+		t.Fatal(err)
+	} else if received == 0 {
+		t.Error("no frames received")
+	}
+	after := diag(t)
+	if got := after.Counters.TxPackets - before.Counters.TxPackets; got != frames {
+		t.Errorf("sent %d frames, want %d", got, frames)
+	}
+	if after.Counters.TxErrors != before.Counters.TxErrors {
+		t.Error("transmit errors")
+	}
+	if after.Counters.Errors != before.Counters.Errors {
+		t.Error("bus errors")
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	join(t)
+	do(t, 5*time.Second, "disconnect")
+	if link := do(t, time.Second, "link"); link != "Down" {
+		t.Fatalf("link %s after disconnect", link)
+	}
+	// The network must be joinable again without re-initializing.
+	join(t)
+	if link := do(t, time.Second, "link"); link != "Up" {
+		t.Fatalf("link %s after rejoin", link)
+	}
+}
+
+func TestAP(t *testing.T) {
+	do(t, 10*time.Second, "ap", "hwtest-ap", "hwtestpassphrase", "6")
+	if link := do(t, time.Second, "link"); link != "Up" {
+		t.Errorf("link %s after starting AP", link)
+	}
+	do(t, 10*time.Second, "stopap")
+	if link := do(t, time.Second, "link"); link != "Down" {
+		t.Errorf("link %s after stopping AP", link)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	var buf bytes.Buffer
+	res, err := console.Stream(&buf, time.Second, "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strconv.Itoa(buf.Len()) != res {
+		t.Errorf("received %d bytes, console reported %s", buf.Len(), res)
+	} else if buf.Len() == 0 {
+		t.Error("empty firmware console")
+	}
+}
+
+func TestCoreDump(t *testing.T) {
+	var buf bytes.Buffer
+	res, err := console.Stream(&buf, time.Second, "coredump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const ramSize = 512 * 1024
+	if buf.Len() != ramSize || res != strconv.Itoa(ramSize) {
+		t.Errorf("received %d bytes, console reported %s, want %d", buf.Len(), res, ramSize)
+	}
+}
+
+func TestPower(t *testing.T) {
+	do(t, 5*time.Second, "power", "500", "idle", "pm2-sleep")
+	// The device must be usable after the states which keep the firmware running.
+	do(t, time.Second, "mac")
+}
@@ -0,0 +1,308 @@
+// Package improv implements the device side of the Improv Wi-Fi serial
+// protocol (https://www.improv-wifi.com/serial/) so that browser based tools
+// such as ESP Web Tools can provision the Wi-Fi credentials of a device over
+// USB-CDC:
+//
+//	srv := improv.New(dev, machine.Serial, improv.Config{Storage: store})
+//	ssid, pass, err := srv.Serve()
+//
+// Wi-Fi scanning is not supported by the driver so scan requests are answered
+// with an unknown command error, which clients handle by asking for the SSID.
+package improv
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/storage"
+)
+
+var (
+	errPacket = errors.New("improv: invalid packet")
+)
+
+const (
+	header  = "IMPROV"
+	version = 1
+	// hdrLen is the length of header, version, type and length fields.
+	hdrLen     = len(header) + 3
+	maxPacket  = hdrLen + 255 + 1
+	idleSleep  = 10 * time.Millisecond
+	maxSSIDLen = 32
+	maxPassLen = 64
+)
+
+// Packet types.
+const (
+	typeCurrentState uint8 = 0x01
+	typeErrorState   uint8 = 0x02
+	typeRPCCommand   uint8 = 0x03
+	typeRPCResult    uint8 = 0x04
+)
+
+// RPC commands.
+const (
+	cmdWiFiSettings uint8 = 0x01
+	cmdCurrentState uint8 = 0x02
+	cmdDeviceInfo   uint8 = 0x03
+	cmdScanNetworks uint8 = 0x04
+)
+
+// State is the provisioning state reported to the client.
+type State uint8
+
+const (
+	StateReady        State = 0x02
+	StateProvisioning State = 0x03
+	StateProvisioned  State = 0x04
+)
+
+// Error is the error state reported to the client.
+type Error uint8
+
+const (
+	ErrorNone            Error = 0x00
+	ErrorInvalidRPC      Error = 0x01
+	ErrorUnknownRPC      Error = 0x02
+	ErrorUnableToConnect Error = 0x03
+	ErrorUnknown         Error = 0xff
+)
+
+// Config configures the information a Server reports.
+type Config struct {
+	// FirmwareName and FirmwareVersion identify the program. They default to
+	// "cyw43439" and "unknown".
+	FirmwareName    string
+	FirmwareVersion string
+	// Hardware is the chip or board variant. Defaults to "RP2040".
+	Hardware string
+	// DeviceName is the user facing device name. Defaults to "Pico W".
+	DeviceName string
+	// URL, if set, is sent to the client once provisioned so it may offer the
+	// user to open it, i.e: the address of a configuration page.
+	URL func() string
+	// Storage, if set, stores the credentials once the network is joined.
+	Storage storage.Storage
+}
+
+// Server answers Improv serial requests read from a stream, joining the
+// networks provisioned by the client.
+type Server struct {
+	dev   *cyw43439.Device
+	rw    io.ReadWriter
+	cfg   Config
+	state State
+	ssid  string
+	pass  string
+	rbuf  [maxPacket]byte
+	rlen  int
+	wbuf  [maxPacket + 1]byte
+}
+
+// New returns a Server reading requests from and writing responses to rw,
+// usually the USB-CDC serial port. The initial state is provisioned if dev's
+// link is already up.
+func New(dev *cyw43439.Device, rw io.ReadWriter, cfg Config) *Server {
+	if cfg.FirmwareName == "" {
+		cfg.FirmwareName = "cyw43439"
+	}
+	if cfg.FirmwareVersion == "" {
+		cfg.FirmwareVersion = "unknown"
+	}
+	if cfg.Hardware == "" {
+		cfg.Hardware = "RP2040"
+	}
+	if cfg.DeviceName == "" {
+		cfg.DeviceName = "Pico W"
+	}
+	s := &Server{dev: dev, rw: rw, cfg: cfg, state: StateReady}
+	if dev.IsLinkUp() {
+		s.state = StateProvisioned
+	}
+	return s
+}
+
+// State returns the current provisioning state.
+func (s *Server) State() State { return s.state }
+
+// Serve handles requests until the client provisions credentials with which
+// the network is joined and returns them. Failed joins are reported to the
+// client which may retry. Serve returns early on read or write errors.
+func (s *Server) Serve() (ssid, pass string, err error) {
+	var buf [64]byte
+	for {
+		n, err := s.rw.Read(buf[:])
+		if err != nil {
+			return "", "", err
+		}
+		if n == 0 {
+			time.Sleep(idleSleep)
+			continue
+		}
+		for _, b := range buf[:n] {
+			provisioned, err := s.handleByte(b)
+			if err != nil {
+				return "", "", err
+			}
+			if provisioned {
+				return s.ssid, s.pass, nil
+			}
+		}
+	}
+}
+
+// handleByte appends b to the packet being received and handles the packet
+// once complete. It reports whether the packet provisioned credentials.
+func (s *Server) handleByte(b byte) (bool, error) {
+	if s.rlen < len(header) && b != header[s.rlen] {
+		// Resynchronize on the header, skipping other serial traffic.
+		s.rlen = 0
+		if b != header[0] {
+			return false, nil
+		}
+	}
+	s.rbuf[s.rlen] = b
+	s.rlen++
+	if s.rlen < hdrLen || s.rlen < hdrLen+int(s.rbuf[hdrLen-1])+1 {
+		return false, nil
+	}
+	pkt := s.rbuf[:s.rlen]
+	s.rlen = 0
+	if pkt[len(header)] != version || checksum(pkt[:len(pkt)-1]) != pkt[len(pkt)-1] {
+		return false, s.sendError(ErrorInvalidRPC)
+	}
+	if pkt[len(header)+1] != typeRPCCommand {
+		return false, nil
+	}
+	return s.handleRPC(pkt[hdrLen : len(pkt)-1])
+}
+
+func (s *Server) handleRPC(data []byte) (bool, error) {
+	if len(data) < 2 || int(data[1]) != len(data)-2 {
+		return false, s.sendError(ErrorInvalidRPC)
+	}
+	cmd, args := data[0], data[2:]
+	switch cmd {
+	case cmdWiFiSettings:
+		ssid, pass, err := parseSettings(args)
+		if err != nil {
+			return false, s.sendError(ErrorInvalidRPC)
+		}
+		return s.provision(ssid, pass)
+	case cmdCurrentState:
+		err := s.sendState(s.state)
+		if err == nil && s.state == StateProvisioned {
+			err = s.sendURL()
+		}
+		return false, err
+	case cmdDeviceInfo:
+		return false, s.sendResult(cmdDeviceInfo, s.cfg.FirmwareName, s.cfg.FirmwareVersion, s.cfg.Hardware, s.cfg.DeviceName)
+	default: // Including cmdScanNetworks.
+		return false, s.sendError(ErrorUnknownRPC)
+	}
+}
+
+// provision joins the network and reports the outcome to the client.
+func (s *Server) provision(ssid, pass string) (bool, error) {
+	err := s.sendError(ErrorNone)
+	if err != nil {
+		return false, err
+	}
+	s.state = StateProvisioning
+	err = s.sendState(s.state)
+	if err != nil {
+		return false, err
+	}
+	err = s.dev.JoinWPA2(ssid, pass)
+	if err != nil {
+		s.state = StateReady
+		err = s.sendError(ErrorUnableToConnect)
+		if err == nil {
+			err = s.sendState(s.state)
+		}
+		return false, err
+	}
+	s.state = StateProvisioned
+	s.ssid, s.pass = ssid, pass
+	if s.cfg.Storage != nil {
+		err = storage.StoreCredentials(s.cfg.Storage, ssid, pass)
+		if err != nil {
+			return false, err
+		}
+	}
+	err = s.sendState(s.state)
+	if err != nil {
+		return false, err
+	}
+	return true, s.sendURL()
+}
+
+func (s *Server) sendURL() error {
+	if s.cfg.URL == nil {
+		return s.sendResult(cmdWiFiSettings)
+	}
+	return s.sendResult(cmdWiFiSettings, s.cfg.URL())
+}
+
+func (s *Server) sendState(state State) error {
+	return s.send(typeCurrentState, byte(state))
+}
+
+func (s *Server) sendError(e Error) error {
+	return s.send(typeErrorState, byte(e))
+}
+
+// sendResult sends the result of cmd consisting of strs.
+func (s *Server) sendResult(cmd uint8, strs ...string) error {
+	data := s.wbuf[hdrLen:]
+	data[0] = cmd
+	n := 2
+	for _, str := range strs {
+		if n+1+len(str) > 255 {
+			break
+		}
+		data[n] = byte(len(str))
+		n += 1 + copy(data[n+1:], str)
+	}
+	data[1] = byte(n - 2)
+	return s.write(typeRPCResult, n)
+}
+
+func (s *Server) send(typ uint8, data ...byte) error {
+	return s.write(typ, copy(s.wbuf[hdrLen:], data))
+}
+
+// write completes the packet of typ with n bytes of data in s.wbuf and writes it.
+func (s *Server) write(typ uint8, n int) error {
+	copy(s.wbuf[:], header)
+	s.wbuf[len(header)] = version
+	s.wbuf[len(header)+1] = typ
+	s.wbuf[len(header)+2] = byte(n)
+	end := hdrLen + n
+	s.wbuf[end] = checksum(s.wbuf[:end])
+	s.wbuf[end+1] = '\n'
+	_, err := s.rw.Write(s.wbuf[:end+2])
+	return err
+}
+
+// parseSettings parses the arguments of the send Wi-Fi settings command.
+func parseSettings(args []byte) (ssid, pass string, err error) {
+	if len(args) < 1 || int(args[0]) > maxSSIDLen || len(args) < 2+int(args[0]) {
+		return "", "", errPacket
+	}
+	ssid = string(args[1 : 1+args[0]])
+	args = args[1+args[0]:]
+	if int(args[0]) > maxPassLen || len(args) != 1+int(args[0]) || ssid == "" {
+		return "", "", errPacket
+	}
+	return ssid, string(args[1:]), nil
+}
+
+func checksum(b []byte) (sum uint8) {
+	for _, c := range b {
+		sum += c
+	}
+	return sum
+}
@@ -0,0 +1,74 @@
+// Command geniovar generates the typed iovar getters and setters of the
+// cyw43439 package from the whd.IOVars catalog. It is run via go generate.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+func main() {
+	output := flag.String("o", "iovar_catalog.go", "output file name")
+	flag.Parse()
+	src, err := generate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(*output, src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by \"geniovar\"; DO NOT EDIT.\n\npackage cyw43439\n\nimport \"github.com/soypat/cyw43439/whd\"\n")
+	seen := make(map[string]bool)
+	for _, v := range whd.IOVars {
+		if seen[v.Method] {
+			return nil, fmt.Errorf("duplicate method %q", v.Method)
+		}
+		seen[v.Method] = true
+		if v.Set != 0 && v.Get == 0 {
+			return nil, fmt.Errorf("%s: Set ioctl without Get ioctl", v.Name)
+		}
+		getCmd, setCmd := "0", "0"
+		if v.Get != 0 {
+			getCmd = "whd.WLC_" + v.Get.String()
+		}
+		if v.Set != 0 {
+			setCmd = "whd.WLC_" + v.Set.String()
+		} else if v.Get != 0 && !v.ReadOnly {
+			return nil, fmt.Errorf("%s: writable ioctl variable without Set ioctl", v.Name)
+		}
+		var typ, conv, param string
+		switch v.Type {
+		case whd.IOVarUint32:
+			typ, param = "uint32", "v"
+		case whd.IOVarInt32:
+			typ, conv, param = "int32", "int32(v)", "uint32(v)"
+		case whd.IOVarBool:
+			typ, conv, param = "bool", "v != 0", "b2u32(v)"
+		default:
+			return nil, fmt.Errorf("%s: unknown type %d", v.Name, v.Type)
+		}
+		fmt.Fprintf(&buf, "\n// %s returns %s\nfunc (d *Device) %s() (%s, error) {\n", v.Method, v.Doc, v.Method, typ)
+		if v.Type == whd.IOVarUint32 {
+			fmt.Fprintf(&buf, "\treturn d.getCatalogVar(%q, %s)\n}\n", v.Name, getCmd)
+		} else {
+			fmt.Fprintf(&buf, "\tv, err := d.getCatalogVar(%q, %s)\n\treturn %s, err\n}\n", v.Name, getCmd, conv)
+		}
+		if v.ReadOnly {
+			continue
+		}
+		fmt.Fprintf(&buf, "\n// Set%s sets %s\nfunc (d *Device) Set%s(v %s) error {\n", v.Method, v.Doc, v.Method, typ)
+		fmt.Fprintf(&buf, "\treturn d.setCatalogVar(%q, %s, %s)\n}\n", v.Name, setCmd, param)
+	}
+	return format.Source(buf.Bytes())
+}
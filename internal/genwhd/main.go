@@ -0,0 +1,401 @@
+// Command genwhd generates Go constants from the C headers of the Infineon
+// WiFi Host Driver (WHD), i.e: whd_wlioctl.h, whd_events.h and the chip
+// register headers, so that the whd package need not be extended by hand to
+// use a register, ioctl or event. It is run via go generate in whd/whdconst
+// with WHD_INCLUDE set to the include directory of a checkout of the WHD
+// release pinned there:
+//
+//	WHD_INCLUDE=~/wifi-host-driver/WiFi_Host_Driver/inc go generate ./whd/whdconst
+//
+// Integer object-like macros and enumeration constants are converted; macros
+// whose value is not a constant expression of other converted names are
+// skipped. With -check the hand-typed constants of the whd package are
+// compared against the headers and mismatches are reported:
+//
+//	go run ./internal/genwhd -I $WHD_INCLUDE -check ./whd
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+func main() {
+	include := flag.String("I", "", "WHD include directory, all .h files in it are parsed")
+	output := flag.String("o", "", "output file name, none if empty")
+	pkg := flag.String("pkg", "whdconst", "package name of the output file")
+	version := flag.String("version", "", "WHD release the headers belong to, recorded in the output file")
+	check := flag.String("check", "", "directory of the whd package whose constants are checked against the headers")
+	flag.Parse()
+	if *include == "" {
+		log.Fatal("genwhd: -I flag required")
+	} else if *output != "" && *version == "" {
+		log.Fatal("genwhd: -version flag required with -o")
+	}
+	files, err := filepath.Glob(filepath.Join(*include, "*.h"))
+	if err != nil {
+		log.Fatal(err)
+	} else if len(files) == 0 {
+		log.Fatal("genwhd: no header files in ", *include)
+	}
+	sort.Strings(files)
+	defs := newDefs()
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = defs.parseHeader(filepath.Base(name), f)
+		f.Close()
+		if err != nil {
+			log.Fatal(name, ": ", err)
+		}
+	}
+	if *output != "" {
+		src, err := defs.generate(*pkg, *version)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = os.WriteFile(*output, src, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *check != "" {
+		mismatches, err := defs.check(*check)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range mismatches {
+			fmt.Fprintln(os.Stderr, m)
+		}
+		if len(mismatches) > 0 {
+			os.Exit(1)
+		}
+	}
+}
+
+// def is a constant defined by a header.
+type def struct {
+	name  string
+	file  string
+	value constant.Value
+}
+
+// defs holds the constants of the parsed headers in definition order.
+type defs struct {
+	list   []def
+	byName map[string]constant.Value
+}
+
+func newDefs() *defs {
+	return &defs{byName: make(map[string]constant.Value)}
+}
+
+var (
+	reDefine = regexp.MustCompile(`^#\s*define\s+([A-Za-z_]\w*)\s+(.+)$`)
+	// reCast matches C casts to integer types, i.e: (uint32_t).
+	reCast = regexp.MustCompile(`\(\s*(?:unsigned\s+|signed\s+|const\s+)*(?:u?int\d+_t|int|long|short|char|uint|size_t)\s*\)`)
+	// reSuffix matches the suffixes of C integer literals, i.e: 1UL.
+	reSuffix = regexp.MustCompile(`\b(0[xX][0-9a-fA-F]+|\d+)[uUlL]+\b`)
+	reEnum   = regexp.MustCompile(`\benum\b[^{;]*\{`)
+)
+
+// parseHeader adds the object-like integer macros and enumeration constants
+// of the header read from r to d. file names the header in the output.
+func (d *defs) parseHeader(file string, r io.Reader) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	text := stripComments(string(src))
+	text = strings.ReplaceAll(text, "\\\n", " ")   // Line continuations.
+	text = reEnum.ReplaceAllString(text, "enum {") // Braces on the next line.
+	var enumBody strings.Builder
+	inEnum := false
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if inEnum {
+			end := strings.IndexByte(line, '}')
+			if end < 0 {
+				enumBody.WriteString(line)
+				enumBody.WriteByte('\n')
+				continue
+			}
+			enumBody.WriteString(line[:end])
+			d.addEnum(file, enumBody.String())
+			enumBody.Reset()
+			inEnum = false
+			continue
+		}
+		if m := reDefine.FindStringSubmatch(line); m != nil {
+			d.add(file, m[1], m[2])
+			continue
+		}
+		if loc := reEnum.FindStringIndex(line); loc != nil {
+			rest := line[loc[1]:]
+			if end := strings.IndexByte(rest, '}'); end >= 0 {
+				d.addEnum(file, rest[:end])
+				continue
+			}
+			enumBody.WriteString(rest)
+			enumBody.WriteByte('\n')
+			inEnum = true
+		}
+	}
+	return sc.Err()
+}
+
+// addEnum adds the constants of the body of an enumeration, which start at
+// zero and increment by one unless given a value.
+func (d *defs) addEnum(file, body string) {
+	next := constant.MakeInt64(0)
+	for _, entry := range strings.Split(body, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, expr, hasValue := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if hasValue {
+			v, ok := d.eval(cleanExpr(expr))
+			if !ok {
+				next = nil // Following implicit values are unknown.
+				continue
+			}
+			next = v
+		} else if next == nil {
+			continue
+		}
+		d.set(file, name, next)
+		next = constant.BinaryOp(next, token.ADD, constant.MakeInt64(1))
+	}
+}
+
+// add adds the macro name if expr is an integer constant expression.
+func (d *defs) add(file, name, expr string) {
+	v, ok := d.eval(cleanExpr(expr))
+	if ok {
+		d.set(file, name, v)
+	}
+}
+
+func (d *defs) set(file, name string, v constant.Value) {
+	if strings.HasPrefix(name, "_") || token.IsKeyword(name) {
+		return
+	}
+	if _, dup := d.byName[name]; dup {
+		return // First definition wins, i.e: over conditional redefinitions.
+	}
+	d.byName[name] = v
+	d.list = append(d.list, def{name: name, file: file, value: v})
+}
+
+// cleanExpr converts a C integer expression to Go syntax.
+func cleanExpr(expr string) string {
+	expr = reCast.ReplaceAllString(expr, "")
+	expr = reSuffix.ReplaceAllString(expr, "$1")
+	return strings.ReplaceAll(strings.TrimSpace(expr), "~", "^")
+}
+
+// eval evaluates the integer constant expression expr, which may reference
+// previously defined names.
+func (d *defs) eval(expr string) (constant.Value, bool) {
+	x, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, false
+	}
+	return evalExpr(x, d.byName)
+}
+
+func evalExpr(x ast.Expr, names map[string]constant.Value) (constant.Value, bool) {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		if x.Kind != token.INT && x.Kind != token.CHAR {
+			return nil, false
+		}
+		v := constant.MakeFromLiteral(x.Value, x.Kind, 0)
+		if x.Kind == token.CHAR {
+			v = constant.ToInt(v)
+		}
+		return v, v.Kind() == constant.Int
+	case *ast.Ident:
+		v, ok := names[x.Name]
+		return v, ok
+	case *ast.ParenExpr:
+		return evalExpr(x.X, names)
+	case *ast.UnaryExpr:
+		v, ok := evalExpr(x.X, names)
+		if !ok || (x.Op != token.SUB && x.Op != token.ADD && x.Op != token.XOR) {
+			return nil, false
+		}
+		// C's ~ on unsigned 32 bit values, the common case in the headers.
+		return constant.UnaryOp(x.Op, v, 32), true
+	case *ast.BinaryExpr:
+		a, ok := evalExpr(x.X, names)
+		if !ok {
+			return nil, false
+		}
+		b, ok := evalExpr(x.Y, names)
+		if !ok {
+			return nil, false
+		}
+		switch x.Op {
+		case token.SHL, token.SHR:
+			s, exact := constant.Uint64Val(b)
+			if !exact || s > 63 {
+				return nil, false
+			}
+			return constant.Shift(a, x.Op, uint(s)), true
+		case token.QUO, token.REM:
+			if constant.Sign(b) == 0 {
+				return nil, false
+			}
+			if x.Op == token.QUO {
+				return constant.BinaryOp(a, token.QUO_ASSIGN, b), true // Integer division.
+			}
+			return constant.BinaryOp(a, x.Op, b), true
+		case token.ADD, token.SUB, token.MUL, token.AND, token.OR, token.XOR, token.AND_NOT:
+			return constant.BinaryOp(a, x.Op, b), true
+		}
+	}
+	return nil, false
+}
+
+// stripComments removes C block and line comments, keeping line breaks.
+func stripComments(src string) string {
+	var b strings.Builder
+	for i := 0; i < len(src); i++ {
+		switch {
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			b.WriteString(strings.Repeat("\n", strings.Count(src[i:i+2+end], "\n")))
+			i += end + 3
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return b.String()
+			}
+			i += end - 1
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return b.String()
+}
+
+// generate returns the Go source declaring the constants of d, grouped by
+// header. version is the WHD release the headers belong to.
+func (d *defs) generate(pkg, version string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by \"genwhd\" from WHD %s; DO NOT EDIT.\n\npackage %s\n", version, pkg)
+	file := ""
+	for _, def := range d.list {
+		if def.file != file {
+			if file != "" {
+				buf.WriteString(")\n")
+			}
+			file = def.file
+			fmt.Fprintf(&buf, "\n// Constants of %s.\nconst (\n", file)
+		}
+		fmt.Fprintf(&buf, "\t%s = %s\n", def.name, formatValue(def.value))
+	}
+	if file != "" {
+		buf.WriteString(")\n")
+	}
+	return format.Source(buf.Bytes())
+}
+
+func formatValue(v constant.Value) string {
+	if u, ok := constant.Uint64Val(v); ok && u >= 256 {
+		return fmt.Sprintf("0x%x", u)
+	}
+	return v.ExactString()
+}
+
+var errNoConsts = errors.New("genwhd: no constants found in package directory")
+
+// check compares the constants declared in the Go files of dir with the
+// header definitions of the same name and returns the mismatches found.
+// Event constants named EvX are compared with WLC_E_X.
+func (d *defs) check(dir string) ([]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	goNames := make(map[string]constant.Value)
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			collectConsts(f, goNames)
+		}
+	}
+	if len(goNames) == 0 {
+		return nil, errNoConsts
+	}
+	var mismatches []string
+	for name, v := range goNames {
+		cname := name
+		if rest, ok := strings.CutPrefix(name, "Ev"); ok {
+			cname = "WLC_E_" + rest
+		}
+		want, ok := d.byName[cname]
+		if ok && constant.Compare(v, token.NEQ, want) {
+			mismatches = append(mismatches, fmt.Sprintf("%s = %s, header %s = %s", name, v.ExactString(), cname, want.ExactString()))
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches, nil
+}
+
+// collectConsts evaluates the integer constants declared in f into names.
+// Constants depending on iota or on declarations not yet seen are skipped.
+func collectConsts(f *ast.File, names map[string]constant.Value) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if i >= len(vs.Values) {
+					break
+				}
+				if v, ok := evalExpr(unconvert(vs.Values[i]), names); ok {
+					names[name.Name] = v
+				}
+			}
+		}
+	}
+}
+
+// unconvert strips type conversions, i.e: SDPCMCommand(2), from x.
+func unconvert(x ast.Expr) ast.Expr {
+	if call, ok := x.(*ast.CallExpr); ok && len(call.Args) == 1 {
+		return unconvert(call.Args[0])
+	}
+	return x
+}
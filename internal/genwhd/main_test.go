@@ -0,0 +1,77 @@
+package main
+
+import (
+	"go/constant"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	f, err := os.Open("testdata/fixture.h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := newDefs()
+	err = d.parseHeader("fixture.h", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{
+		"WLC_UP":                  2,
+		"WLC_DOWN":                3,
+		"WLC_SET_KEY":             45,
+		"CHIPCOMMON_BASE_ADDRESS": 0x18000000,
+		"CHIPCOMMON_SR_CONTROL1":  0x18000508,
+		"SFC_RF_TERM":             1,
+		"ALL_BUT_LOW":             0xfffffff0,
+		"LONG_VALUE":              16,
+		"WLC_E_SET_SSID":          0,
+		"WLC_E_JOIN":              1,
+		"WLC_E_LINK":              16,
+		"WLC_E_DEAUTH_IND":        17,
+		"BAND_A":                  0,
+		"BAND_B":                  4,
+		"BAND_C":                  5,
+	}
+	for name, v := range want {
+		got, ok := d.byName[name]
+		if !ok {
+			t.Errorf("%s not parsed", name)
+			continue
+		}
+		if u, _ := constant.Uint64Val(got); u != v {
+			t.Errorf("%s = %s, want %#x", name, got.ExactString(), v)
+		}
+	}
+	for _, name := range []string{"_FIXTURE_H_", "WHD_MACRO", "WHD_STRING"} {
+		if _, ok := d.byName[name]; ok {
+			t.Errorf("%s should not be parsed", name)
+		}
+	}
+	if len(d.byName) != len(want) {
+		t.Errorf("parsed %d constants, want %d", len(d.byName), len(want))
+	}
+	src, err := d.generate("whdconst", "v0.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const header = "// Code generated by \"genwhd\" from WHD v0.0.0; DO NOT EDIT."
+	if !strings.HasPrefix(string(src), header) {
+		t.Errorf("generated source does not start with %q", header)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	d := newDefs()
+	d.set("x.h", "WLC_E_LINK", constant.MakeInt64(16))
+	d.set("x.h", "WLC_UP", constant.MakeInt64(3))
+	mismatches, err := d.check("../../whd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 || mismatches[0] != "WLC_UP = 2, header WLC_UP = 3" {
+		t.Errorf("unexpected mismatches %q", mismatches)
+	}
+}
@@ -0,0 +1,29 @@
+/*
+ * Fixture modelled on whd_wlioctl.h and whd_events.h.
+ */
+#ifndef _FIXTURE_H_
+#define _FIXTURE_H_
+
+#define WLC_UP                 ((uint32_t)2)
+#define WLC_DOWN               ((uint32_t)3) /* Bring the interface down. */
+#define WLC_SET_KEY            (45U)
+#define CHIPCOMMON_BASE_ADDRESS (0x18000000UL)
+#define CHIPCOMMON_SR_CONTROL1  (CHIPCOMMON_BASE_ADDRESS + 0x508)
+#define SFC_RF_TERM            (1 << 0) // Read frame terminate.
+#define ALL_BUT_LOW            (~0xfU)
+#define LONG_VALUE             (1 << \
+                                4)
+#define WHD_MACRO(x)           ((x) + 1)
+#define WHD_STRING             "whd"
+
+typedef enum
+{
+    WLC_E_SET_SSID = 0,
+    WLC_E_JOIN, /* 1 */
+    WLC_E_LINK = 16,
+    WLC_E_DEAUTH_IND,
+} whd_event_num_t;
+
+typedef enum { BAND_A, BAND_B = 4, BAND_C } band_t;
+
+#endif
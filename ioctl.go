@@ -15,7 +15,6 @@ import (
 )
 
 var (
-	errTxPacketTooLarge      = errors.New("tx packet too large")
 	errLinkDown              = errors.New("link down")
 	errIOVarTooLarge         = errors.New("iovar too large")
 	errInvalidIoctlIface     = errors.New("invalid ioctl iface")
@@ -30,6 +29,8 @@ var (
 	errNoF2Avail            = errors.New("no packet available")
 	errWaitForCreditTimeout = errors.New("waitForCredit timeout")
 	errIoctlPollTimeout     = errors.New("ioctl poll timeout")
+	errPollForIoctlTimeout  = errors.New("pollForIoctl timeout")
+	errRxPacketTooLarge     = errors.New("received packet larger than receive buffer, dropped")
 )
 
 const noPacket = whd.SDPCMHeaderType(0xff)
@@ -58,6 +59,9 @@ func (e *eventMask) Enable(event whd.AsyncEventType) {
 }
 
 func (e *eventMask) IsEnabled(event whd.AsyncEventType) bool {
+	if int(event/8) >= len(e.events) {
+		return false // Event type received from the radio out of range.
+	}
 	return e.events[event/8]&(1<<(event%8)) != 0
 }
 
@@ -78,10 +82,23 @@ func (d *Device) update_credit(hdr *whd.SDPCMHeader) {
 		if (max - d.sdpcmSeq) > 0x40 {
 			max = d.sdpcmSeq + 2
 		}
+		prev := d.sdpcmSeqMax
 		d.sdpcmSeqMax = max
+		if d.onTxCredit != nil && max != prev && d.has_credit() {
+			d.onTxCredit(d.tx_credits())
+		}
+		d.credit_check()
 	}
 }
 
+// tx_credits returns the amount of frames the firmware can currently accept.
+func (d *Device) tx_credits() uint8 {
+	if !d.has_credit() {
+		return 0
+	}
+	return d.sdpcmSeqMax - d.sdpcmSeq
+}
+
 func (d *Device) has_credit() bool {
 	return d.sdpcmSeq != d.sdpcmSeqMax && (d.sdpcmSeqMax-d.sdpcmSeq)&0x80 == 0
 }
@@ -90,8 +107,8 @@ func (d *Device) has_credit() bool {
 const mtuPrefix = 2 + whd.SDPCM_HEADER_LEN + whd.BDC_HEADER_LEN
 const MTU = 2048 - mtuPrefix
 
-// tx transmits a SDPCM+BDC data packet to the device.
-func (d *Device) tx(packet []byte) (err error) {
+// tx transmits a SDPCM+BDC data packet to the device with the given 802.1d priority.
+func (d *Device) tx(packet []byte, prio Priority) (err error) {
 	if !d.IsLinkUp() {
 		return errLinkDown
 	}
@@ -105,8 +122,13 @@ func (d *Device) tx(packet []byte) (err error) {
 
 	const PADDING_SIZE = 2
 	totalLen := mtuPrefix + len(packet)
-	if totalLen > len(buf8) {
-		return errTxPacketTooLarge
+	if len(packet) > d.MTU() {
+		// Writing more than the F2 maximum packet size corrupts the FIFO.
+		return ErrFrameTooLarge
+	}
+	if !d.shapers[prio&7].allow(time.Now(), uint32(len(packet))) {
+		d.counters.TxShaped++
+		return ErrTxShaped
 	}
 	d.log_read()
 
@@ -128,13 +150,27 @@ func (d *Device) tx(packet []byte) (err error) {
 	d.lastSDPCMHeader.Put(_busOrder, buf8[:whd.SDPCM_HEADER_LEN])
 
 	d.auxBDCHeader = whd.BDCHeader{
-		Flags: 2 << 4, // BDC version.
+		Flags:    2 << 4, // BDC version.
+		Priority: uint8(prio & 7),
+	}
+	if d.csum&ChecksumTx != 0 {
+		d.auxBDCHeader.Flags |= whd.BDC_FLAG_SUM_NEEDED
 	}
 	d.auxBDCHeader.Put(buf8[whd.SDPCM_HEADER_LEN+PADDING_SIZE:])
 
 	copy(buf8[whd.SDPCM_HEADER_LEN+PADDING_SIZE+whd.BDC_HEADER_LEN:], packet)
 
-	return d.wlan_write(buf[:alignup(uint32(totalLen), 4)/4], uint32(totalLen))
+	err = d.wlan_write(buf[:alignup(uint32(totalLen), 4)/4], uint32(totalLen))
+	if err != nil {
+		if err == errFIFOOverflow {
+			d.sdpcmSeq = seq // Frame discarded, reuse its sequence number.
+		}
+		d.counters.TxErrors++
+		return err
+	}
+	d.counters.TxPackets++
+	d.counters.TxBytes += uint32(len(packet))
+	return nil
 }
 
 func (d *Device) get_iovar(VAR string, iface whd.IoctlInterface) (_ uint32, err error) {
@@ -164,11 +200,56 @@ func (d *Device) get_iovar_n(VAR string, iface whd.IoctlInterface, res []byte) (
 	return plen, err
 }
 
+// get_iovar_params is get_iovar_n for iovars which take input parameters after the
+// null terminated variable name. params must not alias the start of d._iovarBuf.
+func (d *Device) get_iovar_params(VAR string, iface whd.IoctlInterface, params, res []byte) (plen int, err error) {
+	buf8 := u32AsU8(d._iovarBuf[:])
+	if len(VAR)+1+len(params) > len(buf8) || len(res) > len(buf8) {
+		return 0, errIOVarTooLarge
+	}
+	length := copy(buf8[:], VAR)
+	buf8[length] = 0
+	length++
+	length += copy(buf8[length:], params)
+	totalLen := max(length, len(res))
+	for i := length; i < totalLen; i++ {
+		buf8[i] = 0 // Zero out where we'll read.
+	}
+	d.trace("get_iovar_params:ini", slog.String("var", VAR), slog.Int("reslen", totalLen))
+	plen, err = d.doIoctlGet(whd.WLC_GET_VAR, iface, buf8[:totalLen])
+	if plen > len(res) {
+		plen = len(res)
+	}
+	copy(res[:], buf8[:plen])
+	return plen, err
+}
+
+// iovarParamBuf returns a scratch buffer for building iovar parameters. It does not
+// overlap the start of _iovarBuf where set_iovar_n and get_iovar_params build the iovar.
+func (d *Device) iovarParamBuf() []byte {
+	return u32AsU8(d._iovarBuf[256:])
+}
+
 // reference: ioctl_set_u32
 func (d *Device) set_ioctl(cmd whd.SDPCMCommand, iface whd.IoctlInterface, val uint32) error {
 	return d.doIoctlSet(cmd, iface, u32PtrTo4U8(&val)[:4])
 }
 
+// get_ioctl gets an ioctl which returns a single uint32 value.
+func (d *Device) get_ioctl(cmd whd.SDPCMCommand, iface whd.IoctlInterface) (uint32, error) {
+	var buf [4]byte
+	_, err := d.doIoctlGet(cmd, iface, buf[:])
+	return _busOrder.Uint32(buf[:]), err
+}
+
+// set_ioctl2 sets an ioctl which takes two uint32 values.
+func (d *Device) set_ioctl2(cmd whd.SDPCMCommand, iface whd.IoctlInterface, val0, val1 uint32) error {
+	var buf [8]byte
+	_busOrder.PutUint32(buf[:4], val0)
+	_busOrder.PutUint32(buf[4:], val1)
+	return d.doIoctlSet(cmd, iface, buf[:])
+}
+
 func (d *Device) set_iovar(VAR string, iface whd.IoctlInterface, val uint32) error {
 	buf8 := u32AsU8(d._iovarBuf[256:]) // Safe to get offset.
 	copy(buf8[:4], u32PtrTo4U8(&val)[:4])
@@ -285,7 +366,11 @@ func (d *Device) sendIoctl(kind uint8, cmd whd.SDPCMCommand, iface whd.IoctlInte
 
 	copy(buf8[whd.SDPCM_HEADER_LEN+whd.CDC_HEADER_LEN:], data)
 
-	return d.wlan_write(buf[:alignup(totalLen, 4)/4], totalLen)
+	err = d.wlan_write(buf[:alignup(totalLen, 4)/4], totalLen)
+	if err == errFIFOOverflow {
+		d.sdpcmSeq = sdpcmSeq // Frame discarded, reuse its sequence number.
+	}
+	return err
 }
 
 // handle_irq waits for IRQ on F2 packet available
@@ -378,7 +463,7 @@ func (d *Device) pollForIoctl(buf []uint32) ([]byte, error) {
 		}
 		time.Sleep(10 * time.Millisecond)
 	}
-	return nil, errors.New("pollForIoctl timeout")
+	return nil, errPollForIoctlTimeout
 }
 
 // check_status handles F2 events while status register is set.
@@ -404,14 +489,30 @@ func (d *Device) tryPoll(buf []uint32) ([]byte, whd.SDPCMHeaderType, error) {
 	}
 	avail, length := d.f2PacketAvail()
 	if !avail {
+		d.credit_check()
 		return nil, whd.UNKNOWN_HEADER, errNoF2Avail
 	}
+	if int(length) > 4*len(buf) {
+		// Packet does not fit in buffer, have the chip discard it.
+		d.logerr("tryPoll:drop", slog.Uint64("len", uint64(length)), slog.Int("buflen", 4*len(buf)))
+		d.recordErr("rx", errRxPacketTooLarge)
+		d.glom = glomDesc{} // The dropped packet may be the announced superframe.
+		err := d.write8(FuncBackplane, whd.SPI_FRAME_CONTROL, whd.SFC_RF_TERM)
+		return nil, whd.UNKNOWN_HEADER, errjoin(errRxPacketTooLarge, err)
+	}
 	err := d.wlan_read(buf[:], int(length))
 	if err != nil {
+		d.glom = glomDesc{}
 		return nil, whd.UNKNOWN_HEADER, err
 	}
 	buf8 := u32AsU8(buf[:])
-	offset, plen, hdrType, err := d.rx(buf8[:length])
+	var offset, plen uint16
+	var hdrType whd.SDPCMHeaderType
+	if d.glom.n > 0 {
+		offset, plen, hdrType, err = d.rxSuperframe(buf8[:length])
+	} else {
+		offset, plen, hdrType, err = d.rx(buf8[:length])
+	}
 	if err != nil {
 		spuriousError := err == whd.ErrInvalidEtherType || err == errBDCInvalidLength || err == errEventBufferTooSmall
 		if spuriousError {
@@ -423,7 +524,10 @@ func (d *Device) tryPoll(buf []uint32) ([]byte, whd.SDPCMHeaderType, error) {
 				d.debug("tryPoll:ignore_spurious", slog.String("err", err.Error()))
 			}
 			err = nil
-		} else if d.logenabled(slog.LevelError) {
+		} else {
+			d.recordErr("rx", err)
+		}
+		if err != nil && d.logenabled(slog.LevelError) {
 			d.logerr("tryPoll:rx", slog.Uint64("plen", uint64(plen)), slog.String("err", err.Error()))
 		}
 	}
@@ -434,12 +538,16 @@ func (d *Device) rx(packet []byte) (offset, plen uint16, _ whd.SDPCMHeaderType,
 	d.trace("rx:start")
 	//reference: https://github.com/embassy-rs/embassy/blob/main/cyw43/src/runner.rs#L347
 	const requiredPacketSize = whd.SDPCM_HEADER_LEN + whd.BDC_HEADER_LEN + 1
-	if len(packet) < requiredPacketSize {
+	if len(packet) < whd.SDPCM_HEADER_LEN {
 		return 0, 0, noPacket, io.ErrShortBuffer
 	}
 
 	d.lastSDPCMHeader = whd.DecodeSDPCMHeader(_busOrder, packet)
 	hdrType := d.lastSDPCMHeader.Type()
+	if len(packet) < requiredPacketSize && hdrType != whd.GLOM_HEADER {
+		// Glom descriptors are the only frames without a BDC/CDC header.
+		return 0, 0, noPacket, io.ErrShortBuffer
+	}
 	d.debug("rx", slog.Int("len", len(packet)), slog.String("hdr", hdrType.String()))
 	payload, err := d.lastSDPCMHeader.Parse(packet)
 	if err != nil {
@@ -455,6 +563,8 @@ func (d *Device) rx(packet []byte) (offset, plen uint16, _ whd.SDPCMHeaderType,
 		err = d.rxEvent(payload)
 	case whd.DATA_HEADER:
 		err = d.rxData(payload)
+	case whd.GLOM_HEADER:
+		err = d.rxGlomDesc(payload)
 	default:
 		err = errInvalidIoctlCmdOrKind
 	}
@@ -462,6 +572,9 @@ func (d *Device) rx(packet []byte) (offset, plen uint16, _ whd.SDPCMHeaderType,
 }
 
 func (d *Device) rxControl(packet []byte) (offset, plen uint16, err error) {
+	if len(packet) < whd.CDC_HEADER_LEN {
+		return 0, 0, io.ErrShortBuffer
+	}
 	d.auxCDCHeader = whd.DecodeCDCHeader(_busOrder, packet)
 	if d.isTraceEnabled() {
 		d.trace("rxControl",
@@ -476,6 +589,9 @@ func (d *Device) rxControl(packet []byte) (offset, plen uint16, err error) {
 		d.logerr("rxControl:ioctlerror", slog.Uint64("status", uint64(d.auxCDCHeader.Status)))
 		return 0, 0, errRxIoctlStatus
 	}
+	if _, err = d.auxCDCHeader.Parse(packet); err != nil {
+		return 0, 0, err
+	}
 	offset = uint16(d.lastSDPCMHeader.HeaderLength + whd.CDC_HEADER_LEN)
 	// NB: losing some precision here (uint16(uint32)).
 	plen = uint16(d.auxCDCHeader.Length)
@@ -491,6 +607,7 @@ var (
 
 func (d *Device) rxEvent(packet []byte) (err error) {
 	d.trace("rxEvent:start")
+	d.counters.RxEvents++
 	var bdcHdr whd.BDCHeader
 	var aePacket whd.EventPacket
 	// Split packet into BDC header:payload.
@@ -522,55 +639,99 @@ func (d *Device) rxEvent(packet []byte) (err error) {
 		)
 	}
 	ev := aePacket.Message.EventType
+	d.dispatchEvent(&aePacket.Message, eventPayload(bdcPacket, &aePacket))
 	if !d.eventmask.IsEnabled(ev) {
 		return nil
 	}
 	switch ev {
 	case whd.EvAUTH:
 		if aePacket.Message.Status != 0 {
-			d.state = linkStateAuthFailed
-		} else if d.state == linkStateDown {
-			d.state = linkStateUpWaitForSSID
+			d.setLinkState(LinkStateAuthFailed)
+		} else if d.state == LinkStateAuthenticating {
+			d.setLinkState(LinkStateAssociated)
 		}
+	case whd.EvPSK_SUP:
+		const supKeyed = 6 // WLC_SUP_KEYED: supplicant handshake done, keys installed.
+		if aePacket.Message.Status == supKeyed && d.state == LinkStateAssociated {
+			d.setLinkState(LinkStateKeysInstalled)
+		}
+		d.supEvent(&aePacket.Message)
 	case whd.EvSET_SSID:
-		if aePacket.Message.Status == 0 && d.state == linkStateUpWaitForSSID {
-			d.state = linkStateUp // join operation ends with SET_SSID event
+		if aePacket.Message.Status == 0 && (d.state == LinkStateAssociated || d.state == LinkStateKeysInstalled) {
+			d.setLinkState(LinkStateUp) // join operation ends with SET_SSID event
 		} else if aePacket.Message.Status != 0 {
-			d.state = linkStateFailed
+			d.setLinkState(LinkStateFailed)
 		}
 	case whd.EvLINK:
 		if aePacket.Message.Flags&^1 == 0 { // 1 set on REASSOC.
-			d.state = linkStateWaitForReconnect // Disconnected, but will try to reconnect.
+			d.setLinkState(LinkStateReconnecting) // Disconnected, but will try to reconnect.
 		}
 	case whd.EvJOIN:
-		if d.state == linkStateWaitForReconnect {
-			d.state = linkStateUp
+		if d.state == LinkStateReconnecting {
+			d.setLinkState(LinkStateUp)
 		}
 	case whd.EvDEAUTH, whd.EvDISASSOC:
-		d.state = linkStateDown
-	}
+		d.setLinkState(LinkStateDown)
+	case whd.EvPFN_NET_FOUND:
+		d.pnoFound(eventPayload(bdcPacket, &aePacket))
+	case whd.EvRRM:
+		d.rrmEvent(eventPayload(bdcPacket, &aePacket))
+	case whd.EvACTION_FRAME_RX:
+		d.actionFrame(eventPayload(bdcPacket, &aePacket))
+	case whd.EvRSSI:
+		d.rssiEvent(eventPayload(bdcPacket, &aePacket))
+	case whd.EvIF:
+		d.ifEvent(&aePacket.Message, eventPayload(bdcPacket, &aePacket))
+	}
+	d.queueEvent(&aePacket.Message)
 	if d.logenabled(slog.LevelInfo) {
 		d.info("rxEvent",
 			slog.String("event", ev.String()),
 			slog.Uint64("status", uint64(aePacket.Message.Status)),
 			slog.Uint64("reason", uint64(aePacket.Message.Reason)),
 			slog.Uint64("flags", uint64(aePacket.Message.Flags)),
-			slog.Uint64("dev.linkstate", uint64(d.state)),
+			slog.String("dev.linkstate", d.state.String()),
 		)
 	}
 	return nil
 }
 
+// eventPayload returns the data following the event message in bdcPacket.
+func eventPayload(bdcPacket []byte, ev *whd.EventPacket) []byte {
+	payload := bdcPacket[72:]
+	if int(ev.Message.DataLen) < len(payload) {
+		payload = payload[:ev.Message.DataLen]
+	}
+	return payload
+}
+
 func (d *Device) rxData(packet []byte) (err error) {
 	d.trace("rxData:start")
-	if d.rcvEth != nil {
+	d.counters.RxPackets++
+	d.counters.RxBytes += uint32(len(packet))
+	if d.rcvEth != nil || d.onEAPOL != nil {
+		if len(packet) < whd.BDC_HEADER_LEN {
+			return errInvalidRxBDCHeaderLen
+		}
 		bdcHdr := whd.DecodeBDCHeader(packet)
 		packetStart := whd.BDC_HEADER_LEN + 4*int(bdcHdr.DataOffset)
 		if packetStart > len(packet) {
 			return errInvalidRxBDCHeaderLen
 		}
 		payload := packet[packetStart:]
-		return d.rcvEth(payload)
+		d.recordIRQLatency()
+		if d.onEAPOL != nil && isEAPOL(payload) {
+			d.onEAPOL(payload)
+			return nil
+		} else if d.rcvEth == nil {
+			return nil
+		} else if d.rxq.lens != nil {
+			return d.queueRx(payload)
+		}
+		d.rxSumGood = d.csum&ChecksumRx != 0 && bdcHdr.Flags&whd.BDC_FLAG_SUM_GOOD != 0
+		err = d.rcvEth(payload)
+		d.rxSumGood = false
+		return err
 	}
 	return nil
 }
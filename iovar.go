@@ -0,0 +1,38 @@
+package cyw43439
+
+import (
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+//go:generate go run ./internal/geniovar -o iovar_catalog.go
+
+// getCatalogVar reads a variable of the whd.IOVars catalog. If cmd is non-zero
+// the variable is read with the ioctl instead of the iovar name.
+func (d *Device) getCatalogVar(name string, cmd whd.SDPCMCommand) (uint32, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	if cmd != 0 {
+		return d.get_ioctl(cmd, whd.IF_STA)
+	}
+	return d.get_iovar(name, whd.IF_STA)
+}
+
+// setCatalogVar writes a variable of the whd.IOVars catalog. If cmd is non-zero
+// the variable is written with the ioctl instead of the iovar name.
+func (d *Device) setCatalogVar(name string, cmd whd.SDPCMCommand, val uint32) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("setCatalogVar", slog.String("var", name), slog.Uint64("val", uint64(val)))
+	if cmd != 0 {
+		return d.set_ioctl(cmd, whd.IF_STA, val)
+	}
+	return d.set_iovar(name, whd.IF_STA, val)
+}
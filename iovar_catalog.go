@@ -0,0 +1,422 @@
+// Code generated by "geniovar"; DO NOT EDIT.
+
+package cyw43439
+
+import "github.com/soypat/cyw43439/whd"
+
+// PM returns the power management mode: 0 disables power save, 1 is PM1 (PS-Poll) and 2 is PM2 (fast power save).
+func (d *Device) PM() (uint32, error) {
+	return d.getCatalogVar("pm", whd.WLC_GET_PM)
+}
+
+// SetPM sets the power management mode: 0 disables power save, 1 is PM1 (PS-Poll) and 2 is PM2 (fast power save).
+func (d *Device) SetPM(v uint32) error {
+	return d.setCatalogVar("pm", whd.WLC_SET_PM, v)
+}
+
+// Rate returns the current transmit rate in units of 500kbps.
+func (d *Device) Rate() (uint32, error) {
+	return d.getCatalogVar("rate", whd.WLC_GET_RATE)
+}
+
+// Infra returns whether the interface is in infrastructure (as opposed to ad-hoc) mode.
+func (d *Device) Infra() (bool, error) {
+	v, err := d.getCatalogVar("infra", whd.WLC_GET_INFRA)
+	return v != 0, err
+}
+
+// Auth returns the 802.11 authentication type: 0 is open system and 1 is shared key.
+func (d *Device) Auth() (uint32, error) {
+	return d.getCatalogVar("auth", whd.WLC_GET_AUTH)
+}
+
+// WSec returns the wireless security (cipher) bitmask of the interface.
+func (d *Device) WSec() (uint32, error) {
+	return d.getCatalogVar("wsec", whd.WLC_GET_WSEC)
+}
+
+// WPAAuth returns the WPA authenticated key management bitmask of the interface.
+func (d *Device) WPAAuth() (uint32, error) {
+	return d.getCatalogVar("wpa_auth", whd.WLC_GET_WPA_AUTH)
+}
+
+// AP returns whether the device is operating as an access point.
+func (d *Device) AP() (bool, error) {
+	v, err := d.getCatalogVar("ap", whd.WLC_GET_AP)
+	return v != 0, err
+}
+
+// ShortRetryLimit returns the amount of transmit retries for frames shorter than the RTS threshold.
+func (d *Device) ShortRetryLimit() (uint32, error) {
+	return d.getCatalogVar("srl", whd.WLC_GET_SRL)
+}
+
+// SetShortRetryLimit sets the amount of transmit retries for frames shorter than the RTS threshold.
+func (d *Device) SetShortRetryLimit(v uint32) error {
+	return d.setCatalogVar("srl", whd.WLC_SET_SRL, v)
+}
+
+// LongRetryLimit returns the amount of transmit retries for frames longer than the RTS threshold.
+func (d *Device) LongRetryLimit() (uint32, error) {
+	return d.getCatalogVar("lrl", whd.WLC_GET_LRL)
+}
+
+// SetLongRetryLimit sets the amount of transmit retries for frames longer than the RTS threshold.
+func (d *Device) SetLongRetryLimit(v uint32) error {
+	return d.setCatalogVar("lrl", whd.WLC_SET_LRL, v)
+}
+
+// AntennaDiversity returns the antenna selection mode: 0 and 1 select a fixed antenna and 3 enables diversity.
+func (d *Device) AntennaDiversity() (uint32, error) {
+	return d.getCatalogVar("antdiv", whd.WLC_GET_ANTDIV)
+}
+
+// SetAntennaDiversity sets the antenna selection mode: 0 and 1 select a fixed antenna and 3 enables diversity.
+func (d *Device) SetAntennaDiversity(v uint32) error {
+	return d.setCatalogVar("antdiv", whd.WLC_SET_ANTDIV, v)
+}
+
+// BeaconPeriod returns the beacon period in time units (1024us) used in AP mode.
+func (d *Device) BeaconPeriod() (uint32, error) {
+	return d.getCatalogVar("bcnprd", whd.WLC_GET_BCNPRD)
+}
+
+// SetBeaconPeriod sets the beacon period in time units (1024us) used in AP mode.
+func (d *Device) SetBeaconPeriod(v uint32) error {
+	return d.setCatalogVar("bcnprd", whd.WLC_SET_BCNPRD, v)
+}
+
+// DTIMPeriod returns the amount of beacons between DTIM beacons used in AP mode.
+func (d *Device) DTIMPeriod() (uint32, error) {
+	return d.getCatalogVar("dtimprd", whd.WLC_GET_DTIMPRD)
+}
+
+// SetDTIMPeriod sets the amount of beacons between DTIM beacons used in AP mode.
+func (d *Device) SetDTIMPeriod(v uint32) error {
+	return d.setCatalogVar("dtimprd", whd.WLC_SET_DTIMPRD, v)
+}
+
+// GMode returns the 802.11g mode: 0 is legacy 802.11b, 1 is auto and 2 is 802.11g only.
+func (d *Device) GMode() (uint32, error) {
+	return d.getCatalogVar("gmode", whd.WLC_GET_GMODE)
+}
+
+// SetGMode sets the 802.11g mode: 0 is legacy 802.11b, 1 is auto and 2 is 802.11g only.
+func (d *Device) SetGMode(v uint32) error {
+	return d.setCatalogVar("gmode", whd.WLC_SET_GMODE, v)
+}
+
+// Band returns the band selection: 0 is auto and 2 is 2.4GHz.
+func (d *Device) Band() (uint32, error) {
+	return d.getCatalogVar("band", whd.WLC_GET_BAND)
+}
+
+// SetBand sets the band selection: 0 is auto and 2 is 2.4GHz.
+func (d *Device) SetBand(v uint32) error {
+	return d.setCatalogVar("band", whd.WLC_SET_BAND, v)
+}
+
+// RoamScanPeriod returns the period in seconds between roam scans while the link is below the roam trigger.
+func (d *Device) RoamScanPeriod() (uint32, error) {
+	return d.getCatalogVar("roam_scan_period", whd.WLC_GET_ROAM_SCAN_PERIOD)
+}
+
+// SetRoamScanPeriod sets the period in seconds between roam scans while the link is below the roam trigger.
+func (d *Device) SetRoamScanPeriod(v uint32) error {
+	return d.setCatalogVar("roam_scan_period", whd.WLC_SET_ROAM_SCAN_PERIOD, v)
+}
+
+// TxPowerPercent returns the transmit power limit as a percentage (1-100) of the regulatory maximum.
+func (d *Device) TxPowerPercent() (uint32, error) {
+	return d.getCatalogVar("pwrout_percentage", whd.WLC_GET_PWROUT_PERCENTAGE)
+}
+
+// SetTxPowerPercent sets the transmit power limit as a percentage (1-100) of the regulatory maximum.
+func (d *Device) SetTxPowerPercent(v uint32) error {
+	return d.setCatalogVar("pwrout_percentage", whd.WLC_SET_PWROUT_PERCENTAGE, v)
+}
+
+// MPC returns whether minimum power consumption mode, which powers down the radio while not associated, is enabled.
+func (d *Device) MPC() (bool, error) {
+	v, err := d.getCatalogVar("mpc", 0)
+	return v != 0, err
+}
+
+// SetMPC sets whether minimum power consumption mode, which powers down the radio while not associated, is enabled.
+func (d *Device) SetMPC(v bool) error {
+	return d.setCatalogVar("mpc", 0, b2u32(v))
+}
+
+// PM2SleepRet returns the time in milliseconds the radio stays awake after activity before returning to sleep in PM2.
+func (d *Device) PM2SleepRet() (uint32, error) {
+	return d.getCatalogVar("pm2_sleep_ret", 0)
+}
+
+// SetPM2SleepRet sets the time in milliseconds the radio stays awake after activity before returning to sleep in PM2.
+func (d *Device) SetPM2SleepRet(v uint32) error {
+	return d.setCatalogVar("pm2_sleep_ret", 0, v)
+}
+
+// AssocListen returns the listen interval in beacons advertised to the access point on association.
+func (d *Device) AssocListen() (uint32, error) {
+	return d.getCatalogVar("assoc_listen", 0)
+}
+
+// SetAssocListen sets the listen interval in beacons advertised to the access point on association.
+func (d *Device) SetAssocListen(v uint32) error {
+	return d.setCatalogVar("assoc_listen", 0, v)
+}
+
+// ListenInterval returns the amount of DTIM periods slept through in power save. See SetListenInterval.
+func (d *Device) ListenInterval() (uint32, error) {
+	return d.getCatalogVar("bcn_li_dtim", 0)
+}
+
+// BeaconListenInterval returns the amount of beacon intervals slept through in power save. See SetBeaconListenInterval.
+func (d *Device) BeaconListenInterval() (uint32, error) {
+	return d.getCatalogVar("bcn_li_bcn", 0)
+}
+
+// BeaconTimeout returns the amount of consecutive missed beacons after which the link is considered lost.
+func (d *Device) BeaconTimeout() (uint32, error) {
+	return d.getCatalogVar("bcn_timeout", 0)
+}
+
+// SetBeaconTimeout sets the amount of consecutive missed beacons after which the link is considered lost.
+func (d *Device) SetBeaconTimeout(v uint32) error {
+	return d.setCatalogVar("bcn_timeout", 0, v)
+}
+
+// AMPDURx returns whether AMPDU reception is enabled. See SetAMPDU.
+func (d *Device) AMPDURx() (bool, error) {
+	v, err := d.getCatalogVar("ampdu_rx", 0)
+	return v != 0, err
+}
+
+// AMPDUTx returns whether AMPDU transmission is enabled. See SetAMPDU.
+func (d *Device) AMPDUTx() (bool, error) {
+	v, err := d.getCatalogVar("ampdu_tx", 0)
+	return v != 0, err
+}
+
+// AMPDUBAWSize returns the AMPDU block ack window size. See SetAMPDUWindow.
+func (d *Device) AMPDUBAWSize() (uint32, error) {
+	return d.getCatalogVar("ampdu_ba_wsize", 0)
+}
+
+// AMPDUMPDU returns the maximum amount of MPDUs per transmitted AMPDU. See SetAMPDUWindow.
+func (d *Device) AMPDUMPDU() (uint32, error) {
+	return d.getCatalogVar("ampdu_mpdu", 0)
+}
+
+// AMPDURxFactor returns the maximum receive AMPDU length exponent advertised to peers: the length is 2^(13+factor)-1 bytes.
+func (d *Device) AMPDURxFactor() (uint32, error) {
+	return d.getCatalogVar("ampdu_rx_factor", 0)
+}
+
+// SetAMPDURxFactor sets the maximum receive AMPDU length exponent advertised to peers: the length is 2^(13+factor)-1 bytes.
+func (d *Device) SetAMPDURxFactor(v uint32) error {
+	return d.setCatalogVar("ampdu_rx_factor", 0, v)
+}
+
+// FixedRate returns the fixed transmit rate or 0 for automatic rate control. See SetFixedRate.
+func (d *Device) FixedRate() (uint32, error) {
+	return d.getCatalogVar("nrate", 0)
+}
+
+// SGIRx returns the 802.11n short guard interval reception mode: -1 is auto, 0 disables and 1 enables it.
+func (d *Device) SGIRx() (int32, error) {
+	v, err := d.getCatalogVar("sgi_rx", 0)
+	return int32(v), err
+}
+
+// SetSGIRx sets the 802.11n short guard interval reception mode: -1 is auto, 0 disables and 1 enables it.
+func (d *Device) SetSGIRx(v int32) error {
+	return d.setCatalogVar("sgi_rx", 0, uint32(v))
+}
+
+// SGITx returns the 802.11n short guard interval transmission mode: -1 is auto, 0 disables and 1 enables it.
+func (d *Device) SGITx() (int32, error) {
+	v, err := d.getCatalogVar("sgi_tx", 0)
+	return int32(v), err
+}
+
+// SetSGITx sets the 802.11n short guard interval transmission mode: -1 is auto, 0 disables and 1 enables it.
+func (d *Device) SetSGITx(v int32) error {
+	return d.setCatalogVar("sgi_tx", 0, uint32(v))
+}
+
+// RTSThreshold returns the frame length in bytes above which RTS/CTS protection is used.
+func (d *Device) RTSThreshold() (uint32, error) {
+	return d.getCatalogVar("rtsthresh", 0)
+}
+
+// SetRTSThreshold sets the frame length in bytes above which RTS/CTS protection is used.
+func (d *Device) SetRTSThreshold(v uint32) error {
+	return d.setCatalogVar("rtsthresh", 0, v)
+}
+
+// FragThreshold returns the frame length in bytes above which frames are fragmented.
+func (d *Device) FragThreshold() (uint32, error) {
+	return d.getCatalogVar("fragthresh", 0)
+}
+
+// SetFragThreshold sets the frame length in bytes above which frames are fragmented.
+func (d *Device) SetFragThreshold(v uint32) error {
+	return d.setCatalogVar("fragthresh", 0, v)
+}
+
+// TxPower returns the maximum transmit power in quarter dBm. Setting bit 31 overrides regulatory limits.
+func (d *Device) TxPower() (uint32, error) {
+	return d.getCatalogVar("qtxpower", 0)
+}
+
+// SetTxPower sets the maximum transmit power in quarter dBm. Setting bit 31 overrides regulatory limits.
+func (d *Device) SetTxPower(v uint32) error {
+	return d.setCatalogVar("qtxpower", 0, v)
+}
+
+// TxDutyCycleCCK returns the maximum transmit duty cycle in percent for CCK (802.11b) rates. See SetTxDutyCycle.
+func (d *Device) TxDutyCycleCCK() (uint32, error) {
+	return d.getCatalogVar("dutycycle_cck", 0)
+}
+
+// TxDutyCycleOFDM returns the maximum transmit duty cycle in percent for OFDM rates. See SetTxDutyCycle.
+func (d *Device) TxDutyCycleOFDM() (uint32, error) {
+	return d.getCatalogVar("dutycycle_ofdm", 0)
+}
+
+// Chanspec returns the chanspec (channel, band and bandwidth) the interface is operating on.
+func (d *Device) Chanspec() (uint32, error) {
+	return d.getCatalogVar("chanspec", 0)
+}
+
+// AssocRetryMax returns the maximum amount of association attempts made per join.
+func (d *Device) AssocRetryMax() (uint32, error) {
+	return d.getCatalogVar("assoc_retry_max", 0)
+}
+
+// SetAssocRetryMax sets the maximum amount of association attempts made per join.
+func (d *Device) SetAssocRetryMax(v uint32) error {
+	return d.setCatalogVar("assoc_retry_max", 0, v)
+}
+
+// RoamOff returns whether roaming is disabled. See SetRoaming.
+func (d *Device) RoamOff() (bool, error) {
+	v, err := d.getCatalogVar("roam_off", 0)
+	return v != 0, err
+}
+
+// SupWPA returns whether the firmware's internal WPA supplicant is enabled.
+func (d *Device) SupWPA() (bool, error) {
+	v, err := d.getCatalogVar("sup_wpa", 0)
+	return v != 0, err
+}
+
+// SupWPATimeout returns the WPA supplicant handshake timeout in milliseconds.
+func (d *Device) SupWPATimeout() (uint32, error) {
+	return d.getCatalogVar("sup_wpa_tmo", 0)
+}
+
+// SetSupWPATimeout sets the WPA supplicant handshake timeout in milliseconds.
+func (d *Device) SetSupWPATimeout(v uint32) error {
+	return d.setCatalogVar("sup_wpa_tmo", 0, v)
+}
+
+// MFP returns the management frame protection (802.11w) mode: 0 disables, 1 enables and 2 requires it.
+func (d *Device) MFP() (uint32, error) {
+	return d.getCatalogVar("mfp", 0)
+}
+
+// SetMFP sets the management frame protection (802.11w) mode: 0 disables, 1 enables and 2 requires it.
+func (d *Device) SetMFP(v uint32) error {
+	return d.setCatalogVar("mfp", 0, v)
+}
+
+// WME returns whether Wi-Fi multimedia (WMM) QoS is enabled.
+func (d *Device) WME() (bool, error) {
+	v, err := d.getCatalogVar("wme", 0)
+	return v != 0, err
+}
+
+// SetWME sets whether Wi-Fi multimedia (WMM) QoS is enabled.
+func (d *Device) SetWME(v bool) error {
+	return d.setCatalogVar("wme", 0, b2u32(v))
+}
+
+// WMEAPSD returns whether WMM automatic power save delivery is enabled.
+func (d *Device) WMEAPSD() (bool, error) {
+	v, err := d.getCatalogVar("wme_apsd", 0)
+	return v != 0, err
+}
+
+// SetWMEAPSD sets whether WMM automatic power save delivery is enabled.
+func (d *Device) SetWMEAPSD(v bool) error {
+	return d.setCatalogVar("wme_apsd", 0, b2u32(v))
+}
+
+// MaxAssoc returns the maximum amount of stations which may associate in AP mode.
+func (d *Device) MaxAssoc() (uint32, error) {
+	return d.getCatalogVar("maxassoc", 0)
+}
+
+// SetMaxAssoc sets the maximum amount of stations which may associate in AP mode.
+func (d *Device) SetMaxAssoc(v uint32) error {
+	return d.setCatalogVar("maxassoc", 0, v)
+}
+
+// APSTA returns whether simultaneous AP and station operation is enabled.
+func (d *Device) APSTA() (bool, error) {
+	v, err := d.getCatalogVar("apsta", 0)
+	return v != 0, err
+}
+
+// ARPOffload returns whether ARP offload is enabled. See EnableARPOffload.
+func (d *Device) ARPOffload() (bool, error) {
+	v, err := d.getCatalogVar("arpoe", 0)
+	return v != 0, err
+}
+
+// NDOffload returns whether IPv6 neighbor discovery offload is enabled. See EnableNDOffload.
+func (d *Device) NDOffload() (bool, error) {
+	v, err := d.getCatalogVar("ndoe", 0)
+	return v != 0, err
+}
+
+// EDThreshold returns the energy-detect CCA threshold in dBm. See Config.EDThreshold.
+func (d *Device) EDThreshold() (int32, error) {
+	v, err := d.getCatalogVar("ed_thresh", 0)
+	return int32(v), err
+}
+
+// EDCRS returns whether energy-detect carrier sense (adaptivity) is enabled. See Config.Adaptivity.
+func (d *Device) EDCRS() (bool, error) {
+	v, err := d.getCatalogVar("edcrs", 0)
+	return v != 0, err
+}
+
+// BTCoexMode returns the Bluetooth coexistence mode: 0 disables coexistence and 1 enables it.
+func (d *Device) BTCoexMode() (uint32, error) {
+	return d.getCatalogVar("btc_mode", 0)
+}
+
+// SetBTCoexMode sets the Bluetooth coexistence mode: 0 disables coexistence and 1 enables it.
+func (d *Device) SetBTCoexMode(v uint32) error {
+	return d.setCatalogVar("btc_mode", 0, v)
+}
+
+// TxGlom returns whether the firmware aggregates multiple frames per bus transfer.
+func (d *Device) TxGlom() (bool, error) {
+	v, err := d.getCatalogVar("bus:txglom", 0)
+	return v != 0, err
+}
+
+// SetTxGlom sets whether the firmware aggregates multiple frames per bus transfer.
+func (d *Device) SetTxGlom(v bool) error {
+	return d.setCatalogVar("bus:txglom", 0, b2u32(v))
+}
+
+// CLMLoadStatus returns the status of the last CLM blob download: 0 means success.
+func (d *Device) CLMLoadStatus() (uint32, error) {
+	return d.getCatalogVar("clmload_status", 0)
+}
@@ -0,0 +1,54 @@
+package cyw43439
+
+import (
+	"errors"
+	"math/bits"
+	"net/netip"
+)
+
+var errIPMask = errors.New("invalid IPv4 subnet mask")
+
+// IPConfig is the IPv4 addressing of the network interface shared by the
+// network helpers, i.e: udpdriver.Config, dhcpclient leases and the examples'
+// stack setup, so applications switch between static and DHCP addressing by
+// setting or leaving zero a single field.
+type IPConfig struct {
+	// Addr is the static IPv4 address. The zero value selects DHCP.
+	Addr netip.Addr
+	// Mask is the subnet mask, i.e: 255.255.255.0.
+	Mask    netip.Addr
+	Gateway netip.Addr
+	// DNS are the DNS servers, unused entries are the zero value.
+	DNS [2]netip.Addr
+}
+
+// IsDHCP reports whether the address is to be obtained with DHCP, i.e: no static address is set.
+func (c IPConfig) IsDHCP() bool {
+	return !c.Addr.IsValid()
+}
+
+// Prefix returns the address and its network prefix given by Mask, i.e:
+// 192.168.1.10/24. It returns the zero Prefix if Addr is not set and an
+// error if Mask is not a valid IPv4 subnet mask.
+func (c IPConfig) Prefix() (netip.Prefix, error) {
+	if !c.Addr.IsValid() {
+		return netip.Prefix{}, nil
+	}
+	if !c.Mask.Is4() {
+		return netip.Prefix{}, errIPMask
+	}
+	m := c.Mask.As4()
+	mask := uint32(m[0])<<24 | uint32(m[1])<<16 | uint32(m[2])<<8 | uint32(m[3])
+	ones := bits.LeadingZeros32(^mask)
+	if mask<<ones != 0 {
+		return netip.Prefix{}, errIPMask // Not contiguous.
+	}
+	return c.Addr.Prefix(ones)
+}
+
+// IPMask returns the IPv4 subnet mask of a prefix of length bits, i.e: 255.255.255.0 for 24.
+func IPMask(bits int) netip.Addr {
+	bits = max(0, min(bits, 32))
+	mask := ^uint32(0) << (32 - bits) // Zero for bits=0, shifts past the width give zero.
+	return netip.AddrFrom4([4]byte{byte(mask >> 24), byte(mask >> 16), byte(mask >> 8), byte(mask)})
+}
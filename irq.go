@@ -0,0 +1,42 @@
+package cyw43439
+
+// This file filters the host-wake (IRQ) line for interrupt driven
+// applications. On the Pico W the IRQ line shares GPIO24 with the gSPI data
+// line, so every transaction toggles it and an edge interrupt handler sees
+// edges which are not interrupts. Acting on them, i.e: by polling, causes more
+// transactions and so more edges: an interrupt storm. Edges seen by MarkIRQ
+// while a transaction is in flight are therefore ignored and the interrupt
+// register is read once the driver releases the bus instead, since a real
+// interrupt asserted during a transaction leaves the line high without a new edge.
+
+// IRQPending reports whether an interrupt was signalled since the last call,
+// clearing it. Interrupts are signalled by calls to MarkIRQ from the IRQ pin's
+// edge interrupt handler outside of bus transactions and by the interrupt
+// register check the driver makes after edges were ignored. It is safe to call
+// from any goroutine without blocking:
+//
+//	for {
+//		if dev.IRQPending() {
+//			dev.PollOne()
+//		}
+//		// ...
+//	}
+func (d *Device) IRQPending() bool {
+	return d.irqPending.Swap(false)
+}
+
+// irqRecheck reads the interrupt register if MarkIRQ ignored edges during
+// transactions since the last check and signals an interrupt if any enabled
+// interrupt is pending. It must be called with the device acquired and
+// without a transaction in flight.
+func (d *Device) irqRecheck() {
+	if !d.irqMasked.Load() || d.mode == 0 || d.busAsleep {
+		return
+	}
+	irq := d.getInterrupts()
+	// Edges raised by the read above are ours; a pending interrupt is in irq.
+	d.irqMasked.Store(false)
+	if irq&d.irqEnable != 0 {
+		d.irqPending.Store(true)
+	}
+}
@@ -0,0 +1,98 @@
+package cyw43439
+
+import "time"
+
+// This file implements optional instrumentation of the latency between the
+// host-wake (IRQ) line asserting and the received packet being delivered to
+// the application, to help tune polling and interrupt configurations.
+// The instrumentation is inactive until the application calls MarkIRQ.
+
+const irqLatencyBuckets = 12
+
+// IRQLatencyStats is a histogram of latencies from a call to MarkIRQ
+// to the delivery of the next received packet to the RecvEthHandle handler.
+type IRQLatencyStats struct {
+	// Buckets[i] counts latencies below BucketLimit(i).
+	// The last bucket counts all latencies not counted by the other buckets.
+	Buckets [irqLatencyBuckets]uint32
+	// Count is the total amount of latencies recorded.
+	Count uint32
+	Min   time.Duration
+	Max   time.Duration
+	// Total is the sum of all recorded latencies.
+	Total time.Duration
+}
+
+// BucketLimit returns the exclusive upper limit of latencies counted by Buckets[i].
+// Limits start at 16µs and double with each bucket. The last bucket has no limit
+// and BucketLimit returns the maximum duration.
+func (s *IRQLatencyStats) BucketLimit(i int) time.Duration {
+	if i >= irqLatencyBuckets-1 {
+		return 1<<63 - 1
+	}
+	return 16 * time.Microsecond << i
+}
+
+// Mean returns the mean latency, or zero if no latencies were recorded.
+func (s *IRQLatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+func (s *IRQLatencyStats) record(latency time.Duration) {
+	i := 0
+	for i < irqLatencyBuckets-1 && latency >= s.BucketLimit(i) {
+		i++
+	}
+	s.Buckets[i]++
+	if s.Count == 0 || latency < s.Min {
+		s.Min = latency
+	}
+	if latency > s.Max {
+		s.Max = latency
+	}
+	s.Count++
+	s.Total += latency
+}
+
+// MarkIRQ timestamps the assertion of the host-wake (IRQ) line. It is meant to
+// be called from the pin's edge interrupt handler and is safe to call from an
+// interrupt context. The latency from the first MarkIRQ call to the delivery of the
+// next received packet is recorded in the histogram returned by IRQLatencyStats.
+// Edges during bus transactions are ignored and the interrupt is signalled
+// to IRQPending, see irq.go.
+func (d *Device) MarkIRQ() {
+	if d.spi.inTx.Load() {
+		d.irqMasked.Store(true) // Data line toggling, not an interrupt.
+		return
+	}
+	d.irqPending.Store(true)
+	d.irqMark.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+// IRQLatencyStats returns the histogram of latencies recorded since the
+// last call to ResetIRQLatencyStats. See MarkIRQ.
+func (d *Device) IRQLatencyStats() IRQLatencyStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.irqStats
+}
+
+// ResetIRQLatencyStats clears the latency histogram and any pending MarkIRQ timestamp.
+func (d *Device) ResetIRQLatencyStats() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.irqStats = IRQLatencyStats{}
+	d.irqMark.Store(0)
+}
+
+// recordIRQLatency records the latency since the pending MarkIRQ call, if any.
+func (d *Device) recordIRQLatency() {
+	mark := d.irqMark.Swap(0)
+	if mark == 0 {
+		return
+	}
+	d.irqStats.record(time.Duration(time.Now().UnixNano() - mark))
+}
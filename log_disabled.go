@@ -0,0 +1,11 @@
+//go:build cyw43439.nolog
+
+package cyw43439
+
+// This file removes the driver's logging at compile time: the logging methods
+// in debug.go reduce to empty functions which the compiler inlines away so
+// that logging neither takes code space nor perturbs bus timing. The logger
+// set with SetLogger or Config.Logger is ignored and the CYW43439 firmware
+// log is not read.
+
+const logBuild = false
@@ -0,0 +1,7 @@
+//go:build !cyw43439.nolog
+
+package cyw43439
+
+// logBuild enables the driver's logging. Build with the cyw43439.nolog tag to
+// remove it at compile time, see log_disabled.go.
+const logBuild = true
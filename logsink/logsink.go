@@ -0,0 +1,191 @@
+// Package logsink provides an allocation-free slog.Handler and log sinks for
+// microcontrollers, where writing logs to USB with print or a blocking writer
+// stalls the program indefinitely when no host is attached:
+//
+//   - Any io.Writer, i.e: machine.USBCDC, is a blocking sink suited to
+//     development with a host attached.
+//   - Dropping is a non-blocking sink, i.e: for a UART, which queues lines
+//     and drops them when its queue is full instead of waiting.
+//   - Ring keeps the most recent output in RAM so it can be read post-mortem,
+//     i.e: from a serial shell after a failure.
+//
+// Sinks are combined with Multi and passed to NewHandler:
+//
+//	ring := logsink.NewRing(4096)
+//	uart := logsink.NewDropping(machine.UART0, 1024)
+//	logger := slog.New(logsink.NewHandler(logsink.Multi(ring, uart), slog.LevelInfo))
+//	cfg := cyw43439.DefaultWifiConfig()
+//	cfg.Logger = logger
+//	// ... in the main loop:
+//	uart.Flush()
+package logsink
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLine is the maximum length of a log line, longer lines are truncated.
+const maxLine = 256
+
+// Handler is a slog.Handler which writes records as text lines without
+// allocating:
+//
+//	INFO msg key=value key2="quoted value"
+//
+// Lines longer than 256 bytes are truncated. The record time is not written
+// since microcontrollers are often without a wall clock.
+type Handler struct {
+	out    *output
+	level  slog.Leveler
+	attrs  []byte // Preformatted attributes added with WithAttrs.
+	prefix string // Group prefix of keys added with WithGroup.
+}
+
+// output is shared by a Handler and those derived from it with WithAttrs and WithGroup.
+type output struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf [maxLine]byte
+}
+
+// NewHandler returns a Handler writing records of at least level to w. A nil
+// level selects slog.LevelInfo. Each record is written with a single call to w.Write.
+func NewHandler(w io.Writer, level slog.Leveler) *Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &Handler{out: &output{w: w}, level: level}
+}
+
+// Enabled reports whether records of level are written.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes r as a line.
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	b := appendLevel(h.out.buf[:0], r.Level)
+	b = append(b, ' ')
+	b = append(b, r.Message...)
+	b = append(b, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		b = appendAttr(b, h.prefix, a)
+		return true
+	})
+	if len(b) >= maxLine {
+		b = b[:maxLine-1]
+	}
+	b = append(b, '\n')
+	_, err := h.out.w.Write(b)
+	return err
+}
+
+// WithAttrs returns a Handler which writes attrs with every record.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]byte(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = appendAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup returns a Handler which prefixes keys with name and a dot.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+func appendLevel(b []byte, level slog.Level) []byte {
+	name, base := "DEBUG", slog.LevelDebug
+	switch {
+	case level >= slog.LevelError:
+		name, base = "ERROR", slog.LevelError
+	case level >= slog.LevelWarn:
+		name, base = "WARN", slog.LevelWarn
+	case level >= slog.LevelInfo:
+		name, base = "INFO", slog.LevelInfo
+	}
+	b = append(b, name...)
+	if level != base {
+		if level > base {
+			b = append(b, '+')
+		}
+		b = strconv.AppendInt(b, int64(level-base), 10)
+	}
+	return b
+}
+
+func appendAttr(b []byte, prefix string, a slog.Attr) []byte {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "." // Groups are rare, allocating here is acceptable.
+		}
+		for _, ga := range v.Group() {
+			b = appendAttr(b, prefix, ga)
+		}
+		return b
+	} else if a.Key == "" {
+		return b
+	}
+	b = append(b, ' ')
+	b = append(b, prefix...)
+	b = append(b, a.Key...)
+	b = append(b, '=')
+	switch v.Kind() {
+	case slog.KindString:
+		b = appendString(b, v.String())
+	case slog.KindInt64:
+		b = strconv.AppendInt(b, v.Int64(), 10)
+	case slog.KindUint64:
+		b = strconv.AppendUint(b, v.Uint64(), 10)
+	case slog.KindBool:
+		b = strconv.AppendBool(b, v.Bool())
+	case slog.KindFloat64:
+		b = strconv.AppendFloat(b, v.Float64(), 'g', -1, 64)
+	case slog.KindDuration:
+		b = strconv.AppendInt(b, v.Duration().Microseconds(), 10)
+		b = append(b, "us"...)
+	case slog.KindTime:
+		b = v.Time().AppendFormat(b, time.RFC3339)
+	default:
+		switch x := v.Any().(type) {
+		case error:
+			b = appendString(b, x.Error())
+		case interface{ String() string }:
+			b = appendString(b, x.String())
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// appendString appends s, quoted if it is empty or contains spaces, quotes,
+// equal signs or non printable characters.
+func appendString(b []byte, s string) []byte {
+	quote := s == ""
+	for _, c := range s {
+		if c <= ' ' || c == '"' || c == '=' || c == utf8.RuneError || c >= 0x7f {
+			quote = true
+			break
+		}
+	}
+	if quote {
+		return strconv.AppendQuote(b, s)
+	}
+	return append(b, s...)
+}
@@ -0,0 +1,150 @@
+package logsink
+
+import (
+	"io"
+	"sync"
+)
+
+// Ring is a sink holding the most recent output in RAM, overwriting the
+// oldest when full. Writes never block or fail. It may be dumped at any time
+// with WriteTo, i.e: from a serial shell after a failure.
+type Ring struct {
+	mu  sync.Mutex
+	buf []byte
+	// n is the total amount of bytes written, the next byte is written to buf[n%len(buf)].
+	n uint64
+}
+
+// NewRing returns a Ring holding the last size bytes written.
+func NewRing(size int) *Ring {
+	return &Ring{buf: make([]byte, size)}
+}
+
+// Write stores p, overwriting the oldest output if needed. It always succeeds.
+func (r *Ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(p)
+	if len(r.buf) == 0 {
+		return n, nil
+	} else if len(p) > len(r.buf) {
+		r.n += uint64(len(p) - len(r.buf))
+		p = p[len(p)-len(r.buf):]
+	}
+	off := int(r.n % uint64(len(r.buf)))
+	c := copy(r.buf[off:], p)
+	copy(r.buf, p[c:])
+	r.n += uint64(len(p))
+	return n, nil
+}
+
+// WriteTo writes the stored output to w, oldest first. The Ring is not modified.
+func (r *Ring) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.n < uint64(len(r.buf)) {
+		n, err := w.Write(r.buf[:r.n])
+		return int64(n), err
+	}
+	off := int(r.n % uint64(len(r.buf)))
+	n1, err := w.Write(r.buf[off:])
+	if err != nil {
+		return int64(n1), err
+	}
+	n2, err := w.Write(r.buf[:off])
+	return int64(n1 + n2), err
+}
+
+// Len returns the amount of bytes stored.
+func (r *Ring) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.n < uint64(len(r.buf)) {
+		return int(r.n)
+	}
+	return len(r.buf)
+}
+
+// Reset discards the stored output.
+func (r *Ring) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.n = 0
+}
+
+// Dropping is a non-blocking sink which queues writes and drops those which
+// do not fit in its queue instead of waiting, so that a slow or stuck
+// destination such as a UART can not stall the program. Queued writes are
+// passed on to the destination by Flush, which should be called regularly
+// from the main loop.
+type Dropping struct {
+	mu    sync.Mutex
+	w     io.Writer
+	queue []byte
+	// pending is the amount of queued bytes at the start of queue.
+	pending int
+	dropped uint32
+	// flush is the buffer being written by Flush, swapped with queue.
+	flush []byte
+}
+
+// NewDropping returns a Dropping sink writing to w with a queue of size bytes.
+func NewDropping(w io.Writer, size int) *Dropping {
+	return &Dropping{w: w, queue: make([]byte, size), flush: make([]byte, size)}
+}
+
+// Write queues p if it fits entirely, otherwise it is dropped. It never
+// blocks on the destination and always succeeds.
+func (s *Dropping) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(p) > len(s.queue)-s.pending {
+		s.dropped++
+		return len(p), nil
+	}
+	s.pending += copy(s.queue[s.pending:], p)
+	return len(p), nil
+}
+
+// Flush writes the queued bytes to the destination. Writes to the Dropping
+// sink are not blocked while the destination is written. Flush must not be
+// called concurrently.
+func (s *Dropping) Flush() error {
+	s.mu.Lock()
+	s.queue, s.flush = s.flush, s.queue
+	n := s.pending
+	s.pending = 0
+	s.mu.Unlock()
+	if n == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.flush[:n])
+	return err
+}
+
+// Dropped returns the amount of writes dropped since the queue was full.
+func (s *Dropping) Dropped() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Multi returns a sink duplicating writes to each of sinks. Unlike
+// io.MultiWriter it writes to every sink even if one fails and returns the
+// first error.
+func Multi(sinks ...io.Writer) io.Writer {
+	return multi(append([]io.Writer(nil), sinks...))
+}
+
+type multi []io.Writer
+
+func (m multi) Write(p []byte) (int, error) {
+	var firstErr error
+	for _, w := range m {
+		_, err := w.Write(p)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return len(p), firstErr
+}
@@ -0,0 +1,75 @@
+package cyw43439
+
+import (
+	"crypto/rand"
+	"log/slog"
+	"net"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements MAC address randomization so that a device can not be
+// tracked across boots, or across scans, by its factory programmed address.
+// Random addresses are locally administered unicast addresses.
+
+// MACRandomMode selects when a random MAC address is used. See MACRandomization.
+type MACRandomMode uint8
+
+const (
+	// MACRandomOff uses the factory programmed MAC address.
+	MACRandomOff MACRandomMode = iota
+	// MACRandomPerBoot uses a random MAC address chosen by Init.
+	MACRandomPerBoot
+	// MACRandomPerScan uses a random MAC address chosen by Init and replaced
+	// by a new one each time a scan is started while not associated.
+	MACRandomPerScan
+)
+
+// MACRandomization configures the random MAC addresses of Config.MACRandomization.
+type MACRandomization struct {
+	Mode MACRandomMode
+	// KeepOUI preserves the organizationally unique identifier, the first three
+	// bytes, of the factory address so that the vendor remains identifiable,
+	// only setting its locally administered bit. Otherwise all bytes are random.
+	KeepOUI bool
+}
+
+// randomizeMAC sets a new random MAC address derived from the current one.
+// The interface must be down or the caller must bring it down around the call.
+func (d *Device) randomizeMAC() error {
+	mac := d.mac
+	random := mac[:]
+	if d.macRandom.KeepOUI {
+		random = mac[3:]
+	}
+	_, err := rand.Read(random)
+	if err != nil {
+		return err
+	}
+	mac[0] = mac[0]&^1 | 2 // Unicast, locally administered.
+	d.debug("randomizeMAC", slog.String("mac", net.HardwareAddr(mac[:]).String()))
+	err = d.set_iovar_n("cur_etheraddr", whd.IF_STA, mac[:])
+	if err != nil {
+		return err
+	}
+	d.mac = mac
+	return nil
+}
+
+// scanMAC replaces the MAC address before a scan if per scan randomization
+// is enabled and the device is not associated.
+func (d *Device) scanMAC() error {
+	if d.macRandom.Mode != MACRandomPerScan || d.state != LinkStateDown {
+		return nil
+	}
+	// The MAC address can only be changed while the interface is down.
+	err := d.doIoctlSet(whd.WLC_DOWN, whd.IF_STA, nil)
+	if err != nil {
+		return err
+	}
+	err = d.randomizeMAC()
+	if err != nil {
+		return err
+	}
+	return d.doIoctlSet(whd.WLC_UP, whd.IF_STA, nil)
+}
@@ -0,0 +1,238 @@
+// Package managed runs the CYW43439 driver on its own goroutines for
+// applications which use the TinyGo scheduler and want a concurrent API
+// without building it themselves.
+//
+// A receive goroutine polls the device, on interrupts signalled with
+// Driver.MarkIRQ or every PollInterval, and demultiplexes received packets
+// into a bounded queue read with Recv. A control goroutine runs the
+// operations passed to Do one at a time, so long operations such as joining
+// a network never run on the caller's goroutine:
+//
+//	drv, err := managed.Start(dev, managed.Config{})
+//	if err != nil {
+//		panic(err)
+//	}
+//	err = drv.Do(func(dev *cyw43439.Device) error {
+//		return dev.JoinWPA2(ssid, pass)
+//	})
+//	var buf [cyw43439.MTU]byte
+//	for {
+//		n, err := drv.Recv(buf[:]) // Blocks until a packet arrives.
+//		// ... pass buf[:n] to the stack.
+//	}
+//
+// Packets received while the queue is full are dropped and counted, see
+// RxDropped. Unlike package multicore the goroutines block on channels
+// instead of spinning so they cost nothing while the device is idle.
+package managed
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/soypat/cyw43439"
+)
+
+var errStopped = errors.New("managed: driver stopped")
+
+// Config configures a Driver.
+type Config struct {
+	// RxQueue is the amount of received packets buffered until read with Recv
+	// and CtlQueue the amount of operations queued with Do. Zero selects 4.
+	RxQueue  int
+	CtlQueue int
+	// PollInterval is the interval at which the device is polled when no
+	// interrupt is signalled. Zero selects 10ms.
+	PollInterval time.Duration
+}
+
+// request is an operation queued with Do.
+type request struct {
+	fn    func(dev *cyw43439.Device) error
+	reply chan error
+}
+
+// Driver runs the receive and control goroutines of a Device started with
+// Start. Its methods are safe for concurrent use.
+type Driver struct {
+	dev          *cyw43439.Device
+	mac          [6]byte
+	pollInterval time.Duration
+	rx           chan []byte // Received packets.
+	free         chan []byte // Receive buffers not in rx.
+	ctl          chan request
+	irq          chan struct{} // Signalled by MarkIRQ to wake rxLoop.
+	done         chan struct{}
+	stopOnce     sync.Once
+	wg           sync.WaitGroup
+	rxDropped    atomic.Uint32
+	pollErrs     atomic.Uint32
+}
+
+// Start starts the receive and control goroutines for dev, which must be
+// initialized. dev's RecvEthHandle handler is owned by the Driver until Stop.
+// Other Device methods remain safe to call directly.
+func Start(dev *cyw43439.Device, cfg Config) (*Driver, error) {
+	if cfg.RxQueue <= 0 {
+		cfg.RxQueue = 4
+	}
+	if cfg.CtlQueue <= 0 {
+		cfg.CtlQueue = 4
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 10 * time.Millisecond
+	}
+	mac, err := dev.HardwareAddr6()
+	if err != nil {
+		return nil, err
+	}
+	d := &Driver{
+		dev:          dev,
+		mac:          mac,
+		pollInterval: cfg.PollInterval,
+		rx:           make(chan []byte, cfg.RxQueue),
+		free:         make(chan []byte, cfg.RxQueue),
+		ctl:          make(chan request, cfg.CtlQueue),
+		irq:          make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	for i := 0; i < cfg.RxQueue; i++ {
+		d.free <- make([]byte, cyw43439.MTU)
+	}
+	dev.RecvEthHandle(d.demux)
+	d.wg.Add(2)
+	go d.rxLoop()
+	go d.ctlLoop()
+	return d, nil
+}
+
+// Stop stops the goroutines and waits for them to exit. Calls blocked in
+// Recv or Do return an error. The operation running in Do, if any, is
+// completed first.
+func (d *Driver) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+		d.wg.Wait()
+		d.dev.RecvEthHandle(nil)
+	})
+}
+
+// demux is the device's RecvEthHandle handler. It is called with the device
+// acquired so it never blocks: packets are dropped if no buffer is free.
+func (d *Driver) demux(pkt []byte) error {
+	select {
+	case buf := <-d.free:
+		n := copy(buf[:cap(buf)], pkt)
+		d.rx <- buf[:n] // Never blocks, rx and free share their buffers.
+	default:
+		d.rxDropped.Add(1)
+	}
+	return nil
+}
+
+// MarkIRQ signals an interrupt to the device, see Device.MarkIRQ, and wakes
+// the receive goroutine to poll it without waiting for PollInterval. It is
+// meant to be called from the IRQ pin's edge interrupt handler in place of
+// Device.MarkIRQ and never blocks.
+func (d *Driver) MarkIRQ() {
+	d.dev.MarkIRQ()
+	select {
+	case d.irq <- struct{}{}:
+	default: // Already signalled.
+	}
+}
+
+func (d *Driver) rxLoop() {
+	defer d.wg.Done()
+	timer := time.NewTimer(d.pollInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		gotPacket, err := d.dev.PollOne()
+		if err != nil {
+			d.pollErrs.Add(1)
+		}
+		if gotPacket || d.dev.IRQPending() {
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C: // Drain expired timer before Reset.
+			default:
+			}
+		}
+		timer.Reset(d.pollInterval)
+		select {
+		case <-d.done:
+			return
+		case <-d.irq:
+		case <-timer.C:
+		}
+	}
+}
+
+func (d *Driver) ctlLoop() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case req := <-d.ctl:
+			req.reply <- req.fn(d.dev)
+		}
+	}
+}
+
+// Do runs fn on the control goroutine and returns its error once it completes.
+// fn may call any Device method. Do blocks while the control queue is full.
+func (d *Driver) Do(fn func(dev *cyw43439.Device) error) error {
+	req := request{fn: fn, reply: make(chan error, 1)}
+	select {
+	case d.ctl <- req:
+	case <-d.done:
+		return errStopped
+	}
+	select {
+	case err := <-req.reply:
+		return err
+	case <-d.done:
+		return errStopped
+	}
+}
+
+// Recv blocks until a packet is received, copies it to buf and returns its
+// length. Packets longer than buf are truncated.
+func (d *Driver) Recv(buf []byte) (int, error) {
+	select {
+	case pkt := <-d.rx:
+		n := copy(buf, pkt)
+		d.free <- pkt
+		return n, nil
+	case <-d.done:
+		return 0, errStopped
+	}
+}
+
+// SendEth sends pkt on the calling goroutine, the device serializes it with
+// the receive and control goroutines. pkt is copied and may be reused once SendEth returns.
+func (d *Driver) SendEth(pkt []byte) error {
+	return d.dev.SendEth(pkt)
+}
+
+// HardwareAddr6 returns the device's MAC address as read by Start.
+func (d *Driver) HardwareAddr6() ([6]byte, error) { return d.mac, nil }
+
+// MTU returns the maximum size of packets passed to SendEth.
+func (d *Driver) MTU() int { return d.dev.MTU() }
+
+// RxDropped returns the amount of received packets dropped because the receive queue was full.
+func (d *Driver) RxDropped() uint32 { return d.rxDropped.Load() }
+
+// PollErrors returns the amount of errors returned by polling the device.
+func (d *Driver) PollErrors() uint32 { return d.pollErrs.Load() }
@@ -0,0 +1,199 @@
+// Package multicore runs the CYW43439 driver's poll loop on a dedicated core
+// of a multicore microcontroller such as the RP2040, freeing the other core
+// entirely for the application.
+//
+// Received and transmitted packets cross cores through lock-free
+// single-producer single-consumer rings and other device operations
+// (ioctls, iovars) are handed to the poll loop with Poller.Do, so only the
+// poll loop core accesses the bus:
+//
+//	poller, err := multicore.NewPoller(dev, multicore.Config{})
+//	if err != nil {
+//		panic(err)
+//	}
+//	go poller.Run()
+//	poller.RecvEthHandle(stack.RecvEth)
+//	for {
+//		poller.PollOne() // Cheap: only reads from the receive ring.
+//		// ... run application and stack.
+//	}
+//
+// TinyGo does not provide a way to pin a goroutine to a specific core. With the
+// multicore scheduler (-scheduler=cores) goroutines run in parallel on both
+// RP2040 cores so Run, which never blocks, occupies a core on its own as long as
+// the application keeps the other core busy. Run should be started before any
+// other long running goroutine for this reason.
+package multicore
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/soypat/cyw43439"
+)
+
+var errTxFull = errors.New("multicore: transmit ring full")
+
+// Config configures a Poller.
+type Config struct {
+	// RxSlots and TxSlots are the amount of packets buffered in each direction.
+	// They must be a power of two. Zero selects 4.
+	RxSlots int
+	TxSlots int
+	// IdleSleep is the duration Run sleeps for when there was no work to do.
+	// Zero makes Run busy poll which gives the lowest latency.
+	IdleSleep time.Duration
+}
+
+// request states.
+const (
+	reqIdle uint32 = iota
+	reqPending
+	reqDone
+)
+
+// Poller runs the driver's poll loop via Run and exposes a subset of the
+// Device networking API which is safe to call from another core.
+type Poller struct {
+	dev       *cyw43439.Device
+	mac       [6]byte
+	rx        *Ring
+	tx        *Ring
+	idleSleep time.Duration
+	rcvEth    func(pkt []byte) error
+	rxBuf     [cyw43439.MTU]byte
+	rxDropped atomic.Uint32
+	sendErrs  atomic.Uint32
+	pollErrs  atomic.Uint32
+	// Single slot request queue from the application core to the poll loop.
+	reqState atomic.Uint32
+	reqFn    func(dev *cyw43439.Device) error
+	reqErr   error
+}
+
+// NewPoller returns a Poller for dev, which must be initialized and
+// should not be used directly while Run is running.
+func NewPoller(dev *cyw43439.Device, cfg Config) (*Poller, error) {
+	if cfg.RxSlots == 0 {
+		cfg.RxSlots = 4
+	}
+	if cfg.TxSlots == 0 {
+		cfg.TxSlots = 4
+	}
+	mac, err := dev.HardwareAddr6()
+	if err != nil {
+		return nil, err
+	}
+	rx, err := NewRing(cfg.RxSlots, cyw43439.MTU)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := NewRing(cfg.TxSlots, cyw43439.MTU)
+	if err != nil {
+		return nil, err
+	}
+	return &Poller{dev: dev, mac: mac, rx: rx, tx: tx, idleSleep: cfg.IdleSleep}, nil
+}
+
+// Run is the poll loop. It services requests made with Do, sends packets
+// queued with SendEth and receives packets into the receive ring. It never returns.
+// Errors sending and polling are counted, see SendErrors and PollErrors.
+func (p *Poller) Run() {
+	p.dev.RecvEthHandle(func(pkt []byte) error {
+		if !p.rx.Push(pkt) {
+			p.rxDropped.Add(1)
+		}
+		return nil
+	})
+	var txBuf [cyw43439.MTU]byte
+	for {
+		idle := true
+		if p.reqState.Load() == reqPending {
+			p.reqErr = p.reqFn(p.dev)
+			p.reqState.Store(reqDone)
+			idle = false
+		}
+		for {
+			n, ok := p.tx.Pop(txBuf[:])
+			if !ok {
+				break
+			}
+			err := p.dev.SendEth(txBuf[:n])
+			if err != nil {
+				p.sendErrs.Add(1)
+			}
+			idle = false
+		}
+		gotPacket, err := p.dev.PollOne()
+		if err != nil {
+			p.pollErrs.Add(1)
+		}
+		if gotPacket {
+			continue
+		}
+		if idle && p.idleSleep > 0 {
+			time.Sleep(p.idleSleep)
+		} else if idle {
+			runtime.Gosched()
+		}
+	}
+}
+
+// Do runs fn on the poll loop core and returns its error, allowing the application
+// to use any Device method, i.e: ioctls and iovars, without touching the bus itself.
+// fn must not call Run. Do must only be called from one goroutine at a time.
+func (p *Poller) Do(fn func(dev *cyw43439.Device) error) error {
+	p.reqFn = fn
+	p.reqState.Store(reqPending) // Publish reqFn to the poll loop.
+	for p.reqState.Load() != reqDone {
+		runtime.Gosched()
+	}
+	err := p.reqErr
+	p.reqFn, p.reqErr = nil, nil
+	p.reqState.Store(reqIdle)
+	return err
+}
+
+// SendEth queues pkt to be sent by the poll loop. pkt is copied and may be reused
+// once SendEth returns. An error is returned if the transmit ring is full.
+// SendEth must only be called from one goroutine at a time.
+func (p *Poller) SendEth(pkt []byte) error {
+	if !p.tx.Push(pkt) {
+		return errTxFull
+	}
+	return nil
+}
+
+// RecvEthHandle sets the handler called by PollOne for received packets.
+// It must be called from the same goroutine as PollOne.
+func (p *Poller) RecvEthHandle(handler func(pkt []byte) error) {
+	p.rcvEth = handler
+}
+
+// PollOne passes the oldest received packet to the RecvEthHandle handler.
+// Returns true if a packet was available. It does not access the bus.
+// PollOne must only be called from one goroutine at a time.
+func (p *Poller) PollOne() (bool, error) {
+	n, ok := p.rx.Pop(p.rxBuf[:])
+	if !ok || p.rcvEth == nil {
+		return ok, nil
+	}
+	return true, p.rcvEth(p.rxBuf[:n])
+}
+
+// HardwareAddr6 returns the device's MAC address as read by NewPoller.
+func (p *Poller) HardwareAddr6() ([6]byte, error) { return p.mac, nil }
+
+// MTU returns the maximum size of packets passed to SendEth.
+func (p *Poller) MTU() int { return cyw43439.MTU }
+
+// RxDropped returns the amount of received packets dropped because the receive ring was full.
+func (p *Poller) RxDropped() uint32 { return p.rxDropped.Load() }
+
+// SendErrors returns the amount of packets queued with SendEth which the device failed to send.
+func (p *Poller) SendErrors() uint32 { return p.sendErrs.Load() }
+
+// PollErrors returns the amount of errors returned by polling the device.
+func (p *Poller) PollErrors() uint32 { return p.pollErrs.Load() }
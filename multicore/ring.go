@@ -0,0 +1,71 @@
+package multicore
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var errRingSize = errors.New("multicore: ring slots must be a power of two")
+
+// Ring is a lock-free single-producer single-consumer queue of packets stored
+// in fixed size slots. One goroutine (core) may call Push while another calls Pop
+// without further synchronization.
+type Ring struct {
+	buf      []byte
+	lens     []uint16
+	slotSize int
+	mask     uint32
+	// head is the amount of packets popped. Only written by the consumer.
+	head atomic.Uint32
+	// tail is the amount of packets pushed. Only written by the producer.
+	tail atomic.Uint32
+}
+
+// NewRing returns a Ring with the given amount of slots, which must be a
+// power of two, each able to hold a packet of up to slotSize bytes.
+func NewRing(slots, slotSize int) (*Ring, error) {
+	if slots <= 0 || slots&(slots-1) != 0 || slotSize > 0xffff {
+		return nil, errRingSize
+	}
+	return &Ring{
+		buf:      make([]byte, slots*slotSize),
+		lens:     make([]uint16, slots),
+		slotSize: slotSize,
+		mask:     uint32(slots - 1),
+	}, nil
+}
+
+// Push copies pkt into the next free slot. It returns false if the ring is
+// full or pkt does not fit in a slot. Must only be called by the producer.
+func (r *Ring) Push(pkt []byte) bool {
+	tail := r.tail.Load()
+	if len(pkt) > r.slotSize || tail-r.head.Load() > r.mask {
+		return false
+	}
+	i := tail & r.mask
+	r.lens[i] = uint16(copy(r.slot(i), pkt))
+	r.tail.Store(tail + 1) // Publish the slot to the consumer.
+	return true
+}
+
+// Pop copies the oldest packet into dst and returns its length. It returns
+// false if the ring is empty. If dst is too short the packet is truncated.
+// Must only be called by the consumer.
+func (r *Ring) Pop(dst []byte) (int, bool) {
+	head := r.head.Load()
+	if head == r.tail.Load() {
+		return 0, false
+	}
+	i := head & r.mask
+	n := copy(dst, r.slot(i)[:r.lens[i]])
+	r.head.Store(head + 1) // Return the slot to the producer.
+	return n, true
+}
+
+// Len returns the amount of packets in the ring.
+func (r *Ring) Len() int { return int(r.tail.Load() - r.head.Load()) }
+
+func (r *Ring) slot(i uint32) []byte {
+	off := int(i) * r.slotSize
+	return r.buf[off : off+r.slotSize]
+}
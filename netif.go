@@ -1,16 +1,51 @@
 package cyw43439
 
 import (
+	"encoding/binary"
 	"errors"
 	"log/slog"
 	"net"
+	"net/netip"
+	"time"
 
 	"github.com/soypat/cyw43439/whd"
 )
 
+// ErrFrameTooLarge is returned when sending a frame larger than MTU.
+var ErrFrameTooLarge = errors.New("frame larger than MTU")
+
+var (
+	errInvalidHardwareAddr = errors.New("invalid unicast hardware address")
+	errAnnounceAddr        = errors.New("announce address must be IPv4")
+	errAnnounceGroup       = errors.New("announce group must be IPv4 multicast")
+)
+
+const (
+	defaultAnnounceCount = 3
+	announceInterval     = 100 * time.Millisecond
+)
+
 // MTU (maximum transmission unit) returns the maximum amount
 // of bytes that can be sent in a single ethernet frame in a call to SendEth.
-func (d *Device) MTU() int { return MTU }
+// It is limited by the F2 maximum packet size reported by the chip on Init and
+// is at most the MTU constant. Larger frames are rejected with ErrFrameTooLarge.
+func (d *Device) MTU() int {
+	if d.f2MaxPacket == 0 {
+		return MTU
+	}
+	return min(MTU, int(d.f2MaxPacket)-mtuPrefix)
+}
+
+// RxMTU returns the maximum amount of bytes of an ethernet frame which can be
+// received. It is limited by the F2 maximum packet size and the receive
+// buffer set by Config.RxBuffer; larger frames are dropped by the chip.
+func (d *Device) RxMTU() int {
+	limit := 4 * len(d._rxBuf)
+	if d.f2MaxPacket != 0 {
+		limit = min(limit, int(d.f2MaxPacket))
+	}
+	return max(limit-mtuPrefix, 0)
+}
 
 // HardwareAddr6 returns the device's 6-byte [MAC address].
 //
@@ -36,6 +71,7 @@ func (d *Device) PollOne() (bool, error) {
 		return false, err
 	}
 	_, cmd, err := d.tryPoll(d._rxBuf[:])
+	d.ledUpdate()
 	if err == errNoF2Avail {
 		return false, nil
 	}
@@ -54,13 +90,39 @@ func (d *Device) RecvEthHandle(handler func(pkt []byte) error) {
 }
 
 // SendEth sends an Ethernet packet over the current interface.
+// pkt is copied to an internal buffer and may be reused once SendEth returns.
 func (d *Device) SendEth(pkt []byte) error {
 	err := d.acquire(modeWifi)
 	defer d.release()
 	if err != nil {
 		return err
 	}
-	return d.tx(pkt)
+	return d.tx(pkt, PriorityBestEffort)
+}
+
+// Priority is an 802.1d user priority (0-7). The firmware maps it to one of
+// the four WMM access categories which determine channel access latency.
+type Priority uint8
+
+// 802.1d priorities which map to each of the WMM access categories.
+const (
+	PriorityBestEffort Priority = 0 // AC_BE: default for regular traffic.
+	PriorityBackground Priority = 1 // AC_BK: bulk transfers which may be delayed.
+	PriorityVideo      Priority = 5 // AC_VI: low latency streams.
+	PriorityVoice      Priority = 6 // AC_VO: lowest latency, i.e: control loops.
+)
+
+// SendEthPriority is like SendEth but marks the packet with the 802.1d priority
+// prio, carried to the firmware in the BDC header. Access categories other than
+// best effort only receive preferential treatment when WME is enabled and the
+// access point supports WMM.
+func (d *Device) SendEthPriority(pkt []byte, prio Priority) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.tx(pkt, prio)
 }
 
 // NetFlags returns the current network flags for the device.
@@ -79,12 +141,178 @@ func (d *Device) NetFlags() (flags net.Flags) {
 		FlagMulticast                          // interface supports multicast access capability
 		FlagRunning                            // interface is in running state
 	)
-	if d.state == linkStateDown {
+	if d.state == LinkStateDown || d.state == LinkStateAuthenticating {
 		return 0
 	}
 	flags |= FlagUp // TODO: does this device support broadcast/multicast?
-	if d.state == linkStateUp {
+	if d.state == LinkStateUp {
 		flags |= FlagRunning
 	}
 	return flags
 }
+
+// TxCredits returns the amount of frames the firmware can currently accept
+// before SendEth has to wait for it to free buffers.
+func (d *Device) TxCredits() uint8 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tx_credits()
+}
+
+// OnTxCredit sets a callback invoked when the firmware returns transmit credits,
+// which signals frames previously sent with SendEth have been consumed. credits is
+// the amount of frames the firmware can accept. It may be used to implement backpressure.
+// The SDPCM protocol does not report per-frame transmit status so completion of a
+// specific frame cannot be observed. The callback is called while the device is
+// acquired so it must not call Device methods. Pass nil to remove the callback.
+func (d *Device) OnTxCredit(cb func(credits uint8)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onTxCredit = cb
+}
+
+// SetPromiscuous enables or disables promiscuous reception in which frames not
+// addressed to the device's MAC address are also passed to the RecvEthHandle handler.
+// Useful for bridging and monitoring applications.
+func (d *Device) SetPromiscuous(enable bool) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetPromiscuous", slog.Bool("enable", enable))
+	return d.set_ioctl(whd.WLC_SET_PROMISC, whd.IF_STA, b2u32(enable))
+}
+
+// SetHardwareAddr changes the device's MAC address, i.e: to pass through the
+// MAC address of a bridged host since an 802.11 station can only send frames
+// with its own source address. It must be called before joining a network.
+func (d *Device) SetHardwareAddr(mac [6]byte) error {
+	if mac[0]&1 != 0 || mac == [6]byte{} {
+		return errInvalidHardwareAddr
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetHardwareAddr", slog.String("mac", net.HardwareAddr(mac[:]).String()))
+	// The MAC address can only be changed while the interface is down.
+	err = d.doIoctlSet(whd.WLC_DOWN, whd.IF_STA, nil)
+	if err != nil {
+		return err
+	}
+	err = d.set_iovar_n("cur_etheraddr", whd.IF_STA, mac[:])
+	if err != nil {
+		return err
+	}
+	d.mac = mac
+	return d.doIoctlSet(whd.WLC_UP, whd.IF_STA, nil)
+}
+
+// AnnounceL2 sends gratuitous ARPs for ip from hwaddr so switches and the access
+// point learn the station's location and peers update their ARP caches immediately
+// after joining, avoiding loss of the first packets sent to the device. hwaddr is
+// usually the device's own address but may differ when bridging. An IGMPv2
+// membership report is sent after each ARP for every IPv4 multicast group in
+// groups so snooping switches and the access point forward the groups' traffic
+// without waiting for a router's query. The number of announcements sent is
+// set by Config.AnnounceCount and they are spaced 100ms apart.
+func (d *Device) AnnounceL2(hwaddr [6]byte, ip netip.Addr, groups ...netip.Addr) error {
+	if !ip.Is4() {
+		return errAnnounceAddr
+	} else if hwaddr[0]&1 != 0 || hwaddr == [6]byte{} {
+		return errInvalidHardwareAddr
+	}
+	for _, group := range groups {
+		if !group.Is4() || !group.IsMulticast() {
+			return errAnnounceGroup
+		}
+	}
+	// Gratuitous ARP request: sender and target protocol address are both ip.
+	// Padded to the minimum Ethernet frame length excluding FCS.
+	const (
+		ethHeaderLen = 14
+		arpLen       = 28
+	)
+	var frame [60]byte
+	copy(frame[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[6:12], hwaddr[:])
+	binary.BigEndian.PutUint16(frame[12:], 0x0806) // ARP EtherType.
+	arp := frame[ethHeaderLen : ethHeaderLen+arpLen]
+	binary.BigEndian.PutUint16(arp[0:], 1)      // Ethernet hardware type.
+	binary.BigEndian.PutUint16(arp[2:], 0x0800) // IPv4 protocol type.
+	arp[4] = 6
+	arp[5] = 4
+	binary.BigEndian.PutUint16(arp[6:], 1) // Request operation.
+	ip4 := ip.As4()
+	copy(arp[8:14], hwaddr[:])
+	copy(arp[14:18], ip4[:])
+	copy(arp[24:28], ip4[:])
+	var report [60]byte
+	n := max(d.announceCount, 1)
+	for i := 0; ; i++ {
+		err := d.announce(frame[:], ip)
+		for j := 0; err == nil && j < len(groups); j++ {
+			putIGMPReport(&report, hwaddr, ip4, groups[j].As4())
+			err = d.announce(report[:], groups[j])
+		}
+		if err != nil || i == n-1 {
+			return err
+		}
+		time.Sleep(announceInterval)
+	}
+}
+
+// putIGMPReport writes an IGMPv2 membership report for group sent from ip
+// into frame, which is zero padded to the minimum Ethernet frame length.
+// Reference: RFC 2236 and RFC 1112 section 6.4 for the group's MAC address.
+func putIGMPReport(frame *[60]byte, hwaddr [6]byte, ip, group [4]byte) {
+	const (
+		ethHeaderLen = 14
+		ipHeaderLen  = 24 // Includes the router alert option.
+		igmpLen      = 8
+	)
+	*frame = [60]byte{}
+	copy(frame[0:3], []byte{0x01, 0x00, 0x5e})
+	frame[3] = group[1] & 0x7f
+	frame[4] = group[2]
+	frame[5] = group[3]
+	copy(frame[6:12], hwaddr[:])
+	binary.BigEndian.PutUint16(frame[12:], 0x0800) // IPv4 EtherType.
+	iph := frame[ethHeaderLen : ethHeaderLen+ipHeaderLen]
+	iph[0] = 0x46 // Version 4, 6 word header.
+	binary.BigEndian.PutUint16(iph[2:], ipHeaderLen+igmpLen)
+	iph[8] = 1 // TTL, IGMP is link local.
+	iph[9] = 2 // IGMP protocol.
+	copy(iph[12:16], ip[:])
+	copy(iph[16:20], group[:])
+	copy(iph[20:24], []byte{0x94, 0x04, 0x00, 0x00}) // Router alert option.
+	binary.BigEndian.PutUint16(iph[10:], inetChecksum(iph))
+	igmp := frame[ethHeaderLen+ipHeaderLen : ethHeaderLen+ipHeaderLen+igmpLen]
+	igmp[0] = 0x16 // Version 2 membership report.
+	copy(igmp[4:8], group[:])
+	binary.BigEndian.PutUint16(igmp[2:], inetChecksum(igmp))
+}
+
+// inetChecksum returns the internet checksum of b, which must be of even length. Reference: RFC 1071.
+func inetChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func (d *Device) announce(frame []byte, ip netip.Addr) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.debug("AnnounceL2", slog.String("ip", ip.String()))
+	return d.tx(frame, PriorityBestEffort)
+}
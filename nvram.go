@@ -0,0 +1,177 @@
+package cyw43439
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// This file converts NVRAM, the board specific radio calibration and
+// configuration, from its text form to the binary form downloaded to the
+// chip: NUL terminated key=value entries followed by a NUL. Vendors ship
+// NVRAM either as plain text with one entry per line or as a C header of
+// concatenated string literals, i.e: wifi_nvram_43439.h of the Pico SDK.
+
+var (
+	errNVRAMEntry   = errors.New("NVRAM entry is not key=value")
+	errNVRAMLiteral = errors.New("invalid string literal in NVRAM header")
+	errNVRAMEmpty   = errors.New("NVRAM has no entries")
+	errNVRAMFormat  = errors.New("NVRAM not in binary format, see ParseNVRAM")
+)
+
+// ParseNVRAM converts NVRAM text to the binary format of Config.NVRAM. text
+// is either plain text with one key=value entry per line, where blank lines
+// and lines starting with # are ignored, or a C header whose string literals
+// concatenate to NUL separated entries, where preprocessor lines are ignored
+// and C escape sequences such as \0 are interpreted. The header format is
+// detected by the presence of a double quote.
+func ParseNVRAM(text string) (string, error) {
+	var entries []string
+	if strings.Contains(text, "\"") {
+		blob, err := nvramLiterals(text)
+		if err != nil {
+			return "", err
+		}
+		entries = strings.Split(blob, "\x00")
+	} else {
+		entries = strings.Split(text, "\n")
+	}
+	var b strings.Builder
+	n := 0
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || entry[0] == '#' {
+			continue
+		}
+		key, _, ok := strings.Cut(entry, "=")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return "", errNVRAMEntry
+		}
+		b.WriteString(entry)
+		b.WriteByte(0)
+		n++
+	}
+	if n == 0 {
+		return "", errNVRAMEmpty
+	}
+	b.WriteByte(0)
+	return b.String(), nil
+}
+
+// nvramLiterals returns the concatenation of the C string literals in src,
+// skipping comments and preprocessor lines such as #include "file.h".
+func nvramLiterals(src string) (string, error) {
+	var b strings.Builder
+	lineStart := true // Only whitespace since the start of the line.
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\n':
+			lineStart = true
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			continue
+		case c == '#' && lineStart:
+			// Skip the directive including continuation lines.
+			for i < len(src) && src[i] != '\n' {
+				if src[i] == '\\' && i+1 < len(src) && src[i+1] == '\n' {
+					i++
+				}
+				i++
+			}
+			i-- // Newline handled by the next iteration.
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return b.String(), nil
+			}
+			i += end - 1
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return b.String(), nil
+			}
+			i += end + 3
+		case c == '"':
+			n, err := unquoteC(&b, src[i+1:])
+			if err != nil {
+				return "", err
+			}
+			i += n + 1
+		}
+		lineStart = false
+	}
+	return b.String(), nil
+}
+
+// unquoteC writes the C string literal whose body starts at src to b,
+// interpreting C escape sequences, and returns the offset of its closing
+// double quote in src.
+func unquoteC(b *strings.Builder, src string) (int, error) {
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch c {
+		case '"':
+			return i, nil
+		case '\n':
+			return 0, errNVRAMLiteral
+		case '\\':
+		default:
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(src) {
+			break
+		}
+		switch c = src[i]; c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '\\', '\'', '"', '?':
+			b.WriteByte(c)
+		case 'x':
+			// Any amount of hex digits, the value must fit a byte.
+			end := i + 1
+			for end < len(src) && isHexDigit(src[end]) {
+				end++
+			}
+			v, err := strconv.ParseUint(src[i+1:end], 16, 8)
+			if err != nil {
+				return 0, errNVRAMLiteral
+			}
+			b.WriteByte(byte(v))
+			i = end - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// Up to 3 octal digits, i.e: \0.
+			end := i + 1
+			for end < len(src) && end < i+3 && src[end] >= '0' && src[end] <= '7' {
+				end++
+			}
+			v, err := strconv.ParseUint(src[i:end], 8, 8)
+			if err != nil {
+				return 0, errNVRAMLiteral
+			}
+			b.WriteByte(byte(v))
+			i = end - 1
+		default:
+			return 0, errNVRAMLiteral
+		}
+	}
+	return 0, errNVRAMLiteral // Unterminated.
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
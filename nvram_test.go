@@ -0,0 +1,59 @@
+package cyw43439
+
+import "testing"
+
+func TestNVRAMLiterals(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want string
+		err  error
+	}{
+		{name: "concat", src: `"a=1\x00" "b=2\x00"`, want: "a=1\x00b=2\x00"},
+		{name: "octal nul", src: `"a=1\0" "b=2\0"`, want: "a=1\x00b=2\x00"},
+		{name: "octal", src: `"\101\1010\60"`, want: "AA00"},
+		{name: "hex", src: `"\x41\x4a"`, want: "AJ"},
+		{name: "simple escapes", src: `"\"\\\'\?\t\n"`, want: "\"\\'?\t\n"},
+		{name: "include", src: "#include \"board.h\"\n\"a=1\\0\"", want: "a=1\x00"},
+		{name: "indented define", src: "  # define X \"x=1\"\n\"a=1\\0\"", want: "a=1\x00"},
+		{name: "continued define", src: "#define X \\\n \"x=1\"\n\"a=1\\0\"", want: "a=1\x00"},
+		{name: "hash in literal", src: "\"#a=1\\0\"", want: "#a=1\x00"},
+		{name: "comments", src: "// \"x=1\"\n/* \"y=2\" */ \"a=1\\0\"", want: "a=1\x00"},
+		{name: "array", src: "static const char nvram[] =\n\t\"a=1\\0\"\n\t\"b=2\\0\";\n", want: "a=1\x00b=2\x00"},
+		{name: "unterminated", src: `"a=1`, err: errNVRAMLiteral},
+		{name: "newline in literal", src: "\"a=1\n\"", err: errNVRAMLiteral},
+		{name: "unknown escape", src: `"\q"`, err: errNVRAMLiteral},
+		{name: "hex overflow", src: `"\x100"`, err: errNVRAMLiteral},
+		{name: "octal overflow", src: `"\777"`, err: errNVRAMLiteral},
+		{name: "empty hex", src: `"\xg"`, err: errNVRAMLiteral},
+	} {
+		got, err := nvramLiterals(tc.src)
+		if err != tc.err {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+		} else if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseNVRAM(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		text string
+		want string
+		err  error
+	}{
+		{name: "text", text: "# Comment\na=1\n\nb=2\n", want: "a=1\x00b=2\x00\x00"},
+		{name: "header", text: "#include <stdint.h>\nconst char n[] = \"a=1\\0\" \"b=2\\0\";", want: "a=1\x00b=2\x00\x00"},
+		{name: "no key", text: "=1\n", err: errNVRAMEntry},
+		{name: "space in key", text: "a b=1\n", err: errNVRAMEntry},
+		{name: "empty", text: "# Comment\n", err: errNVRAMEmpty},
+	} {
+		got, err := ParseNVRAM(tc.text)
+		if err != tc.err {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+		} else if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,558 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements configuration of firmware offloads which allow the
+// CYW43439 to keep network sessions alive and the device discoverable while
+// the host is sleeping.
+
+var (
+	errTKOAddrMismatch = errors.New("tko local and remote addresses must be same IP version")
+	errTKOPacketLen    = errors.New("tko request/response packets too large")
+	errTKOInterval     = errors.New("tko interval out of range")
+)
+
+// tko iovar subcommands. Reference: wl_tko_t in wlioctl.h.
+const (
+	tkoSubcmdMaxTCP  = 0
+	tkoSubcmdParam   = 1
+	tkoSubcmdConnect = 2
+	tkoSubcmdEnable  = 3
+	tkoSubcmdStatus  = 4
+	tkoHeaderLen     = 4
+	// Maximum length of a tko payload. Leaves room in _iovarBuf for iovar name and header.
+	tkoMaxDataLen = 512
+)
+
+// TKOParams are the TCP keepalive offload timing parameters common to all offloaded connections.
+type TKOParams struct {
+	// Interval between keepalive transmissions. Second resolution.
+	Interval time.Duration
+	// RetryInterval is the interval between keepalive retransmissions when no response is received.
+	RetryInterval time.Duration
+	// RetryCount is the amount of retransmissions before the connection is considered lost
+	// and a TKO event is raised.
+	RetryCount uint16
+}
+
+// TKOConnection describes a TCP connection whose keepalives are handled by the firmware.
+type TKOConnection struct {
+	// Index of the offloaded connection slot, 0 to TKOMaxConnections()-1.
+	Index      uint8
+	LocalAddr  netip.AddrPort
+	RemoteAddr netip.AddrPort
+	// Current local and remote TCP sequence numbers.
+	LocalSeq  uint32
+	RemoteSeq uint32
+	// Request is the keepalive packet (IP+TCP headers) sent by the firmware.
+	Request []byte
+	// Response is the expected keepalive response packet (IP+TCP headers).
+	Response []byte
+}
+
+// TKOMaxConnections returns the maximum amount of TCP connections the firmware can offload.
+func (d *Device) TKOMaxConnections() (int, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	buf := d.tkoBuf()
+	putTKOHeader(buf, tkoSubcmdMaxTCP, 0)
+	var res [tkoHeaderLen + 4]byte
+	_, err = d.get_iovar_params("tko", whd.IF_STA, buf[:tkoHeaderLen], res[:])
+	if err != nil {
+		return 0, err
+	}
+	return int(res[tkoHeaderLen]), nil
+}
+
+// SetTKOParams configures the TCP keepalive offload timing parameters.
+func (d *Device) SetTKOParams(params TKOParams) error {
+	interval := params.Interval / time.Second
+	retry := params.RetryInterval / time.Second
+	if interval <= 0 || interval > 0xffff || retry <= 0 || retry > 0xffff {
+		return errTKOInterval
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetTKOParams", slog.Duration("interval", params.Interval), slog.Uint64("retries", uint64(params.RetryCount)))
+	buf := d.tkoBuf()
+	const plen = 8
+	putTKOHeader(buf, tkoSubcmdParam, plen)
+	_busOrder.PutUint16(buf[tkoHeaderLen:], uint16(interval))
+	_busOrder.PutUint16(buf[tkoHeaderLen+2:], uint16(retry))
+	_busOrder.PutUint16(buf[tkoHeaderLen+4:], params.RetryCount)
+	_busOrder.PutUint16(buf[tkoHeaderLen+6:], 0) // Pad.
+	return d.set_iovar_n("tko", whd.IF_STA, buf[:tkoHeaderLen+plen])
+}
+
+// AddTKOConnection installs a TCP connection's 4-tuple, sequence numbers and
+// keepalive packets for the firmware to keep alive. Offloading must then be enabled with EnableTKO.
+func (d *Device) AddTKOConnection(conn TKOConnection) error {
+	local, remote := conn.LocalAddr.Addr(), conn.RemoteAddr.Addr()
+	if local.Is4() != remote.Is4() || !local.IsValid() || !remote.IsValid() {
+		return errTKOAddrMismatch
+	}
+	addrLen := 16
+	if local.Is4() {
+		addrLen = 4
+	}
+	const connHdrLen = 20
+	plen := connHdrLen + 2*addrLen + len(conn.Request) + len(conn.Response)
+	if plen > tkoMaxDataLen {
+		return errTKOPacketLen
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("AddTKOConnection", slog.Int("index", int(conn.Index)), slog.String("remote", conn.RemoteAddr.String()))
+	buf := d.tkoBuf()
+	putTKOHeader(buf, tkoSubcmdConnect, uint16(plen))
+	data := buf[tkoHeaderLen:]
+	data[0] = conn.Index
+	data[1] = uint8(b2u32(!local.Is4())) // 0=IPv4, 1=IPv6.
+	_busOrder.PutUint16(data[2:], conn.LocalAddr.Port())
+	_busOrder.PutUint16(data[4:], conn.RemoteAddr.Port())
+	_busOrder.PutUint16(data[6:], 0) // Pad.
+	_busOrder.PutUint32(data[8:], conn.LocalSeq)
+	_busOrder.PutUint32(data[12:], conn.RemoteSeq)
+	_busOrder.PutUint16(data[16:], uint16(len(conn.Request)))
+	_busOrder.PutUint16(data[18:], uint16(len(conn.Response)))
+	n := connHdrLen
+	n += copy(data[n:], local.AsSlice())
+	n += copy(data[n:], remote.AsSlice())
+	n += copy(data[n:], conn.Request)
+	n += copy(data[n:], conn.Response)
+	return d.set_iovar_n("tko", whd.IF_STA, buf[:tkoHeaderLen+n])
+}
+
+// EnableTKO enables or disables the firmware's TCP keepalive offload.
+// A whd.EvTKO event is raised when an offloaded connection is lost.
+func (d *Device) EnableTKO(enable bool) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("EnableTKO", slog.Bool("enable", enable))
+	buf := d.tkoBuf()
+	const plen = 4
+	putTKOHeader(buf, tkoSubcmdEnable, plen)
+	_busOrder.PutUint32(buf[tkoHeaderLen:], b2u32(enable)) // enable + 3 pad bytes.
+	if enable {
+		d.eventmask.Enable(whd.EvTKO)
+	} else {
+		d.eventmask.Disable(whd.EvTKO)
+	}
+	return d.set_iovar_n("tko", whd.IF_STA, buf[:tkoHeaderLen+plen])
+}
+
+func (d *Device) tkoBuf() []byte {
+	return d.iovarParamBuf()[:tkoHeaderLen+tkoMaxDataLen]
+}
+
+func putTKOHeader(buf []byte, subcmd, length uint16) {
+	_busOrder.PutUint16(buf, subcmd)
+	_busOrder.PutUint16(buf[2:], length)
+}
+
+// Maximum amount of host IP addresses the firmware stores for ARP and
+// neighbor discovery offload. Reference: ARP_MULTIHOMING_MAX in wlioctl.h.
+const offloadMaxHostIPs = 8
+
+var errOffloadAddr = errors.New("invalid address for offload")
+
+// ARP offload agent modes. Reference: ARP_OL_* in wlioctl.h.
+const (
+	arpOffloadAgent     = 0x1 // ARP_OL_AGENT
+	arpOffloadSnoop     = 0x2 // ARP_OL_SNOOP
+	arpOffloadHostAutoR = 0x4 // ARP_OL_HOST_AUTO_REPLY
+	arpOffloadPeerAutoR = 0x8 // ARP_OL_PEER_AUTO_REPLY
+)
+
+// EnableARPOffload enables the firmware's ARP agent which replies to ARP
+// requests for the given IPv4 host addresses while the host is sleeping.
+// At most 8 addresses may be registered. Passing no addresses disables ARP offload.
+func (d *Device) EnableARPOffload(hostIPs ...netip.Addr) error {
+	if len(hostIPs) > offloadMaxHostIPs {
+		return errOffloadAddr
+	}
+	for _, ip := range hostIPs {
+		if !ip.Is4() {
+			return errOffloadAddr
+		}
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("EnableARPOffload", slog.Int("n", len(hostIPs)))
+	err = d.set_iovar("arp_hostip_clear", whd.IF_STA, 0)
+	if err != nil {
+		return err
+	}
+	if len(hostIPs) == 0 {
+		return d.set_iovar("arpoe", whd.IF_STA, 0)
+	}
+	err = d.set_iovar("arp_ol", whd.IF_STA, arpOffloadAgent|arpOffloadSnoop|arpOffloadHostAutoR|arpOffloadPeerAutoR)
+	if err != nil {
+		return err
+	}
+	err = d.set_iovar("arpoe", whd.IF_STA, 1)
+	if err != nil {
+		return err
+	}
+	for _, ip := range hostIPs {
+		ip4 := ip.As4()
+		err = d.set_iovar("arp_hostip", whd.IF_STA, _busOrder.Uint32(ip4[:]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnableNDOffload enables the firmware's IPv6 neighbor discovery offload which
+// replies to neighbor solicitations for the given IPv6 host addresses while
+// the host is sleeping. At most 8 addresses may be registered. Passing no
+// addresses disables neighbor discovery offload.
+func (d *Device) EnableNDOffload(hostIPs ...netip.Addr) error {
+	if len(hostIPs) > offloadMaxHostIPs {
+		return errOffloadAddr
+	}
+	for _, ip := range hostIPs {
+		if !ip.Is6() || ip.Is4In6() {
+			return errOffloadAddr
+		}
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("EnableNDOffload", slog.Int("n", len(hostIPs)))
+	err = d.set_iovar_n("nd_hostip_clear", whd.IF_STA, nil)
+	if err != nil {
+		return err
+	}
+	if len(hostIPs) == 0 {
+		return d.set_iovar("ndoe", whd.IF_STA, 0)
+	}
+	err = d.set_iovar("ndoe", whd.IF_STA, 1)
+	if err != nil {
+		return err
+	}
+	for _, ip := range hostIPs {
+		ip16 := ip.As16()
+		err = d.set_iovar_n("nd_hostip", whd.IF_STA, ip16[:])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	errMDNSName     = errors.New("invalid mdns name")
+	errMDNSTooLarge = errors.New("mdns records too large")
+)
+
+// bdo (Bonjour dongle offload) iovar subcommands. Reference: wl_bdo_t in wlioctl.h.
+const (
+	bdoVersion           = 1
+	bdoSubcmdDownload    = 0
+	bdoSubcmdEnable      = 1
+	bdoSubcmdMaxDownload = 2
+	bdoHeaderLen         = 6
+	bdoDownloadHeaderLen = 8
+	// Length of the database fragments downloaded per bdo iovar.
+	bdoFragLen = 512
+	// Maximum length of the mDNS record database. It is built at the end of
+	// iovarParamBuf, after the fragment being downloaded.
+	mdnsMaxDBLen  = 1024
+	mdnsDBOffset  = bdoHeaderLen + bdoDownloadHeaderLen + bdoFragLen
+	mdnsDomain    = "local"
+	mdnsDefTTL    = 120 * time.Second
+	dnsTypeA      = 1
+	dnsTypePTR    = 12
+	dnsTypeTXT    = 16
+	dnsTypeAAAA   = 28
+	dnsTypeSRV    = 33
+	dnsClassIN    = 1
+	dnsCacheFlush = 0x8000
+)
+
+// MDNSService is a DNS-SD service instance answered by the firmware's mDNS offload.
+type MDNSService struct {
+	// Instance is the user visible service instance name, i.e: "Kitchen sensor".
+	Instance string
+	// Service is the service type and transport, i.e: "_http._tcp".
+	Service string
+	// Port the service listens on.
+	Port uint16
+	// TXT holds the service's key=value TXT record strings.
+	TXT []string
+}
+
+// MDNSRecords are the hostname and service records the firmware answers mDNS
+// queries for while the host is sleeping. Names are registered in the
+// ".local" domain.
+type MDNSRecords struct {
+	// Hostname without the ".local" suffix, i.e: "pico".
+	Hostname string
+	// Addrs are the IPv4 and IPv6 addresses answered for Hostname.
+	Addrs []netip.Addr
+	// Services are the service instances on Hostname.
+	Services []MDNSService
+	// TTL of the records. Second resolution. Zero selects 120 seconds.
+	TTL time.Duration
+}
+
+// MDNSOffloadMaxSize returns the maximum length in bytes of the mDNS record
+// database the firmware accepts. The database built by SetMDNSOffload for
+// the records is further limited to 1024 bytes.
+func (d *Device) MDNSOffloadMaxSize() (int, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	buf := d.iovarParamBuf()
+	putBDOHeader(buf, bdoSubcmdMaxDownload, 0)
+	var res [bdoHeaderLen + 4]byte
+	_, err = d.get_iovar_params("bdo", whd.IF_STA, buf[:bdoHeaderLen], res[:])
+	if err != nil {
+		return 0, err
+	}
+	return int(_busOrder.Uint16(res[bdoHeaderLen:])), nil
+}
+
+// SetMDNSOffload downloads the hostname address records and the PTR, SRV and
+// TXT records of each service to the firmware's mDNS offload. Offloading
+// must then be enabled with EnableMDNSOffload. The records replace any
+// previously downloaded ones.
+func (d *Device) SetMDNSOffload(records MDNSRecords) error {
+	if records.Hostname == "" {
+		return errMDNSName
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	buf := d.iovarParamBuf()
+	db := buf[mdnsDBOffset : mdnsDBOffset+mdnsMaxDBLen]
+	n, err := putMDNSRecords(db, &records)
+	if err != nil {
+		return err
+	}
+	d.info("SetMDNSOffload", slog.String("host", records.Hostname), slog.Int("services", len(records.Services)), slog.Int("len", n))
+	frag := buf[bdoHeaderLen+bdoDownloadHeaderLen:]
+	for off, num := 0, 0; off < n; off, num = off+bdoFragLen, num+1 {
+		flen := min(n-off, bdoFragLen)
+		putBDOHeader(buf, bdoSubcmdDownload, uint16(bdoDownloadHeaderLen+flen))
+		dl := buf[bdoHeaderLen:]
+		_busOrder.PutUint16(dl[0:], uint16(n))
+		_busOrder.PutUint16(dl[2:], uint16(num))
+		_busOrder.PutUint16(dl[4:], uint16(flen))
+		_busOrder.PutUint16(dl[6:], 0) // Pad.
+		copy(frag, db[off:off+flen])
+		err = d.set_iovar_n("bdo", whd.IF_STA, buf[:bdoHeaderLen+bdoDownloadHeaderLen+flen])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnableMDNSOffload enables or disables the firmware's answering of mDNS
+// queries for the records downloaded with SetMDNSOffload.
+func (d *Device) EnableMDNSOffload(enable bool) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("EnableMDNSOffload", slog.Bool("enable", enable))
+	buf := d.iovarParamBuf()
+	const plen = 4
+	putBDOHeader(buf, bdoSubcmdEnable, plen)
+	_busOrder.PutUint32(buf[bdoHeaderLen:], b2u32(enable)) // enable + 2 pad bytes.
+	return d.set_iovar_n("bdo", whd.IF_STA, buf[:bdoHeaderLen+plen])
+}
+
+func putBDOHeader(buf []byte, subcmd, length uint16) {
+	_busOrder.PutUint16(buf, bdoVersion)
+	_busOrder.PutUint16(buf[2:], subcmd)
+	_busOrder.PutUint16(buf[4:], length)
+}
+
+// putMDNSRecords writes the records as uncompressed DNS resource records in
+// wire format into dst and returns the amount of bytes written.
+func putMDNSRecords(dst []byte, rec *MDNSRecords) (int, error) {
+	ttl := rec.TTL
+	if ttl == 0 {
+		ttl = mdnsDefTTL
+	}
+	w := dnsWriter{buf: dst, ttl: uint32(ttl / time.Second)}
+	for _, addr := range rec.Addrs {
+		addr = addr.Unmap()
+		if !addr.IsValid() {
+			return 0, errOffloadAddr
+		}
+		typ := uint16(dnsTypeAAAA)
+		if addr.Is4() {
+			typ = dnsTypeA
+		}
+		start := w.record("", rec.Hostname, typ, true)
+		w.bytes(addr.AsSlice())
+		w.endRecord(start)
+	}
+	for i := range rec.Services {
+		svc := &rec.Services[i]
+		if svc.Instance == "" || svc.Service == "" {
+			return 0, errMDNSName
+		}
+		start := w.record("", svc.Service, dnsTypePTR, false)
+		w.name(svc.Instance, svc.Service)
+		w.endRecord(start)
+
+		start = w.record(svc.Instance, svc.Service, dnsTypeSRV, true)
+		w.u16(0) // Priority.
+		w.u16(0) // Weight.
+		w.u16(svc.Port)
+		w.name("", rec.Hostname)
+		w.endRecord(start)
+
+		start = w.record(svc.Instance, svc.Service, dnsTypeTXT, true)
+		if len(svc.TXT) == 0 {
+			w.u8(0) // A TXT record holds at least one, possibly empty, string.
+		}
+		for _, txt := range svc.TXT {
+			w.label(txt)
+		}
+		w.endRecord(start)
+	}
+	return w.n, w.err
+}
+
+// dnsWriter writes DNS resource records into buf. The first error is kept in
+// err and makes subsequent writes no-ops.
+type dnsWriter struct {
+	buf []byte
+	n   int
+	ttl uint32
+	err error
+}
+
+func (w *dnsWriter) grow(n int) []byte {
+	if w.err != nil {
+		return nil
+	}
+	if w.n+n > len(w.buf) {
+		w.err = errMDNSTooLarge
+		return nil
+	}
+	b := w.buf[w.n : w.n+n]
+	w.n += n
+	return b
+}
+
+func (w *dnsWriter) u8(v uint8) {
+	if b := w.grow(1); b != nil {
+		b[0] = v
+	}
+}
+
+func (w *dnsWriter) u16(v uint16) {
+	if b := w.grow(2); b != nil {
+		binary.BigEndian.PutUint16(b, v)
+	}
+}
+
+func (w *dnsWriter) bytes(v []byte) {
+	if b := w.grow(len(v)); b != nil {
+		copy(b, v)
+	}
+}
+
+// label writes a length prefixed string, used both for name labels and TXT strings.
+func (w *dnsWriter) label(s string) {
+	if len(s) > 255 {
+		w.err = errMDNSName
+		return
+	}
+	if b := w.grow(1 + len(s)); b != nil {
+		b[0] = uint8(len(s))
+		copy(b[1:], s)
+	}
+}
+
+// name writes the domain name formed by the single label instance, if not
+// empty, followed by the dot separated labels of domain and ".local".
+func (w *dnsWriter) name(instance, domain string) {
+	start := w.n
+	if instance != "" {
+		w.nameLabel(instance)
+	}
+	for domain != "" {
+		i := 0
+		for i < len(domain) && domain[i] != '.' {
+			i++
+		}
+		w.nameLabel(domain[:i])
+		domain = domain[min(i+1, len(domain)):]
+	}
+	w.nameLabel(mdnsDomain)
+	w.u8(0)
+	if w.err == nil && w.n-start > 255 {
+		w.err = errMDNSName
+	}
+}
+
+func (w *dnsWriter) nameLabel(s string) {
+	if len(s) == 0 || len(s) > 63 {
+		w.err = errMDNSName
+		return
+	}
+	w.label(s)
+}
+
+// record writes a resource record header up to its data length and returns
+// the offset endRecord fills the data length at. Unique records set the
+// mDNS cache flush bit.
+func (w *dnsWriter) record(instance, domain string, typ uint16, unique bool) int {
+	w.name(instance, domain)
+	class := uint16(dnsClassIN)
+	if unique {
+		class |= dnsCacheFlush
+	}
+	w.u16(typ)
+	w.u16(class)
+	if b := w.grow(4); b != nil {
+		binary.BigEndian.PutUint32(b, w.ttl)
+	}
+	w.u16(0) // Data length, filled by endRecord.
+	return w.n
+}
+
+func (w *dnsWriter) endRecord(start int) {
+	if w.err == nil {
+		binary.BigEndian.PutUint16(w.buf[start-2:], uint16(w.n-start))
+	}
+}
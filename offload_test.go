@@ -0,0 +1,50 @@
+package cyw43439
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestPutMDNSRecords(t *testing.T) {
+	var buf [mdnsMaxDBLen]byte
+	n, err := putMDNSRecords(buf[:], &MDNSRecords{
+		Hostname: "pico",
+		Addrs:    []netip.Addr{netip.MustParseAddr("192.168.1.2")},
+		Services: []MDNSService{{Instance: "Sensor", Service: "_http._tcp", Port: 80}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		host = "\x04pico\x05local\x00"
+		svc  = "\x05_http\x04_tcp\x05local\x00"
+		ttl  = "\x00\x00\x00\x78"
+	)
+	want := host + "\x00\x01\x80\x01" + ttl + "\x00\x04\xc0\xa8\x01\x02" +
+		svc + "\x00\x0c\x00\x01" + ttl + "\x00\x19" + "\x06Sensor" + svc +
+		"\x06Sensor" + svc + "\x00\x21\x80\x01" + ttl + "\x00\x12" + "\x00\x00\x00\x00\x00\x50" + host +
+		"\x06Sensor" + svc + "\x00\x10\x80\x01" + ttl + "\x00\x01" + "\x00"
+	if !bytes.Equal(buf[:n], []byte(want)) {
+		t.Errorf("got\n%q\nwant\n%q", buf[:n], want)
+	}
+
+	addrs := []netip.Addr{netip.MustParseAddr("fe80::1")}
+	for _, tc := range []struct {
+		name string
+		rec  MDNSRecords
+		err  error
+	}{
+		{name: "empty label", rec: MDNSRecords{Hostname: "pico..x", Addrs: addrs}, err: errMDNSName},
+		{name: "long label", rec: MDNSRecords{Hostname: strings.Repeat("a", 64), Addrs: addrs}, err: errMDNSName},
+		{name: "no instance", rec: MDNSRecords{Hostname: "pico", Services: []MDNSService{{Service: "_http._tcp"}}}, err: errMDNSName},
+		{name: "invalid addr", rec: MDNSRecords{Hostname: "pico", Addrs: []netip.Addr{{}}}, err: errOffloadAddr},
+		{name: "too large", rec: MDNSRecords{Hostname: "pico", Services: []MDNSService{{Instance: "a", Service: "_b._tcp", TXT: []string{strings.Repeat("x", 255), strings.Repeat("x", 255), strings.Repeat("x", 255), strings.Repeat("x", 255)}}}}, err: errMDNSTooLarge},
+	} {
+		_, err := putMDNSRecords(buf[:], &tc.rec)
+		if err != tc.err {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements reading the one time programmable (OTP) memory of the
+// CYW43439 where the module manufacturer stores per-unit data such as the
+// factory MAC address and calibration values in CIS tuple format.
+
+var errNoOTP = errors.New("chip reports no OTP memory")
+
+const (
+	// Size of the SPROM/OTP shadow region in ChipCommon. Unprogrammed words read as zero.
+	otpShadowSize = 0x400
+	// OTP size field in ChipCommon capabilities register. Reference: CC_CAP_OTPSIZE in sbchipc.h.
+	ccCapOTPSizeMask = 0x0038_0000
+
+	// CIS tuple codes used to store the MAC address. Reference: CISTPL_FUNCE/LAN_NID in bcmcdefs.h.
+	cisTupleFuncExt = 0x22
+	cisFuncExtLANID = 0x04
+)
+
+// ReadOTP reads the chip's OTP memory through the ChipCommon shadow region and
+// returns its raw contents. Use ParseOTPMAC to extract the factory MAC address.
+func (d *Device) ReadOTP() ([]byte, error) {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return nil, err
+	}
+	caps, err := d.bp_read32(whd.CHIPCOMMON_CAPABILITIES)
+	if err != nil {
+		return nil, err
+	}
+	d.debug("ReadOTP", slog.Uint64("caps", uint64(caps)))
+	if caps&ccCapOTPSizeMask == 0 {
+		return nil, errNoOTP
+	}
+	otp := make([]byte, otpShadowSize)
+	err = d.bp_read(whd.CHIPCOMMON_SROM_OTP, otp)
+	if err != nil {
+		return nil, err
+	}
+	return otp, nil
+}
+
+// ParseOTPMAC searches OTP contents returned by ReadOTP for the LAN node ID
+// CIS tuple containing the factory programmed MAC address.
+// ok is false if no valid MAC address was found.
+func ParseOTPMAC(otp []byte) (mac [6]byte, ok bool) {
+	// Tuple layout: code, length, function extension type, address length, address.
+	const tupleLen = 2 + 2 + 6
+	for i := 0; i+tupleLen <= len(otp); i++ {
+		if otp[i] != cisTupleFuncExt || otp[i+1] != 8 || otp[i+2] != cisFuncExtLANID || otp[i+3] != 6 {
+			continue
+		}
+		copy(mac[:], otp[i+4:])
+		if mac != [6]byte{} && mac != [6]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff} && mac[0]&1 == 0 {
+			return mac, true
+		}
+	}
+	return [6]byte{}, false
+}
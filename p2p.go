@@ -0,0 +1,253 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file exposes the raw ioctl layer with interface and bsscfg routing,
+// on which package experimental builds features still being worked out, and
+// the firmware calls creating additional P2P (Wi-Fi Direct) interfaces.
+//
+// The firmware addresses interfaces in two ways: ioctls are routed by the
+// interface index (wlc_if) in the CDC header while "bsscfg:" prefixed iovars
+// are sent on the primary interface with a leading bsscfg index. The indexes
+// of an interface are reported by the EvIF event once it is created.
+
+var errBsscfgIovar = errors.New("bsscfg iovar name or data too large")
+
+// P2P interface parameters. Reference: wl_p2p_if_t and WLC_E_IF in wlioctl.h.
+const (
+	p2pIfLen        = 10
+	ifEventLen      = 5
+	bsscfgIovarName = "bsscfg:"
+)
+
+// P2PRole is the role of a firmware P2P interface.
+type P2PRole uint8
+
+// P2P interface roles. Reference: WL_P2P_IF_*.
+const (
+	P2PClient     P2PRole = 0
+	P2PGroupOwner P2PRole = 1
+	// P2PDynamicBeaconGroupOwner is a group owner whose beacon is updated by the host.
+	P2PDynamicBeaconGroupOwner P2PRole = 2
+	// P2PDevice is the discovery interface, created with EnableP2PDiscovery instead.
+	P2PDevice P2PRole = 3
+)
+
+// InterfaceAction is the action reported by an InterfaceEvent.
+type InterfaceAction uint8
+
+// Interface actions. Reference: WLC_E_IF_ADD, WLC_E_IF_DEL and WLC_E_IF_CHANGE.
+const (
+	InterfaceAdded   InterfaceAction = 1
+	InterfaceDeleted InterfaceAction = 2
+	InterfaceChanged InterfaceAction = 3
+)
+
+// InterfaceEvent reports the creation, deletion or change of a firmware
+// interface. Ioctls are routed to it with whd.IoctlInterface(IfIdx) and
+// bsscfg iovars with BSSCfgIdx.
+type InterfaceEvent struct {
+	Action InterfaceAction
+	// MAC is the hardware address of the interface.
+	MAC       [6]byte
+	IfIdx     uint8
+	BSSCfgIdx uint8
+	// Flags holds the firmware's WLC_E_IF_FLAGS_* bits, i.e: bit 0 is set if
+	// no host interface need be created.
+	Flags uint8
+	// Role is the firmware's WLC_E_IF_ROLE_*, i.e: 2 for a P2P group owner.
+	Role uint8
+}
+
+// IoctlGet issues the get ioctl cmd on the firmware interface iface. data holds
+// the parameters, if any, and is overwritten with the response. It returns the
+// length of the response.
+func (d *Device) IoctlGet(cmd whd.SDPCMCommand, iface whd.IoctlInterface, data []byte) (int, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	return d.doIoctlGet(cmd, iface, data)
+}
+
+// IoctlSet issues the set ioctl cmd with data on the firmware interface iface.
+func (d *Device) IoctlSet(cmd whd.SDPCMCommand, iface whd.IoctlInterface, data []byte) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("IoctlSet", slog.String("cmd", cmd.String()), slog.String("iface", iface.String()), slog.Int("len", len(data)))
+	return d.doIoctlSet(cmd, iface, data)
+}
+
+// IovarGet reads the iovar name of the firmware interface iface into res.
+// params are the iovar's input parameters, if any. It returns the length read.
+func (d *Device) IovarGet(name string, iface whd.IoctlInterface, params, res []byte) (int, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	return d.get_iovar_params(name, iface, params, res)
+}
+
+// IovarSet writes val to the iovar name of the firmware interface iface.
+func (d *Device) IovarSet(name string, iface whd.IoctlInterface, val []byte) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("IovarSet", slog.String("var", name), slog.String("iface", iface.String()), slog.Int("len", len(val)))
+	return d.set_iovar_n(name, iface, val)
+}
+
+// BsscfgIovarGet reads the per-bsscfg iovar name, without the "bsscfg:"
+// prefix, of the bsscfg with index bsscfgIdx into res and returns the length read.
+func (d *Device) BsscfgIovarGet(name string, bsscfgIdx uint32, res []byte) (int, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	buf8 := u32AsU8(d._iovarBuf[:])
+	length, err := putBsscfgIovar(buf8, name, bsscfgIdx, nil)
+	if err != nil || len(res) > len(buf8) {
+		return 0, errBsscfgIovar
+	}
+	totalLen := max(length, len(res))
+	for i := length; i < totalLen; i++ {
+		buf8[i] = 0 // Zero out where we'll read.
+	}
+	plen, err := d.doIoctlGet(whd.WLC_GET_VAR, whd.IF_STA, buf8[:totalLen])
+	plen = min(plen, len(res))
+	copy(res, buf8[:plen])
+	return plen, err
+}
+
+// BsscfgIovarSet writes val to the per-bsscfg iovar name, without the
+// "bsscfg:" prefix, of the bsscfg with index bsscfgIdx.
+func (d *Device) BsscfgIovarSet(name string, bsscfgIdx uint32, val []byte) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("BsscfgIovarSet", slog.String("var", name), slog.Uint64("bsscfg", uint64(bsscfgIdx)), slog.Int("len", len(val)))
+	return d.set_bsscfg_iovar_n(name, bsscfgIdx, val)
+}
+
+// EnableP2PDiscovery enables or disables the P2P device (discovery)
+// interface. When enabling it returns the bsscfg index of the interface.
+func (d *Device) EnableP2PDiscovery(enable bool) (bsscfgIdx uint32, err error) {
+	err = d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	d.info("EnableP2PDiscovery", slog.Bool("enable", enable))
+	if enable {
+		err = d.set_fw_event(whd.EvIF, true)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = d.set_iovar("p2p_disc", whd.IF_STA, b2u32(enable))
+	if err != nil || !enable {
+		return 0, err
+	}
+	return d.get_iovar("p2p_dev", whd.IF_STA)
+}
+
+// AddP2PInterface creates a firmware interface with hardware address mac for
+// role P2PClient or a P2P group owner role. chanspec is the firmware chanspec
+// a group owner operates on, zero leaves the choice to the firmware. The new
+// interface's indexes are passed to the callback set with OnInterfaceEvent
+// once the firmware has created it.
+func (d *Device) AddP2PInterface(role P2PRole, mac [6]byte, chanspec uint16) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("AddP2PInterface", slog.Int("role", int(role)), slog.Uint64("chanspec", uint64(chanspec)))
+	var buf [p2pIfLen]byte
+	copy(buf[:6], mac[:])
+	buf[6] = byte(role)
+	binary.LittleEndian.PutUint16(buf[8:], chanspec)
+	err = d.set_fw_event(whd.EvIF, true)
+	if err != nil {
+		return err
+	}
+	return d.set_iovar_n("p2p_ifadd", whd.IF_STA, buf[:])
+}
+
+// RemoveP2PInterface deletes the firmware P2P interface with hardware address mac.
+func (d *Device) RemoveP2PInterface(mac [6]byte) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("RemoveP2PInterface")
+	return d.set_iovar_n("p2p_ifdel", whd.IF_STA, mac[:])
+}
+
+// OnInterfaceEvent sets the callback called when the firmware creates,
+// deletes or changes an interface. It is called from within the polling
+// functions with the Device locked so it must not call Device methods.
+func (d *Device) OnInterfaceEvent(cb func(InterfaceEvent)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onIfEvent = cb
+}
+
+// ifEvent handles the payload of an IF event, a wl_event_data_if_t.
+func (d *Device) ifEvent(msg *whd.EventMessage, payload []byte) {
+	if d.onIfEvent == nil || len(payload) < ifEventLen {
+		return
+	}
+	d.onIfEvent(InterfaceEvent{
+		Action:    InterfaceAction(payload[1]),
+		MAC:       msg.Addr,
+		IfIdx:     payload[0],
+		Flags:     payload[2],
+		BSSCfgIdx: payload[3],
+		Role:      payload[4],
+	})
+}
+
+// set_bsscfg_iovar_n sets the iovar "bsscfg:"+VAR of bsscfg bsscfgIdx to val.
+func (d *Device) set_bsscfg_iovar_n(VAR string, bsscfgIdx uint32, val []byte) error {
+	d.trace("set_bsscfg_iovar", slog.String("var", VAR))
+	buf8 := u32AsU8(d._iovarBuf[:])
+	length, err := putBsscfgIovar(buf8, VAR, bsscfgIdx, val)
+	if err != nil {
+		return err
+	}
+	return d.doIoctlSet(whd.WLC_SET_VAR, whd.IF_STA, buf8[:length])
+}
+
+// putBsscfgIovar writes the null terminated "bsscfg:"+VAR followed by the
+// bsscfg index and val to dst and returns the length written.
+func putBsscfgIovar(dst []byte, VAR string, bsscfgIdx uint32, val []byte) (int, error) {
+	if len(bsscfgIovarName)+len(VAR)+1+4+len(val) > len(dst) {
+		return 0, errBsscfgIovar
+	}
+	n := copy(dst, bsscfgIovarName)
+	n += copy(dst[n:], VAR)
+	dst[n] = 0
+	n++
+	_busOrder.PutUint32(dst[n:], bsscfgIdx)
+	n += 4
+	n += copy(dst[n:], val)
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements PHY level diagnostics to validate the RF layout of
+// custom boards, i.e: by comparing the per antenna RSSI and noise floor of
+// a board against a Pico W at the same location.
+
+var errPHYRSSIAnt = errors.New("short phy_rssi_ant response")
+
+const (
+	// maxRSSIAnt is WL_RSSI_ANT_MAX, the amount of antennas in wl_rssi_ant_t.
+	maxRSSIAnt = 4
+	// rssiAntLen is the length of wl_rssi_ant_t: version, count and the RSSIs.
+	rssiAntLen = 8 + maxRSSIAnt
+)
+
+// PHYStats are the PHY measurements of the link with the access point.
+type PHYStats struct {
+	// RSSI is the RSSI in dBm of frames from the access point per receive
+	// antenna (PHY core), of which Antennas are valid. The CYW43439 has one.
+	RSSI     [maxRSSIAnt]int8
+	Antennas uint8
+	// Noise is the noise floor in dBm measured by the PHY.
+	Noise int8
+	// CRSMin is the minimum received power in dBm at which carrier sense
+	// triggers. It is zero if not reported by the firmware.
+	CRSMin int8
+}
+
+// PHYStats returns the per antenna RSSI, noise floor and carrier sense
+// threshold of the PHY. The device must be associated.
+func (d *Device) PHYStats() (PHYStats, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return PHYStats{}, err
+	}
+	if !d.IsLinkUp() {
+		return PHYStats{}, errLinkDown
+	}
+	d.info("PHYStats")
+	var stats PHYStats
+	var buf [rssiAntLen]byte
+	n, err := d.get_iovar_n("phy_rssi_ant", whd.IF_STA, buf[:])
+	if err != nil {
+		return PHYStats{}, err
+	} else if n < rssiAntLen {
+		return PHYStats{}, errPHYRSSIAnt
+	}
+	stats.Antennas = uint8(min(binary.LittleEndian.Uint32(buf[4:]), maxRSSIAnt))
+	for i := range stats.RSSI[:stats.Antennas] {
+		stats.RSSI[i] = int8(buf[8+i])
+	}
+	noise, err := d.get_ioctl(whd.WLC_GET_PHY_NOISE, whd.IF_STA)
+	if err != nil {
+		return PHYStats{}, err
+	}
+	stats.Noise = int8(int32(noise))
+	crsmin, err := d.get_iovar("phy_crs_min_pwr", whd.IF_STA)
+	if err == nil {
+		stats.CRSMin = int8(int32(crsmin))
+	} else {
+		d.debug("PHYStats:no-crsmin", slog.String("err", err.Error()))
+	}
+	return stats, nil
+}
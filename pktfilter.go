@@ -0,0 +1,111 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// Packet filters are matched against received frames inside the CYW43439 so
+// that unwanted traffic is dropped before it reaches the host.
+// Reference: wl_pkt_filter_t in wlioctl.h.
+
+var (
+	errPatternFilterLen = errors.New("pattern filter mask and pattern must be of equal non-zero length")
+	errPatternTooLarge  = errors.New("pattern filter too large")
+)
+
+const (
+	pktFilterTypePattern = 0 // WL_PKT_FILTER_TYPE_PATTERN_MATCH
+	pktFilterHeaderLen   = 4 * 5
+	pktFilterMaxPattern  = 256
+)
+
+// PatternFilter is a packet filter matching received frames against a pattern.
+// A received frame matches if for every byte i of the pattern:
+//
+//	frame[Offset+i] & Mask[i] == Pattern[i]
+type PatternFilter struct {
+	// Offset within the received ethernet frame to start matching.
+	Offset uint32
+	// Mask is ANDed with received bytes before comparing with Pattern. Must be of same length as Pattern.
+	Mask    []byte
+	Pattern []byte
+	// Negate inverts the result of the pattern match.
+	Negate bool
+}
+
+// PacketFilterMode selects what the firmware does with frames that match enabled packet filters.
+type PacketFilterMode uint32
+
+const (
+	// PacketFilterDropOnMatch drops frames matching any enabled filter.
+	PacketFilterDropOnMatch PacketFilterMode = 0
+	// PacketFilterForwardOnMatch only forwards frames matching an enabled filter to the host.
+	PacketFilterForwardOnMatch PacketFilterMode = 1
+)
+
+// AddPacketFilter installs and enables a pattern matching packet filter with the given id.
+func (d *Device) AddPacketFilter(id uint8, pattern PatternFilter) error {
+	if len(pattern.Mask) != len(pattern.Pattern) || len(pattern.Pattern) == 0 {
+		return errPatternFilterLen
+	} else if len(pattern.Pattern) > pktFilterMaxPattern {
+		return errPatternTooLarge
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("AddPacketFilter", slog.Int("id", int(id)), slog.Int("len", len(pattern.Pattern)))
+	buf := d.iovarParamBuf()
+	_busOrder.PutUint32(buf[0:], uint32(id))
+	_busOrder.PutUint32(buf[4:], pktFilterTypePattern)
+	_busOrder.PutUint32(buf[8:], b2u32(pattern.Negate))
+	_busOrder.PutUint32(buf[12:], pattern.Offset)
+	_busOrder.PutUint32(buf[16:], uint32(len(pattern.Pattern)))
+	n := pktFilterHeaderLen
+	n += copy(buf[n:], pattern.Mask)
+	n += copy(buf[n:], pattern.Pattern)
+	err = d.set_iovar_n("pkt_filter_add", whd.IF_STA, buf[:n])
+	if err != nil {
+		return err
+	}
+	return d.enablePacketFilter(id, true)
+}
+
+// EnablePacketFilter enables or disables a previously added packet filter.
+func (d *Device) EnablePacketFilter(id uint8, enable bool) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.enablePacketFilter(id, enable)
+}
+
+// RemovePacketFilter deletes a previously added packet filter.
+func (d *Device) RemovePacketFilter(id uint8) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("RemovePacketFilter", slog.Int("id", int(id)))
+	return d.set_iovar("pkt_filter_delete", whd.IF_STA, uint32(id))
+}
+
+// SetPacketFilterMode sets the action taken on frames matching enabled packet filters.
+func (d *Device) SetPacketFilterMode(mode PacketFilterMode) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.set_iovar("pkt_filter_mode", whd.IF_STA, uint32(mode))
+}
+
+func (d *Device) enablePacketFilter(id uint8, enable bool) error {
+	return d.set_iovar2("pkt_filter_enable", whd.IF_STA, uint32(id), b2u32(enable))
+}
@@ -0,0 +1,174 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements preferred network offload (PNO), firmware scheduled
+// scans which raise an event when one of a list of networks comes in range
+// so that the host need not run periodic foreground scans.
+
+var errPNOConfig = errors.New("PNO requires 1..16 SSIDs of at most 32 bytes and interval of 10s..1h")
+
+// PNO parameters. Reference: wl_pfn_param_t and wl_pfn_t in wlioctl.h.
+const (
+	pnoMaxSSIDs     = 16
+	pnoVersion      = 2
+	pnoParamLen     = 24
+	pnoNetLen       = 56
+	pnoResultHdrLen = 12
+	pnoResultLen    = 44
+	// PFN flags.
+	pnoImmediateScan = 1 << 3
+	pnoHidden        = 1 << 2
+	pnoRepeat        = 4
+	pnoExpMax        = 3
+	wpaAuthPFNAny    = 0xffffffff
+	pnoLostTimeout   = 60 // seconds.
+
+	defaultPNOInterval = 30 * time.Second
+)
+
+// PNOConfig configures firmware scheduled scans.
+type PNOConfig struct {
+	// SSIDs are the networks to look for. At most 16.
+	SSIDs []string
+	// Hidden must be set if the networks do not broadcast their SSID so
+	// that they are probed for actively.
+	Hidden bool
+	// Interval is the time between scans. The firmware backs off up to 8
+	// times the interval while no network is found. Second resolution,
+	// zero selects 30s.
+	Interval time.Duration
+}
+
+// PNONetwork is a network found by a scheduled scan.
+type PNONetwork struct {
+	SSID    string
+	BSSID   [6]byte
+	Channel uint8
+	// RSSI in dBm.
+	RSSI int16
+}
+
+// StartPNO starts scheduled scans for cfg.SSIDs replacing any previous
+// configuration. The callback set with OnPNONetworkFound is called when one
+// of the networks comes in range. Scheduled scans are meant to be run while
+// not associated; call StopPNO before joining the found network. With
+// MACRandomPerScan a new random MAC address is used for the scans.
+func (d *Device) StartPNO(cfg PNOConfig) error {
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultPNOInterval
+	}
+	interval := cfg.Interval / time.Second
+	if len(cfg.SSIDs) == 0 || len(cfg.SSIDs) > pnoMaxSSIDs || interval < 10 || interval > 3600 {
+		return errPNOConfig
+	}
+	for _, ssid := range cfg.SSIDs {
+		if len(ssid) == 0 || len(ssid) > 32 {
+			return errPNOConfig
+		}
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("StartPNO", slog.Int("ssids", len(cfg.SSIDs)), slog.Duration("interval", cfg.Interval))
+	err = d.stopPNO()
+	if err != nil {
+		return err
+	}
+	err = d.scanMAC()
+	if err != nil {
+		return err
+	}
+	buf := d.iovarParamBuf()
+	param := buf[:pnoParamLen]
+	for i := range param {
+		param[i] = 0
+	}
+	_busOrder.PutUint32(param[0:], pnoVersion)
+	_busOrder.PutUint32(param[4:], uint32(interval))
+	_busOrder.PutUint32(param[8:], pnoLostTimeout)
+	_busOrder.PutUint16(param[12:], pnoImmediateScan)
+	param[18] = pnoRepeat
+	param[19] = pnoExpMax
+	err = d.set_iovar_n("pfn_set", whd.IF_STA, param)
+	if err != nil {
+		return err
+	}
+	for _, ssid := range cfg.SSIDs {
+		net := buf[:pnoNetLen]
+		for i := range net {
+			net[i] = 0
+		}
+		_busOrder.PutUint32(net[0:], uint32(len(ssid)))
+		copy(net[4:36], ssid)
+		if cfg.Hidden {
+			_busOrder.PutUint32(net[36:], pnoHidden)
+		}
+		_busOrder.PutUint32(net[40:], 1) // Infrastructure.
+		_busOrder.PutUint32(net[48:], wpaAuthPFNAny)
+		err = d.set_iovar_n("pfn_add", whd.IF_STA, net)
+		if err != nil {
+			return err
+		}
+	}
+	d.eventmask.Enable(whd.EvPFN_NET_FOUND)
+	return d.set_iovar("pfn", whd.IF_STA, 1)
+}
+
+// StopPNO stops scheduled scans and clears their configuration.
+func (d *Device) StopPNO() error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("StopPNO")
+	return d.stopPNO()
+}
+
+func (d *Device) stopPNO() error {
+	d.eventmask.Disable(whd.EvPFN_NET_FOUND)
+	err := d.set_iovar("pfn", whd.IF_STA, 0)
+	if err != nil {
+		return err
+	}
+	return d.set_iovar_n("pfnclear", whd.IF_STA, nil)
+}
+
+// OnPNONetworkFound sets the callback called for each network found by
+// scheduled scans. It is called from within the polling functions with the
+// Device locked so it must not call Device methods; it should signal another
+// goroutine to stop scheduled scans and join the network.
+func (d *Device) OnPNONetworkFound(cb func(PNONetwork)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onPNOFound = cb
+}
+
+// pnoFound handles the payload of a PFN_NET_FOUND event, a wl_pfn_scanresults_t.
+func (d *Device) pnoFound(payload []byte) {
+	if d.onPNOFound == nil || len(payload) < pnoResultHdrLen {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(payload[8:]))
+	payload = payload[pnoResultHdrLen:]
+	for i := 0; i < count && len(payload) >= pnoResultLen; i++ {
+		var net PNONetwork
+		copy(net.BSSID[:], payload[0:6])
+		net.Channel = payload[6]
+		ssidLen := min(int(payload[7]), 32)
+		net.SSID = string(payload[8 : 8+ssidLen])
+		net.RSSI = int16(binary.LittleEndian.Uint16(payload[40:]))
+		d.onPNOFound(net)
+		payload = payload[pnoResultLen:]
+	}
+}
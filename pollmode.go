@@ -0,0 +1,61 @@
+package cyw43439
+
+import (
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements pure polling operation for boards whose host-wake
+// (IRQ) line is not usable, i.e: not wired or shared with another function.
+// With Config.DisableIRQ the CYW43439 never asserts the line and the host
+// finds out about received packets by reading the gSPI status register, so
+// the driver works with only the CLK, DATA and CS lines plus WL_REG_ON.
+
+const (
+	defaultPollInterval = 10 * time.Millisecond
+	// maxPollFrames bounds the frames read by a single Poll call so that a
+	// traffic burst does not starve the application.
+	maxPollFrames = 32
+)
+
+// Poll reads the gSPI status register and processes the packets the
+// CYW43439 has available, returning the amount of packets read. Calls made
+// within Config.PollInterval of the last status register read return
+// immediately without accessing the bus, so Poll may be called in a tight
+// loop. Poll is the receive path of applications which set Config.DisableIRQ
+// but may be used with the IRQ line too.
+func (d *Device) Poll() (n int, err error) {
+	// Checked before acquire, which may verify or wake the bus.
+	d.mu.Lock()
+	early := time.Since(d.lastPoll) < d.pollInterval
+	d.mu.Unlock()
+	if early {
+		return 0, nil
+	}
+	err = d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	d.lastPoll = now
+	// Read the status explicitly, the cached status may be stale.
+	d.lastStatusGet = now
+	_, err = d.read32(FuncBus, whd.SPI_STATUS_REGISTER)
+	if err != nil {
+		return 0, err
+	}
+	for n < maxPollFrames {
+		_, _, err = d.tryPoll(d._rxBuf[:])
+		if err == errNoF2Avail {
+			err = nil
+			break
+		} else if err != nil {
+			break
+		}
+		n++
+	}
+	d.ledUpdate()
+	return n, err
+}
@@ -0,0 +1,134 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements a power measurement mode which sequences the chip
+// through its power states, holding each one for a fixed time, so the current
+// drawn on the VBAT and VDDIO rails can be measured with a current probe and
+// compared with the figures of the CYW43439 datasheet.
+
+var (
+	errPowerState     = errors.New("invalid power state")
+	errPowerTestOrder = errors.New("PowerDown must be the last power test state")
+)
+
+// PowerState is a chip power state entered by PowerTest.
+type PowerState uint8
+
+const (
+	// PowerIdle keeps the firmware running with power save disabled (PM0)
+	// and the bus awake, i.e: the receive current of an idle radio.
+	PowerIdle PowerState = iota
+	// PowerSleep enables PM2 power save and puts the bus to sleep so the chip
+	// may drop its HT clock between beacons, as with Sleep.
+	PowerSleep
+	// PowerDown drives WL_REG_ON low, powering down the chip. The firmware is
+	// lost so Init must be called before the Device is used again.
+	PowerDown
+)
+
+func (s PowerState) String() string {
+	switch s {
+	case PowerIdle:
+		return "idle"
+	case PowerSleep:
+		return "pm2-sleep"
+	case PowerDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// PowerTestConfig configures PowerTest.
+type PowerTestConfig struct {
+	// States are entered in order. If nil PowerIdle, PowerSleep and PowerDown
+	// are entered. PowerDown may only be the last state.
+	States []PowerState
+	// Hold is the time each state is held. Defaults to 5 seconds.
+	Hold time.Duration
+	// OnState, if not nil, is called once a state has been entered, i.e: to
+	// trigger a current probe capture. It is called with the Device locked
+	// so it must not call Device methods.
+	OnState func(PowerState)
+}
+
+// PowerTest sequences the chip through cfg.States holding each for cfg.Hold
+// so their current consumption can be measured. Joining a network first
+// measures the states with beacon reception. Other Device methods block until
+// it returns. The power management mode in use before the test is restored
+// unless the chip was powered down, PM2 parameters are left at those of the
+// default power save mode.
+func (d *Device) PowerTest(cfg PowerTestConfig) error {
+	states := cfg.States
+	if states == nil {
+		states = []PowerState{PowerIdle, PowerSleep, PowerDown}
+	}
+	for i, s := range states {
+		if s > PowerDown {
+			return errPowerState
+		} else if s == PowerDown && i != len(states)-1 {
+			return errPowerTestOrder
+		}
+	}
+	hold := cfg.Hold
+	if hold <= 0 {
+		hold = 5 * time.Second
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("PowerTest", slog.Int("states", len(states)), slog.Duration("hold", hold))
+	pm, err := d.get_ioctl(whd.WLC_GET_PM, whd.IF_STA)
+	if err != nil {
+		return err
+	}
+	for _, s := range states {
+		err = d.power_state(s)
+		if err != nil {
+			return err
+		}
+		d.debug("PowerTest:state", slog.String("state", s.String()))
+		if cfg.OnState != nil {
+			cfg.OnState(s)
+		}
+		time.Sleep(hold)
+	}
+	if d.mode == 0 {
+		return nil // Powered down.
+	}
+	err = d.bus_wake()
+	if err != nil {
+		return err
+	}
+	return d.set_ioctl(whd.WLC_SET_PM, whd.IF_STA, pm)
+}
+
+// power_state puts the chip in power state s.
+func (d *Device) power_state(s PowerState) error {
+	if s == PowerDown {
+		d.pwr(false)
+		d.resetState()
+		return nil
+	}
+	err := d.bus_wake()
+	if err != nil {
+		return err
+	}
+	if s == PowerIdle {
+		return d.set_power_management(pmNone)
+	}
+	err = d.set_power_management(pmPowerSave)
+	if err != nil {
+		return err
+	}
+	return d.bus_sleep()
+}
@@ -0,0 +1,126 @@
+package provision
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/soypat/cyw43439/udpdriver"
+	"github.com/soypat/seqs/eth/dhcp"
+)
+
+const (
+	dhcpLeaseSecs = 3600
+	dhcpPoolSize  = 4
+)
+
+// dhcpd is a minimal DHCP server handing out addresses following the device's
+// own to the stations which connect to the provisioning access point. The
+// device itself is advertised as router and DNS server so that every name
+// resolves to the configuration page.
+type dhcpd struct {
+	conn *udpdriver.Conn
+	addr netip.Prefix
+	pool [dhcpPoolSize][6]byte // MAC of station leased addr+1+index.
+	next int
+	rbuf [udpdriver.MaxPayload]byte
+	wbuf [dhcp.OptionsOffset + 64]byte
+}
+
+func (s *dhcpd) handle() {
+	n, _, err := s.conn.ReadFrom(s.rbuf[:])
+	if err != nil || n < dhcp.OptionsOffset || binary.BigEndian.Uint32(s.rbuf[dhcp.MagicCookieOffset:]) != dhcp.MagicCookie {
+		return
+	}
+	msg := s.rbuf[:n]
+	hdr := dhcp.DecodeHeaderV4(msg)
+	if hdr.OP != dhcp.OpRequest || hdr.HLen != 6 {
+		return
+	}
+	var typ dhcp.MessageType
+	var requested [4]byte
+	dhcp.ForEachOption(msg, func(opt dhcp.Option) error {
+		switch {
+		case opt.Num == dhcp.OptMessageType && len(opt.Data) == 1:
+			typ = dhcp.MessageType(opt.Data[0])
+		case opt.Num == dhcp.OptRequestedIPaddress && len(opt.Data) == 4:
+			copy(requested[:], opt.Data)
+		}
+		return nil
+	})
+	mac := [6]byte(hdr.CHAddr[:6])
+	yiaddr := s.lease(mac)
+	switch typ {
+	case dhcp.MsgDiscover:
+		s.reply(hdr, dhcp.MsgOffer, yiaddr)
+	case dhcp.MsgRequest:
+		if requested == ([4]byte{}) {
+			requested = hdr.CIAddr // Renewing.
+		}
+		if requested == yiaddr {
+			s.reply(hdr, dhcp.MsgAck, yiaddr)
+		} else {
+			s.reply(hdr, dhcp.MsgNak, [4]byte{})
+		}
+	}
+}
+
+// lease returns the address leased to mac, assigning one if necessary.
+func (s *dhcpd) lease(mac [6]byte) [4]byte {
+	i := 0
+	for ; i < len(s.pool); i++ {
+		if s.pool[i] == mac {
+			break
+		}
+	}
+	if i == len(s.pool) {
+		i = s.next
+		s.pool[i] = mac
+		s.next = (s.next + 1) % len(s.pool)
+	}
+	ip := s.addr.Addr().As4()
+	ip[3] += byte(1 + i)
+	return ip
+}
+
+func (s *dhcpd) reply(req dhcp.HeaderV4, typ dhcp.MessageType, yiaddr [4]byte) {
+	buf := s.wbuf[:]
+	for i := range buf {
+		buf[i] = 0
+	}
+	server := s.addr.Addr().As4()
+	hdr := dhcp.HeaderV4{
+		OP:     dhcp.OpReply,
+		HType:  1,
+		HLen:   6,
+		Xid:    req.Xid,
+		Flags:  req.Flags,
+		YIAddr: yiaddr,
+		SIAddr: server,
+		CHAddr: req.CHAddr,
+	}
+	hdr.Put(buf)
+	binary.BigEndian.PutUint32(buf[dhcp.MagicCookieOffset:], dhcp.MagicCookie)
+	ptr := dhcp.OptionsOffset
+	ptr += putOption(buf[ptr:], dhcp.OptMessageType, byte(typ))
+	ptr += putOption(buf[ptr:], dhcp.OptServerIdentification, server[:]...)
+	if typ != dhcp.MsgNak {
+		var mask [4]byte
+		binary.BigEndian.PutUint32(mask[:], ^uint32(0)<<(32-s.addr.Bits()))
+		var lease [4]byte
+		binary.BigEndian.PutUint32(lease[:], dhcpLeaseSecs)
+		ptr += putOption(buf[ptr:], dhcp.OptIPAddressLeaseTime, lease[:]...)
+		ptr += putOption(buf[ptr:], dhcp.OptSubnetMask, mask[:]...)
+		ptr += putOption(buf[ptr:], dhcp.OptRouter, server[:]...)
+		ptr += putOption(buf[ptr:], dhcp.OptDNSServers, server[:]...)
+	}
+	buf[ptr] = 0xff // End option.
+	ptr++
+	// Stations have no address yet so replies are broadcast.
+	s.conn.WriteTo(buf[:ptr], netip.AddrPortFrom(netip.AddrFrom4([4]byte{255, 255, 255, 255}), dhcp.DefaultClientPort))
+}
+
+func putOption(dst []byte, num dhcp.OptNum, data ...byte) int {
+	dst[0] = byte(num)
+	dst[1] = byte(len(data))
+	return 2 + copy(dst[2:], data)
+}
@@ -0,0 +1,56 @@
+package provision
+
+import (
+	"encoding/binary"
+
+	"github.com/soypat/cyw43439/udpdriver"
+	"github.com/soypat/seqs/eth/dns"
+)
+
+// captiveDNS answers every A query with the device's address so that stations
+// are directed to the configuration page whichever host they try to reach.
+type captiveDNS struct {
+	conn *udpdriver.Conn
+	addr [4]byte
+	buf  [dns.MaxSizeUDP]byte
+}
+
+func (s *captiveDNS) handle() {
+	n, from, err := s.conn.ReadFrom(s.buf[:])
+	if err != nil || n < dns.SizeHeader {
+		return
+	}
+	hdr := dns.DecodeHeader(s.buf[:])
+	if hdr.Flags.IsResponse() || hdr.QDCount != 1 {
+		return
+	}
+	// Find the end of the question.
+	off := dns.SizeHeader
+	for off < n && s.buf[off] != 0 {
+		if s.buf[off]&0xc0 != 0 {
+			return // Queries do not use compression.
+		}
+		off += 1 + int(s.buf[off])
+	}
+	off += 1 + 4 // Null label, type and class.
+	if off > n {
+		return
+	}
+	qtype := dns.Type(binary.BigEndian.Uint16(s.buf[off-4:]))
+	hdr.Flags |= 1<<15 | 1<<7 // Response, recursion available.
+	hdr.ANCount, hdr.NSCount, hdr.ARCount = 0, 0, 0
+	const answerLen = 2 + 2 + 2 + 4 + 2 + 4
+	if qtype == dns.TypeA && off+answerLen <= len(s.buf) {
+		hdr.ANCount = 1
+		ans := s.buf[off : off+answerLen]
+		binary.BigEndian.PutUint16(ans[0:], 0xc000|dns.SizeHeader) // Pointer to question name.
+		binary.BigEndian.PutUint16(ans[2:], uint16(dns.TypeA))
+		binary.BigEndian.PutUint16(ans[4:], uint16(dns.ClassINET))
+		binary.BigEndian.PutUint32(ans[6:], 60) // TTL.
+		binary.BigEndian.PutUint16(ans[10:], 4)
+		copy(ans[12:], s.addr[:])
+		off += answerLen
+	}
+	hdr.Put(s.buf[:])
+	s.conn.WriteTo(s.buf[:off], from)
+}
@@ -0,0 +1,285 @@
+package provision
+
+import (
+	"bytes"
+	"html"
+	"net/netip"
+	"net/url"
+	"strconv"
+
+	"github.com/soypat/cyw43439/udpdriver"
+	"github.com/soypat/seqs"
+	"github.com/soypat/seqs/eth"
+)
+
+const (
+	tcpProto     = 6
+	httpPort     = 80
+	segQueueLen  = 4
+	maxRequest   = 1024
+	maxConns     = 4
+	sendMSS      = 536 // Minimum MSS every TCP implementation accepts.
+	recvWindow   = maxRequest
+	maxSegLength = 1500 - eth.SizeIPv4Header
+)
+
+// httpd is a tiny HTTP/1.0 responder serving the configuration form over a
+// minimal TCP implementation. Connections are handled without per connection
+// TCP state beyond the request bytes received so far: the initial sequence
+// number is derived from the peer's address and port, responses are sent at
+// once followed by FIN and are never retransmitted. A lost response is resent
+// when the peer retransmits its request.
+type httpd struct {
+	stack  *udpdriver.Stack
+	local  [4]byte
+	secret uint32
+	queue  [segQueueLen]segment
+	conns  [maxConns]httpConn
+	next   int
+	// msg is shown above the form, i.e: why the previous credentials failed.
+	msg string
+	// ssid and pass are set once credentials are submitted.
+	ssid, pass string
+	done       bool
+	txbuf      [eth.SizeTCPHeader + sendMSS]byte
+	page       bytes.Buffer
+}
+
+type segment struct {
+	src  [4]byte
+	n    int
+	used bool
+	buf  [maxSegLength]byte
+}
+
+type httpConn struct {
+	addr  [4]byte
+	port  uint16
+	start uint32 // Sequence number of first request byte.
+	n     int
+	used  bool
+	buf   [maxRequest]byte
+}
+
+// recv is the Stack's TCP handler. It queues segments for handle.
+func (h *httpd) recv(src, dst netip.Addr, payload []byte) {
+	for i := range h.queue {
+		q := &h.queue[i]
+		if !q.used && len(payload) <= len(q.buf) {
+			q.src = src.As4()
+			q.n = copy(q.buf[:], payload)
+			q.used = true
+			return
+		}
+	}
+}
+
+// handle processes the segments queued since the last call.
+func (h *httpd) handle() {
+	for i := range h.queue {
+		q := &h.queue[i]
+		if q.used {
+			h.segment(q.src, q.buf[:q.n])
+			q.used = false
+		}
+	}
+}
+
+func (h *httpd) segment(src [4]byte, b []byte) {
+	if len(b) < eth.SizeTCPHeader {
+		return
+	}
+	thdr, off := eth.DecodeTCPHeader(b)
+	if int(off) < eth.SizeTCPHeader || int(off) > len(b) || thdr.DestinationPort != httpPort {
+		return
+	}
+	pseudo := eth.IPv4Header{VersionAndIHL: 5, TotalLength: uint16(eth.SizeIPv4Header + len(b)), Protocol: tcpProto, Source: src, Destination: h.local}
+	payload := b[off:]
+	if thdr.CalculateChecksumIPv4(&pseudo, b[eth.SizeTCPHeader:off], payload) != thdr.Checksum {
+		return
+	}
+	flags := thdr.Flags()
+	seq, ack := uint32(thdr.Seq), uint32(thdr.Ack)
+	port := thdr.SourcePort
+	iss := h.iss(src, port)
+	switch {
+	case flags.HasAny(seqs.FlagRST):
+		h.drop(src, port)
+	case flags.HasAll(seqs.FlagSYN):
+		h.drop(src, port)
+		h.send(src, port, iss, seq+1, seqs.FlagSYN|seqs.FlagACK, nil)
+	case !flags.HasAll(seqs.FlagACK) || ack-iss-1 > 1<<16:
+		// Not a segment of a connection we accepted.
+	case len(payload) > 0:
+		c := h.conn(src, port, seq)
+		switch {
+		case seq == c.start+uint32(c.n):
+			c.n += copy(c.buf[c.n:], payload)
+		case seq-c.start < uint32(c.n):
+			// Retransmission of data already received.
+		default:
+			return // Out of order, wait for retransmission.
+		}
+		if !h.complete(c) {
+			h.send(src, port, ack, c.start+uint32(c.n), seqs.FlagACK, nil)
+			return
+		}
+		h.respond(src, port, ack, c.start+uint32(c.n), c.buf[:c.n])
+		c.used = false
+	case flags.HasAny(seqs.FlagFIN):
+		h.send(src, port, ack, seq+1, seqs.FlagACK, nil)
+	}
+}
+
+// iss returns the initial sequence number of the connection from addr:port.
+func (h *httpd) iss(addr [4]byte, port uint16) uint32 {
+	x := h.secret ^ uint32(port)<<16 ^ uint32(addr[0])<<24 ^ uint32(addr[1])<<16 ^ uint32(addr[2])<<8 ^ uint32(addr[3])
+	// xorshift to spread the bits.
+	x ^= x << 13
+	x ^= x >> 17
+	x ^= x << 5
+	return x
+}
+
+// conn returns the request state of addr:port, allocating it if the segment
+// starting at seq is the first one with data.
+func (h *httpd) conn(addr [4]byte, port uint16, seq uint32) *httpConn {
+	for i := range h.conns {
+		c := &h.conns[i]
+		if c.used && c.addr == addr && c.port == port {
+			return c
+		}
+	}
+	c := &h.conns[h.next]
+	h.next = (h.next + 1) % len(h.conns)
+	*c = httpConn{addr: addr, port: port, start: seq, used: true}
+	return c
+}
+
+func (h *httpd) drop(addr [4]byte, port uint16) {
+	for i := range h.conns {
+		c := &h.conns[i]
+		if c.used && c.addr == addr && c.port == port {
+			c.used = false
+		}
+	}
+}
+
+// complete reports whether c holds the request headers and the whole body.
+func (h *httpd) complete(c *httpConn) bool {
+	req := c.buf[:c.n]
+	end := bytes.Index(req, []byte("\r\n\r\n"))
+	if end < 0 {
+		return c.n == len(c.buf)
+	}
+	return c.n-(end+4) >= h.declared(req[:end]) || c.n == len(c.buf)
+}
+
+// declared returns the body length declared in the request headers hdrs.
+func (h *httpd) declared(hdrs []byte) int {
+	length, _ := strconv.Atoi(string(header(hdrs, "content-length")))
+	return length
+}
+
+// respond sends the response to req followed by FIN.
+func (h *httpd) respond(addr [4]byte, port uint16, seq, ack uint32, req []byte) {
+	h.page.Reset()
+	status := "200 OK"
+	end := bytes.Index(req, []byte("\r\n\r\n"))
+	switch {
+	case end < 0 || h.declared(req[:end]) > len(req)-(end+4):
+		status = "413 Request Entity Too Large"
+	case bytes.HasPrefix(req, []byte("POST ")):
+		form, err := url.ParseQuery(string(req[end+4:]))
+		ssid := form.Get("ssid")
+		if err != nil || len(ssid) == 0 || len(ssid) > 32 || len(form.Get("pass")) > 64 {
+			h.putForm("Invalid SSID or passphrase.")
+			break
+		}
+		h.ssid, h.pass, h.done = ssid, form.Get("pass"), true
+		h.page.WriteString(pageHead)
+		h.page.WriteString("<p>Connecting to ")
+		h.page.WriteString(html.EscapeString(ssid))
+		h.page.WriteString("&hellip; This access point will now stop.</p>")
+		h.page.WriteString(pageTail)
+	default:
+		// Every other request, including captive portal probes, gets the form.
+		h.putForm(h.msg)
+	}
+	var hdr [128]byte
+	b := append(hdr[:0], "HTTP/1.0 "...)
+	b = append(b, status...)
+	b = append(b, "\r\nContent-Type: text/html\r\nConnection: close\r\nContent-Length: "...)
+	b = strconv.AppendInt(b, int64(h.page.Len()), 10)
+	b = append(b, "\r\n\r\n"...)
+	h.send(addr, port, seq, ack, seqs.FlagACK|seqs.FlagPSH, b)
+	seq += uint32(len(b))
+	body := h.page.Bytes()
+	for len(body) > 0 {
+		n := min(len(body), sendMSS)
+		flags := seqs.FlagACK | seqs.FlagPSH
+		if n == len(body) {
+			flags |= seqs.FlagFIN
+		}
+		h.send(addr, port, seq, ack, flags, body[:n])
+		seq += uint32(n)
+		body = body[n:]
+	}
+}
+
+func (h *httpd) putForm(msg string) {
+	h.page.WriteString(pageHead)
+	if msg != "" {
+		h.page.WriteString("<p><b>")
+		h.page.WriteString(html.EscapeString(msg))
+		h.page.WriteString("</b></p>")
+	}
+	h.page.WriteString(pageForm)
+	h.page.WriteString(pageTail)
+}
+
+func (h *httpd) send(addr [4]byte, port uint16, seq, ack uint32, flags seqs.Flags, payload []byte) error {
+	thdr := eth.TCPHeader{
+		SourcePort:      httpPort,
+		DestinationPort: port,
+		Seq:             seqs.Value(seq),
+		Ack:             seqs.Value(ack),
+		WindowSizeRaw:   recvWindow,
+	}
+	thdr.SetOffset(eth.SizeTCPHeader / 4)
+	thdr.SetFlags(flags)
+	n := eth.SizeTCPHeader + len(payload)
+	pseudo := eth.IPv4Header{VersionAndIHL: 5, TotalLength: uint16(eth.SizeIPv4Header + n), Protocol: tcpProto, Source: h.local, Destination: addr}
+	thdr.Checksum = thdr.CalculateChecksumIPv4(&pseudo, nil, payload)
+	thdr.Put(h.txbuf[:])
+	copy(h.txbuf[eth.SizeTCPHeader:], payload)
+	return h.stack.SendIPv4(tcpProto, netip.AddrFrom4(addr), h.txbuf[:n])
+}
+
+// header returns the value of the HTTP header name (lowercase) in hdrs.
+func header(hdrs []byte, name string) []byte {
+	for _, line := range bytes.Split(hdrs, []byte("\r\n")) {
+		colon := bytes.IndexByte(line, ':')
+		if colon == len(name) && string(bytes.ToLower(line[:colon])) == name {
+			return bytes.TrimSpace(line[colon+1:])
+		}
+	}
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+const (
+	pageHead = `<!DOCTYPE html><html><head><meta name="viewport" content="width=device-width">` +
+		`<title>Wi-Fi setup</title></head><body><h1>Wi-Fi setup</h1>`
+	pageForm = `<form method="POST" action="/">` +
+		`<p><label>Network name<br><input name="ssid" maxlength="32" required></label></p>` +
+		`<p><label>Passphrase<br><input name="pass" type="password" maxlength="64"></label></p>` +
+		`<p><input type="submit" value="Connect"></p></form>`
+	pageTail = `</body></html>`
+)
@@ -0,0 +1,172 @@
+// Package provision configures the Wi-Fi credentials of a device without
+// compiling them into the program. Run brings up an access point serving a
+// captive configuration page where the user enters the SSID and passphrase of
+// their network, stores them and joins the network:
+//
+//	ssid, pass, err := storage.LoadCredentials(store)
+//	if err == nil {
+//		err = dev.JoinWPA2(ssid, pass)
+//	}
+//	if err != nil {
+//		_, _, err = provision.Run(dev, provision.Config{Storage: store})
+//	}
+//
+// Stations associating with the access point are leased an address with DHCP
+// and every DNS query is answered with the device's address so that operating
+// systems detect a captive portal and open the configuration page. The page is
+// served by a tiny HTTP responder over the udpdriver package, not a full TCP
+// implementation, and only suits this purpose.
+package provision
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/storage"
+	"github.com/soypat/cyw43439/udpdriver"
+	"github.com/soypat/seqs/eth/dhcp"
+	"github.com/soypat/seqs/eth/dns"
+)
+
+var (
+	errTimeout = errors.New("provision: timeout")
+	errAddr    = errors.New("provision: address must be IPv4 with room for DHCP pool in network")
+)
+
+const (
+	pollInterval = 5 * time.Millisecond
+	// linger is the time the access point is kept up after credentials are
+	// submitted so that the response page is delivered.
+	linger = 2 * time.Second
+)
+
+// Config configures the provisioning access point.
+type Config struct {
+	// SSID of the access point. Defaults to "cyw43439-setup".
+	SSID string
+	// Passphrase of the access point. Empty selects an open access point.
+	Passphrase string
+	// Channel of the access point. Zero selects 6.
+	Channel uint8
+	// Addr is the device's address on the access point's network. Stations are
+	// leased the following 4 addresses. Defaults to 192.168.4.1/24.
+	Addr netip.Prefix
+	// Storage, if set, stores the credentials once the network is joined.
+	Storage storage.Storage
+	// Timeout is the time waited for credentials to be submitted each time the
+	// access point is brought up. Zero waits forever.
+	Timeout time.Duration
+}
+
+// Run brings up the access point and serves the configuration page until
+// credentials are submitted, then stops the access point and joins the
+// network in station mode. If joining fails the access point is brought up
+// again showing the error. On success the credentials are stored in
+// cfg.Storage and returned. dev's receive handler is removed before returning
+// so that a network stack may be installed.
+func Run(dev *cyw43439.Device, cfg Config) (ssid, pass string, err error) {
+	if cfg.SSID == "" {
+		cfg.SSID = "cyw43439-setup"
+	}
+	if cfg.Channel == 0 {
+		cfg.Channel = 6
+	}
+	if !cfg.Addr.IsValid() {
+		cfg.Addr = netip.MustParsePrefix("192.168.4.1/24")
+	}
+	local := cfg.Addr.Addr()
+	if !local.Is4() || cfg.Addr.Bits() > 29 || local.As4()[3] > 255-dhcpPoolSize {
+		return "", "", errAddr
+	}
+	stack, err := udpdriver.New(dev, udpdriver.Config{IP: cyw43439.IPConfig{
+		Addr: local,
+		Mask: cyw43439.IPMask(cfg.Addr.Bits()),
+	}})
+	if err != nil {
+		return "", "", err
+	}
+	defer dev.RecvEthHandle(nil)
+	dhcpConn, err := stack.ListenUDP(dhcp.DefaultServerPort)
+	if err != nil {
+		return "", "", err
+	}
+	defer dhcpConn.Close()
+	dnsConn, err := stack.ListenUDP(dns.ServerPort)
+	if err != nil {
+		return "", "", err
+	}
+	defer dnsConn.Close()
+	// Reads return immediately when no datagram is available.
+	dhcpConn.SetReadDeadline(time.Unix(1, 0))
+	dnsConn.SetReadDeadline(time.Unix(1, 0))
+	p := &provisioner{
+		stack: stack,
+		dhcp:  dhcpd{conn: dhcpConn, addr: cfg.Addr},
+		dns:   captiveDNS{conn: dnsConn, addr: local.As4()},
+		http:  httpd{stack: stack, local: local.As4(), secret: uint32(time.Now().UnixNano())},
+	}
+	stack.HandleIPv4(tcpProto, p.http.recv)
+	defer stack.HandleIPv4(0, nil)
+	for {
+		err = dev.StartAP(cfg.SSID, cfg.Passphrase, cfg.Channel)
+		if err != nil {
+			return "", "", err
+		}
+		err = p.serve(cfg.Timeout)
+		if err != nil {
+			dev.StopAP()
+			return "", "", err
+		}
+		err = dev.StopAP()
+		if err != nil {
+			return "", "", err
+		}
+		ssid, pass = p.http.ssid, p.http.pass
+		err = dev.JoinWPA2(ssid, pass)
+		if err == nil {
+			break
+		}
+		p.http.msg = "Could not join " + ssid + ": " + err.Error()
+		p.http.done = false
+	}
+	if cfg.Storage != nil {
+		err = storage.StoreCredentials(cfg.Storage, ssid, pass)
+	}
+	return ssid, pass, err
+}
+
+type provisioner struct {
+	stack *udpdriver.Stack
+	dhcp  dhcpd
+	dns   captiveDNS
+	http  httpd
+}
+
+// serve serves stations until credentials are submitted.
+func (p *provisioner) serve(timeout time.Duration) error {
+	var deadline, doneAt time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		err := p.stack.Poll()
+		if err != nil {
+			return err
+		}
+		p.dhcp.handle()
+		p.dns.handle()
+		p.http.handle()
+		now := time.Now()
+		switch {
+		case p.http.done && doneAt.IsZero():
+			doneAt = now
+		case p.http.done && now.Sub(doneAt) > linger:
+			return nil
+		case !p.http.done && !deadline.IsZero() && now.After(deadline):
+			return errTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,66 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+var errRoamScanPeriod = errors.New("roam scan period out of range")
+
+// wlcBandAll applies a roam setting to all bands. Reference: WLC_BAND_ALL.
+const wlcBandAll = 3
+
+// RoamingConfig configures how the firmware hands over between access points
+// of the same network.
+type RoamingConfig struct {
+	// Disable turns off firmware roaming entirely. Useful for fixed installations.
+	// When set all other fields are ignored.
+	Disable bool
+	// TriggerRSSI is the RSSI in dBm below which the firmware starts looking for
+	// a better access point, i.e: -70. Zero leaves the firmware default.
+	TriggerRSSI int8
+	// Delta is the RSSI improvement in dB a candidate access point must provide
+	// over the current one before roaming. Zero leaves the firmware default.
+	Delta uint8
+	// ScanPeriod is the time between roam scans while below TriggerRSSI.
+	// Second resolution. Zero leaves the firmware default.
+	ScanPeriod time.Duration
+}
+
+// SetRoaming configures firmware roaming thresholds and triggers.
+func (d *Device) SetRoaming(cfg RoamingConfig) error {
+	period := cfg.ScanPeriod / time.Second
+	if period < 0 || period > 0xffff {
+		return errRoamScanPeriod
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetRoaming", slog.Bool("disable", cfg.Disable), slog.Int("trigger", int(cfg.TriggerRSSI)),
+		slog.Int("delta", int(cfg.Delta)), slog.Duration("period", cfg.ScanPeriod))
+	err = d.set_iovar("roam_off", whd.IF_STA, b2u32(cfg.Disable))
+	if err != nil || cfg.Disable {
+		return err
+	}
+	if cfg.TriggerRSSI != 0 {
+		err = d.set_ioctl2(whd.WLC_SET_ROAM_TRIGGER, whd.IF_STA, uint32(int32(cfg.TriggerRSSI)), wlcBandAll)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.Delta != 0 {
+		err = d.set_ioctl2(whd.WLC_SET_ROAM_DELTA, whd.IF_STA, uint32(cfg.Delta), wlcBandAll)
+		if err != nil {
+			return err
+		}
+	}
+	if period != 0 {
+		err = d.set_ioctl(whd.WLC_SET_ROAM_SCAN_PERIOD, whd.IF_STA, uint32(period))
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package cyw43439
+
+// This file implements the two contexts in which the RecvEthHandle handler
+// may be called, selected with Config.RxQueue:
+//
+//   - Inline (default): the handler is called from PollOne, Poll or Wake while
+//     the device is acquired, at the deepest point of the driver's receive
+//     path. Its stack usage adds to the driver's on the stack of the goroutine
+//     which polls, so the handler must be short, must not parse deeply nested
+//     protocols and must not call Device methods, which would deadlock.
+//   - Queued: received frames are copied into RxQueue buffers of MTU bytes
+//     and the handler is called by HandleRx without the device acquired. The
+//     polling goroutine only needs stack for the driver itself and the
+//     handler runs on the stack of the goroutine calling HandleRx, which may
+//     be sized for it, i.e: a TCP/IP stack's, and may call Device methods
+//     such as SendEth. Frames received while all buffers are in use are
+//     dropped and counted in Counters.RxDropped.
+//
+// TinyGo goroutine stacks are small and fixed in size, overflowing them
+// corrupts memory rather than growing the stack, so deep handlers should
+// use the queued context.
+
+// rxQueue is a ring buffer of received frames.
+type rxQueue struct {
+	buf  []byte   // Frame storage, MTU bytes per slot.
+	lens []uint16 // Frame lengths per slot.
+	head int      // Index of the oldest frame.
+	n    int
+}
+
+// setSlots allocates the storage for slots frames, reusing the previous
+// storage if the amount of slots did not change.
+func (q *rxQueue) setSlots(slots int) {
+	q.head, q.n = 0, 0
+	if slots == len(q.lens) {
+		return
+	} else if slots <= 0 {
+		q.buf, q.lens = nil, nil
+		return
+	}
+	q.buf = make([]byte, slots*MTU)
+	q.lens = make([]uint16, slots)
+}
+
+func (q *rxQueue) slot(i int) []byte {
+	return q.buf[i*MTU : (i+1)*MTU]
+}
+
+// HandleRx passes the frames queued while polling to the RecvEthHandle handler,
+// oldest first, and returns the amount of frames handled. It returns early with
+// the first error returned by the handler. The handler is called without the
+// device acquired so it may call Device methods. HandleRx does nothing unless
+// Config.RxQueue is set and must only be called from one goroutine at a time:
+//
+//	for {
+//		dev.PollOne()
+//		dev.HandleRx()
+//		// ...
+//	}
+func (d *Device) HandleRx() (n int, err error) {
+	for {
+		d.mu.Lock()
+		q := &d.rxq
+		handler := d.rcvEth
+		if q.n == 0 || handler == nil {
+			d.mu.Unlock()
+			return n, nil
+		}
+		head := q.head
+		frame := q.slot(head)[:q.lens[head]]
+		d.mu.Unlock()
+
+		// The slot is not reused until removed from the queue below.
+		err = handler(frame)
+
+		d.mu.Lock()
+		q.head = (head + 1) % len(q.lens)
+		q.n--
+		d.mu.Unlock()
+		n++
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// queueRx copies frame into the receive queue or counts it as dropped if full.
+func (d *Device) queueRx(frame []byte) error {
+	q := &d.rxq
+	if q.n == len(q.lens) || len(frame) > MTU {
+		d.counters.RxDropped++
+		return nil
+	}
+	i := (q.head + q.n) % len(q.lens)
+	q.lens[i] = uint16(copy(q.slot(i), frame))
+	q.n++
+	return nil
+}
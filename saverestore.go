@@ -0,0 +1,72 @@
+package cyw43439
+
+import (
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file configures the save/restore (SR) engine, which saves the state
+// of the WLAN core to retention memory before the chip powers down in deep
+// sleep and restores it on wake. Without it the chip cannot power down between
+// beacons and the power save modes do not reach their rated currents.
+// Reference: whd_enable_save_restore in WHD and cyw43_ll_bus_init in cyw43-driver.
+
+// SaveRestore returns true if the firmware's save/restore engine was
+// configured on Init, which allows the chip to enter deep sleep.
+func (d *Device) SaveRestore() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.srEnabled
+}
+
+// sr_enable configures the bus for the SR engine if the firmware initialized
+// it. Must be called once the firmware is running and the HT clock is available.
+func (d *Device) sr_enable() error {
+	d.srEnabled = false
+	// Firmware which supports SR initializes the SR engine on startup.
+	srctl, err := d.bp_read32(whd.CHIPCOMMON_SR_CONTROL1)
+	if err != nil {
+		return err
+	} else if srctl == 0 {
+		d.debug("sr:unsupported")
+		return nil
+	}
+	d.debug("sr:enable", slog.Uint64("srctl", uint64(srctl)))
+	// Request the HT clock as soon as the bus core is powered on after deep sleep.
+	wake, err := d.read8(FuncBackplane, whd.SDIO_WAKEUP_CTRL)
+	if err != nil {
+		return err
+	}
+	err = d.write8(FuncBackplane, whd.SDIO_WAKEUP_CTRL, wake|whd.SBSDIO_WCTRL_WAKE_TILL_HT_AVAIL)
+	if err != nil {
+		return err
+	}
+	// Wake on any bus activity even though commands are not decoded while asleep.
+	err = d.write8(FuncBus, whd.SDIOD_CCCR_BRCM_CARDCAP, whd.SDIOD_CCCR_BRCM_CARDCAP_CMD_NODEC)
+	if err != nil {
+		return err
+	}
+	err = d.write8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR, whd.SBSDIO_FORCE_HT)
+	if err != nil {
+		return err
+	}
+	// Sleep is now controlled solely by the keep SDIO on (KSO) bit. See kso_set.
+	slp, err := d.read8(FuncBackplane, whd.SDIO_SLEEP_CSR)
+	if err != nil {
+		return err
+	}
+	if slp&whd.SBSDIO_SLPCSR_KEEP_SDIO_ON == 0 {
+		err = d.write8(FuncBackplane, whd.SDIO_SLEEP_CSR, slp|whd.SBSDIO_SLPCSR_KEEP_SDIO_ON)
+		if err != nil {
+			return err
+		}
+	}
+	// Put the SPI interface block to sleep.
+	err = d.write8(FuncBackplane, whd.SDIO_PULL_UP, 0xf)
+	if err != nil {
+		return err
+	}
+	d.srEnabled = true
+	return nil
+}
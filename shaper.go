@@ -0,0 +1,125 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// This file implements transmit shaping: token buckets limiting the rate at
+// which frames of a priority are written to the bus so that low priority
+// traffic, i.e: telemetry, cannot starve the gSPI bus when the application
+// also streams audio or firmware updates.
+
+// ErrTxShaped is returned by SendEth and SendEthPriority when a frame exceeds
+// the rate limit of its priority set with SetTxShaping. The frame is not sent;
+// callers may drop it or retry later.
+var ErrTxShaped = errors.New("tx rate limit exceeded")
+
+// maxEthFrame is the size of the largest Ethernet frame without FCS.
+const maxEthFrame = 1514
+
+// maxShapeIdle bounds the idle time credited to a token bucket so the refill
+// arithmetic can not overflow. Buckets are full well before.
+const maxShapeIdle = 10 * time.Second
+
+// TxShaping is a transmit rate limit. Zero fields are not limited.
+type TxShaping struct {
+	// BytesPerSecond is the sustained rate of Ethernet frame bytes.
+	BytesPerSecond uint32
+	// BurstBytes is the amount of bytes which may be sent at once after
+	// idling. It must be at least the size of the largest frame sent. Zero
+	// selects the larger of BytesPerSecond/10 and 1514, the largest
+	// Ethernet frame.
+	BurstBytes uint32
+	// FramesPerSecond is the sustained rate of frames.
+	FramesPerSecond uint32
+	// BurstFrames is the amount of frames which may be sent at once after
+	// idling. Zero selects the larger of FramesPerSecond/10 and 1.
+	BurstFrames uint32
+}
+
+// SetTxShaping sets the transmit rate limit of frames sent with priority
+// prio, replacing any previous limit. The zero TxShaping removes the limit.
+// Frames exceeding the limit are rejected with ErrTxShaped instead of waiting
+// so that they do not hold up the bus for other traffic.
+func (d *Device) SetTxShaping(prio Priority, shaping TxShaping) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if shaping.BytesPerSecond != 0 && shaping.BurstBytes == 0 {
+		shaping.BurstBytes = max(shaping.BytesPerSecond/10, maxEthFrame)
+	}
+	if shaping.FramesPerSecond != 0 && shaping.BurstFrames == 0 {
+		shaping.BurstFrames = max(shaping.FramesPerSecond/10, 1)
+	}
+	if shaping.BytesPerSecond != 0 && shaping.BurstBytes < maxEthFrame {
+		// Larger frames are always rejected.
+		d.warn("SetTxShaping:small-burst", slog.Uint64("burst", uint64(shaping.BurstBytes)))
+	}
+	d.info("SetTxShaping", slog.Int("prio", int(prio)),
+		slog.Uint64("Bps", uint64(shaping.BytesPerSecond)), slog.Uint64("fps", uint64(shaping.FramesPerSecond)))
+	now := time.Now()
+	d.shapers[prio&7] = txShaper{
+		cfg:    shaping,
+		bytes:  tokenBucket{tokens: shaping.BurstBytes, last: now},
+		frames: tokenBucket{tokens: shaping.BurstFrames, last: now},
+	}
+}
+
+// txShaper holds the token buckets of a priority.
+type txShaper struct {
+	cfg    TxShaping
+	bytes  tokenBucket
+	frames tokenBucket
+}
+
+// allow takes the tokens for a frame of n bytes and reports whether it may be sent.
+// No tokens are taken if it may not.
+func (s *txShaper) allow(now time.Time, n uint32) bool {
+	if s.cfg.BytesPerSecond == 0 && s.cfg.FramesPerSecond == 0 {
+		return true
+	}
+	okBytes := s.cfg.BytesPerSecond == 0 || s.bytes.refill(now, s.cfg.BytesPerSecond, s.cfg.BurstBytes) >= n
+	okFrames := s.cfg.FramesPerSecond == 0 || s.frames.refill(now, s.cfg.FramesPerSecond, s.cfg.BurstFrames) >= 1
+	if !okBytes || !okFrames {
+		return false
+	}
+	if s.cfg.BytesPerSecond != 0 {
+		s.bytes.tokens -= n
+	}
+	if s.cfg.FramesPerSecond != 0 {
+		s.frames.tokens--
+	}
+	return true
+}
+
+type tokenBucket struct {
+	tokens uint32
+	// last is the time up to which tokens have been credited.
+	last time.Time
+}
+
+// refill credits the tokens accrued at rate per second since the last
+// refill, up to burst, and returns the available tokens.
+func (b *tokenBucket) refill(now time.Time, rate, burst uint32) uint32 {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return b.tokens
+	} else if elapsed > maxShapeIdle {
+		elapsed = maxShapeIdle
+		b.last = now.Add(-maxShapeIdle)
+	}
+	add := uint64(elapsed) * uint64(rate) / uint64(time.Second)
+	if add == 0 {
+		return b.tokens // Keep the fraction of a token accrued.
+	}
+	if uint64(b.tokens)+add >= uint64(burst) {
+		b.tokens = burst
+		b.last = now
+	} else {
+		b.tokens += uint32(add)
+		// Only credit the time of whole tokens so fractions are not lost.
+		b.last = b.last.Add(time.Duration(add * uint64(time.Second) / uint64(rate)))
+	}
+	return b.tokens
+}
@@ -0,0 +1,92 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements connection quality notifications from the firmware's
+// RSSI event thresholds so that applications need not poll the RSSI.
+
+var errSignalThreshold = errors.New("signal thresholds require lowDbm < highDbm < 0")
+
+const (
+	// rssiEventLen is the length of wl_rssi_event_t: rate_limit_msec,
+	// num_rssi_levels and 8 rssi_levels padded to a word.
+	rssiEventLen = 16
+	// rssiEventRateLimit is the minimum time in milliseconds between RSSI events.
+	rssiEventRateLimit = 1000
+)
+
+// SignalQuality is the connection quality reported to the OnSignalThreshold callback.
+type SignalQuality uint8
+
+const (
+	SignalUnknown SignalQuality = iota
+	// SignalWeak is reported when the RSSI falls below the low threshold.
+	SignalWeak
+	// SignalGood is reported when the RSSI rises above the high threshold.
+	SignalGood
+)
+
+// OnSignalThreshold sets the callback called when the RSSI of the associated
+// access point falls below lowDbm or rises above highDbm, i.e: -75 and -65.
+// RSSI changes between the thresholds do not call the callback so that a
+// signal hovering around a threshold does not cause repeated calls. The
+// firmware rate limits RSSI events to one per second. A nil callback disables
+// the events. It is called from within the polling functions with the Device
+// locked so it must not call Device methods.
+func (d *Device) OnSignalThreshold(lowDbm, highDbm int8, cb func(q SignalQuality, rssi int8)) error {
+	if cb != nil && (lowDbm >= highDbm || highDbm >= 0) {
+		return errSignalThreshold
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("OnSignalThreshold", slog.Int("low", int(lowDbm)), slog.Int("high", int(highDbm)))
+	var ev [rssiEventLen]byte
+	if cb != nil {
+		_busOrder.PutUint32(ev[0:], rssiEventRateLimit)
+		ev[4] = 2
+		ev[5] = uint8(lowDbm)
+		ev[6] = uint8(highDbm)
+	}
+	err = d.set_iovar_n("rssi_event", whd.IF_STA, ev[:])
+	if err != nil {
+		return err
+	}
+	d.onSignal = cb
+	d.signalLow, d.signalHigh = lowDbm, highDbm
+	d.signalQuality = SignalUnknown
+	if cb != nil {
+		d.eventmask.Enable(whd.EvRSSI)
+	} else {
+		d.eventmask.Disable(whd.EvRSSI)
+	}
+	return nil
+}
+
+// rssiEvent handles the payload of an RSSI event, the RSSI in network order.
+func (d *Device) rssiEvent(payload []byte) {
+	if d.onSignal == nil || len(payload) < 4 {
+		return
+	}
+	rssi := int32(binary.BigEndian.Uint32(payload))
+	q := d.signalQuality
+	switch {
+	case rssi < int32(d.signalLow):
+		q = SignalWeak
+	case rssi > int32(d.signalHigh):
+		q = SignalGood
+	}
+	if q == d.signalQuality {
+		return
+	}
+	d.signalQuality = q
+	d.onSignal(q, int8(max(rssi, -128)))
+}
@@ -0,0 +1,153 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements the host sleep handshake. When the bus is put to sleep
+// the CYW43439 is allowed to drop its HT clock and enter a low power state
+// while still being able to raise the host-wake (IRQ) line once a packet
+// arrives. Any subsequent transaction wakes the device back up first.
+// Reference: cyw43_ll_bus_sleep and cyw43_kso_set in cyw43-driver.
+
+var (
+	errKSOTimeout    = errors.New("keep SDIO on (KSO) handshake timeout")
+	errWakeHTTimeout = errors.New("HT clock timeout on wake")
+)
+
+// SetSleepHooks sets callbacks called right after the CYW43439 bus is put to sleep
+// and right before it is woken up again. They are the place for the host MCU to
+// arm the host-wake interrupt (shared with the data line on the Pico W) and enter
+// a dormant state, and to restore the pin to bus operation. Either may be nil.
+func (d *Device) SetSleepHooks(afterSleep, beforeWake func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.afterSleep = afterSleep
+	d.beforeWake = beforeWake
+}
+
+// Sleep puts the CYW43439 bus to sleep so the host may enter a dormant state.
+// The F2 packet available interrupt is kept enabled so the chip can raise the
+// host-wake line on incoming packets. The device is automatically woken up on
+// the next call that performs a bus transaction or with a call to Wake.
+func (d *Device) Sleep() error {
+	// Don't use acquire since it would wake an already sleeping bus.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mode == 0 {
+		return errDevUninitialized
+	}
+	return d.bus_sleep()
+}
+
+// Wake wakes up the CYW43439 bus after a call to Sleep. It should be called
+// by the host after it is woken by the host-wake interrupt. It then services
+// any pending packets.
+func (d *Device) Wake() error {
+	err := d.acquire(modeInit) // acquire wakes the bus.
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	return d.check_status(d._rxBuf[:])
+}
+
+// IsAsleep returns true if the bus was put to sleep with Sleep and has not been woken up since.
+func (d *Device) IsAsleep() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.busAsleep
+}
+
+func (d *Device) bus_sleep() error {
+	if d.busAsleep {
+		return nil
+	}
+	d.debug("bus_sleep")
+	if !d.disableIRQ {
+		// Make sure the chip can raise the IRQ line on incoming packets.
+		err := d.set_interrupt_enable(d.irqEnable | whd.F2_PACKET_AVAILABLE)
+		if err != nil {
+			return err
+		}
+	}
+	// Drop clock request so chip may power down.
+	err := d.write8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR, 0)
+	if err != nil {
+		return err
+	}
+	err = d.kso_set(false)
+	if err != nil {
+		return err
+	}
+	d.busAsleep = true
+	if d.afterSleep != nil {
+		d.afterSleep()
+	}
+	return nil
+}
+
+func (d *Device) bus_wake() error {
+	if !d.busAsleep {
+		return nil
+	}
+	if d.beforeWake != nil {
+		d.beforeWake()
+	}
+	d.debug("bus_wake")
+	err := d.kso_set(true)
+	if err != nil {
+		return err
+	}
+	err = d.write8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR, whd.SBSDIO_HT_AVAIL_REQ)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(64 * time.Millisecond)
+	for {
+		got, err := d.read8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR)
+		if err != nil {
+			return err
+		}
+		if got&whd.SBSDIO_HT_AVAIL != 0 {
+			break
+		} else if time.Since(deadline) > 0 {
+			return errWakeHTTimeout
+		}
+		time.Sleep(time.Millisecond)
+	}
+	d.busAsleep = false
+	return nil
+}
+
+// kso_set sets or clears the keep SDIO on (KSO) bit and waits for the device to acknowledge.
+func (d *Device) kso_set(on bool) error {
+	var writeValue, compare, mask uint8
+	if on {
+		// Device wakeup: wait for both KSO and device-on bits.
+		writeValue = whd.SBSDIO_SLPCSR_KEEP_SDIO_ON
+		compare = whd.SBSDIO_SLPCSR_KEEP_SDIO_ON | whd.SBSDIO_SLPCSR_DEVICE_ON
+		mask = compare
+	} else {
+		// Device sleep: device-on bit may not clear right away, check KSO only.
+		mask = whd.SBSDIO_SLPCSR_KEEP_SDIO_ON
+	}
+	// These reads may fail while the device is waking up.
+	d.read8(FuncBackplane, whd.SDIO_SLEEP_CSR)
+	d.read8(FuncBackplane, whd.SDIO_SLEEP_CSR)
+	d.write8(FuncBackplane, whd.SDIO_SLEEP_CSR, writeValue)
+	for retries := 0; retries < 64; retries++ {
+		got, err := d.read8(FuncBackplane, whd.SDIO_SLEEP_CSR)
+		if err == nil && got != 0xff && got&mask == compare {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+		d.write8(FuncBackplane, whd.SDIO_SLEEP_CSR, writeValue)
+	}
+	d.logerr("kso_set:timeout", slog.Bool("on", on))
+	return errKSOTimeout
+}
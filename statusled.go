@@ -0,0 +1,61 @@
+package cyw43439
+
+import (
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements the status indicator enabled with Config.StatusLED:
+// the LED on CYW43439 GPIO 0, the onboard LED of the Pico W, blinks in a
+// pattern for each driver state so headless units can be diagnosed at a glance.
+//
+// The LED is updated from PollOne and while joining since the driver has no
+// goroutine of its own; applications must call PollOne regularly for the
+// patterns to be shown.
+
+// Patterns are 2 second periods of 20 slots of 100ms, bit i is slot i. The
+// LED is solid on while Init runs.
+const (
+	ledSlot        = 100 * time.Millisecond
+	ledSlots       = 20
+	ledWLGPIO      = 0
+	ledJoinPattern = 0b11001100110011001100 // Fast blink while scanning or joining.
+	ledUpPattern   = 1<<(ledSlots-2) - 1    // On with a short off blink when associated.
+	ledDownPattern = 0b00000111110000011111 // Slow blink when idle, not associated.
+	ledErrPattern  = 0b110011               // Double blink after a join failure.
+)
+
+func (d *Device) ledPattern() uint32 {
+	switch d.state {
+	case LinkStateUp:
+		return ledUpPattern
+	case LinkStateFailed, LinkStateAuthFailed:
+		return ledErrPattern
+	case LinkStateAuthenticating, LinkStateAssociated, LinkStateKeysInstalled, LinkStateReconnecting:
+		return ledJoinPattern
+	}
+	if d.eventmask.IsEnabled(whd.EvPFN_NET_FOUND) {
+		return ledJoinPattern // Scheduled scans running.
+	}
+	return ledDownPattern
+}
+
+// ledUpdate sets the status LED to the current slot of the pattern of the
+// driver state. It must not be called while processing received frames since
+// it may issue an ioctl.
+func (d *Device) ledUpdate() {
+	if !d.statusLED {
+		return
+	}
+	slot := uint(time.Now().UnixNano()/int64(ledSlot)) % ledSlots
+	d.ledSet(d.ledPattern()>>slot&1 != 0)
+}
+
+func (d *Device) ledSet(on bool) {
+	if d.ledKnown && d.ledOn == on {
+		return
+	}
+	err := d.set_iovar2("gpioout", whd.IF_STA, 1<<ledWLGPIO, b2u32(on)<<ledWLGPIO)
+	d.ledOn, d.ledKnown = on, err == nil
+}
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	errFlashFull  = errors.New("storage: flash region full")
+	errKey        = errors.New("storage: key must be 1..254 bytes")
+	errValue      = errors.New("storage: value too large")
+	errFlashGeom  = errors.New("storage: region must fit 2 erase blocks")
+	errFlashAlign = errors.New("storage: region offset not erase block aligned")
+	errCorrupt    = errors.New("storage: corrupt record")
+)
+
+// BlockDevice is the flash interface implemented by TinyGo's machine.Flash.
+type BlockDevice interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() int64
+	WriteBlockSize() int64
+	EraseBlockSize() int64
+	EraseBlocks(start, len int64) error
+}
+
+// Flash is a Storage which keeps values in two erase blocks of a BlockDevice as
+// an append-only log of records so that flash is only erased when a block
+// fills up. The latest value of each key is then copied to the other block,
+// which is committed by writing its header last, so a power loss during
+// compaction does not lose stored values.
+//
+// Block layout: 4 byte magic and 4 byte sequence number followed by records of
+// 1 byte key length, 2 byte value length, key and value. A value length of
+// 0xffff marks a deleted key. Erased flash (0xff) marks the end of the log.
+type Flash struct {
+	dev       BlockDevice
+	blocks    [2]int64 // Block offsets in dev.
+	blockSize int64
+	active    int
+	seq       uint32
+	end       int64 // End of log relative to active block.
+	page      []byte
+	keybuf    [255]byte
+}
+
+type record struct {
+	off  int64 // Relative to block start.
+	klen int
+	vlen int
+}
+
+func (r record) valueOff() int64 { return r.off + recordHdrLen + int64(r.klen) }
+func (r record) next() int64 {
+	if r.vlen == deletedLen {
+		return r.valueOff()
+	}
+	return r.valueOff() + int64(r.vlen)
+}
+
+const (
+	flashMagic     = "CYWS"
+	flashHeaderLen = 8
+	recordHdrLen   = 3
+	deletedLen     = 0xffff
+)
+
+var _ Storage = (*Flash)(nil)
+
+// NewFlash returns a Flash storage using the two erase blocks of dev starting
+// at offset, recovering any previously stored values.
+func NewFlash(dev BlockDevice, offset int64) (*Flash, error) {
+	bs := dev.EraseBlockSize()
+	if offset%bs != 0 {
+		return nil, errFlashAlign
+	}
+	if offset+2*bs > dev.Size() {
+		return nil, errFlashGeom
+	}
+	f := &Flash{
+		dev:       dev,
+		blocks:    [2]int64{offset, offset + bs},
+		blockSize: bs,
+		page:      make([]byte, dev.WriteBlockSize()),
+	}
+	seq0, ok0 := f.header(0)
+	seq1, ok1 := f.header(1)
+	var err error
+	switch {
+	case ok0 && (!ok1 || int32(seq0-seq1) > 0):
+		f.active, f.seq = 0, seq0
+	case ok1:
+		f.active, f.seq = 1, seq1
+	default:
+		// Neither block formatted: format block 0 from an erased block 1.
+		f.active, f.seq = 1, 0
+		err = dev.EraseBlocks(f.blocks[1]/bs, 1)
+		if err != nil {
+			return nil, err
+		}
+		err = f.compact("", nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	f.end = flashHeaderLen
+	for {
+		r, ok, err := f.record(f.active, f.end)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		f.end = r.next()
+	}
+	return f, nil
+}
+
+// Load implements Storage.
+func (f *Flash) Load(key string, dst []byte) (int, error) {
+	r, found, err := f.latest(f.active, key, flashHeaderLen)
+	if err != nil {
+		return 0, err
+	}
+	if !found || r.vlen == deletedLen {
+		return 0, ErrNotFound
+	}
+	if r.vlen > len(dst) {
+		return 0, ErrShortBuffer
+	}
+	_, err = f.dev.ReadAt(dst[:r.vlen], f.blocks[f.active]+r.valueOff())
+	return r.vlen, err
+}
+
+// Store implements Storage. The record must fit in an erase block.
+func (f *Flash) Store(key string, value []byte) error {
+	if len(key) == 0 || len(key) > 254 {
+		return errKey
+	}
+	need := int64(recordHdrLen + len(key) + len(value))
+	if len(value) >= deletedLen || flashHeaderLen+need > f.blockSize {
+		return errValue
+	}
+	vlen := len(value)
+	if value == nil {
+		vlen = deletedLen
+	}
+	if f.end+need > f.blockSize {
+		return f.compact(key, value, vlen)
+	}
+	err := f.putRecordHeader(f.active, key, vlen)
+	if err != nil {
+		return err
+	}
+	err = f.write(f.blocks[f.active]+f.end, value)
+	f.end += int64(len(value))
+	return err
+}
+
+// compact copies the latest value of every key to the inactive block and
+// then activates it. If key is not empty its value is replaced by value, or
+// deleted if vlen is deletedLen, before the block is committed so that a
+// power loss leaves either the old or the new value stored.
+func (f *Flash) compact(key string, value []byte, vlen int) (err error) {
+	src, dst := f.active, 1-f.active
+	err = f.dev.EraseBlocks(f.blocks[dst]/f.blockSize, 1)
+	if err != nil {
+		return err
+	}
+	srcEnd := f.end
+	defer func() {
+		if err != nil {
+			// Keep the uncommitted block inactive.
+			f.active, f.end = src, srcEnd
+		}
+	}()
+	f.active = dst
+	f.end = flashHeaderLen
+	for off := int64(flashHeaderLen); ; {
+		r, ok, err := f.record(src, off)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		off = r.next()
+		k, err := f.readKey(src, r)
+		if err != nil {
+			return err
+		}
+		if r.vlen == deletedLen || (key != "" && k == key) {
+			continue
+		}
+		_, later, err := f.latest(src, k, off)
+		if err != nil {
+			return err
+		}
+		if later {
+			continue // Superseded by a later record.
+		}
+		err = f.putRecordHeader(dst, k, r.vlen)
+		if err != nil {
+			return err
+		}
+		// Copy value in page sized chunks.
+		for voff := int64(0); voff < int64(r.vlen); {
+			chunk := f.keybuf[:min(len(f.keybuf), r.vlen-int(voff))]
+			_, err = f.dev.ReadAt(chunk, f.blocks[src]+r.valueOff()+voff)
+			if err != nil {
+				return err
+			}
+			err = f.write(f.blocks[dst]+f.end, chunk)
+			if err != nil {
+				return err
+			}
+			f.end += int64(len(chunk))
+			voff += int64(len(chunk))
+		}
+	}
+	if key != "" && vlen != deletedLen {
+		if f.end+int64(recordHdrLen+len(key)+len(value)) > f.blockSize {
+			return errFlashFull
+		}
+		err = f.putRecordHeader(dst, key, vlen)
+		if err != nil {
+			return err
+		}
+		err = f.write(f.blocks[dst]+f.end, value)
+		if err != nil {
+			return err
+		}
+		f.end += int64(len(value))
+	}
+	// Commit by writing the header last.
+	var hdr [flashHeaderLen]byte
+	copy(hdr[:], flashMagic)
+	f.seq++
+	binary.LittleEndian.PutUint32(hdr[4:], f.seq)
+	return f.write(f.blocks[dst], hdr[:])
+}
+
+func (f *Flash) putRecordHeader(block int, key string, vlen int) error {
+	var hdr [recordHdrLen + 255]byte
+	hdr[0] = byte(len(key))
+	binary.LittleEndian.PutUint16(hdr[1:], uint16(vlen))
+	n := recordHdrLen + copy(hdr[recordHdrLen:], key)
+	err := f.write(f.blocks[block]+f.end, hdr[:n])
+	f.end += int64(n)
+	return err
+}
+
+// latest returns the last record of key in block at or after off.
+func (f *Flash) latest(block int, key string, off int64) (last record, found bool, err error) {
+	for {
+		r, ok, err := f.record(block, off)
+		if err != nil || !ok {
+			return last, found, err
+		}
+		off = r.next()
+		if r.klen != len(key) {
+			continue
+		}
+		k, err := f.readKey(block, r)
+		if err != nil {
+			return last, found, err
+		}
+		if k == key {
+			last, found = r, true
+		}
+	}
+}
+
+// record reads the record header at off. ok is false at the end of the log.
+func (f *Flash) record(block int, off int64) (r record, ok bool, err error) {
+	if off+recordHdrLen > f.blockSize {
+		return r, false, nil
+	}
+	var hdr [recordHdrLen]byte
+	_, err = f.dev.ReadAt(hdr[:], f.blocks[block]+off)
+	if err != nil || hdr[0] == 0xff {
+		return r, false, err
+	}
+	r = record{off: off, klen: int(hdr[0]), vlen: int(binary.LittleEndian.Uint16(hdr[1:]))}
+	if r.klen == 0 || r.next() > f.blockSize {
+		return r, false, errCorrupt
+	}
+	return r, true, nil
+}
+
+func (f *Flash) readKey(block int, r record) (string, error) {
+	_, err := f.dev.ReadAt(f.keybuf[:r.klen], f.blocks[block]+r.off+recordHdrLen)
+	return string(f.keybuf[:r.klen]), err
+}
+
+func (f *Flash) header(block int) (seq uint32, ok bool) {
+	var hdr [flashHeaderLen]byte
+	_, err := f.dev.ReadAt(hdr[:], f.blocks[block])
+	if err != nil || string(hdr[:4]) != flashMagic {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(hdr[4:]), true
+}
+
+// write programs b at off in write block aligned chunks. Flash programming can
+// only clear bits so bytes around b in each chunk are read and written back unchanged.
+func (f *Flash) write(off int64, b []byte) error {
+	wbs := int64(len(f.page))
+	for len(b) > 0 {
+		pageOff := off - off%wbs
+		_, err := f.dev.ReadAt(f.page, pageOff)
+		if err != nil {
+			return err
+		}
+		n := copy(f.page[off-pageOff:], b)
+		_, err = f.dev.WriteAt(f.page, pageOff)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		off += int64(n)
+	}
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,12 @@
+//go:build rp2040
+
+package storage
+
+import "machine"
+
+// NewPicoFlash returns a Flash storage using the last two erase blocks of the
+// RP2040's flash which are not occupied by the program (machine.Flash).
+func NewPicoFlash() (*Flash, error) {
+	bs := machine.Flash.EraseBlockSize()
+	return NewFlash(machine.Flash, (machine.Flash.Size()/bs-2)*bs)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+)
+
+// DerivePMK returns the WPA2 pairwise master key of the network ssid with
+// passphrase pass: PBKDF2 with HMAC-SHA1, the SSID as salt and 4096
+// iterations. Reference: IEEE 802.11i-2004 annex H.4.
+func DerivePMK(ssid, pass string) (pmk [32]byte) {
+	mac := hmac.New(sha1.New, []byte(pass))
+	var u, t [sha1.Size]byte
+	var block [4]byte
+	for i := 0; i < 2; i++ {
+		binary.BigEndian.PutUint32(block[:], uint32(i+1))
+		mac.Reset()
+		mac.Write([]byte(ssid))
+		mac.Write(block[:])
+		mac.Sum(u[:0])
+		t = u
+		for j := 1; j < 4096; j++ {
+			mac.Reset()
+			mac.Write(u[:])
+			mac.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		copy(pmk[i*sha1.Size:], t[:])
+	}
+	return pmk
+}
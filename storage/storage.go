@@ -0,0 +1,129 @@
+// Package storage defines a small key-value persistence interface used to keep
+// Wi-Fi credentials and DHCP leases across reboots, along with a flash backed
+// implementation suited to microcontrollers such as the RP2040.
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned by Load when no value is stored under the key.
+	ErrNotFound = errors.New("storage: key not found")
+	// ErrShortBuffer is returned by Load when the value does not fit in the buffer.
+	ErrShortBuffer = errors.New("storage: buffer too short for value")
+	errCredentials = errors.New("storage: SSID must be 1..32 bytes and passphrase at most 64 bytes, 8..63 for a PMK")
+)
+
+// Storage persists small values by key.
+type Storage interface {
+	// Load copies the value stored under key to dst and returns its length.
+	// It returns ErrNotFound if no value is stored.
+	Load(key string, dst []byte) (int, error)
+	// Store stores value under key replacing any previous value.
+	// A nil value deletes the key.
+	Store(key string, value []byte) error
+}
+
+// Keys used by the packages of this module to store their state.
+const (
+	KeySSID       = "wifi.ssid"
+	KeyPassphrase = "wifi.pass"
+	// KeyPMK is the 32 byte WPA2 pairwise master key derived from the passphrase
+	// and SSID, which may be stored instead of the passphrase. See StorePMK.
+	KeyPMK = "wifi.pmk"
+	// KeyLease is the last DHCP lease, see dhcpclient.Config.Storage.
+	KeyLease = "dhcp.lease"
+)
+
+// StoreCredentials stores the Wi-Fi SSID and passphrase, removing a PMK
+// stored with StorePMK.
+func StoreCredentials(s Storage, ssid, pass string) error {
+	if len(ssid) == 0 || len(ssid) > 32 || len(pass) > 64 {
+		return errCredentials
+	}
+	err := s.Store(KeySSID, []byte(ssid))
+	if err != nil {
+		return err
+	}
+	err = s.Store(KeyPassphrase, []byte(pass))
+	if err != nil {
+		return err
+	}
+	return s.Store(KeyPMK, nil)
+}
+
+// StorePMK stores the Wi-Fi SSID and the WPA2 pairwise master key derived
+// from pass and ssid instead of the passphrase, so the passphrase itself is
+// not kept in flash. A passphrase stored with StoreCredentials is removed.
+func StorePMK(s Storage, ssid, pass string) error {
+	if len(ssid) == 0 || len(ssid) > 32 || len(pass) < 8 || len(pass) > 63 {
+		return errCredentials
+	}
+	pmk := DerivePMK(ssid, pass)
+	err := s.Store(KeySSID, []byte(ssid))
+	if err != nil {
+		return err
+	}
+	err = s.Store(KeyPMK, pmk[:])
+	if err != nil {
+		return err
+	}
+	return s.Store(KeyPassphrase, nil)
+}
+
+// LoadCredentials loads the Wi-Fi SSID and passphrase stored with
+// StoreCredentials or StorePMK. It returns ErrNotFound if no SSID is stored.
+// An empty passphrase is returned for open networks. A stored PMK is returned
+// as the passphrase in its 64 hexadecimal digit form, which
+// Device.JoinWPA2 passes to the firmware as the key itself.
+func LoadCredentials(s Storage) (ssid, pass string, err error) {
+	var buf [64]byte
+	n, err := s.Load(KeySSID, buf[:32])
+	if err != nil {
+		return "", "", err
+	}
+	ssid = string(buf[:n])
+	n, err = s.Load(KeyPassphrase, buf[:])
+	if err == ErrNotFound {
+		var pmk [32]byte
+		n, err = s.Load(KeyPMK, pmk[:])
+		if err == nil && n == len(pmk) {
+			hex.Encode(buf[:], pmk[:])
+			return ssid, string(buf[:]), nil
+		}
+		n = 0
+	}
+	if err != nil && err != ErrNotFound {
+		return "", "", err
+	}
+	return ssid, string(buf[:n]), nil
+}
+
+// Mem is a Storage which keeps values in memory, i.e: for testing on a host.
+type Mem map[string][]byte
+
+var _ Storage = Mem(nil)
+
+// Load implements Storage.
+func (m Mem) Load(key string, dst []byte) (int, error) {
+	v, ok := m[key]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if len(v) > len(dst) {
+		return 0, ErrShortBuffer
+	}
+	return copy(dst, v), nil
+}
+
+// Store implements Storage.
+func (m Mem) Store(key string, value []byte) error {
+	if value == nil {
+		delete(m, key)
+		return nil
+	}
+	m[key] = append([]byte(nil), value...)
+	return nil
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+var errPowerLoss = errors.New("power loss")
+
+// memFlash is a BlockDevice in memory. Programming can only clear bits as on
+// NOR flash. After failAfter writes or erases every operation fails, which
+// simulates a power loss.
+type memFlash struct {
+	data      []byte
+	failAfter int
+	ops       int
+}
+
+func newMemFlash(size int) *memFlash {
+	f := &memFlash{data: make([]byte, size), failAfter: -1}
+	for i := range f.data {
+		f.data[i] = 0xff
+	}
+	return f
+}
+
+func (f *memFlash) ReadAt(b []byte, off int64) (int, error) {
+	return copy(b, f.data[off:]), nil
+}
+
+func (f *memFlash) WriteAt(b []byte, off int64) (int, error) {
+	if err := f.op(); err != nil {
+		return 0, err
+	}
+	for i, c := range b {
+		f.data[off+int64(i)] &= c
+	}
+	return len(b), nil
+}
+
+func (f *memFlash) EraseBlocks(start, n int64) error {
+	if err := f.op(); err != nil {
+		return err
+	}
+	bs := f.EraseBlockSize()
+	for i := start * bs; i < (start+n)*bs; i++ {
+		f.data[i] = 0xff
+	}
+	return nil
+}
+
+func (f *memFlash) op() error {
+	if f.failAfter >= 0 && f.ops >= f.failAfter {
+		return errPowerLoss
+	}
+	f.ops++
+	return nil
+}
+
+func (f *memFlash) Size() int64           { return int64(len(f.data)) }
+func (f *memFlash) WriteBlockSize() int64 { return 16 }
+func (f *memFlash) EraseBlockSize() int64 { return 256 }
+
+func load(t *testing.T, s Storage, key string) string {
+	t.Helper()
+	var buf [64]byte
+	n, err := s.Load(key, buf[:])
+	if err == ErrNotFound {
+		return "<none>"
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestFlashStore(t *testing.T) {
+	dev := newMemFlash(1024)
+	f, err := NewFlash(dev, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough stores to compact several times.
+	for i := 0; i < 50; i++ {
+		err = f.Store("a", []byte{'v', byte('0' + i%10)})
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		err = f.Store("b", []byte("constant"))
+		if err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	err = f.Store("c", []byte("gone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Store("c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err = NewFlash(dev, 256) // Reopen as after a reboot.
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"a": "v9", "b": "constant", "c": "<none>"} {
+		if got := load(t, f, key); got != want {
+			t.Errorf("key %q: got %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestFlashPowerLoss(t *testing.T) {
+	// Fill the active block so the next store compacts, then lose power after
+	// every possible amount of flash operations during the store.
+	for failAfter := 0; ; failAfter++ {
+		dev := newMemFlash(512)
+		f, err := NewFlash(dev, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; f.end+int64(recordHdrLen+len("pass")+len("old")) <= f.blockSize; i++ {
+			err = f.Store("pass", []byte("old"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		dev.ops, dev.failAfter = 0, failAfter
+		err = f.Store("pass", []byte("new"))
+		dev.failAfter = -1
+		f, err2 := NewFlash(dev, 0)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		got := load(t, f, "pass")
+		if err == nil && got != "new" {
+			t.Fatalf("failAfter=%d: got %q after successful store", failAfter, got)
+		} else if got != "old" && got != "new" {
+			t.Fatalf("failAfter=%d: got %q, want old or new value", failAfter, got)
+		}
+		if err == nil {
+			return
+		}
+	}
+}
+
+func TestFlashFull(t *testing.T) {
+	dev := newMemFlash(512)
+	f, err := NewFlash(dev, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := make([]byte, 200)
+	err = f.Store("x", big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Store("y", big)
+	if err != errFlashFull {
+		t.Fatalf("got %v, want errFlashFull", err)
+	}
+	if got := load(t, f, "y"); got != "<none>" {
+		t.Errorf("y stored after full error: %q", got)
+	}
+	err = f.Store("x", []byte("small")) // Replacing x must still be possible.
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDerivePMK(t *testing.T) {
+	// IEEE 802.11i-2004 H.4.2 test vector.
+	pmk := DerivePMK("IEEE", "password")
+	const want = "f42c6fc52df0ebef9ebb4b90b38a5f902e83fe1b135a70e23aed762e9710a12e"
+	if got := hex.EncodeToString(pmk[:]); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	m := Mem{}
+	err := StorePMK(m, "IEEE", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssid, pass, err := LoadCredentials(m)
+	if err != nil || ssid != "IEEE" || pass != "f42c6fc52df0ebef9ebb4b90b38a5f902e83fe1b135a70e23aed762e9710a12e" {
+		t.Fatalf("got %q %q %v", ssid, pass, err)
+	}
+	err = StoreCredentials(m, "net", "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssid, pass, err = LoadCredentials(m)
+	if err != nil || ssid != "net" || pass != "passphrase" {
+		t.Fatalf("got %q %q %v", ssid, pass, err)
+	}
+	if _, ok := m[KeyPMK]; ok {
+		t.Error("PMK not removed by StoreCredentials")
+	}
+}
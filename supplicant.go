@@ -0,0 +1,180 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file selects who runs the 802.1X/WPA key exchange. By default the
+// firmware's internal supplicant (sup_wpa=1) performs the 4-way handshake of
+// WPA2-PSK networks. With the host supplicant the firmware passes EAPOL frames
+// to the host instead, which runs the handshake, i.e: for WPA2-Enterprise, and
+// plumbs the derived keys into the firmware with PlumbKey.
+
+var errKeyLen = errors.New("key too long")
+
+// EtherTypeEAPOL is the EtherType of 802.1X EAPOL frames.
+const EtherTypeEAPOL = 0x888e
+
+// Key parameters. Reference: wl_wsec_key_t in wlioctl.h.
+const (
+	wsecKeyLen     = 164
+	wsecKeyMaxData = 32
+	wlPrimaryKey   = 1 << 1 // WL_PRIMARY_KEY
+)
+
+// KeyAlgo is the cipher of a key plumbed with PlumbKey.
+type KeyAlgo uint32
+
+// Key ciphers. Reference: CRYPTO_ALGO_*.
+const (
+	KeyAlgoOff    KeyAlgo = 0
+	KeyAlgoWEP1   KeyAlgo = 1
+	KeyAlgoTKIP   KeyAlgo = 2
+	KeyAlgoWEP128 KeyAlgo = 3
+	KeyAlgoAESCCM KeyAlgo = 4
+)
+
+// Key is a pairwise or group key derived by the host supplicant.
+type Key struct {
+	// Index is the key index, 0 for the pairwise key and 1-3 for group keys.
+	Index uint32
+	// Data is the temporal key, at most 32 bytes. Empty data with KeyAlgoOff removes the key.
+	Data []byte
+	Algo KeyAlgo
+	// Primary marks the key used for transmission.
+	Primary bool
+	// RSC is the 48 bit receive sequence counter of group keys.
+	RSC uint64
+	// Addr is the peer of pairwise keys, the zero value for group keys.
+	Addr [6]byte
+}
+
+// SupplicantState is the state reported by a SupplicantEvent.
+type SupplicantState uint32
+
+// Supplicant states. Reference: WLC_SUP_*.
+const (
+	SupDisconnected   SupplicantState = 0
+	SupConnecting     SupplicantState = 1
+	SupAuthenticating SupplicantState = 3
+	SupAuthenticated  SupplicantState = 4
+	SupKeyExchange    SupplicantState = 5
+	// SupKeyed is reported once the handshake is done and the keys installed.
+	SupKeyed   SupplicantState = 6
+	SupTimeout SupplicantState = 7
+)
+
+// SupplicantEvent is the firmware's report of the key exchange progress
+// (PSK_SUP event) during a join.
+type SupplicantEvent struct {
+	State SupplicantState
+	// Reason is the firmware's WLC_E_SUP_* reason, non-zero on failure.
+	Reason uint32
+}
+
+// UseInternalSupplicant selects the firmware supplicant for subsequent joins,
+// which is the default. The firmware performs the WPA2-PSK key exchange using
+// the passphrase given to JoinWPA2.
+func (d *Device) UseInternalSupplicant() error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("UseInternalSupplicant")
+	d.hostEAPOL = false
+	return d.set_supplicant()
+}
+
+// UseHostEAPOL disables the firmware supplicant for subsequent joins. EAPOL
+// frames are then passed to the callback set with OnEAPOL, or to the
+// RecvEthHandle handler if none is set, and sent with SendEth. The host
+// supplicant must plumb the keys it derives with PlumbKey.
+func (d *Device) UseHostEAPOL() error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("UseHostEAPOL")
+	d.hostEAPOL = true
+	return d.set_supplicant()
+}
+
+// OnEAPOL sets the callback called with the Ethernet frames of EtherType
+// EtherTypeEAPOL received, which are then not passed to the RecvEthHandle
+// handler. frame is only valid during the call. It is called from within the
+// polling functions with the Device locked so it must not call Device methods.
+func (d *Device) OnEAPOL(cb func(frame []byte)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onEAPOL = cb
+}
+
+// OnSupplicantEvent sets the callback called with the key exchange progress
+// reported during joins. It is called from within the polling functions with
+// the Device locked so it must not call Device methods.
+func (d *Device) OnSupplicantEvent(cb func(SupplicantEvent)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onSupEvent = cb
+}
+
+// PlumbKey installs a key derived by the host supplicant into the firmware.
+func (d *Device) PlumbKey(k Key) error {
+	if len(k.Data) > wsecKeyMaxData {
+		return errKeyLen
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("PlumbKey", slog.Uint64("index", uint64(k.Index)), slog.Uint64("algo", uint64(k.Algo)))
+	var buf [wsecKeyLen]byte
+	binary.LittleEndian.PutUint32(buf[0:], k.Index)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(k.Data)))
+	copy(buf[8:40], k.Data)
+	binary.LittleEndian.PutUint32(buf[112:], uint32(k.Algo))
+	if k.Primary {
+		binary.LittleEndian.PutUint32(buf[116:], wlPrimaryKey)
+	}
+	if k.RSC != 0 {
+		binary.LittleEndian.PutUint32(buf[132:], 1) // iv_initialized.
+		binary.LittleEndian.PutUint32(buf[140:], uint32(k.RSC>>16))
+		binary.LittleEndian.PutUint16(buf[144:], uint16(k.RSC))
+	}
+	copy(buf[156:162], k.Addr[:])
+	return d.doIoctlSet(whd.WLC_SET_KEY, whd.IF_STA, buf[:])
+}
+
+// set_supplicant configures the supplicant of the STA bsscfg selected by hostEAPOL.
+func (d *Device) set_supplicant() error {
+	if d.hostEAPOL {
+		return d.set_iovar2("bsscfg:sup_wpa", whd.IF_STA, 0, 0)
+	}
+	if err := d.set_iovar2("bsscfg:sup_wpa", whd.IF_STA, 0, 1); err != nil {
+		return err
+	}
+	// Use the EAPOL version of the AP.
+	if err := d.set_iovar2("bsscfg:sup_wpa2_eapver", whd.IF_STA, 0, 0xffff_ffff); err != nil {
+		return err
+	}
+	return d.set_iovar2("bsscfg:sup_wpa_tmo", whd.IF_STA, 0, 2500)
+}
+
+// supEvent handles a PSK_SUP event.
+func (d *Device) supEvent(msg *whd.EventMessage) {
+	if d.onSupEvent != nil {
+		d.onSupEvent(SupplicantEvent{State: SupplicantState(msg.Status), Reason: msg.Reason})
+	}
+}
+
+// isEAPOL reports whether the Ethernet frame is an EAPOL frame.
+func isEAPOL(frame []byte) bool {
+	return len(frame) >= 14 && binary.BigEndian.Uint16(frame[12:14]) == EtherTypeEAPOL
+}
@@ -0,0 +1,49 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// Temperature returns the chip's die temperature in degrees Celsius as read by
+// the PHY temperature sensor via the phy_tempsense iovar. The sensor has a
+// resolution of one degree and reads higher than ambient while transmitting.
+func (d *Device) Temperature() (float32, error) {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return 0, err
+	}
+	v, err := d.get_iovar("phy_tempsense", whd.IF_STA)
+	if err != nil {
+		return 0, err
+	}
+	d.debug("Temperature", slog.Int("celsius", int(int32(v))))
+	return float32(int32(v)), nil
+}
+
+var errDutyCycle = errors.New("duty cycle must be within 1..100 percent")
+
+// SetTxDutyCycle limits the fraction of time in percent the radio may spend
+// transmitting with CCK (802.11b) and OFDM rates respectively, which bounds
+// the average current draw and heating of the chip. 100 removes the limit.
+// The limits may be changed at any time, including while joined to a network.
+// Pair with SetTxPowerPercent to also reduce peak transmit power.
+func (d *Device) SetTxDutyCycle(cck, ofdm uint8) error {
+	if cck == 0 || cck > 100 || ofdm == 0 || ofdm > 100 {
+		return errDutyCycle
+	}
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetTxDutyCycle", slog.Int("cck", int(cck)), slog.Int("ofdm", int(ofdm)))
+	err = d.set_iovar("dutycycle_cck", whd.IF_STA, uint32(cck))
+	if err != nil {
+		return err
+	}
+	return d.set_iovar("dutycycle_ofdm", whd.IF_STA, uint32(ofdm))
+}
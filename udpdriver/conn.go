@@ -0,0 +1,138 @@
+package udpdriver
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+)
+
+var (
+	errClosed       = errors.New("udpdriver: use of closed conn")
+	errTimeout      = errors.New("udpdriver: i/o timeout")
+	errNotConnected = errors.New("udpdriver: conn not connected, use WriteTo")
+)
+
+// Conn is a UDP endpoint. It buffers a single received datagram: datagrams
+// which arrive while the buffer is full are dropped and counted.
+// A Conn must not be used concurrently from multiple goroutines.
+type Conn struct {
+	s        *Stack
+	lport    uint16
+	raddr    netip.AddrPort
+	rbuf     [MaxPayload]byte
+	rlen     int
+	rfrom    netip.AddrPort
+	full     bool
+	closed   bool
+	dropped  uint32
+	deadline time.Time
+}
+
+// LocalPort returns the local UDP port of the Conn.
+func (c *Conn) LocalPort() uint16 { return c.lport }
+
+// RemoteAddr returns the peer address of a Conn opened with DialUDP. It is the
+// zero value for Conns opened with ListenUDP.
+func (c *Conn) RemoteAddr() netip.AddrPort { return c.raddr }
+
+// Dropped returns the amount of datagrams dropped because the receive buffer was full.
+func (c *Conn) Dropped() uint32 {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	return c.dropped
+}
+
+// SetReadDeadline sets the time after which blocked reads return an error.
+// A zero t makes reads block indefinitely.
+func (c *Conn) SetReadDeadline(t time.Time) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.deadline = t
+}
+
+// ReadFrom blocks until a datagram is received or the read deadline passes and
+// copies it to b. Bytes of the datagram which do not fit in b are discarded.
+func (c *Conn) ReadFrom(b []byte) (n int, addr netip.AddrPort, err error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if c.closed {
+			return 0, addr, errClosed
+		}
+		if c.full {
+			n = copy(b, c.rbuf[:c.rlen])
+			c.full = false
+			return n, c.rfrom, nil
+		}
+		err = s.poll()
+		if err != nil {
+			return 0, addr, err
+		}
+		if c.full {
+			continue
+		}
+		if !c.deadline.IsZero() && !time.Now().Before(c.deadline) {
+			return 0, addr, errTimeout
+		}
+		s.mu.Unlock()
+		time.Sleep(s.pollInterval)
+		s.mu.Lock()
+	}
+}
+
+// Read is like ReadFrom but discards the sender's address.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadFrom(b)
+	return n, err
+}
+
+// WriteTo sends b as a single datagram to addr. It blocks while the
+// hardware address of addr, or the gateway's, is resolved.
+func (c *Conn) WriteTo(b []byte, addr netip.AddrPort) (int, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.closed {
+		return 0, errClosed
+	}
+	err := s.sendUDP(c.lport, addr, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Write sends b as a single datagram to the peer of a Conn opened with DialUDP.
+func (c *Conn) Write(b []byte) (int, error) {
+	if !c.raddr.IsValid() {
+		return 0, errNotConnected
+	}
+	return c.WriteTo(b, c.raddr)
+}
+
+// Close releases the Conn's port. Blocked reads return an error.
+func (c *Conn) Close() error {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if c.closed {
+		return errClosed
+	}
+	c.closed = true
+	c.s.close(c)
+	return nil
+}
+
+// deliver is called from the receive handler with c.s.mu held.
+func (c *Conn) deliver(from netip.AddrPort, payload []byte) {
+	if c.raddr.IsValid() && from != c.raddr {
+		return
+	}
+	if c.full {
+		c.dropped++
+		return
+	}
+	c.rlen = copy(c.rbuf[:], payload)
+	c.rfrom = from
+	c.full = true
+}
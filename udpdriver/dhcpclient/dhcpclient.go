@@ -0,0 +1,461 @@
+// Package dhcpclient implements a minimal DHCP client over a udpdriver.Stack
+// which obtains and renews an IPv4 lease so programs do not need a full
+// network stack just to get an address:
+//
+//	client, err := dhcpclient.New(stack, dhcpclient.Config{
+//		Hostname: "pico",
+//		OnLease: func(l dhcpclient.Lease) {
+//			println("got address", l.Addr.String())
+//		},
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	go client.Run()
+//
+// The obtained lease is applied to the stack with SetIPConfig.
+package dhcpclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/cyw43439/storage"
+	"github.com/soypat/cyw43439/udpdriver"
+	"github.com/soypat/seqs/eth/dhcp"
+)
+
+var (
+	errTimeout  = errors.New("dhcpclient: timeout")
+	errNoOffer  = errors.New("dhcpclient: no offer received")
+	errNAK      = errors.New("dhcpclient: request not acknowledged")
+	errNoLease  = errors.New("dhcpclient: no lease")
+	errBadAck   = errors.New("dhcpclient: acknowledgement missing subnet mask")
+	errHostname = errors.New("dhcpclient: hostname too long")
+)
+
+const (
+	defaultTimeout = 2 * time.Second
+	defaultRetries = 4
+	maxHostname    = 63
+	// Used when the server does not provide a lease time.
+	defaultLeaseTime = time.Hour
+	// Minimum time waited between renewal attempts.
+	minRenewWait  = 10 * time.Second
+	flagBroadcast = 0x8000
+)
+
+// Lease is an IPv4 address lease obtained from a DHCP server.
+type Lease struct {
+	// Addr is the leased address and its network prefix.
+	Addr    netip.Prefix
+	Gateway netip.Addr
+	// DNS are the DNS servers advertised by the server, at most 2.
+	DNS    [2]netip.Addr
+	Server netip.Addr
+	// Acquired is when the lease was last acknowledged. The lease must be
+	// renewed after Renew and expires after Expire, both measured from Acquired.
+	Acquired time.Time
+	Renew    time.Duration
+	Rebind   time.Duration
+	Expire   time.Duration
+}
+
+// IPConfig returns the addressing of the lease.
+func (l Lease) IPConfig() cyw43439.IPConfig {
+	c := cyw43439.IPConfig{Gateway: l.Gateway, DNS: l.DNS}
+	if l.Addr.IsValid() {
+		c.Addr = l.Addr.Addr()
+		c.Mask = cyw43439.IPMask(l.Addr.Bits())
+	}
+	return c
+}
+
+// Config configures a Client.
+type Config struct {
+	// Hostname is sent to the server in requests if not empty.
+	Hostname string
+	// RequestedAddr is the address requested on discovery, i.e: that of a
+	// previous lease. May be left zero.
+	RequestedAddr netip.Addr
+	// OnLease is called each time a lease is obtained or renewed.
+	OnLease func(Lease)
+	// OnExpire is called when a lease expired without being renewed. The stack's
+	// address has been unset when it is called.
+	OnExpire func()
+	// Timeout is the time waited for a response to each message. Zero selects 2s.
+	Timeout time.Duration
+	// Retries is the amount of times each message is sent before giving up. Zero selects 4.
+	Retries int
+	// Storage, if set, persists the last lease under storage.KeyLease. Its address
+	// is requested on discovery when RequestedAddr is zero, i.e: after a reboot.
+	Storage storage.Storage
+}
+
+// Client is a DHCP client. Only Lease may be called concurrently with other methods.
+type Client struct {
+	stack *udpdriver.Stack
+	conn  *udpdriver.Conn
+	cfg   Config
+	mac   [6]byte
+	xid   uint32
+	mu    sync.Mutex
+	lease Lease
+	buf   [dhcp.OptionsOffset + 128]byte
+	rbuf  [udpdriver.MaxPayload]byte
+}
+
+// New creates a DHCP client which listens on the DHCP client port of stack.
+func New(stack *udpdriver.Stack, cfg Config) (*Client, error) {
+	if len(cfg.Hostname) > maxHostname {
+		return nil, errHostname
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = defaultRetries
+	}
+	conn, err := stack.ListenUDP(dhcp.DefaultClientPort)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		stack: stack,
+		conn:  conn,
+		cfg:   cfg,
+		mac:   stack.HardwareAddr6(),
+	}
+	c.xid = binary.BigEndian.Uint32(c.mac[2:]) ^ uint32(time.Now().UnixNano())
+	if cfg.Storage != nil && !cfg.RequestedAddr.IsValid() {
+		var buf [storedLeaseLen]byte
+		n, err := cfg.Storage.Load(storage.KeyLease, buf[:])
+		if err == nil && n == storedLeaseLen {
+			c.cfg.RequestedAddr = netip.AddrFrom4([4]byte(buf[:4]))
+		}
+	}
+	return c, nil
+}
+
+// Lease returns the current lease. Its Addr is the zero value if no lease is held.
+func (c *Client) Lease() Lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lease
+}
+
+// Acquire performs the discover, offer, request and acknowledge exchange and
+// applies the obtained lease to the stack.
+func (c *Client) Acquire() (Lease, error) {
+	var offer Lease
+	var offered [4]byte
+	c.xid++
+	err := c.exchange(func() error {
+		return c.send(dhcp.MsgDiscover, c.cfg.RequestedAddr, netip.Addr{}, netip.AddrPortFrom(netip.AddrFrom4([4]byte{255, 255, 255, 255}), dhcp.DefaultServerPort))
+	}, func(msg dhcp.MessageType, l Lease, yiaddr [4]byte) (bool, error) {
+		if msg != dhcp.MsgOffer {
+			return false, nil
+		}
+		if !l.Server.IsValid() || !l.Addr.IsValid() {
+			return false, nil // Ignore unusable offers.
+		}
+		offer, offered = l, yiaddr
+		return true, nil
+	})
+	if err == errTimeout {
+		err = errNoOffer
+	}
+	if err != nil {
+		return Lease{}, err
+	}
+	return c.request(netip.AddrFrom4(offered), offer.Server, true)
+}
+
+// Renew renews the current lease with the server which granted it. If rebind
+// is set the request is broadcast to any server instead, as is done once the
+// rebinding time has passed.
+func (c *Client) Renew(rebind bool) (Lease, error) {
+	current := c.Lease()
+	if !current.Addr.IsValid() {
+		return Lease{}, errNoLease
+	}
+	c.xid++
+	server := current.Server
+	if rebind {
+		server = netip.Addr{}
+	}
+	return c.request(current.Addr.Addr(), server, false)
+}
+
+// Run acquires a lease, retrying every few seconds on failure, and keeps it
+// renewed. It never returns.
+func (c *Client) Run() {
+	for {
+		lease := c.Lease()
+		if !lease.Addr.IsValid() {
+			_, err := c.Acquire()
+			if err != nil {
+				time.Sleep(minRenewWait)
+			}
+			continue
+		}
+		elapsed := time.Since(lease.Acquired)
+		switch {
+		case elapsed >= lease.Expire:
+			c.expire()
+		case elapsed >= lease.Renew:
+			_, err := c.Renew(elapsed >= lease.Rebind)
+			if err == errNAK {
+				c.expire()
+			} else if err != nil {
+				// RFC 2131: wait half of the remaining time until rebind (or expiry) before retrying.
+				next := lease.Rebind
+				if elapsed >= lease.Rebind {
+					next = lease.Expire
+				}
+				time.Sleep(maxDuration((next-elapsed)/2, minRenewWait))
+			}
+		default:
+			time.Sleep(lease.Renew - elapsed)
+		}
+	}
+}
+
+func (c *Client) expire() {
+	c.mu.Lock()
+	c.lease = Lease{}
+	c.mu.Unlock()
+	c.stack.SetIPConfig(cyw43439.IPConfig{})
+	if c.cfg.OnExpire != nil {
+		c.cfg.OnExpire()
+	}
+}
+
+func (c *Client) request(addr, server netip.Addr, selecting bool) (Lease, error) {
+	dst := netip.AddrPortFrom(netip.AddrFrom4([4]byte{255, 255, 255, 255}), dhcp.DefaultServerPort)
+	if server.IsValid() && !selecting {
+		dst = netip.AddrPortFrom(server, dhcp.DefaultServerPort)
+	}
+	var ack Lease
+	var acked [4]byte
+	err := c.exchange(func() error {
+		if selecting {
+			return c.send(dhcp.MsgRequest, addr, server, dst)
+		}
+		return c.send(dhcp.MsgRequest, netip.Addr{}, netip.Addr{}, dst)
+	}, func(msg dhcp.MessageType, l Lease, yiaddr [4]byte) (bool, error) {
+		switch msg {
+		case dhcp.MsgAck:
+			ack, acked = l, yiaddr
+			return true, nil
+		case dhcp.MsgNak:
+			return true, errNAK
+		}
+		return false, nil
+	})
+	if err != nil {
+		return Lease{}, err
+	}
+	if !ack.Addr.IsValid() {
+		// Acknowledgements of renewals may omit the subnet mask.
+		current := c.Lease()
+		if !current.Addr.IsValid() {
+			return Lease{}, errBadAck
+		}
+		ack.Addr = netip.PrefixFrom(netip.AddrFrom4(acked), current.Addr.Bits())
+	}
+	if !ack.Server.IsValid() {
+		ack.Server = server
+	}
+	err = c.stack.SetIPConfig(ack.IPConfig())
+	if err != nil {
+		return Lease{}, err
+	}
+	c.mu.Lock()
+	c.lease = ack
+	c.mu.Unlock()
+	if c.cfg.Storage != nil {
+		c.storeLease(ack)
+	}
+	if c.cfg.OnLease != nil {
+		c.cfg.OnLease(ack)
+	}
+	return ack, nil
+}
+
+// exchange calls send and reads replies until handle returns true, retrying on timeout.
+func (c *Client) exchange(send func() error, handle func(msg dhcp.MessageType, l Lease, yiaddr [4]byte) (bool, error)) error {
+	for retry := 0; retry < c.cfg.Retries; retry++ {
+		err := send()
+		if err != nil {
+			return err
+		}
+		c.conn.SetReadDeadline(time.Now().Add(c.cfg.Timeout))
+		for {
+			n, _, err := c.conn.ReadFrom(c.rbuf[:])
+			if err != nil {
+				break // Timeout, retry.
+			}
+			msg, l, yiaddr, ok := c.parse(c.rbuf[:n])
+			if !ok {
+				continue
+			}
+			done, err := handle(msg, l, yiaddr)
+			if done || err != nil {
+				return err
+			}
+		}
+	}
+	return errTimeout
+}
+
+// send sends a DHCP message. reqAddr and server are added as options if valid.
+// The client address field is set for requests sent while bound.
+func (c *Client) send(msg dhcp.MessageType, reqAddr, server netip.Addr, dst netip.AddrPort) error {
+	buf := c.buf[:]
+	for i := range buf {
+		buf[i] = 0
+	}
+	hdr := dhcp.HeaderV4{
+		OP:    dhcp.OpRequest,
+		HType: 1,
+		HLen:  6,
+		Xid:   c.xid,
+	}
+	if local := c.stack.Addr(); local.IsValid() {
+		hdr.CIAddr = local.Addr().As4()
+	} else {
+		hdr.Flags = flagBroadcast
+	}
+	copy(hdr.CHAddr[:], c.mac[:])
+	hdr.Put(buf)
+	binary.BigEndian.PutUint32(buf[dhcp.MagicCookieOffset:], dhcp.MagicCookie)
+	ptr := dhcp.OptionsOffset
+	ptr += putOption(buf[ptr:], dhcp.OptMessageType, byte(msg))
+	ptr += putOption(buf[ptr:], dhcp.OptClientIdentifier1, 1, c.mac[0], c.mac[1], c.mac[2], c.mac[3], c.mac[4], c.mac[5])
+	if reqAddr.Is4() {
+		a := reqAddr.As4()
+		ptr += putOption(buf[ptr:], dhcp.OptRequestedIPaddress, a[:]...)
+	}
+	if server.Is4() {
+		a := server.As4()
+		ptr += putOption(buf[ptr:], dhcp.OptServerIdentification, a[:]...)
+	}
+	if c.cfg.Hostname != "" {
+		buf[ptr] = byte(dhcp.OptHostName)
+		buf[ptr+1] = byte(len(c.cfg.Hostname))
+		ptr += 2 + copy(buf[ptr+2:], c.cfg.Hostname)
+	}
+	ptr += putOption(buf[ptr:], dhcp.OptParameterRequestList, byte(dhcp.OptSubnetMask), byte(dhcp.OptRouter),
+		byte(dhcp.OptDNSServers), byte(dhcp.OptIPAddressLeaseTime), byte(dhcp.OptRenewTimeValue), byte(dhcp.OptRebindingTimeValue))
+	buf[ptr] = 0xff // End option.
+	ptr++
+	_, err := c.conn.WriteTo(buf[:ptr], dst)
+	return err
+}
+
+func putOption(dst []byte, num dhcp.OptNum, data ...byte) int {
+	dst[0] = byte(num)
+	dst[1] = byte(len(data))
+	return 2 + copy(dst[2:], data)
+}
+
+// parse decodes a server reply addressed to this client.
+func (c *Client) parse(b []byte) (msg dhcp.MessageType, l Lease, yiaddr [4]byte, ok bool) {
+	if len(b) < dhcp.OptionsOffset || binary.BigEndian.Uint32(b[dhcp.MagicCookieOffset:]) != dhcp.MagicCookie {
+		return 0, l, yiaddr, false
+	}
+	hdr := dhcp.DecodeHeaderV4(b)
+	if hdr.OP != dhcp.OpReply || hdr.Xid != c.xid || [6]byte(hdr.CHAddr[:6]) != c.mac {
+		return 0, l, yiaddr, false
+	}
+	var mask [4]byte
+	var lease, renew, rebind uint32
+	ndns := 0
+	err := dhcp.ForEachOption(b, func(opt dhcp.Option) error {
+		switch {
+		case opt.Num == dhcp.OptMessageType && len(opt.Data) == 1:
+			msg = dhcp.MessageType(opt.Data[0])
+		case opt.Num == dhcp.OptSubnetMask && len(opt.Data) == 4:
+			copy(mask[:], opt.Data)
+		case opt.Num == dhcp.OptRouter && len(opt.Data) >= 4:
+			l.Gateway = netip.AddrFrom4([4]byte(opt.Data[:4]))
+		case opt.Num == dhcp.OptServerIdentification && len(opt.Data) == 4:
+			l.Server = netip.AddrFrom4([4]byte(opt.Data))
+		case opt.Num == dhcp.OptDNSServers:
+			for i := 0; i+4 <= len(opt.Data) && ndns < len(l.DNS); i += 4 {
+				l.DNS[ndns] = netip.AddrFrom4([4]byte(opt.Data[i : i+4]))
+				ndns++
+			}
+		case opt.Num == dhcp.OptIPAddressLeaseTime && len(opt.Data) == 4:
+			lease = binary.BigEndian.Uint32(opt.Data)
+		case opt.Num == dhcp.OptRenewTimeValue && len(opt.Data) == 4:
+			renew = binary.BigEndian.Uint32(opt.Data)
+		case opt.Num == dhcp.OptRebindingTimeValue && len(opt.Data) == 4:
+			rebind = binary.BigEndian.Uint32(opt.Data)
+		}
+		return nil
+	})
+	if err != nil || msg == 0 {
+		return 0, l, yiaddr, false
+	}
+	yiaddr = hdr.YIAddr
+	if mask != [4]byte{} {
+		ones := 0
+		for _, b := range mask {
+			for ; b&0x80 != 0; b <<= 1 {
+				ones++
+			}
+		}
+		l.Addr = netip.PrefixFrom(netip.AddrFrom4(yiaddr), ones)
+	}
+	l.Acquired = time.Now()
+	l.Expire = defaultLeaseTime
+	if lease != 0 {
+		l.Expire = time.Duration(lease) * time.Second
+	}
+	// RFC 2131 defaults: renew at 50% and rebind at 87.5% of the lease time.
+	l.Renew = l.Expire / 2
+	l.Rebind = l.Expire * 7 / 8
+	if renew != 0 {
+		l.Renew = time.Duration(renew) * time.Second
+	}
+	if rebind != 0 {
+		l.Rebind = time.Duration(rebind) * time.Second
+	}
+	return msg, l, yiaddr, true
+}
+
+// storedLeaseLen is the length of a lease stored by storeLease: address,
+// prefix length, gateway, 2 DNS servers and server address.
+const storedLeaseLen = 4 + 1 + 4 + 2*4 + 4
+
+// storeLease persists l if its address or servers changed, sparing flash wear on renewals.
+func (c *Client) storeLease(l Lease) {
+	var buf, old [storedLeaseLen]byte
+	a := l.Addr.Addr().As4()
+	copy(buf[0:], a[:])
+	buf[4] = byte(l.Addr.Bits())
+	for i, addr := range [...]netip.Addr{l.Gateway, l.DNS[0], l.DNS[1], l.Server} {
+		if addr.Is4() {
+			a = addr.As4()
+			copy(buf[5+4*i:], a[:])
+		}
+	}
+	n, err := c.cfg.Storage.Load(storage.KeyLease, old[:])
+	if err == nil && n == storedLeaseLen && old == buf {
+		return
+	}
+	c.cfg.Storage.Store(storage.KeyLease, buf[:])
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
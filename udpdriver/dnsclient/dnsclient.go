@@ -0,0 +1,227 @@
+// Package dnsclient implements a minimal DNS-over-UDP resolver of IPv4
+// addresses over a udpdriver.Stack, i.e: with the DNS servers of a lease
+// obtained with dhcpclient:
+//
+//	r, err := dnsclient.New(stack, lease.DNS[0])
+//	if err != nil {
+//		panic(err)
+//	}
+//	addr, err := r.Resolve("pool.ntp.org")
+package dnsclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/soypat/cyw43439/udpdriver"
+	"github.com/soypat/seqs/eth/dns"
+)
+
+var (
+	errNoServer    = errors.New("dnsclient: no DNS server")
+	errName        = errors.New("dnsclient: invalid name")
+	errTimeout     = errors.New("dnsclient: timeout")
+	errNotFound    = errors.New("dnsclient: no A record found")
+	errServerReply = errors.New("dnsclient: server returned error")
+	errMismatch    = errors.New("dnsclient: response does not match query")
+)
+
+const (
+	maxName        = 253
+	defaultTimeout = 2 * time.Second
+	defaultRetries = 3
+)
+
+// Resolver resolves names to IPv4 addresses. Its methods must not be called concurrently.
+type Resolver struct {
+	stack   *udpdriver.Stack
+	servers []netip.Addr
+	id      uint16
+	// Timeout is the time waited for each response. Defaults to 2s.
+	Timeout time.Duration
+	// Retries is the amount of times a query is sent to each server. Defaults to 3.
+	Retries int
+	buf     [dns.MaxSizeUDP]byte
+}
+
+// New returns a Resolver which queries servers in order. Invalid (zero)
+// servers are ignored so the DNS field of a DHCP lease may be passed as is.
+// If no servers are passed the DNS servers of the stack's IPConfig are used.
+func New(stack *udpdriver.Stack, servers ...netip.Addr) (*Resolver, error) {
+	if len(servers) == 0 {
+		dns := stack.IPConfig().DNS
+		servers = dns[:]
+	}
+	r := &Resolver{
+		stack:   stack,
+		Timeout: defaultTimeout,
+		Retries: defaultRetries,
+		id:      uint16(time.Now().UnixNano()),
+	}
+	for _, s := range servers {
+		if s.Is4() {
+			r.servers = append(r.servers, s)
+		}
+	}
+	if len(r.servers) == 0 {
+		return nil, errNoServer
+	}
+	return r, nil
+}
+
+// Resolve returns the first IPv4 address of name's A records. Names which are
+// IPv4 address literals are returned as is without querying.
+func (r *Resolver) Resolve(name string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(name); err == nil && addr.Is4() {
+		return addr, nil
+	}
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		name = name[:len(name)-1]
+	}
+	if len(name) == 0 || len(name) > maxName {
+		return netip.Addr{}, errName
+	}
+	err := errTimeout
+	for _, server := range r.servers {
+		var addr netip.Addr
+		addr, err = r.query(server, name)
+		if err == nil || err == errNotFound {
+			return addr, err
+		}
+	}
+	return netip.Addr{}, err
+}
+
+func (r *Resolver) query(server netip.Addr, name string) (netip.Addr, error) {
+	conn, err := r.stack.DialUDP(netip.AddrPortFrom(server, dns.ServerPort))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	for retry := 0; retry < r.Retries; retry++ {
+		r.id++
+		n, err := r.putQuery(name)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		_, err = conn.Write(r.buf[:n])
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		conn.SetReadDeadline(time.Now().Add(r.Timeout))
+		for {
+			n, err = conn.Read(r.buf[:])
+			if err != nil {
+				break // Timeout, retry.
+			}
+			addr, err := r.parseResponse(r.buf[:n])
+			if err == errMismatch {
+				continue
+			}
+			return addr, err
+		}
+	}
+	return netip.Addr{}, errTimeout
+}
+
+// putQuery writes an A record query for name to r.buf and returns its length.
+func (r *Resolver) putQuery(name string) (int, error) {
+	hdr := dns.Header{
+		TransactionID: r.id,
+		Flags:         dns.NewClientHeaderFlags(dns.OpCodeQuery, true),
+		QDCount:       1,
+	}
+	hdr.Put(r.buf[:])
+	ptr := dns.SizeHeader
+	for len(name) > 0 {
+		label := name
+		for i := 0; i < len(name); i++ {
+			if name[i] == '.' {
+				label = name[:i]
+				break
+			}
+		}
+		if len(label) == 0 || len(label) > 63 {
+			return 0, errName
+		}
+		r.buf[ptr] = byte(len(label))
+		ptr += 1 + copy(r.buf[ptr+1:], label)
+		name = name[min(len(label)+1, len(name)):]
+	}
+	r.buf[ptr] = 0
+	binary.BigEndian.PutUint16(r.buf[ptr+1:], uint16(dns.TypeA))
+	binary.BigEndian.PutUint16(r.buf[ptr+3:], uint16(dns.ClassINET))
+	return ptr + 5, nil
+}
+
+// parseResponse returns the first A record of a response to the last query.
+func (r *Resolver) parseResponse(msg []byte) (netip.Addr, error) {
+	if len(msg) < dns.SizeHeader {
+		return netip.Addr{}, errMismatch
+	}
+	hdr := dns.DecodeHeader(msg)
+	if hdr.TransactionID != r.id || !hdr.Flags.IsResponse() {
+		return netip.Addr{}, errMismatch
+	}
+	switch hdr.Flags.ResponseCode() {
+	case dns.RCodeSuccess:
+	case dns.RCodeNameError:
+		return netip.Addr{}, errNotFound
+	default:
+		return netip.Addr{}, errServerReply
+	}
+	off := dns.SizeHeader
+	var ok bool
+	for i := 0; i < int(hdr.QDCount); i++ {
+		off, ok = skipName(msg, off)
+		if !ok {
+			return netip.Addr{}, errMismatch
+		}
+		off += 4 // Type and class.
+	}
+	for i := 0; i < int(hdr.ANCount); i++ {
+		off, ok = skipName(msg, off)
+		if !ok || off+10 > len(msg) {
+			return netip.Addr{}, errMismatch
+		}
+		typ := dns.Type(binary.BigEndian.Uint16(msg[off:]))
+		class := dns.Class(binary.BigEndian.Uint16(msg[off+2:]))
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return netip.Addr{}, errMismatch
+		}
+		if typ == dns.TypeA && class == dns.ClassINET && rdlen == 4 {
+			return netip.AddrFrom4([4]byte(msg[off : off+4])), nil
+		}
+		off += rdlen // Skip CNAMEs and other records.
+	}
+	return netip.Addr{}, errNotFound
+}
+
+// skipName returns the offset following the possibly compressed name at off.
+func skipName(msg []byte, off int) (int, bool) {
+	for off < len(msg) {
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, true
+		case l&0xc0 == 0xc0:
+			// Compression pointer terminates the name.
+			return off + 2, off+2 <= len(msg)
+		case l&0xc0 != 0:
+			return 0, false
+		}
+		off += 1 + l
+	}
+	return 0, false
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
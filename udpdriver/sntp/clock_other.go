@@ -0,0 +1,7 @@
+//go:build !tinygo
+
+package sntp
+
+import "time"
+
+func adjustClock(offset time.Duration) error { return errNoClock }
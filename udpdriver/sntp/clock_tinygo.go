@@ -0,0 +1,13 @@
+//go:build tinygo
+
+package sntp
+
+import (
+	"runtime"
+	"time"
+)
+
+func adjustClock(offset time.Duration) error {
+	runtime.AdjustTimeOffset(int64(offset))
+	return nil
+}
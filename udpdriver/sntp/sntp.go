@@ -0,0 +1,88 @@
+// Package sntp implements a minimal SNTP (RFC 4330) client over a
+// udpdriver.Stack which obtains wall-clock time and sets the runtime's clock,
+// since the CYW43439 and RP2040 have no battery backed clock and certificate
+// validation and logging need real time:
+//
+//	now, err := sntp.Sync(stack, ntpServerAddr, 2*time.Second)
+//
+// Timestamps are interpreted in NTP era 0 so results are wrong after February 2036.
+package sntp
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/soypat/cyw43439/udpdriver"
+	"github.com/soypat/seqs/eth/ntp"
+)
+
+var (
+	errTimeout  = errors.New("sntp: timeout")
+	errKissCode = errors.New("sntp: server sent kiss-o'-death or is unsynchronized")
+	errNoClock  = errors.New("sntp: setting the clock is only supported with TinyGo")
+)
+
+// Query sends a single SNTP request to server and returns the offset which must be
+// added to the local clock (time.Now) to obtain the server's time. The request is
+// retried 3 times, waiting up to timeout for each response.
+func Query(stack *udpdriver.Stack, server netip.Addr, timeout time.Duration) (time.Duration, error) {
+	conn, err := stack.DialUDP(netip.AddrPortFrom(server, ntp.ServerPort))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var buf [ntp.SizeHeader]byte
+	for retry := 0; retry < 3; retry++ {
+		t1 := time.Now()
+		origin, err := ntp.TimestampFromTime(t1)
+		if err != nil {
+			return 0, err
+		}
+		var req ntp.Header
+		req.SetFlags(ntp.ModeClient, ntp.LeapNoWarning)
+		req.TransmitTime = origin
+		req.Put(buf[:])
+		_, err = conn.Write(buf[:])
+		if err != nil {
+			return 0, err
+		}
+		conn.SetReadDeadline(t1.Add(timeout))
+		for {
+			n, err := conn.Read(buf[:])
+			if err != nil {
+				break // Timeout, retry.
+			}
+			t4 := time.Now()
+			if n < ntp.SizeHeader {
+				continue
+			}
+			resp := ntp.DecodeHeader(buf[:])
+			if resp.Mode() != ntp.ModeServer || resp.OriginTime != origin {
+				continue // Not a response to our request.
+			}
+			if resp.Stratum == ntp.StratumUnspecified || resp.Stratum >= ntp.StratumUnsync || resp.TransmitTime.IsZero() {
+				return 0, errKissCode
+			}
+			// RFC 4330: offset = ((T2 - T1) + (T3 - T4)) / 2.
+			t2 := resp.ReceiveTime.Time()
+			t3 := resp.TransmitTime.Time()
+			return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+		}
+	}
+	return 0, errTimeout
+}
+
+// Sync queries server and adjusts the runtime's clock so that time.Now returns
+// the server's time. It returns the adjusted current time.
+func Sync(stack *udpdriver.Stack, server netip.Addr, timeout time.Duration) (time.Time, error) {
+	offset, err := Query(stack, server, timeout)
+	if err != nil {
+		return time.Time{}, err
+	}
+	err = adjustClock(offset)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now(), nil
+}
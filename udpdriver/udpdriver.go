@@ -0,0 +1,577 @@
+// Package udpdriver implements a minimal socket-like UDP over IPv4 API directly
+// on top of the CYW43439 driver's raw Ethernet frame path for programs which
+// do not need a full TCP/IP stack:
+//
+//	stack, err := udpdriver.New(dev, udpdriver.Config{
+//		IP: cyw43439.IPConfig{
+//			Addr:    netip.MustParseAddr("192.168.1.10"),
+//			Mask:    netip.MustParseAddr("255.255.255.0"),
+//			Gateway: netip.MustParseAddr("192.168.1.1"),
+//		},
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	conn, err := stack.DialUDP(netip.MustParseAddrPort("192.168.1.2:9999"))
+//	if err != nil {
+//		panic(err)
+//	}
+//	conn.Write([]byte("hello"))
+//
+// ARP requests for the local address are answered and peer hardware addresses
+// are resolved and cached internally. There is no IP fragmentation, ICMP or
+// routing beyond a single default gateway. The address may be left unset and
+// provided later with SetIPConfig, i.e: once a DHCP lease is obtained.
+//
+// The Stack installs itself as the device's receive handler so it cannot be
+// used together with another network stack on the same device.
+package udpdriver
+
+import (
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/soypat/cyw43439"
+	"github.com/soypat/seqs/eth"
+)
+
+var (
+	errNoAddr      = errors.New("udpdriver: local address not set")
+	errNoRoute     = errors.New("udpdriver: destination not on local network and no gateway set")
+	errNotIPv4     = errors.New("udpdriver: only IPv4 is supported")
+	errARPTimeout  = errors.New("udpdriver: ARP resolution timeout")
+	errTooLarge    = errors.New("udpdriver: datagram exceeds maximum payload size")
+	errPortInUse   = errors.New("udpdriver: port in use")
+	errTooManyConn = errors.New("udpdriver: too many open conns")
+	errZeroPort    = errors.New("udpdriver: zero port")
+)
+
+const (
+	// MaxPayload is the largest UDP payload which fits in a single unfragmented
+	// IPv4 packet over Ethernet.
+	MaxPayload = 1500 - eth.SizeIPv4Header - eth.SizeUDPHeader
+
+	hdrLen          = eth.SizeEthernetHeader + eth.SizeIPv4Header + eth.SizeUDPHeader
+	arpCacheSize    = 4
+	arpRetries      = 3
+	framesPerPoll   = 8
+	ephemeralPort   = 49152
+	defaultTTL      = 64
+	defaultMaxConns = 4
+)
+
+// Config configures a Stack.
+type Config struct {
+	// IP is the static addressing of the Stack. It may be left zero and the
+	// addressing set later with SetIPConfig, i.e: by dhcpclient.
+	IP cyw43439.IPConfig
+	// MaxConns is the maximum amount of simultaneously open Conns. Zero selects 4.
+	MaxConns int
+	// ARPTimeout is the time waited for each of the 3 ARP requests sent to resolve
+	// a peer's hardware address. Zero selects 500ms.
+	ARPTimeout time.Duration
+	// PollInterval is the time slept between polls of the device while blocked
+	// waiting for a datagram or ARP reply. Zero selects 5ms.
+	PollInterval time.Duration
+}
+
+// Stack is a minimal UDP/IPv4 implementation over a Device.
+type Stack struct {
+	mu           sync.Mutex
+	dev          *cyw43439.Device
+	mac          [6]byte
+	addr         netip.Prefix
+	gateway      netip.Addr
+	dns          [2]netip.Addr
+	conns        []*Conn
+	arp          [arpCacheSize]arpEntry
+	arpNext      uint8
+	arpReply     eth.ARPv4Header
+	pendingReply bool
+	ipProto      uint8
+	ipHandler    func(src, dst netip.Addr, payload []byte)
+	gotFrame     bool
+	ipID         uint16
+	nextPort     uint16
+	arpTimeout   time.Duration
+	pollInterval time.Duration
+	txbuf        [eth.SizeEthernetHeader + 1500]byte
+}
+
+type arpEntry struct {
+	ip    [4]byte
+	mac   [6]byte
+	valid bool
+}
+
+// New creates a Stack over dev, which should be joined to a network, and
+// installs it as dev's receive handler.
+func New(dev *cyw43439.Device, cfg Config) (*Stack, error) {
+	mac, err := dev.HardwareAddr6()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConns <= 0 {
+		cfg.MaxConns = defaultMaxConns
+	}
+	if cfg.ARPTimeout <= 0 {
+		cfg.ARPTimeout = 500 * time.Millisecond
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Millisecond
+	}
+	s := &Stack{
+		dev:          dev,
+		mac:          mac,
+		conns:        make([]*Conn, cfg.MaxConns),
+		nextPort:     ephemeralPort,
+		arpTimeout:   cfg.ARPTimeout,
+		pollInterval: cfg.PollInterval,
+	}
+	err = s.SetIPConfig(cfg.IP)
+	if err != nil {
+		return nil, err
+	}
+	dev.RecvEthHandle(s.recv)
+	return s, nil
+}
+
+// SetAddr sets the local address and network prefix and the gateway, i.e: from
+// a DHCP lease. A zero addr unsets the address so only broadcasts are sent and
+// received. The ARP cache is cleared.
+func (s *Stack) SetAddr(addr netip.Prefix, gateway netip.Addr) error {
+	if addr.IsValid() && !addr.Addr().Is4() || gateway.IsValid() && !gateway.Is4() {
+		return errNotIPv4
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addr = addr
+	s.gateway = gateway
+	s.arp = [arpCacheSize]arpEntry{}
+	return nil
+}
+
+// SetIPConfig sets the local address, network prefix, gateway and DNS
+// servers, i.e: from a DHCP lease. A zero c.Addr unsets the address as SetAddr does.
+func (s *Stack) SetIPConfig(c cyw43439.IPConfig) error {
+	addr, err := c.Prefix()
+	if err != nil {
+		return err
+	}
+	err = s.SetAddr(addr, c.Gateway)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.dns = c.DNS
+	s.mu.Unlock()
+	return nil
+}
+
+// IPConfig returns the local addressing set with SetIPConfig or SetAddr.
+// Its Addr is the zero value if unset.
+func (s *Stack) IPConfig() cyw43439.IPConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := cyw43439.IPConfig{Gateway: s.gateway, DNS: s.dns}
+	if s.addr.IsValid() {
+		c.Addr = s.addr.Addr()
+		c.Mask = cyw43439.IPMask(s.addr.Bits())
+	}
+	return c
+}
+
+// Addr returns the local address and network prefix. It is the zero value if unset.
+func (s *Stack) Addr() netip.Prefix {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// HardwareAddr6 returns the device's MAC address.
+func (s *Stack) HardwareAddr6() [6]byte { return s.mac }
+
+// ListenUDP opens a Conn which receives datagrams sent to port from any peer.
+func (s *Stack) ListenUDP(port uint16) (*Conn, error) {
+	if port == 0 {
+		return nil, errZeroPort
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.open(port, netip.AddrPort{})
+}
+
+// DialUDP opens a Conn on an ephemeral local port which only receives
+// datagrams from raddr and whose Write method sends to raddr.
+func (s *Stack) DialUDP(raddr netip.AddrPort) (*Conn, error) {
+	if !raddr.Addr().Is4() {
+		return nil, errNotIPv4
+	}
+	if raddr.Port() == 0 {
+		return nil, errZeroPort
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < 1<<14; i++ {
+		port := s.nextPort
+		s.nextPort++
+		if s.nextPort == 0 {
+			s.nextPort = ephemeralPort
+		}
+		if s.conn(port) == nil {
+			return s.open(port, raddr)
+		}
+	}
+	return nil, errPortInUse
+}
+
+// Poll processes frames received by the device: ARP requests for the local
+// address are answered and UDP datagrams are queued on their Conn. Blocking Conn
+// methods poll while waiting so Poll need only be called by programs which only
+// use Conns with an expired read deadline.
+func (s *Stack) Poll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.poll()
+}
+
+func (s *Stack) open(port uint16, raddr netip.AddrPort) (*Conn, error) {
+	if s.conn(port) != nil {
+		return nil, errPortInUse
+	}
+	for i := range s.conns {
+		if s.conns[i] == nil {
+			c := &Conn{s: s, lport: port, raddr: raddr}
+			s.conns[i] = c
+			return c, nil
+		}
+	}
+	return nil, errTooManyConn
+}
+
+func (s *Stack) close(c *Conn) {
+	for i := range s.conns {
+		if s.conns[i] == c {
+			s.conns[i] = nil
+		}
+	}
+}
+
+func (s *Stack) conn(port uint16) *Conn {
+	for _, c := range s.conns {
+		if c != nil && c.lport == port {
+			return c
+		}
+	}
+	return nil
+}
+
+// poll must be called with s.mu held.
+func (s *Stack) poll() error {
+	for i := 0; i < framesPerPoll; i++ {
+		s.gotFrame = false
+		got, err := s.dev.PollOne()
+		if err != nil {
+			return err
+		}
+		if !got && !s.gotFrame {
+			break
+		}
+	}
+	if s.pendingReply {
+		// Replies are sent outside of the receive handler since it runs with the device locked.
+		s.pendingReply = false
+		return s.sendARP(&s.arpReply, s.arpReply.HardwareTarget)
+	}
+	return nil
+}
+
+// recv is the device's receive handler. It is called from within poll so s.mu is held.
+func (s *Stack) recv(pkt []byte) error {
+	s.gotFrame = true
+	if len(pkt) < eth.SizeEthernetHeader {
+		return nil
+	}
+	ehdr := eth.DecodeEthernetHeader(pkt)
+	switch ehdr.AssertType() {
+	case eth.EtherTypeARP:
+		s.recvARP(pkt[eth.SizeEthernetHeader:])
+	case eth.EtherTypeIPv4:
+		s.recvIPv4(pkt[eth.SizeEthernetHeader:])
+	}
+	return nil
+}
+
+func (s *Stack) recvARP(b []byte) {
+	if len(b) < eth.SizeARPv4Header {
+		return
+	}
+	ahdr := eth.DecodeARPv4Header(b)
+	if ahdr.HardwareType != 1 || ahdr.ProtoType != uint16(eth.EtherTypeIPv4) {
+		return
+	}
+	local, ok := s.local4()
+	forUs := ok && ahdr.ProtoTarget == local
+	s.learn(ahdr.ProtoSender, ahdr.HardwareSender, forUs)
+	if ahdr.Operation == 1 && forUs {
+		s.arpReply = eth.ARPv4Header{
+			HardwareType:   1,
+			ProtoType:      uint16(eth.EtherTypeIPv4),
+			HardwareLength: 6,
+			ProtoLength:    4,
+			Operation:      2,
+			HardwareSender: s.mac,
+			ProtoSender:    local,
+			HardwareTarget: ahdr.HardwareSender,
+			ProtoTarget:    ahdr.ProtoSender,
+		}
+		s.pendingReply = true
+	}
+}
+
+func (s *Stack) recvIPv4(b []byte) {
+	if len(b) < eth.SizeIPv4Header {
+		return
+	}
+	ihdr, off := eth.DecodeIPv4Header(b)
+	if ihdr.Version() != 4 || off < eth.SizeIPv4Header || int(ihdr.TotalLength) > len(b) ||
+		int(ihdr.TotalLength) < int(off) || ihdr.Flags.MoreFragments() || ihdr.Flags.FragmentOffset() != 0 {
+		return
+	}
+	if !s.acceptDst(ihdr.Destination) {
+		return
+	}
+	b = b[off:ihdr.TotalLength]
+	if ihdr.Protocol != 17 {
+		if s.ipHandler != nil && ihdr.Protocol == s.ipProto {
+			s.ipHandler(netip.AddrFrom4(ihdr.Source), netip.AddrFrom4(ihdr.Destination), b)
+		}
+		return
+	}
+	if len(b) < eth.SizeUDPHeader {
+		return
+	}
+	uhdr := eth.DecodeUDPHeader(b)
+	if int(uhdr.Length) > len(b) || uhdr.Length < eth.SizeUDPHeader {
+		return
+	}
+	payload := b[eth.SizeUDPHeader:uhdr.Length]
+	if uhdr.Checksum != 0 && !s.dev.RxChecksumGood() && uhdr.CalculateChecksumIPv4(&ihdr, payload) != uhdr.Checksum {
+		return
+	}
+	c := s.conn(uhdr.DestinationPort)
+	if c == nil {
+		return
+	}
+	c.deliver(netip.AddrPortFrom(netip.AddrFrom4(ihdr.Source), uhdr.SourcePort), payload)
+}
+
+func (s *Stack) acceptDst(dst [4]byte) bool {
+	local, ok := s.local4()
+	switch {
+	case dst == [4]byte{255, 255, 255, 255}:
+		return true
+	case !ok:
+		// Without an address accept unicast too, i.e: DHCP offers sent to the offered address.
+		return true
+	}
+	return dst == local || dst == s.subnetBroadcast()
+}
+
+// learn updates the ARP cache entry for ip. A new entry is only created if force is set.
+func (s *Stack) learn(ip [4]byte, mac [6]byte, force bool) {
+	for i := range s.arp {
+		if s.arp[i].valid && s.arp[i].ip == ip {
+			s.arp[i].mac = mac
+			return
+		}
+	}
+	if force {
+		s.arp[s.arpNext] = arpEntry{ip: ip, mac: mac, valid: true}
+		s.arpNext = (s.arpNext + 1) % arpCacheSize
+	}
+}
+
+func (s *Stack) lookup(ip [4]byte) ([6]byte, bool) {
+	for i := range s.arp {
+		if s.arp[i].valid && s.arp[i].ip == ip && s.arp[i].mac != [6]byte{} {
+			return s.arp[i].mac, true
+		}
+	}
+	return [6]byte{}, false
+}
+
+func (s *Stack) local4() ([4]byte, bool) {
+	if !s.addr.IsValid() {
+		return [4]byte{}, false
+	}
+	return s.addr.Addr().As4(), true
+}
+
+func (s *Stack) subnetBroadcast() [4]byte {
+	ip := s.addr.Addr().As4()
+	bits := s.addr.Bits()
+	for i := range ip {
+		hostBits := 8*(i+1) - bits
+		if hostBits >= 8 {
+			ip[i] = 0xff
+		} else if hostBits > 0 {
+			ip[i] |= 1<<hostBits - 1
+		}
+	}
+	return ip
+}
+
+// resolve returns the hardware address datagrams to dst must be sent to. Must be called with s.mu held.
+func (s *Stack) resolve(dst [4]byte) ([6]byte, error) {
+	local, ok := s.local4()
+	if dst == [4]byte{255, 255, 255, 255} || ok && dst == s.subnetBroadcast() {
+		return eth.BroadcastHW6(), nil
+	}
+	if !ok {
+		return [6]byte{}, errNoAddr
+	}
+	if !s.addr.Contains(netip.AddrFrom4(dst)) {
+		if !s.gateway.IsValid() {
+			return [6]byte{}, errNoRoute
+		}
+		dst = s.gateway.As4()
+	}
+	if mac, ok := s.lookup(dst); ok {
+		return mac, nil
+	}
+	req := eth.ARPv4Header{
+		HardwareType:   1,
+		ProtoType:      uint16(eth.EtherTypeIPv4),
+		HardwareLength: 6,
+		ProtoLength:    4,
+		Operation:      1,
+		HardwareSender: s.mac,
+		ProtoSender:    local,
+		ProtoTarget:    dst,
+	}
+	for retry := 0; retry < arpRetries; retry++ {
+		err := s.sendARP(&req, eth.BroadcastHW6())
+		if err != nil {
+			return [6]byte{}, err
+		}
+		// Create an incomplete cache entry so that the reply is learned.
+		s.learn(dst, [6]byte{}, true)
+		deadline := time.Now().Add(s.arpTimeout)
+		for time.Now().Before(deadline) {
+			err = s.poll()
+			if err != nil {
+				return [6]byte{}, err
+			}
+			if mac, ok := s.lookup(dst); ok {
+				return mac, nil
+			}
+			s.mu.Unlock()
+			time.Sleep(s.pollInterval)
+			s.mu.Lock()
+		}
+	}
+	return [6]byte{}, errARPTimeout
+}
+
+func (s *Stack) sendARP(ahdr *eth.ARPv4Header, dst [6]byte) error {
+	ehdr := eth.EthernetHeader{
+		Destination:     dst,
+		Source:          s.mac,
+		SizeOrEtherType: uint16(eth.EtherTypeARP),
+	}
+	ehdr.Put(s.txbuf[:])
+	ahdr.Put(s.txbuf[eth.SizeEthernetHeader:])
+	return s.dev.SendEth(s.txbuf[:eth.SizeEthernetHeader+eth.SizeARPv4Header])
+}
+
+// sendUDP must be called with s.mu held.
+func (s *Stack) sendUDP(lport uint16, raddr netip.AddrPort, payload []byte) error {
+	if len(payload) > MaxPayload {
+		return errTooLarge
+	}
+	if !raddr.Addr().Is4() {
+		return errNotIPv4
+	}
+	dst := raddr.Addr().As4()
+	mac, err := s.resolve(dst)
+	if err != nil {
+		return err
+	}
+	ihdr := s.putHeaders(mac, dst, 17, eth.SizeUDPHeader+len(payload))
+	uhdr := eth.UDPHeader{
+		SourcePort:      lport,
+		DestinationPort: raddr.Port(),
+		Length:          uint16(eth.SizeUDPHeader + len(payload)),
+	}
+	// With checksum offload the checksum is left zero for the firmware to compute.
+	if s.dev.ChecksumOffload()&cyw43439.ChecksumTx == 0 {
+		uhdr.Checksum = uhdr.CalculateChecksumIPv4(&ihdr, payload)
+		if uhdr.Checksum == 0 {
+			uhdr.Checksum = 0xffff // Zero means no checksum.
+		}
+	}
+	uhdr.Put(s.txbuf[eth.SizeEthernetHeader+eth.SizeIPv4Header:])
+	n := copy(s.txbuf[hdrLen:], payload)
+	return s.dev.SendEth(s.txbuf[:hdrLen+n])
+}
+
+// SendIPv4 sends payload, which must include the transport header, as an IPv4
+// packet of protocol proto to dst. It is meant for protocols handled with HandleIPv4.
+func (s *Stack) SendIPv4(proto uint8, dst netip.Addr, payload []byte) error {
+	if len(payload) > 1500-eth.SizeIPv4Header {
+		return errTooLarge
+	}
+	if !dst.Is4() {
+		return errNotIPv4
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dst4 := dst.As4()
+	mac, err := s.resolve(dst4)
+	if err != nil {
+		return err
+	}
+	s.putHeaders(mac, dst4, proto, len(payload))
+	n := copy(s.txbuf[eth.SizeEthernetHeader+eth.SizeIPv4Header:], payload)
+	return s.dev.SendEth(s.txbuf[:eth.SizeEthernetHeader+eth.SizeIPv4Header+n])
+}
+
+// HandleIPv4 sets the handler of received IPv4 packets of protocol proto, i.e: 6
+// for TCP, which are otherwise dropped. Only one such protocol may be handled and
+// UDP may not be. handler is called from within Poll with the Stack locked so it
+// must not call Stack or Conn methods; packets it replies to should be copied and
+// replied to with SendIPv4 after Poll returns. A nil handler removes it.
+func (s *Stack) HandleIPv4(proto uint8, handler func(src, dst netip.Addr, payload []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ipProto = proto
+	s.ipHandler = handler
+}
+
+// putHeaders writes the Ethernet and IPv4 headers of a packet carrying n bytes
+// of protocol proto to s.txbuf and returns the IPv4 header.
+func (s *Stack) putHeaders(mac [6]byte, dst [4]byte, proto uint8, n int) eth.IPv4Header {
+	local, _ := s.local4()
+	s.ipID++
+	ihdr := eth.IPv4Header{
+		VersionAndIHL: 5,
+		TotalLength:   uint16(eth.SizeIPv4Header + n),
+		ID:            s.ipID,
+		TTL:           defaultTTL,
+		Protocol:      proto,
+		Source:        local,
+		Destination:   dst,
+	}
+	ihdr.Checksum = ihdr.CalculateChecksum()
+	ehdr := eth.EthernetHeader{
+		Destination:     mac,
+		Source:          s.mac,
+		SizeOrEtherType: uint16(eth.EtherTypeIPv4),
+	}
+	ehdr.Put(s.txbuf[:])
+	ihdr.Put(s.txbuf[eth.SizeEthernetHeader:])
+	return ihdr
+}
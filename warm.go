@@ -0,0 +1,146 @@
+package cyw43439
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements warm restarts: recovering a CYW43439 which is still
+// running firmware downloaded before the application rebooted with WL_REG_ON
+// held high, skipping the power cycle and firmware download of Init.
+
+// ErrNotWarm is returned by InitWarm if the CYW43439 is not running firmware.
+var ErrNotWarm = errors.New("chip not running firmware, Init required")
+
+var (
+	errWarmBluetooth = errors.New("warm restart does not support bluetooth")
+)
+
+const (
+	// warmBusRetries is the amount of test register reads by InitWarm. The
+	// chip is already up so it need not be waited for.
+	warmBusRetries = 2
+	// warmMaxDrain is the maximum amount of stale frames discarded by InitWarm.
+	warmMaxDrain = 32
+)
+
+// InitWarm initializes the Device with a CYW43439 which is already running
+// firmware, i.e: after the application rebooted without power cycling the
+// chip. Only the bus is configured so it takes milliseconds instead of the
+// seconds taken by Init. Firmware settings made before the reboot, such as the
+// country and the joined network, are kept; the link state is recovered from
+// the firmware. Only the driver settings of cfg are applied, its images are not used.
+//
+// If the chip is not running firmware an error wrapping ErrNotWarm is
+// returned and Init must be called, i.e: after a power loss. Bluetooth is not supported.
+func (d *Device) InitWarm(cfg Config) (err error) {
+	if cfg.mode&modeBluetooth != 0 {
+		return errWarmBluetooth
+	} else if cfg.mode&modeWifi == 0 {
+		return errNoOpMode
+	} else if cfg.RxBuffer != nil && (len(cfg.RxBuffer) < MinRxBufferLen || len(cfg.RxBuffer) > MaxRxBufferLen) {
+		return errRxBufferLen
+	}
+	err = d.acquire(0)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.applyConfig(&cfg)
+	d.info("InitWarm:start")
+	start := time.Now()
+	d.resetState()
+	defer func() {
+		if err != nil {
+			d.mode = 0 // Leave the Device uninitialized.
+		}
+	}()
+	d.mode = cfg.mode
+	d.backplaneWindow = 0xaaaa_aaaa
+
+	// A chip running firmware is in the order configured by the last Init,
+	// try it first so other orders are only probed if it is not.
+	order, got, err := d.detect_bus_order(warmBusRetries, bus32)
+	if err != nil {
+		order, got, err = d.detect_bus_order(0, bus16, bus16BE, bus32BE)
+	}
+	if err != nil {
+		return errjoin(ErrNotWarm, err)
+	} else if order == bus16 {
+		// Power on default: the chip was reset since the last Init.
+		d.debug("InitWarm:bus16", slog.Uint64("got", uint64(got)))
+		return ErrNotWarm
+	}
+	err = d.setupBus(order)
+	if err != nil {
+		return err
+	}
+	err = d.detect_chip()
+	if err != nil {
+		return err
+	}
+	if !d.firmware_running() {
+		return ErrNotWarm
+	}
+	d.bp_write32(whd.SDIO_BASE_ADDRESS+whd.SDIO_INT_HOST_MASK, whd.I_HMB_SW_MASK)
+	err = d.log_init()
+	if err != nil {
+		return err
+	}
+
+	// Discard frames queued for the previous session. Their SDPCM headers
+	// also update the transmit credit.
+	for i := 0; i < warmMaxDrain; i++ {
+		_, _, err = d.tryPoll(d._rxBuf)
+		if err == errNoF2Avail {
+			break
+		}
+	}
+	// An ioctl round trip confirms the firmware is responsive.
+	_, err = d.get_iovar_n("cur_etheraddr", whd.IF_STA, d.mac[:6])
+	if err != nil {
+		return errjoin(ErrNotWarm, err)
+	}
+	var bssid [6]byte
+	_, err = d.doIoctlGet(whd.WLC_GET_BSSID, whd.IF_STA, bssid[:])
+	if err == nil && bssid != [6]byte{} {
+		// Still associated, listen for link changes as after a join.
+		d.eventmask.Enable(whd.EvLINK)
+		d.eventmask.Enable(whd.EvJOIN)
+		d.eventmask.Enable(whd.EvDISASSOC)
+		d.eventmask.Enable(whd.EvDEAUTH)
+		d.setLinkState(LinkStateUp)
+	} else {
+		d.setLinkState(LinkStateDown)
+	}
+	d.info("InitWarm:done", slog.String("link", d.state.String()), slog.Duration("took", time.Since(start)))
+	return nil
+}
+
+// firmware_running checks the WLAN core is up with the HT clock running and
+// the firmware has published its shared memory structure, which holds the
+// address of the firmware console.
+func (d *Device) firmware_running() bool {
+	if !d.core_is_up(whd.CORE_WLAN_ARM) {
+		return false
+	}
+	csr, err := d.read8(FuncBackplane, whd.SDIO_CHIP_CLOCK_CSR)
+	if err != nil || csr&whd.SBSDIO_HT_AVAIL == 0 {
+		return false
+	}
+	chip := d.chip_profile()
+	sharedAddr, err := d.bp_read32(chip.sharedPtrAddr())
+	if err != nil || !chip.inRAM(sharedAddr, 32) || sharedAddr%4 != 0 {
+		return false
+	}
+	var shared [32]byte
+	err = d.bp_read(sharedAddr, shared[:])
+	if err != nil {
+		return false
+	}
+	smem := decodeSharedMem(_busOrder, shared[:])
+	return smem.console_addr != 0 && chip.inRAM(smem.console_addr, 16)
+}
@@ -0,0 +1,36 @@
+package cyw43439
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file arms the chipcommon watchdog, a counter clocked by the ILP
+// (low power) clock which resets the whole WLAN chip when it reaches zero.
+// The host re-arms it periodically so that the chip is reset if the host
+// stops servicing it, i.e: after a host hang on an unattended device.
+
+// ILPClockHz is the nominal frequency of the ILP clock which drives the chip
+// watchdog. The actual frequency varies with temperature and supply.
+const ILPClockHz = 32768
+
+// ChipWatchdogTicks returns the ILP clock ticks of timeout for ArmChipWatchdog.
+func ChipWatchdogTicks(timeout time.Duration) uint32 {
+	return uint32(timeout.Milliseconds() * ILPClockHz / 1000)
+}
+
+// ArmChipWatchdog sets the chip watchdog to reset the WLAN chip after ticks
+// ILP clock cycles. It must be called again before the watchdog fires to keep
+// the chip running; ticks of zero disarms the watchdog. Once the watchdog
+// fires the chip loses its firmware and Init must be called again.
+func (d *Device) ArmChipWatchdog(ticks uint32) error {
+	err := d.acquire(modeInit)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.debug("ArmChipWatchdog", slog.Uint64("ticks", uint64(ticks)))
+	return d.bp_write32(whd.CHIPCOMMON_WATCHDOG, ticks)
+}
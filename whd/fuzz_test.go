@@ -0,0 +1,67 @@
+package whd
+
+import (
+	"encoding/binary"
+	"testing"
+	"unsafe"
+)
+
+// The fuzz targets check that parsing bytes received from the radio never panics.
+
+func FuzzSDPCMHeader(f *testing.F) {
+	f.Add([]byte{0x10, 0x00, 0xef, 0xff, 0x00, 0x01, 0x00, 0x0c, 0x00, 0x05, 0x00, 0x00, 0xaa, 0xbb, 0xcc, 0xdd})
+	f.Fuzz(func(t *testing.T, packet []byte) {
+		if len(packet) < SDPCM_HEADER_LEN {
+			return
+		}
+		hdr := DecodeSDPCMHeader(binary.LittleEndian, packet)
+		payload, err := hdr.Parse(packet)
+		if err == nil && len(payload) > len(packet) {
+			t.Fatal("payload longer than packet")
+		}
+	})
+}
+
+func FuzzCDCHeader(f *testing.F) {
+	f.Add([]byte{0x07, 0, 0, 0, 0x04, 0, 0, 0, 0x02, 0, 0x01, 0, 0, 0, 0, 0, 1, 2, 3, 4})
+	f.Fuzz(func(t *testing.T, packet []byte) {
+		if len(packet) < CDC_HEADER_LEN {
+			return
+		}
+		hdr := DecodeCDCHeader(binary.LittleEndian, packet)
+		hdr.Parse(packet)
+	})
+}
+
+func FuzzEventPacket(f *testing.F) {
+	var seed [72]byte
+	binary.BigEndian.PutUint16(seed[12:], 0x886c)
+	binary.BigEndian.PutUint16(seed[14:], 32769)
+	copy(seed[19:22], []byte{0x00, 0x10, 0x18})
+	binary.BigEndian.PutUint16(seed[22:], 1)
+	f.Add(seed[:])
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		DecodeEventPacket(binary.BigEndian, buf)
+	})
+}
+
+func FuzzParseAsyncEvent(f *testing.F) {
+	var seed [48 + 128]byte
+	binary.BigEndian.PutUint32(seed[4:], uint32(CYW43_EV_ESCAN_RESULT))
+	binary.BigEndian.PutUint32(seed[8:], CYW43_STATUS_PARTIAL)
+	f.Add(seed[:])
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		ParseAsyncEvent(binary.BigEndian, buf)
+	})
+}
+
+func FuzzParseScanResult(f *testing.F) {
+	f.Add(make([]byte, 128))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Scan results are parsed in place so copy to a word aligned buffer.
+		buf := make([]uint32, (len(data)+3)/4+1)
+		b := unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), len(data))
+		copy(b, data)
+		ParseScanResult(binary.LittleEndian, b)
+	})
+}
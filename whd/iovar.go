@@ -0,0 +1,145 @@
+package whd
+
+// IOVarType is the Go type an IOVar's 32 bit value is exposed as.
+type IOVarType uint8
+
+const (
+	IOVarUint32 IOVarType = iota
+	IOVarInt32
+	IOVarBool
+)
+
+// IOVar describes a commonly used firmware variable. Variables are accessed
+// via WLC_GET_VAR/WLC_SET_VAR using Name unless Get (and Set) are non-zero
+// in which case the dedicated ioctls are used instead. All values are 32 bits wide.
+type IOVar struct {
+	// Name is the iovar name. For ioctl backed variables it is only informative.
+	Name string
+	// Method is the Go identifier of the typed getter. The setter is prefixed with Set.
+	Method string
+	Type   IOVarType
+	Get    SDPCMCommand
+	Set    SDPCMCommand
+	// ReadOnly variables have no setter, either because the firmware does not allow
+	// it or because the driver has a dedicated setter which keeps its state consistent.
+	ReadOnly bool
+	Doc      string
+}
+
+// IOVars is the catalog of variables for which the cyw43439 package
+// generates typed getters and setters on Device.
+var IOVars = [...]IOVar{
+	// Ioctl backed variables.
+	{Name: "pm", Method: "PM", Get: WLC_GET_PM, Set: WLC_SET_PM,
+		Doc: "the power management mode: 0 disables power save, 1 is PM1 (PS-Poll) and 2 is PM2 (fast power save)."},
+	{Name: "rate", Method: "Rate", Get: WLC_GET_RATE, ReadOnly: true,
+		Doc: "the current transmit rate in units of 500kbps."},
+	{Name: "infra", Method: "Infra", Type: IOVarBool, Get: WLC_GET_INFRA, ReadOnly: true,
+		Doc: "whether the interface is in infrastructure (as opposed to ad-hoc) mode."},
+	{Name: "auth", Method: "Auth", Get: WLC_GET_AUTH, ReadOnly: true,
+		Doc: "the 802.11 authentication type: 0 is open system and 1 is shared key."},
+	{Name: "wsec", Method: "WSec", Get: WLC_GET_WSEC, ReadOnly: true,
+		Doc: "the wireless security (cipher) bitmask of the interface."},
+	{Name: "wpa_auth", Method: "WPAAuth", Get: WLC_GET_WPA_AUTH, ReadOnly: true,
+		Doc: "the WPA authenticated key management bitmask of the interface."},
+	{Name: "ap", Method: "AP", Type: IOVarBool, Get: WLC_GET_AP, ReadOnly: true,
+		Doc: "whether the device is operating as an access point."},
+	{Name: "srl", Method: "ShortRetryLimit", Get: WLC_GET_SRL, Set: WLC_SET_SRL,
+		Doc: "the amount of transmit retries for frames shorter than the RTS threshold."},
+	{Name: "lrl", Method: "LongRetryLimit", Get: WLC_GET_LRL, Set: WLC_SET_LRL,
+		Doc: "the amount of transmit retries for frames longer than the RTS threshold."},
+	{Name: "antdiv", Method: "AntennaDiversity", Get: WLC_GET_ANTDIV, Set: WLC_SET_ANTDIV,
+		Doc: "the antenna selection mode: 0 and 1 select a fixed antenna and 3 enables diversity."},
+	{Name: "bcnprd", Method: "BeaconPeriod", Get: WLC_GET_BCNPRD, Set: WLC_SET_BCNPRD,
+		Doc: "the beacon period in time units (1024us) used in AP mode."},
+	{Name: "dtimprd", Method: "DTIMPeriod", Get: WLC_GET_DTIMPRD, Set: WLC_SET_DTIMPRD,
+		Doc: "the amount of beacons between DTIM beacons used in AP mode."},
+	{Name: "gmode", Method: "GMode", Get: WLC_GET_GMODE, Set: WLC_SET_GMODE,
+		Doc: "the 802.11g mode: 0 is legacy 802.11b, 1 is auto and 2 is 802.11g only."},
+	{Name: "band", Method: "Band", Get: WLC_GET_BAND, Set: WLC_SET_BAND,
+		Doc: "the band selection: 0 is auto and 2 is 2.4GHz."},
+	{Name: "roam_scan_period", Method: "RoamScanPeriod", Get: WLC_GET_ROAM_SCAN_PERIOD, Set: WLC_SET_ROAM_SCAN_PERIOD,
+		Doc: "the period in seconds between roam scans while the link is below the roam trigger."},
+	{Name: "pwrout_percentage", Method: "TxPowerPercent", Get: WLC_GET_PWROUT_PERCENTAGE, Set: WLC_SET_PWROUT_PERCENTAGE,
+		Doc: "the transmit power limit as a percentage (1-100) of the regulatory maximum."},
+
+	// Power save.
+	{Name: "mpc", Method: "MPC", Type: IOVarBool,
+		Doc: "whether minimum power consumption mode, which powers down the radio while not associated, is enabled."},
+	{Name: "pm2_sleep_ret", Method: "PM2SleepRet",
+		Doc: "the time in milliseconds the radio stays awake after activity before returning to sleep in PM2."},
+	{Name: "assoc_listen", Method: "AssocListen",
+		Doc: "the listen interval in beacons advertised to the access point on association."},
+	{Name: "bcn_li_dtim", Method: "ListenInterval", ReadOnly: true,
+		Doc: "the amount of DTIM periods slept through in power save. See SetListenInterval."},
+	{Name: "bcn_li_bcn", Method: "BeaconListenInterval", ReadOnly: true,
+		Doc: "the amount of beacon intervals slept through in power save. See SetBeaconListenInterval."},
+	{Name: "bcn_timeout", Method: "BeaconTimeout",
+		Doc: "the amount of consecutive missed beacons after which the link is considered lost."},
+
+	// Aggregation and rates.
+	{Name: "ampdu_rx", Method: "AMPDURx", Type: IOVarBool, ReadOnly: true,
+		Doc: "whether AMPDU reception is enabled. See SetAMPDU."},
+	{Name: "ampdu_tx", Method: "AMPDUTx", Type: IOVarBool, ReadOnly: true,
+		Doc: "whether AMPDU transmission is enabled. See SetAMPDU."},
+	{Name: "ampdu_ba_wsize", Method: "AMPDUBAWSize", ReadOnly: true,
+		Doc: "the AMPDU block ack window size. See SetAMPDUWindow."},
+	{Name: "ampdu_mpdu", Method: "AMPDUMPDU", ReadOnly: true,
+		Doc: "the maximum amount of MPDUs per transmitted AMPDU. See SetAMPDUWindow."},
+	{Name: "ampdu_rx_factor", Method: "AMPDURxFactor",
+		Doc: "the maximum receive AMPDU length exponent advertised to peers: the length is 2^(13+factor)-1 bytes."},
+	{Name: "nrate", Method: "FixedRate", ReadOnly: true,
+		Doc: "the fixed transmit rate or 0 for automatic rate control. See SetFixedRate."},
+	{Name: "sgi_rx", Method: "SGIRx", Type: IOVarInt32,
+		Doc: "the 802.11n short guard interval reception mode: -1 is auto, 0 disables and 1 enables it."},
+	{Name: "sgi_tx", Method: "SGITx", Type: IOVarInt32,
+		Doc: "the 802.11n short guard interval transmission mode: -1 is auto, 0 disables and 1 enables it."},
+	{Name: "rtsthresh", Method: "RTSThreshold",
+		Doc: "the frame length in bytes above which RTS/CTS protection is used."},
+	{Name: "fragthresh", Method: "FragThreshold",
+		Doc: "the frame length in bytes above which frames are fragmented."},
+	{Name: "qtxpower", Method: "TxPower",
+		Doc: "the maximum transmit power in quarter dBm. Setting bit 31 overrides regulatory limits."},
+	{Name: "dutycycle_cck", Method: "TxDutyCycleCCK", ReadOnly: true,
+		Doc: "the maximum transmit duty cycle in percent for CCK (802.11b) rates. See SetTxDutyCycle."},
+	{Name: "dutycycle_ofdm", Method: "TxDutyCycleOFDM", ReadOnly: true,
+		Doc: "the maximum transmit duty cycle in percent for OFDM rates. See SetTxDutyCycle."},
+	{Name: "chanspec", Method: "Chanspec", ReadOnly: true,
+		Doc: "the chanspec (channel, band and bandwidth) the interface is operating on."},
+
+	// Association and security.
+	{Name: "assoc_retry_max", Method: "AssocRetryMax",
+		Doc: "the maximum amount of association attempts made per join."},
+	{Name: "roam_off", Method: "RoamOff", Type: IOVarBool, ReadOnly: true,
+		Doc: "whether roaming is disabled. See SetRoaming."},
+	{Name: "sup_wpa", Method: "SupWPA", Type: IOVarBool, ReadOnly: true,
+		Doc: "whether the firmware's internal WPA supplicant is enabled."},
+	{Name: "sup_wpa_tmo", Method: "SupWPATimeout",
+		Doc: "the WPA supplicant handshake timeout in milliseconds."},
+	{Name: "mfp", Method: "MFP",
+		Doc: "the management frame protection (802.11w) mode: 0 disables, 1 enables and 2 requires it."},
+	{Name: "wme", Method: "WME", Type: IOVarBool,
+		Doc: "whether Wi-Fi multimedia (WMM) QoS is enabled."},
+	{Name: "wme_apsd", Method: "WMEAPSD", Type: IOVarBool,
+		Doc: "whether WMM automatic power save delivery is enabled."},
+	{Name: "maxassoc", Method: "MaxAssoc",
+		Doc: "the maximum amount of stations which may associate in AP mode."},
+	{Name: "apsta", Method: "APSTA", Type: IOVarBool, ReadOnly: true,
+		Doc: "whether simultaneous AP and station operation is enabled."},
+
+	// Offloads, coexistence and bus.
+	{Name: "arpoe", Method: "ARPOffload", Type: IOVarBool, ReadOnly: true,
+		Doc: "whether ARP offload is enabled. See EnableARPOffload."},
+	{Name: "ndoe", Method: "NDOffload", Type: IOVarBool, ReadOnly: true,
+		Doc: "whether IPv6 neighbor discovery offload is enabled. See EnableNDOffload."},
+	{Name: "ed_thresh", Method: "EDThreshold", Type: IOVarInt32, ReadOnly: true,
+		Doc: "the energy-detect CCA threshold in dBm. See Config.EDThreshold."},
+	{Name: "edcrs", Method: "EDCRS", Type: IOVarBool, ReadOnly: true,
+		Doc: "whether energy-detect carrier sense (adaptivity) is enabled. See Config.Adaptivity."},
+	{Name: "btc_mode", Method: "BTCoexMode",
+		Doc: "the Bluetooth coexistence mode: 0 disables coexistence and 1 enables it."},
+	{Name: "bus:txglom", Method: "TxGlom", Type: IOVarBool,
+		Doc: "whether the firmware aggregates multiple frames per bus transfer."},
+	{Name: "clmload_status", Method: "CLMLoadStatus", ReadOnly: true,
+		Doc: "the status of the last CLM blob download: 0 means success."},
+}
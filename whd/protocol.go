@@ -89,6 +89,9 @@ func (s *SDPCMHeader) Parse(packet []byte) ([]byte, error) {
 	if int(s.Size) != len(packet) {
 		return nil, errSDPCMHeaderSizeMismatch
 	}
+	if int(s.HeaderLength) > len(packet) {
+		return nil, errBadSPCM
+	}
 
 	return packet[s.HeaderLength:], nil
 }
@@ -127,13 +130,19 @@ func (cdc *CDCHeader) Put(order binary.ByteOrder, b []byte) {
 }
 
 func (cdc *CDCHeader) Parse(packet []byte) (payload []byte, err error) {
-	if len(packet) < CDC_HEADER_LEN+int(cdc.Length) {
+	if len(packet) < CDC_HEADER_LEN || uint32(len(packet)-CDC_HEADER_LEN) < cdc.Length {
 		return nil, errShortBufferCDC
 	}
 	payload = packet[CDC_HEADER_LEN:]
 	return
 }
 
+// BDCHeader Flags bits. Reference: bdc.h.
+const (
+	BDC_FLAG_SUM_GOOD   = 0x04 // Firmware verified the received frame's checksums.
+	BDC_FLAG_SUM_NEEDED = 0x08 // Firmware must compute the sent frame's checksums.
+)
+
 type BDCHeader struct {
 	Flags      uint8
 	Priority   uint8 // 802.1d Priority (low 3 bits)
@@ -252,7 +261,7 @@ func ParseScanResult(order binary.ByteOrder, buf []byte) (sr EventScanResult, er
 		bssCount uint16
 		bss      evscanresult
 	}
-	if len(buf) > int(unsafe.Sizeof(scanresult{})) {
+	if len(buf) < int(unsafe.Sizeof(scanresult{})) {
 		return sr, io.ErrShortBuffer
 	}
 	ptr := unsafe.Pointer(&buf[0])
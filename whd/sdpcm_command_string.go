@@ -10,55 +10,137 @@ func _() {
 	var x [1]struct{}
 	_ = x[WLC_UP-2]
 	_ = x[WLC_DOWN-3]
+	_ = x[WLC_GET_PROMISC-9]
+	_ = x[WLC_SET_PROMISC-10]
+	_ = x[WLC_GET_RATE-12]
+	_ = x[WLC_GET_INFRA-19]
 	_ = x[WLC_SET_INFRA-20]
+	_ = x[WLC_GET_AUTH-21]
 	_ = x[WLC_SET_AUTH-22]
 	_ = x[WLC_GET_BSSID-23]
 	_ = x[WLC_GET_SSID-25]
 	_ = x[WLC_SET_SSID-26]
 	_ = x[WLC_SET_CHANNEL-30]
+	_ = x[WLC_GET_SRL-31]
+	_ = x[WLC_SET_SRL-32]
+	_ = x[WLC_GET_LRL-33]
+	_ = x[WLC_SET_LRL-34]
+	_ = x[WLC_GET_KEY-44]
+	_ = x[WLC_SET_KEY-45]
 	_ = x[WLC_DISASSOC-52]
+	_ = x[WLC_GET_ROAM_TRIGGER-54]
+	_ = x[WLC_SET_ROAM_TRIGGER-55]
+	_ = x[WLC_GET_ROAM_DELTA-56]
+	_ = x[WLC_SET_ROAM_DELTA-57]
+	_ = x[WLC_GET_ROAM_SCAN_PERIOD-58]
+	_ = x[WLC_SET_ROAM_SCAN_PERIOD-59]
 	_ = x[WLC_GET_ANTDIV-63]
 	_ = x[WLC_SET_ANTDIV-64]
+	_ = x[WLC_GET_BCNPRD-75]
+	_ = x[WLC_SET_BCNPRD-76]
+	_ = x[WLC_GET_DTIMPRD-77]
 	_ = x[WLC_SET_DTIMPRD-78]
 	_ = x[WLC_GET_PM-85]
 	_ = x[WLC_SET_PM-86]
+	_ = x[WLC_GET_MONITOR-107]
+	_ = x[WLC_SET_MONITOR-108]
+	_ = x[WLC_GET_GMODE-109]
 	_ = x[WLC_SET_GMODE-110]
+	_ = x[WLC_GET_AP-117]
 	_ = x[WLC_SET_AP-118]
+	_ = x[WLC_GET_WSEC-133]
 	_ = x[WLC_SET_WSEC-134]
+	_ = x[WLC_GET_PHY_NOISE-135]
+	_ = x[WLC_GET_BSS_INFO-136]
+	_ = x[WLC_GET_BAND-141]
 	_ = x[WLC_SET_BAND-142]
 	_ = x[WLC_GET_ASSOCLIST-159]
+	_ = x[WLC_GET_WPA_AUTH-164]
 	_ = x[WLC_SET_WPA_AUTH-165]
+	_ = x[WLC_GET_SCAN_CHANNEL_TIME-184]
+	_ = x[WLC_SET_SCAN_CHANNEL_TIME-185]
+	_ = x[WLC_GET_SCAN_UNASSOC_TIME-186]
+	_ = x[WLC_SET_SCAN_UNASSOC_TIME-187]
+	_ = x[WLC_GET_SCAN_HOME_TIME-188]
+	_ = x[WLC_SET_SCAN_HOME_TIME-189]
+	_ = x[WLC_GET_SCAN_NPROBES-190]
+	_ = x[WLC_SET_SCAN_NPROBES-191]
+	_ = x[WLC_GET_PWROUT_PERCENTAGE-236]
+	_ = x[WLC_SET_PWROUT_PERCENTAGE-237]
+	_ = x[WLC_GET_SCAN_PASSIVE_TIME-257]
+	_ = x[WLC_SET_SCAN_PASSIVE_TIME-258]
 	_ = x[WLC_SET_VAR-263]
 	_ = x[WLC_GET_VAR-262]
 	_ = x[WLC_SET_WSEC_PMK-268]
 }
 
-const _SDPCMCommand_name = "UPDOWNSET_INFRASET_AUTHGET_BSSIDGET_SSIDSET_SSIDSET_CHANNELDISASSOCGET_ANTDIVSET_ANTDIVSET_DTIMPRDGET_PMSET_PMSET_GMODESET_APSET_WSECSET_BANDGET_ASSOCLISTSET_WPA_AUTHGET_VARSET_VARSET_WSEC_PMK"
+const _SDPCMCommand_name = "UPDOWNGET_PROMISCSET_PROMISCGET_RATEGET_INFRASET_INFRAGET_AUTHSET_AUTHGET_BSSIDGET_SSIDSET_SSIDSET_CHANNELGET_SRLSET_SRLGET_LRLSET_LRLGET_KEYSET_KEYDISASSOCGET_ROAM_TRIGGERSET_ROAM_TRIGGERGET_ROAM_DELTASET_ROAM_DELTAGET_ROAM_SCAN_PERIODSET_ROAM_SCAN_PERIODGET_ANTDIVSET_ANTDIVGET_BCNPRDSET_BCNPRDGET_DTIMPRDSET_DTIMPRDGET_PMSET_PMGET_MONITORSET_MONITORGET_GMODESET_GMODEGET_APSET_APGET_WSECSET_WSECGET_PHY_NOISEGET_BSS_INFOGET_BANDSET_BANDGET_ASSOCLISTGET_WPA_AUTHSET_WPA_AUTHGET_SCAN_CHANNEL_TIMESET_SCAN_CHANNEL_TIMEGET_SCAN_UNASSOC_TIMESET_SCAN_UNASSOC_TIMEGET_SCAN_HOME_TIMESET_SCAN_HOME_TIMEGET_SCAN_NPROBESSET_SCAN_NPROBESGET_PWROUT_PERCENTAGESET_PWROUT_PERCENTAGEGET_SCAN_PASSIVE_TIMESET_SCAN_PASSIVE_TIMEGET_VARSET_VARSET_WSEC_PMK"
 
 var _SDPCMCommand_map = map[SDPCMCommand]string{
 	2:   _SDPCMCommand_name[0:2],
 	3:   _SDPCMCommand_name[2:6],
-	20:  _SDPCMCommand_name[6:15],
-	22:  _SDPCMCommand_name[15:23],
-	23:  _SDPCMCommand_name[23:32],
-	25:  _SDPCMCommand_name[32:40],
-	26:  _SDPCMCommand_name[40:48],
-	30:  _SDPCMCommand_name[48:59],
-	52:  _SDPCMCommand_name[59:67],
-	63:  _SDPCMCommand_name[67:77],
-	64:  _SDPCMCommand_name[77:87],
-	78:  _SDPCMCommand_name[87:98],
-	85:  _SDPCMCommand_name[98:104],
-	86:  _SDPCMCommand_name[104:110],
-	110: _SDPCMCommand_name[110:119],
-	118: _SDPCMCommand_name[119:125],
-	134: _SDPCMCommand_name[125:133],
-	142: _SDPCMCommand_name[133:141],
-	159: _SDPCMCommand_name[141:154],
-	165: _SDPCMCommand_name[154:166],
-	262: _SDPCMCommand_name[166:173],
-	263: _SDPCMCommand_name[173:180],
-	268: _SDPCMCommand_name[180:192],
+	9:   _SDPCMCommand_name[6:17],
+	10:  _SDPCMCommand_name[17:28],
+	12:  _SDPCMCommand_name[28:36],
+	19:  _SDPCMCommand_name[36:45],
+	20:  _SDPCMCommand_name[45:54],
+	21:  _SDPCMCommand_name[54:62],
+	22:  _SDPCMCommand_name[62:70],
+	23:  _SDPCMCommand_name[70:79],
+	25:  _SDPCMCommand_name[79:87],
+	26:  _SDPCMCommand_name[87:95],
+	30:  _SDPCMCommand_name[95:106],
+	31:  _SDPCMCommand_name[106:113],
+	32:  _SDPCMCommand_name[113:120],
+	33:  _SDPCMCommand_name[120:127],
+	34:  _SDPCMCommand_name[127:134],
+	44:  _SDPCMCommand_name[134:141],
+	45:  _SDPCMCommand_name[141:148],
+	52:  _SDPCMCommand_name[148:156],
+	54:  _SDPCMCommand_name[156:172],
+	55:  _SDPCMCommand_name[172:188],
+	56:  _SDPCMCommand_name[188:202],
+	57:  _SDPCMCommand_name[202:216],
+	58:  _SDPCMCommand_name[216:236],
+	59:  _SDPCMCommand_name[236:256],
+	63:  _SDPCMCommand_name[256:266],
+	64:  _SDPCMCommand_name[266:276],
+	75:  _SDPCMCommand_name[276:286],
+	76:  _SDPCMCommand_name[286:296],
+	77:  _SDPCMCommand_name[296:307],
+	78:  _SDPCMCommand_name[307:318],
+	85:  _SDPCMCommand_name[318:324],
+	86:  _SDPCMCommand_name[324:330],
+	107: _SDPCMCommand_name[330:341],
+	108: _SDPCMCommand_name[341:352],
+	109: _SDPCMCommand_name[352:361],
+	110: _SDPCMCommand_name[361:370],
+	117: _SDPCMCommand_name[370:376],
+	118: _SDPCMCommand_name[376:382],
+	133: _SDPCMCommand_name[382:390],
+	134: _SDPCMCommand_name[390:398],
+	135: _SDPCMCommand_name[398:411],
+	136: _SDPCMCommand_name[411:423],
+	141: _SDPCMCommand_name[423:431],
+	142: _SDPCMCommand_name[431:439],
+	159: _SDPCMCommand_name[439:452],
+	164: _SDPCMCommand_name[452:464],
+	165: _SDPCMCommand_name[464:476],
+	184: _SDPCMCommand_name[476:497],
+	185: _SDPCMCommand_name[497:518],
+	186: _SDPCMCommand_name[518:539],
+	187: _SDPCMCommand_name[539:560],
+	188: _SDPCMCommand_name[560:578],
+	189: _SDPCMCommand_name[578:596],
+	190: _SDPCMCommand_name[596:612],
+	191: _SDPCMCommand_name[612:628],
+	236: _SDPCMCommand_name[628:649],
+	237: _SDPCMCommand_name[649:670],
+	257: _SDPCMCommand_name[670:691],
+	258: _SDPCMCommand_name[691:712],
+	262: _SDPCMCommand_name[712:719],
+	263: _SDPCMCommand_name[719:726],
+	268: _SDPCMCommand_name[726:738],
 }
 
 func (i SDPCMCommand) String() string {
@@ -115,13 +115,25 @@ const (
 
 	SBSDIO_SB_ACCESS_2_4B_FLAG = 0x08000
 
-	CHIPCOMMON_SR_CONTROL1 = CHIPCOMMON_BASE_ADDRESS + 0x508
-	SDIO_INT_STATUS        = SDIO_BASE_ADDRESS + 0x20
-	SDIO_INT_HOST_MASK     = SDIO_BASE_ADDRESS + 0x24
-	SDIO_FUNCTION_INT_MASK = SDIO_BASE_ADDRESS + 0x34
-	SDIO_TO_SB_MAILBOX     = SDIO_BASE_ADDRESS + 0x40
-	SOCSRAM_BANKX_INDEX    = SOCSRAM_BASE_ADDRESS + 0x10
-	SOCSRAM_BANKX_PDA      = SOCSRAM_BASE_ADDRESS + 0x44
+	CHIPCOMMON_CAPABILITIES = CHIPCOMMON_BASE_ADDRESS + 0x04
+	CHIPCOMMON_CHIPSTATUS   = CHIPCOMMON_BASE_ADDRESS + 0x2c
+	CHIPCOMMON_WATCHDOG     = CHIPCOMMON_BASE_ADDRESS + 0x80 // Counts down ILP clock ticks, chip reset at zero.
+	CHIPCOMMON_SR_CONTROL1  = CHIPCOMMON_BASE_ADDRESS + 0x508
+	CHIPCOMMON_SROM_OTP     = CHIPCOMMON_BASE_ADDRESS + 0x800 // SPROM/OTP shadow region.
+	SDIO_INT_STATUS         = SDIO_BASE_ADDRESS + 0x20
+	SDIO_INT_HOST_MASK      = SDIO_BASE_ADDRESS + 0x24
+	SDIO_FUNCTION_INT_MASK  = SDIO_BASE_ADDRESS + 0x34
+	SDIO_TO_SB_MAILBOX      = SDIO_BASE_ADDRESS + 0x40
+	SOCSRAM_BANKX_INDEX     = SOCSRAM_BASE_ADDRESS + 0x10
+	SOCSRAM_BANKX_PDA       = SOCSRAM_BASE_ADDRESS + 0x44
+)
+
+// SDIO_TO_SB_MAILBOX bits
+const (
+	SMB_NAK     = 1 << 0
+	SMB_INT_ACK = 1 << 1
+	SMB_USE_OOB = 1 << 2
+	SMB_DEV_INT = 1 << 3 // Interrupts the firmware, i.e: to have it resend the transmit credit.
 )
 
 // SDIO_CHIP_CLOCK_CSR bits
@@ -157,10 +169,13 @@ const (
 	IF_STA IoctlInterface = 0
 	IF_AP  IoctlInterface = 1
 	IF_P2P IoctlInterface = 2
+	// IF_MAX is the largest interface index which fits the CDC header flags.
+	// Interfaces above IF_P2P are created at runtime, i.e: for P2P roles.
+	IF_MAX IoctlInterface = CDCF_IOC_IF_MASK >> CDCF_IOC_IF_SHIFT
 )
 
 func (i IoctlInterface) IsValid() bool {
-	return i <= IF_P2P
+	return i <= IF_MAX
 }
 
 func (i IoctlInterface) String() (s string) {
@@ -184,11 +199,14 @@ const (
 	CONTROL_HEADER    SDPCMHeaderType = 0
 	ASYNCEVENT_HEADER SDPCMHeaderType = 1
 	DATA_HEADER       SDPCMHeaderType = 2
-	UNKNOWN_HEADER    SDPCMHeaderType = 0xff
+	// GLOM_HEADER frames are glom descriptors listing the subframe lengths of the next superframe.
+	GLOM_HEADER    SDPCMHeaderType = 3
+	UNKNOWN_HEADER SDPCMHeaderType = 0xff
 
 	CDCF_IOC_ID_SHIFT = 16
 	CDCF_IOC_ID_MASK  = 0xffff0000
 	CDCF_IOC_IF_SHIFT = 12
+	CDCF_IOC_IF_MASK  = 0xf000
 )
 
 func (ht SDPCMHeaderType) String() (s string) {
@@ -199,6 +217,8 @@ func (ht SDPCMHeaderType) String() (s string) {
 		s = "asyncev"
 	case DATA_HEADER:
 		s = "data"
+	case GLOM_HEADER:
+		s = "glom"
 	default:
 		s = "UNKNOWN"
 	}
@@ -216,38 +236,92 @@ const (
 type SDPCMCommand uint32
 
 const (
-	WLC_UP            SDPCMCommand = 2
-	WLC_DOWN          SDPCMCommand = 3
-	WLC_SET_INFRA     SDPCMCommand = 20
-	WLC_SET_AUTH      SDPCMCommand = 22
-	WLC_GET_BSSID     SDPCMCommand = 23
-	WLC_GET_SSID      SDPCMCommand = 25
-	WLC_SET_SSID      SDPCMCommand = 26
-	WLC_SET_CHANNEL   SDPCMCommand = 30
-	WLC_DISASSOC      SDPCMCommand = 52
-	WLC_GET_ANTDIV    SDPCMCommand = 63
-	WLC_SET_ANTDIV    SDPCMCommand = 64
-	WLC_SET_DTIMPRD   SDPCMCommand = 78
-	WLC_GET_PM        SDPCMCommand = 85
-	WLC_SET_PM        SDPCMCommand = 86
-	WLC_SET_GMODE     SDPCMCommand = 110
-	WLC_SET_AP        SDPCMCommand = 118
-	WLC_SET_WSEC      SDPCMCommand = 134
-	WLC_SET_BAND      SDPCMCommand = 142
-	WLC_GET_ASSOCLIST SDPCMCommand = 159
-	WLC_SET_WPA_AUTH  SDPCMCommand = 165
-	WLC_SET_VAR       SDPCMCommand = 263
-	WLC_GET_VAR       SDPCMCommand = 262
-	WLC_SET_WSEC_PMK  SDPCMCommand = 268
+	WLC_UP                    SDPCMCommand = 2
+	WLC_DOWN                  SDPCMCommand = 3
+	WLC_GET_PROMISC           SDPCMCommand = 9
+	WLC_SET_PROMISC           SDPCMCommand = 10
+	WLC_GET_RATE              SDPCMCommand = 12
+	WLC_GET_INFRA             SDPCMCommand = 19
+	WLC_SET_INFRA             SDPCMCommand = 20
+	WLC_GET_AUTH              SDPCMCommand = 21
+	WLC_SET_AUTH              SDPCMCommand = 22
+	WLC_GET_BSSID             SDPCMCommand = 23
+	WLC_GET_SSID              SDPCMCommand = 25
+	WLC_SET_SSID              SDPCMCommand = 26
+	WLC_SET_CHANNEL           SDPCMCommand = 30
+	WLC_GET_SRL               SDPCMCommand = 31
+	WLC_SET_SRL               SDPCMCommand = 32
+	WLC_GET_LRL               SDPCMCommand = 33
+	WLC_SET_LRL               SDPCMCommand = 34
+	WLC_GET_KEY               SDPCMCommand = 44
+	WLC_SET_KEY               SDPCMCommand = 45
+	WLC_DISASSOC              SDPCMCommand = 52
+	WLC_GET_ROAM_TRIGGER      SDPCMCommand = 54
+	WLC_SET_ROAM_TRIGGER      SDPCMCommand = 55
+	WLC_GET_ROAM_DELTA        SDPCMCommand = 56
+	WLC_SET_ROAM_DELTA        SDPCMCommand = 57
+	WLC_GET_ROAM_SCAN_PERIOD  SDPCMCommand = 58
+	WLC_SET_ROAM_SCAN_PERIOD  SDPCMCommand = 59
+	WLC_GET_ANTDIV            SDPCMCommand = 63
+	WLC_SET_ANTDIV            SDPCMCommand = 64
+	WLC_GET_BCNPRD            SDPCMCommand = 75
+	WLC_SET_BCNPRD            SDPCMCommand = 76
+	WLC_GET_DTIMPRD           SDPCMCommand = 77
+	WLC_SET_DTIMPRD           SDPCMCommand = 78
+	WLC_GET_PM                SDPCMCommand = 85
+	WLC_SET_PM                SDPCMCommand = 86
+	WLC_GET_MONITOR           SDPCMCommand = 107
+	WLC_SET_MONITOR           SDPCMCommand = 108
+	WLC_GET_GMODE             SDPCMCommand = 109
+	WLC_SET_GMODE             SDPCMCommand = 110
+	WLC_GET_AP                SDPCMCommand = 117
+	WLC_SET_AP                SDPCMCommand = 118
+	WLC_GET_WSEC              SDPCMCommand = 133
+	WLC_SET_WSEC              SDPCMCommand = 134
+	WLC_GET_PHY_NOISE         SDPCMCommand = 135
+	WLC_GET_BSS_INFO          SDPCMCommand = 136
+	WLC_GET_BAND              SDPCMCommand = 141
+	WLC_SET_BAND              SDPCMCommand = 142
+	WLC_GET_ASSOCLIST         SDPCMCommand = 159
+	WLC_GET_WPA_AUTH          SDPCMCommand = 164
+	WLC_SET_WPA_AUTH          SDPCMCommand = 165
+	WLC_GET_SCAN_CHANNEL_TIME SDPCMCommand = 184
+	WLC_SET_SCAN_CHANNEL_TIME SDPCMCommand = 185
+	WLC_GET_SCAN_UNASSOC_TIME SDPCMCommand = 186
+	WLC_SET_SCAN_UNASSOC_TIME SDPCMCommand = 187
+	WLC_GET_SCAN_HOME_TIME    SDPCMCommand = 188
+	WLC_SET_SCAN_HOME_TIME    SDPCMCommand = 189
+	WLC_GET_SCAN_NPROBES      SDPCMCommand = 190
+	WLC_SET_SCAN_NPROBES      SDPCMCommand = 191
+	WLC_GET_PWROUT_PERCENTAGE SDPCMCommand = 236
+	WLC_SET_PWROUT_PERCENTAGE SDPCMCommand = 237
+	WLC_GET_SCAN_PASSIVE_TIME SDPCMCommand = 257
+	WLC_SET_SCAN_PASSIVE_TIME SDPCMCommand = 258
+	WLC_SET_VAR               SDPCMCommand = 263
+	WLC_GET_VAR               SDPCMCommand = 262
+	WLC_SET_WSEC_PMK          SDPCMCommand = 268
 )
 
 func (cmd SDPCMCommand) IsValid() bool {
-	return cmd == WLC_UP || cmd == WLC_DOWN || cmd == WLC_SET_INFRA || cmd == WLC_SET_AUTH || cmd == WLC_GET_BSSID ||
-		cmd == WLC_GET_SSID || cmd == WLC_SET_SSID || cmd == WLC_SET_CHANNEL || cmd == WLC_DISASSOC ||
-		cmd == WLC_GET_ANTDIV || cmd == WLC_SET_ANTDIV || cmd == WLC_SET_DTIMPRD || cmd == WLC_GET_PM ||
-		cmd == WLC_SET_PM || cmd == WLC_SET_GMODE || cmd == WLC_SET_AP || cmd == WLC_SET_WSEC || cmd == WLC_SET_BAND ||
-		cmd == WLC_GET_ASSOCLIST || cmd == WLC_SET_WPA_AUTH || cmd == WLC_SET_VAR || cmd == WLC_GET_VAR ||
-		cmd == WLC_SET_WSEC_PMK
+	switch cmd {
+	case WLC_UP, WLC_DOWN, WLC_GET_PROMISC, WLC_SET_PROMISC, WLC_SET_INFRA, WLC_SET_AUTH, WLC_GET_BSSID,
+		WLC_GET_SSID, WLC_SET_SSID, WLC_SET_CHANNEL, WLC_DISASSOC,
+		WLC_GET_ROAM_TRIGGER, WLC_SET_ROAM_TRIGGER, WLC_GET_ROAM_DELTA, WLC_SET_ROAM_DELTA,
+		WLC_GET_ROAM_SCAN_PERIOD, WLC_SET_ROAM_SCAN_PERIOD,
+		WLC_GET_ANTDIV, WLC_SET_ANTDIV, WLC_SET_DTIMPRD, WLC_GET_PM,
+		WLC_SET_PM, WLC_SET_GMODE, WLC_SET_AP, WLC_SET_WSEC, WLC_SET_BAND,
+		WLC_GET_ASSOCLIST, WLC_SET_WPA_AUTH, WLC_SET_VAR, WLC_GET_VAR,
+		WLC_SET_WSEC_PMK, WLC_GET_RATE, WLC_GET_INFRA, WLC_GET_AUTH, WLC_GET_SRL, WLC_SET_SRL,
+		WLC_GET_LRL, WLC_SET_LRL, WLC_GET_BCNPRD, WLC_SET_BCNPRD, WLC_GET_DTIMPRD, WLC_GET_GMODE,
+		WLC_GET_AP, WLC_GET_WSEC, WLC_GET_BAND, WLC_GET_WPA_AUTH,
+		WLC_GET_PWROUT_PERCENTAGE, WLC_SET_PWROUT_PERCENTAGE, WLC_GET_PHY_NOISE, WLC_GET_BSS_INFO,
+		WLC_GET_SCAN_CHANNEL_TIME, WLC_SET_SCAN_CHANNEL_TIME, WLC_GET_SCAN_UNASSOC_TIME, WLC_SET_SCAN_UNASSOC_TIME,
+		WLC_GET_SCAN_HOME_TIME, WLC_SET_SCAN_HOME_TIME, WLC_GET_SCAN_NPROBES, WLC_SET_SCAN_NPROBES,
+		WLC_GET_SCAN_PASSIVE_TIME, WLC_SET_SCAN_PASSIVE_TIME, WLC_GET_KEY, WLC_SET_KEY,
+		WLC_GET_MONITOR, WLC_SET_MONITOR:
+		return true
+	}
+	return false
 }
 
 // SDIO bus specifics
@@ -358,6 +432,35 @@ const (
 	WAKE_UP                 = 0x80 // 0/1 Wake-up command from Host to WLAN
 )
 
+// BusConfigReg is the 32 bit word read or written at SPI_BUS_CONTROL which spans
+// the SPI_BUS_CONTROL, SPI_RESPONSE_DELAY, SPI_STATUS_ENABLE and SPI_RESET_BP
+// registers, one byte each. It allows constructing F0 configuration writes symbolically.
+type BusConfigReg uint32
+
+// BusControl returns the SPI_BUS_CONTROL bits, i.e: WORD_LENGTH_32.
+func (r BusConfigReg) BusControl() uint8 { return uint8(r) }
+
+// ResponseDelay returns the response delay in bytes applied to F1 reads (or all functions, see RESP_DELAY_ALL).
+func (r BusConfigReg) ResponseDelay() uint8 { return uint8(r >> 8) }
+
+// StatusEnable returns the SPI_STATUS_ENABLE bits, i.e: STATUS_ENABLE.
+func (r BusConfigReg) StatusEnable() uint8 { return uint8(r >> 16) }
+
+// ResetBP returns the SPI_RESET_BP byte.
+func (r BusConfigReg) ResetBP() uint8 { return uint8(r >> 24) }
+
+// SetBusControl sets the SPI_BUS_CONTROL bits.
+func (r *BusConfigReg) SetBusControl(bits uint8) { *r = *r&^0xff | BusConfigReg(bits) }
+
+// SetResponseDelay sets the response delay in bytes.
+func (r *BusConfigReg) SetResponseDelay(delay uint8) { *r = *r&^(0xff<<8) | BusConfigReg(delay)<<8 }
+
+// SetStatusEnable sets the SPI_STATUS_ENABLE bits.
+func (r *BusConfigReg) SetStatusEnable(bits uint8) { *r = *r&^(0xff<<16) | BusConfigReg(bits)<<16 }
+
+// SetResetBP sets the SPI_RESET_BP byte.
+func (r *BusConfigReg) SetResetBP(val uint8) { *r = *r&^(0xff<<24) | BusConfigReg(val)<<24 }
+
 // SPI_STATUS_ENABLE bits
 const (
 	STATUS_ENABLE    = 0x01 // 1/0 Status sent/not sent to host after read/write
@@ -413,6 +516,8 @@ const (
 	BUS_SPI_BACKPLANE_READ_PADD_SIZE    = 4
 
 	SPI_FRAME_CONTROL = 0x1000D
+	SFC_RF_TERM       = 1 << 0 // Read frame terminate. Discards the current F2 read frame.
+	SFC_WF_TERM       = 1 << 1 // Write frame terminate. Discards the current F2 write frame.
 )
 
 // Async events, event_type field
@@ -0,0 +1,18 @@
+// Package whdconst contains constants generated from the C headers of the
+// Infineon WiFi Host Driver, i.e: ioctls, events and chip registers not yet
+// modeled by package whd. Constants keep their C names.
+//
+// whdconst.go is generated by internal/genwhd from the headers of WHD
+// release-v3.1.0 (https://github.com/Infineon/wifi-host-driver), the release
+// recorded in the generated file's header. To regenerate it:
+//
+//	git clone -b release-v3.1.0 https://github.com/Infineon/wifi-host-driver
+//	WHD_INCLUDE=$PWD/wifi-host-driver/WiFi_Host_Driver/inc go generate ./whd/whdconst
+//
+// Changes to hand-typed constants in package whd should be checked against
+// the same headers with:
+//
+//	go run ./internal/genwhd -I $WHD_INCLUDE -check ./whd
+package whdconst
+
+//go:generate go run ../../internal/genwhd -I $WHD_INCLUDE -version release-v3.1.0 -o whdconst.go
@@ -6,6 +6,7 @@ package cyw43439
 import (
 	"encoding/binary"
 	"errors"
+	"io"
 	"net"
 	"time"
 
@@ -19,37 +20,51 @@ var (
 	errJoinSetSSID  = errors.New("join:SET_SSID failed")
 	errJoinWaitSSID = errors.New("join:wait for ssid")
 	errJoinGeneric  = errors.New("join:failed")
+
+	errBTInit        = errors.New("bt init failed")
+	errCLMLoadStatus = errors.New("clmload_status failed")
+	errCLMRead       = errors.New("reading CLM blob failed")
 )
 
-func (d *Device) clmLoad(clm string) error {
+func (d *Device) clmLoad(clm string, r *io.SectionReader) error {
 	// reference: https://github.com/embassy-rs/embassy/blob/26870082427b64d3ca42691c55a2cded5eadc548/cyw43/src/control.rs#L35
-	d.debug("initControl", slog.Int("clm_len", len(clm)))
+	size := len(clm)
+	if r != nil {
+		size = int(r.Size())
+	}
+	d.debug("initControl", slog.Int("clm_len", size))
 	const chunkSize = 1024
-	remaining := clm
 	offset := 0
 
 	buf8 := u32AsU8(d._iovarBuf[:])[:chunkSize+20]
 
-	for len(remaining) > 0 {
-		chunk := remaining[:min(len(remaining), chunkSize)]
-		remaining = remaining[len(chunk):]
+	for offset < size {
+		chunkLen := min(size-offset, chunkSize)
 		var flag uint16 = 0x1000 // Download flag handler version.
 		if offset == 0 {
 			flag |= 0x0002 // Flag begin.
 		}
-		offset += len(chunk)
-		if offset == len(clm) {
+		if offset+chunkLen == size {
 			flag |= 0x0004 // Flag end.
 		}
 		header := whd.DownloadHeader{ // No CRC.
 			Flags: flag,
 			Type:  2, // CLM download type.
-			Len:   uint32(len(chunk)),
+			Len:   uint32(chunkLen),
 		}
 		n := copy(buf8[:8], "clmload\x00")
 		header.Put(_busOrder, buf8[8:20])
 		n += whd.DL_HEADER_LEN
-		n += copy(buf8[20:], chunk)
+		if r != nil {
+			got, err := r.ReadAt(buf8[20:20+chunkLen], int64(offset))
+			if got != chunkLen {
+				return errjoin(errCLMRead, err)
+			}
+		} else {
+			copy(buf8[20:], clm[offset:offset+chunkLen])
+		}
+		n += chunkLen
+		offset += chunkLen
 
 		err := d.doIoctlSet(whd.WLC_SET_VAR, whd.IF_STA, buf8[:n])
 		if err != nil {
@@ -59,50 +74,83 @@ func (d *Device) clmLoad(clm string) error {
 	d.debug("clmload:done")
 	v, err := d.get_iovar("clmload_status", whd.IF_STA)
 	if v != 0 || err != nil {
-		return errjoin(errors.New("clmload_status failed"), err)
+		return errjoin(errCLMLoadStatus, err)
 	}
 	return nil
 }
 
-func (d *Device) initControl(clm string) error {
+func (d *Device) initControl(cfg Config) error {
 	if d.bt_mode_enabled() {
-		err := d.bt_init(btFW)
+		err := d.bt_init(cfg.BTFirmware)
 		if err != nil {
-			return errors.New("cyw bt init failed: " + err.Error())
+			return errjoin(errBTInit, err)
 		}
 	}
 
-	err := d.clmLoad(clm)
+	err := d.clmLoad(cfg.CLM, cfg.CLMReader)
 	if err != nil {
 		return err
 	}
-	// Disable tx gloming which transfers multiple packets in one request.
+	// Configure firmware tx gloming which transfers multiple packets in one request.
 	// 'glom' is short for "conglomerate" which means "gather together into
-	// a compact mass".
-	d.set_iovar("bus:txglom", whd.IF_STA, 0)
+	// a compact mass". Superframes are split by rxSuperframe.
+	d.set_iovar("bus:txglom", whd.IF_STA, b2u32(cfg.Glom))
 	d.set_iovar("apsta", whd.IF_STA, 1)
 
 	// read MAC Address:
 
 	d.get_iovar_n("cur_etheraddr", whd.IF_STA, d.mac[:6])
 	d.debug("MAC", slog.String("mac", d.hwaddr().String()))
+	if cfg.MAC != [6]byte{} {
+		// Override the OTP address while the interface is still down.
+		err = d.set_iovar_n("cur_etheraddr", whd.IF_STA, cfg.MAC[:])
+		if err != nil {
+			return err
+		}
+		d.mac = cfg.MAC
+	}
+	if d.macRandom.Mode != MACRandomOff {
+		err = d.randomizeMAC()
+		if err != nil {
+			return err
+		}
+	}
 	if d.mode&modeWifi != 0 {
-		countryInfo := whd.CountryInfo("XX", 0)
+		country := cfg.Country
+		if country == "" {
+			country = "XX"
+		}
+		d.debug("country", slog.String("code", country))
+		countryInfo := whd.CountryInfo(country, 0)
 		d.set_iovar_n("country", whd.IF_STA, countryInfo[:])
 
 		// set country takes some time, next ioctls fail if we don't wait.
 		time.Sleep(100 * time.Millisecond)
 
+		if cfg.EDThreshold != 0 {
+			// Energy detect threshold used by ETSI adaptivity.
+			err = d.set_iovar("ed_thresh", whd.IF_STA, uint32(int32(cfg.EDThreshold)))
+			if err != nil {
+				return err
+			}
+		}
+		if cfg.Adaptivity != AdaptivityDefault {
+			err = d.set_iovar("edcrs", whd.IF_STA, b2u32(cfg.Adaptivity == AdaptivityEnabled))
+			if err != nil {
+				return err
+			}
+		}
+
 		// Set Antenna to chip antenna.
 		d.set_ioctl(whd.WLC_SET_ANTDIV, whd.IF_STA, 0)
 
-		d.set_iovar("bus:txglom", whd.IF_STA, 0)
+		d.set_iovar("bus:txglom", whd.IF_STA, b2u32(cfg.Glom))
 		time.Sleep(100 * time.Millisecond)
 
-		d.set_iovar("ampdu_ba_wsize", whd.IF_STA, 8)
+		d.set_iovar("ampdu_ba_wsize", whd.IF_STA, defaultAMPDUBAWSize)
 		time.Sleep(100 * time.Millisecond)
 
-		d.set_iovar("ampdu_mpdu", whd.IF_STA, 4)
+		d.set_iovar("ampdu_mpdu", whd.IF_STA, defaultAMPDUMPDU)
 		time.Sleep(100 * time.Millisecond)
 
 		// Ignore uninteresting/spammy events.
@@ -116,9 +164,9 @@ func (d *Device) initControl(clm string) error {
 		evts.Disable(whd.EvPROBREQ_MSG_RX)
 		evts.Disable(whd.EvPROBRESP_MSG)
 		evts.Disable(whd.EvROAM)
-		buf := make([]byte, evts.Size())
-		evts.Put(buf)
-		d.set_iovar_n("bsscfg:event_msgs", whd.IF_STA, buf)
+		var buf [4 + len(evts.events)]byte
+		evts.Put(buf[:])
+		d.set_iovar_n("bsscfg:event_msgs", whd.IF_STA, buf[:])
 
 		time.Sleep(100 * time.Millisecond)
 
@@ -157,12 +205,106 @@ func (d *Device) set_power_management(mode powerManagementMode) error {
 	return d.set_ioctl(whd.WLC_SET_PM, whd.IF_STA, uint32(mode_num))
 }
 
+// SetListenInterval sets the amount of DTIM periods the device sleeps through
+// before waking to receive buffered broadcast/multicast traffic while in power save.
+// Larger values trade RX latency for lower power consumption. dtims=0 restores the firmware default.
+// Most effective when combined with the default PM2 power save mode.
+func (d *Device) SetListenInterval(dtims uint8) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetListenInterval", slog.Uint64("dtims", uint64(dtims)))
+	return d.set_iovar("bcn_li_dtim", whd.IF_STA, uint32(dtims))
+}
+
+// SetBeaconListenInterval sets the amount of beacon intervals the device sleeps through
+// between beacon receptions while in power save. beacons=0 restores the firmware default.
+func (d *Device) SetBeaconListenInterval(beacons uint8) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetBeaconListenInterval", slog.Uint64("beacons", uint64(beacons)))
+	return d.set_iovar("bcn_li_bcn", whd.IF_STA, uint32(beacons))
+}
+
+// Default AMPDU block ack window size and maximum MPDUs per AMPDU, as set by the C SDK.
+const (
+	defaultAMPDUBAWSize = 8
+	defaultAMPDUMPDU    = 4
+)
+
+// SetAMPDU enables or disables aggregated MPDU (802.11n frame aggregation)
+// reception and transmission. Disabling aggregation may improve reliability
+// with access points whose AMPDU implementation is buggy at the cost of throughput.
+// The device must not be joined to a network when calling SetAMPDU.
+func (d *Device) SetAMPDU(rx, tx bool) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetAMPDU", slog.Bool("rx", rx), slog.Bool("tx", tx))
+	err = d.set_iovar("ampdu_rx", whd.IF_STA, b2u32(rx))
+	if err != nil {
+		return err
+	}
+	return d.set_iovar("ampdu_tx", whd.IF_STA, b2u32(tx))
+}
+
+// SetAMPDUWindow sets the AMPDU block ack window size (ampdu_ba_wsize) used when joining
+// networks and the maximum amount of MPDUs per transmitted AMPDU (ampdu_mpdu).
+// Zero values restore the defaults of 8 and 4 respectively.
+// The block ack window size takes effect on the next join.
+func (d *Device) SetAMPDUWindow(baWindowSize, maxMPDU uint8) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetAMPDUWindow", slog.Int("wsize", int(baWindowSize)), slog.Int("mpdu", int(maxMPDU)))
+	if maxMPDU == 0 {
+		maxMPDU = defaultAMPDUMPDU
+	}
+	d.ampduBAWSize = baWindowSize
+	err = d.set_iovar("ampdu_ba_wsize", whd.IF_STA, d.ampduWindowSize())
+	if err != nil {
+		return err
+	}
+	return d.set_iovar("ampdu_mpdu", whd.IF_STA, uint32(maxMPDU))
+}
+
+// SetFixedRate fixes the transmit rate via the nrate iovar.
+// rate is encoded as the firmware expects: legacy rates in units of 500kbps
+// (i.e: 2 for 1Mbps, 108 for 54Mbps) or 0x80|mcs for 802.11n MCS rates.
+// The CYW43439 is a single spatial stream (SISO) chip so only MCS 0-7 are valid.
+// A rate of 0 restores automatic rate control.
+func (d *Device) SetFixedRate(rate uint32) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("SetFixedRate", slog.Uint64("rate", uint64(rate)))
+	return d.set_iovar("nrate", whd.IF_STA, rate)
+}
+
+func (d *Device) ampduWindowSize() uint32 {
+	if d.ampduBAWSize == 0 {
+		return defaultAMPDUBAWSize
+	}
+	return uint32(d.ampduBAWSize)
+}
+
 func (d *Device) join_open(ssid string) error {
 	d.debug("join_open", slog.String("ssid", ssid))
 	if len(ssid) > 32 {
 		return errors.New("ssid too long")
 	}
-	d.set_iovar("ampdu_ba_wsize", whd.IF_STA, 8)
+	d.set_iovar("ampdu_ba_wsize", whd.IF_STA, d.ampduWindowSize())
 	d.set_ioctl(whd.WLC_SET_WSEC, whd.IF_STA, 0)
 	d.set_iovar2("bsscfg:sup_wpa", whd.IF_STA, 0, 0)
 	d.set_ioctl(whd.WLC_SET_INFRA, whd.IF_STA, 1)
@@ -174,6 +316,7 @@ func (d *Device) join_open(ssid string) error {
 func (d *Device) wait_for_join(ssid string) (err error) {
 	d.eventmask.Enable(whd.EvSET_SSID)
 	d.eventmask.Enable(whd.EvAUTH)
+	d.eventmask.Enable(whd.EvPSK_SUP)
 
 	err = d.setSSID(ssid)
 	if err != nil {
@@ -184,27 +327,32 @@ func (d *Device) wait_for_join(ssid string) (err error) {
 	keepGoing := true
 	for keepGoing {
 		time.Sleep(270 * time.Millisecond)
+		d.ledUpdate()
 		err = d.check_status(d._sendIoctlBuf[:])
 		if err != nil {
 			return err
 		}
 		// Keep trying until we get a link up/auth failed/timeout.
-		keepGoing = d.state == linkStateDown && d.state != linkStateUpWaitForSSID &&
-			time.Until(deadline) > 0
+		switch d.state {
+		case LinkStateAuthenticating, LinkStateAssociated, LinkStateKeysInstalled:
+			keepGoing = time.Until(deadline) > 0
+		default:
+			keepGoing = false
+		}
 	}
 	switch d.state {
-	case linkStateUp:
+	case LinkStateUp:
 		// Begin listening in for link change/down events.
 		d.eventmask.Enable(whd.EvLINK)
 		d.eventmask.Enable(whd.EvJOIN)
 		d.eventmask.Enable(whd.EvDISASSOC)
 		d.eventmask.Enable(whd.EvDEAUTH)
 
-	case linkStateAuthFailed:
+	case LinkStateAuthFailed:
 		err = errJoinAuth
-	case linkStateFailed:
+	case LinkStateFailed:
 		err = errJoinSetSSID
-	case linkStateUpWaitForSSID:
+	case LinkStateAssociated, LinkStateKeysInstalled:
 		err = errJoinWaitSSID
 	default:
 		err = errJoinGeneric
@@ -231,7 +379,12 @@ func (d *Device) setPassphrase(pass string) error {
 
 	var pfi = passphraseInfo{
 		length: uint16(len(pass)),
-		flags:  1,
+		flags:  1, // WSEC_PASSPHRASE.
+	}
+	if len(pass) == 64 {
+		// 64 characters are the PMK in hexadecimal, which WPA2 passphrases
+		// of at most 63 characters can not be confused with.
+		pfi.flags = 0
 	}
 	copy(pfi.passphrase[:], pass)
 
@@ -265,8 +418,12 @@ func (d *Device) setSSID(ssid string) error {
 
 	var buf [36]byte
 	info.put(_busOrder, buf[:])
-	d.state = linkStateDown
-	return d.doIoctlSet(whd.WLC_SET_SSID, whd.IF_STA, buf[:])
+	d.setLinkState(LinkStateAuthenticating)
+	err := d.doIoctlSet(whd.WLC_SET_SSID, whd.IF_STA, buf[:])
+	if err != nil {
+		d.setLinkState(LinkStateFailed)
+	}
+	return err
 }
 
 type ssidInfoWithIndex struct {
@@ -299,7 +456,32 @@ func (d *Device) setSSIDWithIndex(ssid string, index uint32) error {
 
 // IsLinkUp returns true if the wifi connection is up.
 func (d *Device) IsLinkUp() bool {
-	return d.state == linkStateUp
+	return d.state == LinkStateUp
+}
+
+// LinkState returns the current state of the wifi station connection.
+func (d *Device) LinkState() LinkState {
+	return d.state
+}
+
+// OnLinkStateChange sets a callback called on every link state transition.
+// The callback is called while the device is acquired during polling so it must
+// not call Device methods. Pass nil to remove the callback.
+func (d *Device) OnLinkStateChange(cb func(old, new LinkState)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onLinkChange = cb
+}
+
+func (d *Device) setLinkState(state LinkState) {
+	old := d.state
+	if old == state {
+		return
+	}
+	d.state = state
+	if d.onLinkChange != nil {
+		d.onLinkChange(old, state)
+	}
 }
 
 func (d *Device) JoinWPA2(ssid, pass string) error {
@@ -313,7 +495,7 @@ func (d *Device) JoinWPA2(ssid, pass string) error {
 	}
 	d.info("joinWpa2", slog.String("ssid", ssid), slog.Int("len(pass)", len(pass)))
 
-	if err := d.set_iovar("ampdu_ba_wsize", whd.IF_STA, 8); err != nil {
+	if err := d.set_iovar("ampdu_ba_wsize", whd.IF_STA, d.ampduWindowSize()); err != nil {
 		return err
 	}
 
@@ -321,13 +503,7 @@ func (d *Device) JoinWPA2(ssid, pass string) error {
 	if err := d.set_ioctl(whd.WLC_SET_WSEC, whd.IF_STA, 4); err != nil {
 		return err
 	}
-	if err := d.set_iovar2("bsscfg:sup_wpa", whd.IF_STA, 0, 1); err != nil {
-		return err
-	}
-	if err := d.set_iovar2("bsscfg:sup_wpa2_eapver", whd.IF_STA, 0, 0xffff_ffff); err != nil {
-		return err
-	}
-	if err := d.set_iovar2("bsscfg:sup_wpa_tmo", whd.IF_STA, 0, 2500); err != nil {
+	if err := d.set_supplicant(); err != nil {
 		return err
 	}
 
@@ -353,6 +529,38 @@ func (d *Device) JoinWPA2(ssid, pass string) error {
 	return d.wait_for_join(ssid)
 }
 
+// Disconnect leaves the joined network, or aborts a join in progress, and
+// forgets its credentials so the firmware does not rejoin it. The link state
+// becomes LinkStateDown and JoinWPA2 may be called again without re-initializing.
+func (d *Device) Disconnect() error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("Disconnect", slog.String("linkstate", d.state.String()))
+	// Stop listening for link events first so the disassociation is not
+	// reported as a link loss and the next join starts from a clean state.
+	d.eventmask.Disable(whd.EvLINK)
+	d.eventmask.Disable(whd.EvJOIN)
+	d.eventmask.Disable(whd.EvDISASSOC)
+	d.eventmask.Disable(whd.EvDEAUTH)
+	err = d.doIoctlSet(whd.WLC_DISASSOC, whd.IF_STA, nil)
+	if err != nil {
+		return err
+	}
+	// Forget the security configuration of the network. JoinWPA2 sets it anew.
+	if err := d.set_ioctl(whd.WLC_SET_WPA_AUTH, whd.IF_STA, 0); err != nil {
+		return err
+	}
+	if err := d.set_ioctl(whd.WLC_SET_WSEC, whd.IF_STA, 0); err != nil {
+		return err
+	}
+	d.setLinkState(LinkStateDown)
+	d.ledUpdate()
+	return nil
+}
+
 func (d *Device) StartAP(ssid, pass string, channel uint8) error {
 	err := d.acquire(modeWifi)
 	defer d.release()
@@ -425,6 +633,32 @@ func (d *Device) StartAP(ssid, pass string, channel uint8) error {
 	if err := d.set_iovar2("bss", whd.IF_STA, 0, 1); err != nil {
 		return err
 	}
+	d.setLinkState(LinkStateUp) // Allow sending data to associated stations.
+	return nil
+}
 
+// StopAP stops the access point started with StartAP and returns the
+// device to station mode so that it may join a network.
+func (d *Device) StopAP() error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("StopAP")
+	// Stop AP (bss = BSS_DOWN)
+	if err := d.set_iovar2("bss", whd.IF_STA, 0, 0); err != nil {
+		return err
+	}
+	if err := d.doIoctlSet(whd.WLC_DOWN, whd.IF_STA, nil); err != nil {
+		return err
+	}
+	if err := d.set_ioctl(whd.WLC_SET_AP, whd.IF_STA, 0); err != nil {
+		return err
+	}
+	if err := d.doIoctlSet(whd.WLC_UP, whd.IF_STA, nil); err != nil {
+		return err
+	}
+	d.setLinkState(LinkStateDown)
 	return nil
 }
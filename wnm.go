@@ -0,0 +1,231 @@
+package cyw43439
+
+import (
+	"encoding/binary"
+	"log/slog"
+
+	"github.com/soypat/cyw43439/whd"
+)
+
+// This file implements 802.11k radio measurement neighbor reports and 802.11v
+// BSS transition management (BTM) requests, with which access points of
+// enterprise networks steer clients between them.
+
+const (
+	// "rrm" iovar capability bit. Reference: DOT11_RRM_CAP_NEIGHBOR_REPORT.
+	rrmCapNeighborReport = 1 << 1
+	// "wnm" iovar capability bit. Reference: WL_WNM_BSSTRANS.
+	wnmBSSTrans = 0x1
+
+	maxNeighbors = 8
+
+	ieNeighborReport    = 52
+	nbrSubelemPref      = 3 // BSS transition candidate preference subelement.
+	nbrFixedLen         = 13
+	actionCatRM         = 5
+	actionRMNbrRep      = 5
+	actionCatWNM        = 10
+	actionWNMBTMRequest = 7
+	// rrmEventHdrLen is the length of the wl_rrm_event_t version, len, cat and subevent fields.
+	rrmEventHdrLen = 8
+	// rxFrameDataLen is the length of wl_event_rx_frame_data_t preceding received action frames.
+	rxFrameDataLen  = 16
+	dot11MgmtHdrLen = 24
+)
+
+// BSS transition request mode bits.
+const (
+	BTMCandidateListIncluded = 1 << 0
+	BTMAbridged              = 1 << 1
+	BTMDisassocImminent      = 1 << 2
+	BTMBSSTerminationIncl    = 1 << 3
+	BTMESSDisassocImminent   = 1 << 4
+)
+
+// Neighbor is an access point of a neighbor report or BSS transition candidate list.
+type Neighbor struct {
+	BSSID [6]byte
+	// Info is the BSSID information field, i.e: bit 2 and 3 report security
+	// and key scope matching the current AP.
+	Info    uint32
+	OpClass uint8
+	Channel uint8
+	PHYType uint8
+	// Preference is the BSS transition candidate preference, higher values
+	// are preferred. Zero if not present.
+	Preference uint8
+}
+
+// BSSTransitionRequest is an 802.11v BSS transition management request.
+type BSSTransitionRequest struct {
+	// From is the BSSID of the requesting access point.
+	From        [6]byte
+	DialogToken uint8
+	// Mode holds the BTM* request mode bits.
+	Mode uint8
+	// DisassocTimer is the amount of beacon intervals until the access point
+	// disassociates the client if BTMDisassocImminent is set.
+	DisassocTimer uint16
+	// ValidityInterval is the amount of beacon intervals Candidates are valid.
+	ValidityInterval uint8
+	// Candidates are the access points suggested to transition to. It is
+	// only valid during the callback.
+	Candidates []Neighbor
+}
+
+// EnableRRM enables 802.11k neighbor reports. It must be called before
+// joining since the capability is advertised during association.
+func (d *Device) EnableRRM(enable bool) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("EnableRRM", slog.Bool("enable", enable))
+	var caps [5]byte // The rrm iovar is a 5 byte capability bitmap.
+	if enable {
+		caps[0] = rrmCapNeighborReport
+		d.eventmask.Enable(whd.EvRRM)
+	} else {
+		d.eventmask.Disable(whd.EvRRM)
+	}
+	return d.set_iovar_n("rrm", whd.IF_STA, caps[:])
+}
+
+// EnableWNM enables 802.11v BSS transition management so that access points
+// may steer the client. It must be called before joining since the capability
+// is advertised during association. The firmware roams on BSS transition
+// requests itself; requests it forwards to the host are passed to the
+// callback set with OnBSSTransitionRequest.
+func (d *Device) EnableWNM(enable bool) error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	d.info("EnableWNM", slog.Bool("enable", enable))
+	if enable {
+		d.eventmask.Enable(whd.EvACTION_FRAME_RX)
+	} else {
+		d.eventmask.Disable(whd.EvACTION_FRAME_RX)
+	}
+	return d.set_iovar("wnm", whd.IF_STA, b2u32(enable)*wnmBSSTrans)
+}
+
+// RequestNeighborReport requests a neighbor report from the associated
+// access point, passed to the callback set with OnNeighborReport once
+// received. EnableRRM must have been called before joining.
+func (d *Device) RequestNeighborReport() error {
+	err := d.acquire(modeWifi)
+	defer d.release()
+	if err != nil {
+		return err
+	}
+	if !d.IsLinkUp() {
+		return errLinkDown
+	}
+	d.info("RequestNeighborReport")
+	var ssid [36]byte // Zero length wlc_ssid_t selects the current SSID.
+	return d.set_iovar_n("rrm_nbr_req", whd.IF_STA, ssid[:])
+}
+
+// OnNeighborReport sets the callback called with the access points of
+// received neighbor reports. neighbors is only valid during the callback.
+// It is called from within the polling functions with the Device locked so
+// it must not call Device methods.
+func (d *Device) OnNeighborReport(cb func(neighbors []Neighbor)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onNeighborReport = cb
+}
+
+// OnBSSTransitionRequest sets the callback called with received BSS
+// transition management requests, i.e: to flush state before an imminent
+// disassociation or adjust roaming with SetRoaming. It is called from within
+// the polling functions with the Device locked so it must not call Device methods.
+func (d *Device) OnBSSTransitionRequest(cb func(req *BSSTransitionRequest)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onBTMRequest = cb
+}
+
+// rrmEvent handles the payload of an RRM event, a wl_rrm_event_t.
+func (d *Device) rrmEvent(payload []byte) {
+	if d.onNeighborReport == nil || len(payload) < rrmEventHdrLen {
+		return
+	}
+	cat := binary.LittleEndian.Uint16(payload[4:])
+	subevent := binary.LittleEndian.Uint16(payload[6:])
+	if cat != actionCatRM || subevent != actionRMNbrRep {
+		return
+	}
+	n := parseNeighbors(d.neighbors[:], payload[rrmEventHdrLen:])
+	d.onNeighborReport(d.neighbors[:n])
+}
+
+// actionFrame handles the payload of an ACTION_FRAME_RX event, a
+// wl_event_rx_frame_data_t followed by the received action frame.
+func (d *Device) actionFrame(payload []byte) {
+	if d.onBTMRequest == nil || len(payload) < rxFrameDataLen+dot11MgmtHdrLen+7 {
+		return
+	}
+	frame := payload[rxFrameDataLen:]
+	body := frame[dot11MgmtHdrLen:]
+	if body[0] != actionCatWNM || body[1] != actionWNMBTMRequest {
+		return
+	}
+	req := BSSTransitionRequest{
+		DialogToken:      body[2],
+		Mode:             body[3],
+		DisassocTimer:    binary.LittleEndian.Uint16(body[4:]),
+		ValidityInterval: body[6],
+	}
+	copy(req.From[:], frame[16:22]) // Address 3 (BSSID).
+	body = body[7:]
+	if req.Mode&BTMBSSTerminationIncl != 0 {
+		const bssTermDurationLen = 12
+		if len(body) < bssTermDurationLen {
+			return
+		}
+		body = body[bssTermDurationLen:]
+	}
+	if req.Mode&BTMESSDisassocImminent != 0 {
+		if len(body) < 1 || len(body) < 1+int(body[0]) {
+			return
+		}
+		body = body[1+body[0]:] // Session information URL.
+	}
+	if req.Mode&BTMCandidateListIncluded != 0 {
+		n := parseNeighbors(d.neighbors[:], body)
+		req.Candidates = d.neighbors[:n]
+	}
+	d.onBTMRequest(&req)
+}
+
+// parseNeighbors parses the neighbor report elements of ies into dst and
+// returns the amount parsed. Other elements are skipped.
+func parseNeighbors(dst []Neighbor, ies []byte) int {
+	n := 0
+	for len(ies) >= 2 && len(ies) >= 2+int(ies[1]) && n < len(dst) {
+		id, data := ies[0], ies[2:2+ies[1]]
+		ies = ies[2+ies[1]:]
+		if id != ieNeighborReport || len(data) < nbrFixedLen {
+			continue
+		}
+		nb := Neighbor{
+			Info:    binary.LittleEndian.Uint32(data[6:]),
+			OpClass: data[10],
+			Channel: data[11],
+			PHYType: data[12],
+		}
+		copy(nb.BSSID[:], data[:6])
+		for sub := data[nbrFixedLen:]; len(sub) >= 2 && len(sub) >= 2+int(sub[1]); sub = sub[2+sub[1]:] {
+			if sub[0] == nbrSubelemPref && sub[1] >= 1 {
+				nb.Preference = sub[2]
+			}
+		}
+		dst[n] = nb
+		n++
+	}
+	return n
+}